@@ -29,6 +29,7 @@ void chunkedBuffer::Put(const rocksdb::Slice& key, const rocksdb::Slice& value)
   put(key.data(), key.size(), value.size());
   put(value.data(), value.size(), 0);
   count_++;
+  bytes_ += key.size() + value.size();
 }
 
 void chunkedBuffer::Clear() {
@@ -36,6 +37,7 @@ void chunkedBuffer::Clear() {
     delete[] bufs_[i].data;
   }
   count_ = 0;
+  bytes_ = 0;
   buf_ptr_ = nullptr;
   bufs_.clear();
 }
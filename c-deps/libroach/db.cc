@@ -56,7 +56,9 @@ DBKey ToDBKey(const rocksdb::Slice& s) {
 ScopedStats::ScopedStats(DBIterator* iter)
     : iter_(iter),
       internal_delete_skipped_count_base_(
-          rocksdb::get_perf_context()->internal_delete_skipped_count) {
+          rocksdb::get_perf_context()->internal_delete_skipped_count),
+      internal_key_skipped_count_base_(rocksdb::get_perf_context()->internal_key_skipped_count),
+      block_read_byte_base_(rocksdb::get_perf_context()->block_read_byte) {
   if (iter_->stats != nullptr) {
     rocksdb::SetPerfLevel(rocksdb::PerfLevel::kEnableTimeExceptForMutex);
   }
@@ -66,6 +68,11 @@ ScopedStats::~ScopedStats() {
     iter_->stats->internal_delete_skipped_count +=
         (rocksdb::get_perf_context()->internal_delete_skipped_count -
          internal_delete_skipped_count_base_);
+    iter_->stats->internal_key_skipped_count +=
+        (rocksdb::get_perf_context()->internal_key_skipped_count -
+         internal_key_skipped_count_base_);
+    iter_->stats->block_read_bytes +=
+        (rocksdb::get_perf_context()->block_read_byte - block_read_byte_base_);
     rocksdb::SetPerfLevel(rocksdb::PerfLevel::kDisable);
   }
 }
@@ -671,24 +678,36 @@ IteratorStats DBIterStats(DBIterator* iter) {
 
 DBIterState DBIterSeek(DBIterator* iter, DBKey key) {
   ScopedStats stats(iter);
+  if (iter->stats != nullptr) {
+    ++iter->stats->seek_count;
+  }
   iter->rep->Seek(EncodeKey(key));
   return DBIterGetState(iter);
 }
 
 DBIterState DBIterSeekToFirst(DBIterator* iter) {
   ScopedStats stats(iter);
+  if (iter->stats != nullptr) {
+    ++iter->stats->seek_count;
+  }
   iter->rep->SeekToFirst();
   return DBIterGetState(iter);
 }
 
 DBIterState DBIterSeekToLast(DBIterator* iter) {
   ScopedStats stats(iter);
+  if (iter->stats != nullptr) {
+    ++iter->stats->seek_count;
+  }
   iter->rep->SeekToLast();
   return DBIterGetState(iter);
 }
 
 DBIterState DBIterNext(DBIterator* iter, bool skip_current_key_versions) {
   ScopedStats stats(iter);
+  if (iter->stats != nullptr) {
+    ++iter->stats->step_count;
+  }
   // If we're skipping the current key versions, remember the key the
   // iterator was pointing out.
   std::string old_key;
@@ -732,6 +751,9 @@ DBIterState DBIterNext(DBIterator* iter, bool skip_current_key_versions) {
 
 DBIterState DBIterPrev(DBIterator* iter, bool skip_current_key_versions) {
   ScopedStats stats(iter);
+  if (iter->stats != nullptr) {
+    ++iter->stats->step_count;
+  }
   // If we're skipping the current key versions, remember the key the
   // iterator was pointed out.
   std::string old_key;
@@ -81,6 +81,8 @@ class ScopedStats {
  private:
   DBIterator* const iter_;
   uint64_t internal_delete_skipped_count_base_;
+  uint64_t internal_key_skipped_count_base_;
+  uint64_t block_read_byte_base_;
 };
 
 // BatchSStables batches the supplied sstable metadata into chunks of
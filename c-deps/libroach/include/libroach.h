@@ -54,6 +54,7 @@ typedef struct {
   bool with_stats;
   DBTimestamp min_timestamp_hint;
   DBTimestamp max_timestamp_hint;
+  int64_t readahead_size;
 } DBIterOptions;
 
 typedef struct {
@@ -233,6 +234,18 @@ typedef struct {
   //
   // TODO(tschottdorf): populate this field for all iterators.
   uint64_t timebound_num_ssts;
+  // The number of seeks and of next/prev steps performed through the
+  // iterator, including those made internally by MVCCGet and MVCCScan.
+  uint64_t seek_count;
+  uint64_t step_count;
+  // The number of internal keys (overwritten or deleted entries) the
+  // RocksDB iterator skipped over.
+  uint64_t internal_key_skipped_count;
+  // The number of bytes of blocks read from disk.
+  uint64_t block_read_bytes;
+  // The number of MVCC versions newer than the read timestamp that
+  // MVCCGet and MVCCScan stepped over.
+  uint64_t versions_skipped;
   // New fields added here must also be added in various other places;
   // just grep the repo for internal_delete_skipped_count. Sorry.
 } IteratorStats;
@@ -346,8 +359,10 @@ typedef struct {
 DBScanResults MVCCGet(DBIterator* iter, DBSlice key, DBTimestamp timestamp, DBTxn txn,
                       bool inconsistent, bool tombstones, bool ignore_sequence);
 DBScanResults MVCCScan(DBIterator* iter, DBSlice start, DBSlice end, DBTimestamp timestamp,
-                       int64_t max_keys, DBTxn txn, bool inconsistent, bool reverse,
-                       bool tombstones, bool ignore_sequence);
+                       DBTimestamp min_timestamp, int64_t max_keys, int64_t target_bytes,
+                       DBTxn txn, bool inconsistent, bool reverse, bool tombstones,
+                       bool ignore_sequence, DBSlice family_suffixes, bool keys_only,
+                       int max_versions_per_key);
 
 // DBStatsResult contains various runtime stats for RocksDB.
 typedef struct {
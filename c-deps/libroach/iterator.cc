@@ -24,6 +24,13 @@ DBIterator::DBIterator(std::atomic<int64_t>* iters, DBIterOptions iter_options)
   read_opts.iterate_lower_bound = &lower_bound;
   read_opts.iterate_upper_bound = &upper_bound;
 
+  if (iter_options.readahead_size > 0) {
+    read_opts.readahead_size = iter_options.readahead_size;
+    // Iterators requesting readahead are used for long sequential scans
+    // which would otherwise evict other workloads' blocks from the cache.
+    read_opts.fill_cache = false;
+  }
+
   if (!EmptyTimestamp(iter_options.min_timestamp_hint) ||
       !EmptyTimestamp(iter_options.max_timestamp_hint)) {
     assert(!EmptyTimestamp(iter_options.max_timestamp_hint));
@@ -11,6 +11,8 @@
 #pragma once
 
 #include <algorithm>
+#include <string>
+#include <vector>
 #include "chunked_buffer.h"
 #include "db.h"
 #include "encoding.h"
@@ -30,7 +32,8 @@ namespace cockroach {
 // successfully finds the desired next key. It decrements the value
 // whenever a call to iter->Seek() occurs. The adaptive
 // iters-before-seek value is constrained to the range
-// [1,kMaxItersBeforeSeek].
+// [1,kMaxItersBeforeSeek], or [1,max_versions_per_key] if the scan
+// bounds the versions stepped over per key to a lower value.
 static const int kMaxItersBeforeSeek = 10;
 
 // mvccScanner implements the MVCCGet, MVCCScan and MVCCReverseScan
@@ -47,14 +50,19 @@ static const int kMaxItersBeforeSeek = 10;
 // key/value.
 template <bool reverse> class mvccScanner {
  public:
-  mvccScanner(DBIterator* iter, DBSlice start, DBSlice end, DBTimestamp timestamp, int64_t max_keys,
-              DBTxn txn, bool inconsistent, bool tombstones, bool ignore_sequence)
+  mvccScanner(DBIterator* iter, DBSlice start, DBSlice end, DBTimestamp timestamp,
+              DBTimestamp min_timestamp, int64_t max_keys, int64_t target_bytes, DBTxn txn,
+              bool inconsistent, bool tombstones, bool ignore_sequence,
+              DBSlice family_suffixes = DBSlice{0, 0}, bool keys_only = false,
+              int max_versions_per_key = 0)
       : iter_(iter),
         iter_rep_(iter->rep.get()),
         start_key_(ToSlice(start)),
         end_key_(ToSlice(end)),
         max_keys_(max_keys),
+        target_bytes_(target_bytes),
         timestamp_(timestamp),
+        min_timestamp_(min_timestamp),
         txn_id_(ToSlice(txn.id)),
         txn_epoch_(txn.epoch),
         txn_sequence_(txn.sequence),
@@ -62,16 +70,30 @@ template <bool reverse> class mvccScanner {
         inconsistent_(inconsistent),
         tombstones_(tombstones),
         ignore_sequence_(ignore_sequence),
+        keys_only_(keys_only),
         check_uncertainty_(timestamp < txn.max_timestamp),
         kvs_(new chunkedBuffer),
         intents_(new rocksdb::WriteBatch),
         peeked_(false),
-        iters_before_seek_(kMaxItersBeforeSeek / 2) {
+        iters_before_seek_limit_(max_versions_per_key > 0
+                                     ? std::min<int>(kMaxItersBeforeSeek, max_versions_per_key)
+                                     : kMaxItersBeforeSeek),
+        iters_before_seek_(std::max<int>(1, iters_before_seek_limit_ / 2)) {
     memset(&results_, 0, sizeof(results_));
     results_.status = kSuccess;
 
     iter_->kvs.reset();
     iter_->intents.reset();
+
+    // family_suffixes holds the family suffixes to scan, each preceded by its
+    // length.
+    rocksdb::Slice suffixes = ToSlice(family_suffixes);
+    while (!suffixes.empty()) {
+      const size_t n = uint8_t(suffixes[0]);
+      suffixes.remove_prefix(1);
+      family_suffixes_.emplace_back(suffixes.data(), std::min(n, suffixes.size()));
+      suffixes.remove_prefix(std::min(n, suffixes.size()));
+    }
   }
 
   // The MVCC data is sorted by key and descending timestamp. If a key
@@ -132,7 +154,7 @@ template <bool reverse> class mvccScanner {
     while (getAndAdvance()) {
     }
 
-    if (kvs_->Count() == max_keys_ && advanceKey()) {
+    if (limitReached() && advanceKey()) {
       if (reverse) {
         // It is possible for cur_key_ to be pointing into mvccScanner.saved_buf_
         // instead of iter_rep_'s underlying storage if iterating in reverse (see
@@ -186,8 +208,8 @@ template <bool reverse> class mvccScanner {
     }
     const auto intent = *(up - 1);
     rocksdb::Slice value = intent.value();
-    if (value.size() > 0 || tombstones_) {
-      kvs_->Put(cur_raw_key_, value);
+    if ((value.size() > 0 || tombstones_) && aboveMinTimestamp(ToDBTimestamp(meta_.timestamp()))) {
+      kvs_->Put(cur_raw_key_, keys_only_ ? rocksdb::Slice() : value);
     }
     return true;
   }
@@ -204,7 +226,34 @@ template <bool reverse> class mvccScanner {
     return false;
   }
 
+  // wantFamily returns whether key is in one of the scanned column families.
+  // Keys other than table keys, and table keys whose family suffix can't be
+  // located, are always scanned. See keys.MakeFamilyKey for the encoding.
+  bool wantFamily(const rocksdb::Slice& key) const {
+    if (family_suffixes_.empty() || key.empty()) {
+      return true;
+    }
+    const uint8_t first = key[0];
+    const uint8_t last = key[key.size() - 1];
+    if (first < kIntMin || first > kIntMax || last < kIntZero || last > kIntZero + 9 ||
+        size_t(last - kIntZero) + 1 >= key.size()) {
+      return true;
+    }
+    const size_t suffix_len = size_t(last - kIntZero) + 1;
+    const rocksdb::Slice suffix(key.data() + key.size() - suffix_len, suffix_len);
+    for (const auto& s : family_suffixes_) {
+      if (suffix == s) {
+        return true;
+      }
+    }
+    return false;
+  }
+
   bool getAndAdvance() {
+    if (!wantFamily(cur_key_)) {
+      return advanceKey();
+    }
+
     const bool is_value = cur_timestamp_ != kZeroTimestamp;
 
     if (is_value) {
@@ -280,7 +329,7 @@ template <bool reverse> class mvccScanner {
       // historical timestamp < the intent timestamp. However, we
       // return the intent separately; the caller may want to resolve
       // it.
-      if (kvs_->Count() == max_keys_) {
+      if (limitReached()) {
         // We've already retrieved the desired number of keys and now
         // we're adding the resume key. We don't want to add the
         // intent here as the intents should only correspond to KVs
@@ -318,6 +367,9 @@ template <bool reverse> class mvccScanner {
         // sequence, read that value.
         const bool found = getFromIntentHistory();
         if (found) {
+          if (limitReached()) {
+            return false;
+          }
           return advanceKey();
         }
         // 10. If no value in the intent history has a sequence number equal to
@@ -357,7 +409,7 @@ template <bool reverse> class mvccScanner {
         return false;
       }
       if (cur_key_ != key_buf_) {
-        iters_before_seek_ = std::max<int>(kMaxItersBeforeSeek, iters_before_seek_ + 1);
+        iters_before_seek_ = std::min<int>(iters_before_seek_limit_, iters_before_seek_ + 1);
         return true;
       }
     }
@@ -388,7 +440,7 @@ template <bool reverse> class mvccScanner {
       if (peeked_key != key_buf_) {
         // The key changed which means the current key is the latest
         // version.
-        iters_before_seek_ = std::max<int>(kMaxItersBeforeSeek, iters_before_seek_ + 1);
+        iters_before_seek_ = std::min<int>(iters_before_seek_limit_, iters_before_seek_ + 1);
         return true;
       }
       if (!iterPrev()) {
@@ -442,6 +494,9 @@ template <bool reverse> class mvccScanner {
       // reach the end of the key space. If that happens, back up to
       // the very last key.
       clearPeeked();
+      if (iter_->stats != nullptr) {
+        ++iter_->stats->seek_count;
+      }
       iter_rep_->SeekToLast();
       if (!updateCurrent()) {
         return false;
@@ -467,16 +522,34 @@ template <bool reverse> class mvccScanner {
 
   bool addAndAdvance(const rocksdb::Slice& value) {
     // Don't include deleted versions (value.size() == 0), unless we've been
-    // instructed to include tombstones in the results.
-    if (value.size() > 0 || tombstones_) {
-      kvs_->Put(cur_raw_key_, value);
-      if (kvs_->Count() == max_keys_) {
+    // instructed to include tombstones in the results, nor versions at or
+    // below min_timestamp_.
+    if ((value.size() > 0 || tombstones_) && aboveMinTimestamp(cur_timestamp_)) {
+      kvs_->Put(cur_raw_key_, keys_only_ ? rocksdb::Slice() : value);
+      if (limitReached()) {
         return false;
       }
     }
     return advanceKey();
   }
 
+  // aboveMinTimestamp returns true if a value at the specified
+  // timestamp should be returned given min_timestamp_. Keys whose
+  // visible version is at or below min_timestamp_ are skipped; a zero
+  // min_timestamp_ disables the check.
+  bool aboveMinTimestamp(DBTimestamp ts) const {
+    return min_timestamp_ == kZeroTimestamp || min_timestamp_ < ts;
+  }
+
+  // limitReached returns true if the scan has retrieved max_keys_
+  // key/value pairs, or if target_bytes_ is set and the key/value
+  // bytes retrieved so far have reached it. The pair that crosses
+  // target_bytes_ is always returned in full.
+  bool limitReached() const {
+    return kvs_->Count() == max_keys_ ||
+           (target_bytes_ > 0 && kvs_->NumBytes() >= target_bytes_);
+  }
+
   // seekVersion advances the iterator to point to an MVCC version for
   // the specified key that is earlier than <ts_wall_time,
   // ts_logical>. Returns false if the iterator is exhausted or an
@@ -496,15 +569,16 @@ template <bool reverse> class mvccScanner {
     key_buf_.assign(cur_key_.data(), cur_key_.size());
 
     for (int i = 0; i < iters_before_seek_; ++i) {
+      countVersionSkipped();
       if (!iterNext()) {
         return advanceKeyAtEnd();
       }
       if (cur_key_ != key_buf_) {
-        iters_before_seek_ = std::min<int>(kMaxItersBeforeSeek, iters_before_seek_ + 1);
+        iters_before_seek_ = std::min<int>(iters_before_seek_limit_, iters_before_seek_ + 1);
         return advanceKeyAtNewKey(key_buf_);
       }
       if (desired_timestamp >= cur_timestamp_) {
-        iters_before_seek_ = std::min<int>(kMaxItersBeforeSeek, iters_before_seek_ + 1);
+        iters_before_seek_ = std::min<int>(iters_before_seek_limit_, iters_before_seek_ + 1);
         if (check_uncertainty && timestamp_ < cur_timestamp_) {
           return uncertaintyError(cur_timestamp_);
         }
@@ -513,6 +587,7 @@ template <bool reverse> class mvccScanner {
     }
 
     iters_before_seek_ = std::max<int>(1, iters_before_seek_ - 1);
+    countVersionSkipped();
     if (!iterSeek(EncodeKey(key_buf_, desired_timestamp.wall_time, desired_timestamp.logical))) {
       return advanceKeyAtEnd();
     }
@@ -528,6 +603,15 @@ template <bool reverse> class mvccScanner {
     return advanceKey();
   }
 
+  // countVersionSkipped records in the iterator stats that the
+  // iterator is about to move past the current version because it is
+  // newer than the read timestamp.
+  void countVersionSkipped() {
+    if (iter_->stats != nullptr && timestamp_ < cur_timestamp_) {
+      ++iter_->stats->versions_skipped;
+    }
+  }
+
   bool updateCurrent() {
     if (!iter_rep_->Valid()) {
       return false;
@@ -545,6 +629,9 @@ template <bool reverse> class mvccScanner {
   // than or equal to key.
   bool iterSeek(const rocksdb::Slice& key) {
     clearPeeked();
+    if (iter_->stats != nullptr) {
+      ++iter_->stats->seek_count;
+    }
     iter_rep_->Seek(key);
     return updateCurrent();
   }
@@ -553,6 +640,9 @@ template <bool reverse> class mvccScanner {
   // less than key.
   bool iterSeekReverse(const rocksdb::Slice& key) {
     clearPeeked();
+    if (iter_->stats != nullptr) {
+      ++iter_->stats->seek_count;
+    }
 
     // `SeekForPrev` positions the iterator at the last key that is less than or
     // equal to `key` AND strictly less than `ReadOptions::iterate_upper_bound`.
@@ -574,6 +664,9 @@ template <bool reverse> class mvccScanner {
   }
 
   bool iterNext() {
+    if (iter_->stats != nullptr) {
+      ++iter_->stats->step_count;
+    }
     if (reverse && peeked_) {
       // If we had peeked at the previous entry, we need to advance
       // the iterator twice to get to the real next entry.
@@ -597,6 +690,9 @@ template <bool reverse> class mvccScanner {
   }
 
   bool iterPrev() {
+    if (iter_->stats != nullptr) {
+      ++iter_->stats->step_count;
+    }
     if (peeked_) {
       peeked_ = false;
       return updateCurrent();
@@ -659,7 +755,9 @@ template <bool reverse> class mvccScanner {
   const rocksdb::Slice start_key_;
   const rocksdb::Slice end_key_;
   const int64_t max_keys_;
+  const int64_t target_bytes_;
   const DBTimestamp timestamp_;
+  const DBTimestamp min_timestamp_;
   const rocksdb::Slice txn_id_;
   const uint32_t txn_epoch_;
   const int32_t txn_sequence_;
@@ -667,7 +765,10 @@ template <bool reverse> class mvccScanner {
   const bool inconsistent_;
   const bool tombstones_;
   const bool ignore_sequence_;
+  // If set, keys are returned with empty values.
+  const bool keys_only_;
   const bool check_uncertainty_;
+  std::vector<std::string> family_suffixes_;
   DBScanResults results_;
   std::unique_ptr<chunkedBuffer> kvs_;
   std::unique_ptr<rocksdb::WriteBatch> intents_;
@@ -688,6 +789,8 @@ template <bool reverse> class mvccScanner {
   rocksdb::Slice cur_value_;
   // cur_timestamp_ is the timestamp for a decoded MVCC key.
   DBTimestamp cur_timestamp_;
+  // iters_before_seek_limit_ is the upper bound of iters_before_seek_.
+  const int iters_before_seek_limit_;
   int iters_before_seek_;
 };
 
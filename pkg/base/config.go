@@ -653,6 +653,10 @@ type StorageConfig struct {
 	Attrs roachpb.Attributes
 	// Dir is the data directory for the Pebble instance.
 	Dir string
+	// WALDir is the directory in which the write-ahead log is stored. If empty,
+	// the WAL is stored in Dir. Storing the WAL on a separate device can reduce
+	// write latency. Only used by Pebble.
+	WALDir string
 	// If true, creating the instance fails if the target directory does not hold
 	// an initialized instance.
 	//
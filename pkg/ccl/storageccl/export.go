@@ -31,6 +31,11 @@ func init() {
 	batcheval.RegisterCommand(roachpb.Export, declareKeysExport, evalExport)
 }
 
+// exportReadAheadSize is the readahead requested for the iterator used to
+// export a span. Exports read their entire span sequentially, so reading ahead
+// trades a little memory for fewer, larger reads.
+const exportReadAheadSize = 2 << 20
+
 func declareKeysExport(
 	desc *roachpb.RangeDescriptor, header roachpb.Header, req roachpb.Request, spans *spanset.SpanSet,
 ) {
@@ -119,7 +124,8 @@ func evalExport(
 	end := engine.MVCCKey{Key: args.EndKey, Timestamp: h.Timestamp}
 
 	io := engine.IterOptions{
-		UpperBound: args.EndKey,
+		UpperBound:    args.EndKey,
+		ReadAheadSize: exportReadAheadSize,
 	}
 
 	// Time-bound iterators only make sense to use if the start time is set.
@@ -176,6 +176,10 @@ var (
 	LocalTransactionSuffix = roachpb.RKey("txn-")
 	// LocalQueueLastProcessedSuffix is the suffix for replica queue state keys.
 	LocalQueueLastProcessedSuffix = roachpb.RKey("qlpt")
+	// LocalRangeLockSuffix is the suffix for lock records, which record that
+	// a transaction holds a lock on a key without having written a provisional
+	// value. The additional detail is the transaction id.
+	LocalRangeLockSuffix = roachpb.RKey("lock")
 
 	// Meta1Prefix is the first level of key addressing. It is selected such that
 	// all range addressing records sort before any system tables which they
@@ -429,6 +429,20 @@ func QueueLastProcessedKey(key roachpb.RKey, queue string) roachpb.Key {
 	return MakeRangeKey(key, LocalQueueLastProcessedSuffix, roachpb.RKey(queue))
 }
 
+// LockKey returns a range-local key for the lock held by the transaction with
+// the specified ID on key. The locked key is encoded in full, rather than its
+// address, so that the lock records of all keys are distinct and the locks on
+// any one key sort together.
+func LockKey(key roachpb.Key, txnID uuid.UUID) roachpb.Key {
+	return MakeRangeKey(roachpb.RKey(key), LocalRangeLockSuffix, roachpb.RKey(txnID.GetBytes()))
+}
+
+// LockKeyPrefix returns the prefix under which the lock records of all
+// transactions holding a lock on key can be found.
+func LockKeyPrefix(key roachpb.Key) roachpb.Key {
+	return MakeRangeKey(roachpb.RKey(key), LocalRangeLockSuffix, nil)
+}
+
 // IsLocal performs a cheap check that returns true iff a range-local key is
 // passed, that is, a key for which `Addr` would return a non-identical RKey
 // (or a decoding error).
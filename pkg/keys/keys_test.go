@@ -121,6 +121,8 @@ func TestKeyAddress(t *testing.T) {
 		{TransactionKey(roachpb.Key("baz"), uuid.MakeV4()), roachpb.RKey("baz")},
 		{TransactionKey(roachpb.KeyMax, uuid.MakeV4()), roachpb.RKeyMax},
 		{RangeDescriptorKey(roachpb.RKey(TransactionKey(roachpb.Key("doubleBaz"), uuid.MakeV4()))), roachpb.RKey("doubleBaz")},
+		{LockKey(roachpb.Key("qux"), uuid.MakeV4()), roachpb.RKey("qux")},
+		{LockKey(RangeDescriptorKey(roachpb.RKey("doubleQux")), uuid.MakeV4()), roachpb.RKey("doubleQux")},
 		{nil, nil},
 	}
 	for i, test := range testCases {
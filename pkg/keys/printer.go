@@ -176,6 +176,7 @@ var (
 		{name: "RangeDescriptor", suffix: LocalRangeDescriptorSuffix, atEnd: true},
 		{name: "Transaction", suffix: LocalTransactionSuffix, atEnd: false},
 		{name: "QueueLastProcessed", suffix: LocalQueueLastProcessedSuffix, atEnd: false},
+		{name: "Lock", suffix: LocalRangeLockSuffix, atEnd: false},
 	}
 )
 
@@ -454,7 +455,7 @@ func localRangeKeyPrint(valDirs []encoding.Direction, key roachpb.Key) string {
 				} else {
 					fmt.Fprintf(&buf, "%s/%s", roachpb.Key(decodedAddrKey), s.name)
 				}
-				if bytes.Equal(s.suffix, LocalTransactionSuffix) {
+				if bytes.Equal(s.suffix, LocalTransactionSuffix) || bytes.Equal(s.suffix, LocalRangeLockSuffix) {
 					txnID, err := uuid.FromBytes(key[(begin + len(s.suffix)):])
 					if err != nil {
 						return fmt.Sprintf("/%q/err:%v", key, err)
@@ -509,8 +509,8 @@ func (cfg *Config) CreateEngines(ctx context.Context) (Engines, error) {
 				pebbleConfig := engine.PebbleConfig{
 					StorageConfig: storageConfig,
 					Opts:          engine.DefaultPebbleOptions(),
+					Cache:         pebbleCache,
 				}
-				pebbleConfig.Opts.Cache = pebbleCache
 				pebbleConfig.Opts.MaxOpenFiles = int(openFileLimitPerStore)
 				eng, err = engine.NewPebble(pebbleConfig)
 			} else {
@@ -431,6 +431,50 @@ func TestSpanSetNonMVCCBatch(t *testing.T) {
 	}
 }
 
+// TestSpanSetWriteOnlyBatchMultiReaderIterator verifies that the writes of a
+// write-only batch wrapped by a SpanSet can be read on top of the engine by a
+// multi-reader iterator.
+func TestSpanSetWriteOnlyBatchMultiReaderIterator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	eng := engine.NewDefaultInMem()
+	defer eng.Close()
+
+	var ss spanset.SpanSet
+	ss.AddNonMVCC(spanset.SpanReadWrite, roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("c")})
+
+	ts := hlc.Timestamp{WallTime: 1}
+	if err := eng.Put(engine.MVCCKey{Key: roachpb.Key("a"), Timestamp: ts}, []byte("a1")); err != nil {
+		t.Fatalf("direct write failed: %+v", err)
+	}
+
+	batch := spanset.NewBatch(eng.NewWriteOnlyBatch(), &ss)
+	defer batch.Close()
+	if !batch.WriteOnly() {
+		t.Fatal("expected the wrapped batch to be write-only")
+	}
+	if err := batch.Put(engine.MVCCKey{Key: roachpb.Key("b"), Timestamp: ts}, []byte("b1")); err != nil {
+		t.Fatalf("failed to write inside the range: %+v", err)
+	}
+
+	iter, err := engine.NewMultiReaderIterator(engine.IterOptions{UpperBound: roachpb.Key("c")}, eng, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Close()
+	var kvs []string
+	for iter.Seek(engine.MakeMVCCMetadataKey(roachpb.Key("a"))); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			break
+		}
+		kvs = append(kvs, string(iter.UnsafeKey().Key)+"="+string(iter.UnsafeValue()))
+	}
+	if expected := []string{"a=a1", "b=b1"}; !reflect.DeepEqual(kvs, expected) {
+		t.Fatalf("expected %q, got %q", expected, kvs)
+	}
+}
+
 // TestSpanSetMVCCResolveWriteIntentRangeUsingIter verifies that
 // MVCCResolveWriteIntentRangeUsingIter does not stray outside of the passed-in
 // key range (which it only used to do in this corner case tested here).
@@ -40,7 +40,10 @@ func ConditionalPut(
 			defer batch.Close()
 		}
 	}
-	handleMissing := engine.CPutMissingBehavior(args.AllowIfDoesNotExist)
+	handleMissing := engine.CPutFailIfMissing
+	if args.AllowIfDoesNotExist {
+		handleMissing = engine.CPutAllowIfMissing
+	}
 	if args.Blind {
 		return result.Result{}, engine.MVCCBlindConditionalPut(ctx, batch, cArgs.Stats, args.Key, h.Timestamp, args.Value, args.ExpValue, handleMissing, h.Txn)
 	}
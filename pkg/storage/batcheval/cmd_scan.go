@@ -40,9 +40,8 @@ func Scan(
 
 	switch args.ScanFormat {
 	case roachpb.BATCH_RESPONSE:
-		var kvData [][]byte
-		var numKvs int64
-		kvData, numKvs, resumeSpan, intents, err = engine.MVCCScanToBytes(
+		var res engine.MVCCScanResult
+		res, err = engine.MVCCScanToBytes(
 			ctx, batch, args.Key, args.EndKey, cArgs.MaxKeys, h.Timestamp,
 			engine.MVCCScanOptions{
 				Inconsistent:   h.ReadConsistency != roachpb.CONSISTENT,
@@ -52,8 +51,9 @@ func Scan(
 		if err != nil {
 			return result.Result{}, err
 		}
-		reply.NumKeys = numKvs
-		reply.BatchResponses = kvData
+		resumeSpan, intents = res.ResumeSpan, res.Intents
+		reply.NumKeys = res.NumKeys
+		reply.BatchResponses = res.KVData
 	case roachpb.KEY_VALUES:
 		var rows []roachpb.KeyValue
 		rows, resumeSpan, intents, err = engine.MVCCScan(
@@ -284,6 +284,12 @@ func TestBatchRepr(t *testing.T) {
 		} else if count != expectedCount {
 			t.Fatalf("bad count: RocksDBBatchCount expected %d, but found %d", expectedCount, count)
 		}
+		if count := b.Count(); count != expectedCount {
+			t.Fatalf("bad count: Batch.Count expected %d, but found %d", expectedCount, count)
+		}
+		if l := b.Len(); l != len(repr) {
+			t.Fatalf("bad length: Batch.Len expected %d, but found %d", len(repr), l)
+		}
 
 		var ops []string
 		for i := 0; i < r.Count(); i++ {
@@ -11,6 +11,7 @@
 package engine
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/rand"
@@ -18,8 +19,10 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/pebble"
@@ -112,6 +115,26 @@ func BenchmarkMVCCReverseScan_Pebble(b *testing.B) {
 	}
 }
 
+func BenchmarkMVCCScanKeysOnly_Pebble(b *testing.B) {
+	ctx := context.Background()
+	for _, numRows := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("rows=%d", numRows), func(b *testing.B) {
+			for _, keysOnly := range []bool{false, true} {
+				b.Run(fmt.Sprintf("keysOnly=%t", keysOnly), func(b *testing.B) {
+					runMVCCScan(ctx, b, setupMVCCPebble, benchScanOptions{
+						benchDataOptions: benchDataOptions{
+							numVersions: 1,
+							valueBytes:  512,
+						},
+						numRows:  numRows,
+						keysOnly: keysOnly,
+					})
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCGet_Pebble(b *testing.B) {
 	ctx := context.Background()
 	for _, numVersions := range []int{1, 10, 100} {
@@ -128,6 +151,42 @@ func BenchmarkMVCCGet_Pebble(b *testing.B) {
 	}
 }
 
+func BenchmarkMVCCScanPrefix_Pebble(b *testing.B) {
+	ctx := context.Background()
+	for _, numVersions := range []int{1, 10} {
+		b.Run(fmt.Sprintf("versions=%d", numVersions), func(b *testing.B) {
+			for _, prefix := range []bool{false, true} {
+				b.Run(fmt.Sprintf("prefix=%t", prefix), func(b *testing.B) {
+					runMVCCScanPrefix(ctx, b, setupMVCCPebble, benchDataOptions{
+						numVersions: numVersions,
+						valueBytes:  8,
+					}, prefix)
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkMVCCGetBatch_Pebble(b *testing.B) {
+	ctx := context.Background()
+	for _, numVersions := range []int{1, 10} {
+		b.Run(fmt.Sprintf("versions=%d", numVersions), func(b *testing.B) {
+			for _, batchSize := range []int{1, 10, 100} {
+				b.Run(fmt.Sprintf("batchSize=%d", batchSize), func(b *testing.B) {
+					for _, useBatch := range []bool{false, true} {
+						b.Run(fmt.Sprintf("useBatch=%t", useBatch), func(b *testing.B) {
+							runMVCCGetBatch(ctx, b, setupMVCCPebble, benchDataOptions{
+								numVersions: numVersions,
+								valueBytes:  8,
+							}, batchSize, useBatch)
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCComputeStats_Pebble(b *testing.B) {
 	if testing.Short() {
 		b.Skip("short flag")
@@ -235,6 +294,47 @@ func BenchmarkMVCCPutDelete_Pebble(b *testing.B) {
 	}
 }
 
+// BenchmarkMVCCPutSingleDelete_Pebble is BenchmarkMVCCPutDelete_Pebble, but
+// deletes with MVCCWriteOptions.SingleDelete. Single deletions are dropped by
+// a flush along with the values they delete, so the sstable size left behind
+// is logged as well.
+func BenchmarkMVCCPutSingleDelete_Pebble(b *testing.B) {
+	ctx := context.Background()
+	db := setupMVCCInMemPebble(b, "put_single_delete")
+	defer db.Close()
+
+	r := rand.New(rand.NewSource(timeutil.Now().UnixNano()))
+	value := roachpb.MakeValueFromBytes(randutil.RandBytes(r, 10))
+	opts := MVCCWriteOptions{SingleDelete: true}
+	var blockNum int64
+
+	for i := 0; i < b.N; i++ {
+		blockID := r.Int63()
+		blockNum++
+		key := encoding.EncodeVarintAscending(nil, blockID)
+		key = encoding.EncodeVarintAscending(key, blockNum)
+
+		if err := MVCCPut(ctx, db, nil, key, hlc.Timestamp{}, value, nil /* txn */); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := MVCCDeleteWithOptions(
+			ctx, db, nil, key, hlc.Timestamp{}, nil /* txn */, opts,
+		); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+	if err := db.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	size, err := db.ApproximateDiskBytes(roachpb.KeyMin, roachpb.KeyMax)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Logf("%d put/delete pairs: %s in sstables", b.N, humanizeutil.IBytes(int64(size)))
+}
+
 func BenchmarkMVCCBatchPut_Pebble(b *testing.B) {
 	ctx := context.Background()
 	for _, valueSize := range []int{10} {
@@ -248,6 +348,40 @@ func BenchmarkMVCCBatchPut_Pebble(b *testing.B) {
 	}
 }
 
+// BenchmarkMVCCBatchPutSkipStats_Pebble measures BenchmarkMVCCBatchPut_Pebble's
+// workload with stats tracking, with and without MVCCWriteOptions.SkipStats.
+func BenchmarkMVCCBatchPutSkipStats_Pebble(b *testing.B) {
+	ctx := context.Background()
+	for _, valueSize := range []int{10} {
+		b.Run(fmt.Sprintf("valueSize=%d", valueSize), func(b *testing.B) {
+			for _, batchSize := range []int{1, 100, 10000, 100000} {
+				b.Run(fmt.Sprintf("batchSize=%d", batchSize), func(b *testing.B) {
+					for _, skipStats := range []bool{false, true} {
+						b.Run(fmt.Sprintf("skipStats=%t", skipStats), func(b *testing.B) {
+							var ms enginepb.MVCCStats
+							runMVCCBatchPutWithOptions(ctx, b, setupMVCCInMemPebble, valueSize, batchSize,
+								&ms, MVCCWriteOptions{SkipStats: skipStats})
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkMVCCIncrementBatch_Pebble(b *testing.B) {
+	ctx := context.Background()
+	for _, numKeys := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("numKeys=%d", numKeys), func(b *testing.B) {
+			for _, batched := range []bool{false, true} {
+				b.Run(fmt.Sprintf("batched=%t", batched), func(b *testing.B) {
+					runMVCCIncrementBatch(ctx, b, setupMVCCInMemPebble, numKeys, batched)
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCBatchTimeSeries_Pebble(b *testing.B) {
 	ctx := context.Background()
 	for _, batchSize := range []int{282} {
@@ -309,6 +443,42 @@ func BenchmarkMVCCGarbageCollect_Pebble(b *testing.B) {
 	}
 }
 
+// BenchmarkMVCCGarbageCollectRange_Pebble is BenchmarkMVCCGarbageCollect_Pebble,
+// collecting the versions with MVCCGarbageCollectRange instead.
+func BenchmarkMVCCGarbageCollectRange_Pebble(b *testing.B) {
+	if testing.Short() {
+		b.Skip("short flag")
+	}
+
+	ctx := context.Background()
+	for _, keySize := range []int{128} {
+		b.Run(fmt.Sprintf("keySize=%d", keySize), func(b *testing.B) {
+			for _, valSize := range []int{128} {
+				b.Run(fmt.Sprintf("valSize=%d", valSize), func(b *testing.B) {
+					for _, numKeys := range []int{1, 1024} {
+						b.Run(fmt.Sprintf("numKeys=%d", numKeys), func(b *testing.B) {
+							for _, numVersions := range []int{2, 1024} {
+								b.Run(fmt.Sprintf("numVersions=%d", numVersions), func(b *testing.B) {
+									runMVCCGarbageCollect(ctx, b, setupMVCCInMemPebble, benchGarbageCollectOptions{
+										benchDataOptions: benchDataOptions{
+											numKeys:     numKeys,
+											numVersions: numVersions,
+											valueBytes:  valSize,
+										},
+										keyBytes:       keySize,
+										deleteVersions: numVersions - 1,
+										gcRange:        true,
+									})
+								})
+							}
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkBatchApplyBatchRepr_Pebble(b *testing.B) {
 	if testing.Short() {
 		b.Skip("short flag")
@@ -333,3 +503,79 @@ func BenchmarkBatchApplyBatchRepr_Pebble(b *testing.B) {
 		})
 	}
 }
+
+// BenchmarkMVCCGetKeyspaceFilters_Pebble compares MVCCGet of present (hit)
+// and absent (miss) keys in a point-lookup heavy "system" keyspace, with and
+// without bloom filters configured for that keyspace, in the presence of a
+// larger, unfiltered user keyspace.
+func BenchmarkMVCCGetKeyspaceFilters_Pebble(b *testing.B) {
+	ctx := context.Background()
+	const numKeys = 10000
+	sysKey := func(i int) roachpb.Key {
+		return roachpb.Key(encoding.EncodeUvarintAscending([]byte("sys-"), uint64(i)))
+	}
+	filters := PebbleKeyspaceFilters{
+		Name: "bench",
+		Bucket: func(key roachpb.Key) int {
+			if bytes.HasPrefix(key, []byte("sys-")) {
+				return 0
+			}
+			return 1
+		},
+		BitsPerKey: []int{10, 0},
+	}
+
+	for _, filtered := range []bool{false, true} {
+		b.Run(fmt.Sprintf("filtered=%t", filtered), func(b *testing.B) {
+			opts := DefaultPebbleOptions()
+			if filtered {
+				opts = DefaultPebbleOptionsWithFilters(filters)
+			}
+			opts.Cache = pebble.NewCache(testCacheSize)
+			opts.FS = vfs.NewMem()
+			eng, err := NewPebble(PebbleConfig{Opts: opts})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer eng.Close()
+
+			// Write the keyspaces in several batches, flushing each, so that
+			// lookups have to consult multiple sstables.
+			ts := hlc.Timestamp{WallTime: 1}
+			value := roachpb.MakeValueFromBytes(make([]byte, 8))
+			for i := 0; i < numKeys; i++ {
+				userKey := roachpb.Key(encoding.EncodeUvarintAscending([]byte("user-"), uint64(i)))
+				for _, key := range []roachpb.Key{sysKey(i), userKey} {
+					if err := MVCCPut(ctx, eng, nil, key, ts, value, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if (i+1)%(numKeys/10) == 0 {
+					if err := eng.Flush(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+
+			for _, hit := range []bool{true, false} {
+				b.Run(fmt.Sprintf("hit=%t", hit), func(b *testing.B) {
+					rng, _ := randutil.NewPseudoRand()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						key := sysKey(rng.Intn(numKeys))
+						if !hit {
+							key = key.Next()
+						}
+						v, _, err := MVCCGet(ctx, eng, key, ts, MVCCGetOptions{})
+						if err != nil {
+							b.Fatal(err)
+						}
+						if (v != nil) != hit {
+							b.Fatalf("unexpected value %v at %s", v, key)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -106,6 +106,26 @@ func BenchmarkMVCCReverseScan_RocksDB(b *testing.B) {
 	}
 }
 
+func BenchmarkMVCCScanKeysOnly_RocksDB(b *testing.B) {
+	ctx := context.Background()
+	for _, numRows := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("rows=%d", numRows), func(b *testing.B) {
+			for _, keysOnly := range []bool{false, true} {
+				b.Run(fmt.Sprintf("keysOnly=%t", keysOnly), func(b *testing.B) {
+					runMVCCScan(ctx, b, setupMVCCRocksDB, benchScanOptions{
+						benchDataOptions: benchDataOptions{
+							numVersions: 1,
+							valueBytes:  512,
+						},
+						numRows:  numRows,
+						keysOnly: keysOnly,
+					})
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCScanTransactionalData_RocksDB(b *testing.B) {
 	ctx := context.Background()
 	runMVCCScan(ctx, b, setupMVCCRocksDB, benchScanOptions{
@@ -134,6 +154,42 @@ func BenchmarkMVCCGet_RocksDB(b *testing.B) {
 	}
 }
 
+func BenchmarkMVCCScanPrefix_RocksDB(b *testing.B) {
+	ctx := context.Background()
+	for _, numVersions := range []int{1, 10} {
+		b.Run(fmt.Sprintf("versions=%d", numVersions), func(b *testing.B) {
+			for _, prefix := range []bool{false, true} {
+				b.Run(fmt.Sprintf("prefix=%t", prefix), func(b *testing.B) {
+					runMVCCScanPrefix(ctx, b, setupMVCCRocksDB, benchDataOptions{
+						numVersions: numVersions,
+						valueBytes:  8,
+					}, prefix)
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkMVCCGetBatch_RocksDB(b *testing.B) {
+	ctx := context.Background()
+	for _, numVersions := range []int{1, 10} {
+		b.Run(fmt.Sprintf("versions=%d", numVersions), func(b *testing.B) {
+			for _, batchSize := range []int{1, 10, 100} {
+				b.Run(fmt.Sprintf("batchSize=%d", batchSize), func(b *testing.B) {
+					for _, useBatch := range []bool{false, true} {
+						b.Run(fmt.Sprintf("useBatch=%t", useBatch), func(b *testing.B) {
+							runMVCCGetBatch(ctx, b, setupMVCCRocksDB, benchDataOptions{
+								numVersions: numVersions,
+								valueBytes:  8,
+							}, batchSize, useBatch)
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCComputeStats_RocksDB(b *testing.B) {
 	if testing.Short() {
 		b.Skip("short flag")
@@ -288,6 +344,19 @@ func BenchmarkMVCCBatchPut_RocksDB(b *testing.B) {
 	}
 }
 
+func BenchmarkMVCCIncrementBatch_RocksDB(b *testing.B) {
+	ctx := context.Background()
+	for _, numKeys := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("numKeys=%d", numKeys), func(b *testing.B) {
+			for _, batched := range []bool{false, true} {
+				b.Run(fmt.Sprintf("batched=%t", batched), func(b *testing.B) {
+					runMVCCIncrementBatch(ctx, b, setupMVCCInMemRocksDB, numKeys, batched)
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkMVCCBatchTimeSeries_RocksDB(b *testing.B) {
 	ctx := context.Background()
 	for _, batchSize := range []int{282} {
@@ -400,6 +469,42 @@ func BenchmarkMVCCGarbageCollect_RocksDB(b *testing.B) {
 	}
 }
 
+// BenchmarkMVCCGarbageCollectRange_RocksDB is BenchmarkMVCCGarbageCollect_RocksDB,
+// collecting the versions with MVCCGarbageCollectRange instead.
+func BenchmarkMVCCGarbageCollectRange_RocksDB(b *testing.B) {
+	if testing.Short() {
+		b.Skip("short flag")
+	}
+
+	ctx := context.Background()
+	for _, keySize := range []int{128} {
+		b.Run(fmt.Sprintf("keySize=%d", keySize), func(b *testing.B) {
+			for _, valSize := range []int{128} {
+				b.Run(fmt.Sprintf("valSize=%d", valSize), func(b *testing.B) {
+					for _, numKeys := range []int{1, 1024} {
+						b.Run(fmt.Sprintf("numKeys=%d", numKeys), func(b *testing.B) {
+							for _, numVersions := range []int{2, 1024} {
+								b.Run(fmt.Sprintf("numVersions=%d", numVersions), func(b *testing.B) {
+									runMVCCGarbageCollect(ctx, b, setupMVCCInMemRocksDB, benchGarbageCollectOptions{
+										benchDataOptions: benchDataOptions{
+											numKeys:     numKeys,
+											numVersions: numVersions,
+											valueBytes:  valSize,
+										},
+										keyBytes:       keySize,
+										deleteVersions: numVersions - 1,
+										gcRange:        true,
+									})
+								})
+							}
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
 func BenchmarkBatchApplyBatchRepr_RocksDB(b *testing.B) {
 	if testing.Short() {
 		b.Skip("short flag")
@@ -197,8 +197,9 @@ func setupMVCCData(
 
 type benchScanOptions struct {
 	benchDataOptions
-	numRows int
-	reverse bool
+	numRows  int
+	reverse  bool
+	keysOnly bool
 }
 
 // runMVCCScan first creates test data (and resets the benchmarking
@@ -241,7 +242,8 @@ func runMVCCScan(ctx context.Context, b *testing.B, emk engineMaker, opts benchS
 		walltime := int64(5 * (rand.Int31n(int32(opts.numVersions)) + 1))
 		ts := hlc.Timestamp{WallTime: walltime}
 		kvs, _, _, err := MVCCScan(ctx, eng, startKey, endKey, int64(opts.numRows), ts, MVCCScanOptions{
-			Reverse: opts.reverse,
+			Reverse:  opts.reverse,
+			KeysOnly: opts.keysOnly,
 		})
 		if err != nil {
 			b.Fatalf("failed scan: %+v", err)
@@ -293,6 +295,101 @@ func runMVCCGet(ctx context.Context, b *testing.B, emk engineMaker, opts benchDa
 	b.StopTimer()
 }
 
+// runMVCCScanPrefix first creates test data (and resets the benchmarking
+// timer). It then performs b.N single-key scans of keys that are absent from
+// the data, either using MVCCScanOptions.Prefix, which lets the engine consult
+// its bloom filters, or as plain bounded scans.
+func runMVCCScanPrefix(
+	ctx context.Context, b *testing.B, emk engineMaker, opts benchDataOptions, prefix bool,
+) {
+	if opts.numKeys != 0 {
+		b.Fatal("test error: cannot call runMVCCScanPrefix with non-zero numKeys")
+	}
+	opts.numKeys = 100000
+
+	eng, _ := setupMVCCData(ctx, b, emk, opts)
+	defer eng.Close()
+
+	b.ResetTimer()
+
+	keyBuf := append(make([]byte, 0, 64), []byte("key-")...)
+	for i := 0; i < b.N; i++ {
+		// The uvarint encoding is prefix-free, so appending a zero byte to an
+		// existing key yields a key that sorts between existing keys but is not
+		// present itself.
+		keyIdx := rand.Int31n(int32(opts.numKeys))
+		key := roachpb.Key(encoding.EncodeUvarintAscending(keyBuf[:4], uint64(keyIdx))).Next()
+		scanOpts := MVCCScanOptions{}
+		if prefix {
+			scanOpts.Prefix = key
+		}
+		ts := hlc.Timestamp{WallTime: int64(5 * opts.numVersions)}
+		kvs, _, _, err := MVCCScan(ctx, eng, key, key.Next(), 1, ts, scanOpts)
+		if err != nil {
+			b.Fatalf("failed scan: %+v", err)
+		}
+		if len(kvs) != 0 {
+			b.Fatalf("unexpected key found: %s", kvs[0].Key)
+		}
+	}
+
+	b.StopTimer()
+}
+
+// runMVCCGetBatch first creates test data (and resets the benchmarking
+// timer). It then performs b.N lookups of batchSize random keys, either
+// using MVCCGetBatch or a loop of MVCCGets.
+func runMVCCGetBatch(
+	ctx context.Context,
+	b *testing.B,
+	emk engineMaker,
+	opts benchDataOptions,
+	batchSize int,
+	useBatch bool,
+) {
+	if opts.numKeys != 0 {
+		b.Fatal("test error: cannot call runMVCCGetBatch with non-zero numKeys")
+	}
+	opts.numKeys = 100000
+
+	eng, _ := setupMVCCData(ctx, b, emk, opts)
+	defer eng.Close()
+
+	b.SetBytes(int64(batchSize * opts.valueBytes))
+	b.ResetTimer()
+
+	keys := make([]roachpb.Key, batchSize)
+	for i := 0; i < b.N; i++ {
+		for j := range keys {
+			keyIdx := rand.Int31n(int32(opts.numKeys))
+			keys[j] = encoding.EncodeUvarintAscending(append(keys[j][:0], "key-"...), uint64(keyIdx))
+		}
+		walltime := int64(5 * (rand.Int31n(int32(opts.numVersions)) + 1))
+		ts := hlc.Timestamp{WallTime: walltime}
+		if useBatch {
+			results, err := MVCCGetBatch(ctx, eng, keys, ts, MVCCGetOptions{})
+			if err != nil {
+				b.Fatalf("failed get: %+v", err)
+			}
+			for j := range results {
+				if results[j].Value == nil {
+					b.Fatalf("failed get (key not found): %s@%d", keys[j], walltime)
+				}
+			}
+		} else {
+			for j := range keys {
+				if v, _, err := MVCCGet(ctx, eng, keys[j], ts, MVCCGetOptions{}); err != nil {
+					b.Fatalf("failed get: %+v", err)
+				} else if v == nil {
+					b.Fatalf("failed get (key not found): %s@%d", keys[j], walltime)
+				}
+			}
+		}
+	}
+
+	b.StopTimer()
+}
+
 func runMVCCPut(ctx context.Context, b *testing.B, emk engineMaker, valueSize int) {
 	rng, _ := randutil.NewPseudoRand()
 	value := roachpb.MakeValueFromBytes(randutil.RandBytes(rng, valueSize))
@@ -440,6 +537,19 @@ func runMVCCBlindInitPut(ctx context.Context, b *testing.B, emk engineMaker, val
 }
 
 func runMVCCBatchPut(ctx context.Context, b *testing.B, emk engineMaker, valueSize, batchSize int) {
+	runMVCCBatchPutWithOptions(ctx, b, emk, valueSize, batchSize, nil /* ms */, MVCCWriteOptions{})
+}
+
+// runMVCCBatchPutWithOptions is runMVCCBatchPut, but writes with
+// MVCCPutWithOptions, accumulating stats into ms.
+func runMVCCBatchPutWithOptions(
+	ctx context.Context,
+	b *testing.B,
+	emk engineMaker,
+	valueSize, batchSize int,
+	ms *enginepb.MVCCStats,
+	opts MVCCWriteOptions,
+) {
 	rng, _ := randutil.NewPseudoRand()
 	value := roachpb.MakeValueFromBytes(randutil.RandBytes(rng, valueSize))
 	keyBuf := append(make([]byte, 0, 64), []byte("key-")...)
@@ -461,7 +571,7 @@ func runMVCCBatchPut(ctx context.Context, b *testing.B, emk engineMaker, valueSi
 		for j := i; j < end; j++ {
 			key := roachpb.Key(encoding.EncodeUvarintAscending(keyBuf[:4], uint64(j)))
 			ts := hlc.Timestamp{WallTime: timeutil.Now().UnixNano()}
-			if err := MVCCPut(ctx, batch, nil, key, ts, value, nil); err != nil {
+			if _, err := MVCCPutWithOptions(ctx, batch, ms, key, ts, value, nil, opts); err != nil {
 				b.Fatalf("failed put: %+v", err)
 			}
 		}
@@ -476,6 +586,47 @@ func runMVCCBatchPut(ctx context.Context, b *testing.B, emk engineMaker, valueSi
 	b.StopTimer()
 }
 
+// runMVCCIncrementBatch benchmarks flushes of numKeys counter increments,
+// either with MVCCIncrementBatch or with a loop of MVCCIncrement calls.
+func runMVCCIncrementBatch(
+	ctx context.Context, b *testing.B, emk engineMaker, numKeys int, batched bool,
+) {
+	deltas := make(map[string]int64, numKeys)
+	keys := make([]roachpb.Key, numKeys)
+	for i := range keys {
+		keys[i] = roachpb.Key(fmt.Sprintf("counter-%d", i))
+		deltas[string(keys[i])] = 1
+	}
+
+	eng := emk(b, fmt.Sprintf("increment_batch_%d", numKeys))
+	defer eng.Close()
+
+	var ms enginepb.MVCCStats
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		batch := eng.NewBatch()
+		ts := hlc.Timestamp{WallTime: timeutil.Now().UnixNano()}
+		if batched {
+			if _, err := MVCCIncrementBatch(ctx, batch, &ms, ts, nil, deltas); err != nil {
+				b.Fatal(err)
+			}
+		} else {
+			for _, key := range keys {
+				if _, err := MVCCIncrement(ctx, batch, &ms, key, ts, nil, deltas[string(key)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		if err := batch.Commit(false /* sync */); err != nil {
+			b.Fatal(err)
+		}
+		batch.Close()
+	}
+
+	b.StopTimer()
+}
+
 // Benchmark batch time series merge operations. This benchmark does not
 // perform any reads and is only used to measure the cost of the periodic time
 // series updates.
@@ -767,6 +918,9 @@ type benchGarbageCollectOptions struct {
 	benchDataOptions
 	keyBytes       int
 	deleteVersions int
+	// gcRange, if set, collects the versions with MVCCGarbageCollectRange
+	// rather than by listing the GC keys.
+	gcRange bool
 }
 
 func runMVCCGarbageCollect(
@@ -821,7 +975,16 @@ func runMVCCGarbageCollect(
 	for i := 0; i < b.N; i++ {
 		batch := eng.NewWriteOnlyBatch()
 		distinct := batch.Distinct()
-		if err := MVCCGarbageCollect(ctx, distinct, nil /* ms */, gcKeys, now); err != nil {
+		if opts.gcRange {
+			// The latest version at or below the threshold is kept, so the
+			// threshold is the timestamp of the oldest version to keep.
+			gcThreshold := ts.Add(0, int32(opts.deleteVersions))
+			if _, err := MVCCGarbageCollectRange(
+				ctx, distinct, nil /* ms */, roachpb.KeyMin, roachpb.KeyMax, gcThreshold, 0, /* maxBytes */
+			); err != nil {
+				b.Fatal(err)
+			}
+		} else if err := MVCCGarbageCollect(ctx, distinct, nil /* ms */, gcKeys, now); err != nil {
 			b.Fatal(err)
 		}
 		distinct.Close()
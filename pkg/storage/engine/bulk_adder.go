@@ -0,0 +1,225 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultBulkAdderBufferSize = 64 << 20
+	defaultBulkAdderSSTSize    = 16 << 20
+	// bulkAdderEntryOverhead approximates the memory used by a buffered
+	// MVCCKeyValue in addition to its key and value bytes.
+	bulkAdderEntryOverhead = 64
+)
+
+// BulkAdderOptions configures a BulkAdder.
+type BulkAdderOptions struct {
+	// BufferSize is the amount of memory used to buffer added keys and values
+	// before they are flushed. Defaults to 64 MB.
+	BufferSize int64
+	// SSTSize is the size of the key and value data in each SST built by a
+	// flush. Defaults to 16 MB.
+	SSTSize int64
+}
+
+// BulkAdderStats summarizes the data ingested by a BulkAdder.
+type BulkAdderStats struct {
+	// Files is the number of SSTs ingested.
+	Files int64
+	// DataSize is the total size of the keys and values ingested.
+	DataSize int64
+	// Duplicates is the number of added keys that were dropped because the
+	// same key was added again later in the same flush.
+	Duplicates int64
+}
+
+// BulkAdder ingests large amounts of data, such as that of an IMPORT or
+// RESTORE, into an engine. Keys can be added in any order. They are buffered
+// in memory, and are sorted and ingested as non-overlapping SSTs once the
+// buffer is full or Flush is called. This avoids the write amplification of
+// writing each key through the memtable and WAL.
+//
+// If a key is added multiple times, the last value is ingested. Note that
+// ingested SSTs bypass MVCC: the keys must be fully formed MVCC keys, and
+// no MVCCStats are maintained.
+//
+// A BulkAdder is not safe for concurrent use.
+type BulkAdder struct {
+	eng  Engine
+	opts BulkAdderOptions
+
+	kvs      []MVCCKeyValue
+	buffered int64
+	stats    BulkAdderStats
+}
+
+// NewBulkAdder creates a BulkAdder which ingests into eng.
+func NewBulkAdder(eng Engine, opts BulkAdderOptions) *BulkAdder {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBulkAdderBufferSize
+	}
+	if opts.SSTSize <= 0 {
+		opts.SSTSize = defaultBulkAdderSSTSize
+	}
+	return &BulkAdder{eng: eng, opts: opts}
+}
+
+// Add buffers the key and value for ingestion, flushing the buffer if it is
+// full. The key and value are copied.
+func (b *BulkAdder) Add(ctx context.Context, key MVCCKey, value []byte) error {
+	if len(key.Key) == 0 {
+		return emptyKeyError()
+	}
+	buf := make([]byte, len(key.Key)+len(value))
+	copy(buf, key.Key)
+	copy(buf[len(key.Key):], value)
+	key.Key = buf[:len(key.Key):len(key.Key)]
+	b.kvs = append(b.kvs, MVCCKeyValue{Key: key, Value: buf[len(key.Key):]})
+	b.buffered += int64(len(buf)) + bulkAdderEntryOverhead
+	if b.buffered >= b.opts.BufferSize {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sorts the buffered keys and ingests them. The SSTs of a flush are
+// ingested atomically.
+func (b *BulkAdder) Flush(ctx context.Context) error {
+	if len(b.kvs) == 0 {
+		return nil
+	}
+	// Sort stably, so that the last of the values added for a key can be kept.
+	sort.SliceStable(b.kvs, func(i, j int) bool {
+		return b.kvs[i].Key.Less(b.kvs[j].Key)
+	})
+	kvs, duplicates := b.kvs[:0], int64(0)
+	for i := range b.kvs {
+		if i+1 < len(b.kvs) && b.kvs[i].Key.Equal(b.kvs[i+1].Key) {
+			duplicates++
+			continue
+		}
+		kvs = append(kvs, b.kvs[i])
+	}
+
+	var paths []string
+	ingested := false
+	defer func() {
+		if ingested {
+			return
+		}
+		for _, path := range paths {
+			if err := b.eng.DeleteFile(path); err != nil && !os.IsNotExist(err) {
+				log.Warningf(ctx, "failed to remove %s: %v", path, err)
+			}
+		}
+	}()
+
+	var dataSize int64
+	for len(kvs) > 0 {
+		path, n, size, err := b.writeSST(kvs)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		kvs = kvs[n:]
+		dataSize += size
+	}
+
+	b.eng.PreIngestDelay(ctx)
+	if err := b.eng.IngestExternalFiles(ctx, paths); err != nil {
+		return errors.Wrapf(err, "ingesting %d SSTs", len(paths))
+	}
+	ingested = true
+	// The ingestion moves the files into the engine, but don't rely on it.
+	for _, path := range paths {
+		if err := b.eng.DeleteFile(path); err != nil && !os.IsNotExist(err) {
+			log.Warningf(ctx, "failed to remove %s: %v", path, err)
+		}
+	}
+
+	b.stats.Files += int64(len(paths))
+	b.stats.DataSize += dataSize
+	b.stats.Duplicates += duplicates
+	b.reset()
+	return nil
+}
+
+// writeSST writes a prefix of the sorted kvs to an SST of about
+// opts.SSTSize, returning its path, the number of kvs and the size of the
+// data it contains.
+func (b *BulkAdder) writeSST(kvs []MVCCKeyValue) (string, int, int64, error) {
+	sst, err := MakeRocksDBSstFileWriter()
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer sst.Close()
+
+	n := 0
+	for n < len(kvs) && sst.DataSize() < b.opts.SSTSize {
+		if err := sst.Put(kvs[n].Key, kvs[n].Value); err != nil {
+			return "", 0, 0, err
+		}
+		n++
+	}
+	data, err := sst.Finish()
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	name := fmt.Sprintf("bulk-%s.sst", uuid.MakeV4())
+	path := name
+	if !b.eng.InMem() {
+		path = filepath.Join(b.eng.GetAuxiliaryDir(), name)
+	}
+	if err := b.eng.WriteFile(path, data); err != nil {
+		return "", 0, 0, err
+	}
+	return path, n, sst.DataSize(), nil
+}
+
+// Stats returns a summary of the data ingested so far.
+func (b *BulkAdder) Stats() BulkAdderStats {
+	return b.stats
+}
+
+// BufferedSize returns the amount of memory used by buffered keys and values
+// which haven't been flushed yet.
+func (b *BulkAdder) BufferedSize() int64 {
+	return b.buffered
+}
+
+func (b *BulkAdder) reset() {
+	for i := range b.kvs {
+		b.kvs[i] = MVCCKeyValue{}
+	}
+	b.kvs = b.kvs[:0]
+	b.buffered = 0
+}
+
+// Close releases the buffer. Keys which were added since the last flush are
+// discarded.
+func (b *BulkAdder) Close(ctx context.Context) {
+	if len(b.kvs) > 0 {
+		log.VEventf(ctx, 2, "discarding %d unflushed keys", len(b.kvs))
+	}
+	b.kvs = nil
+	b.buffered = 0
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestBulkAdder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	runWithAllEngines(func(e Engine, t *testing.T) {
+		const numKeys = 1000
+		ts := hlc.Timestamp{WallTime: 1}
+		key := func(i int) MVCCKey {
+			return MVCCKey{Key: roachpb.Key(fmt.Sprintf("key-%04d", i)), Timestamp: ts}
+		}
+		value := func(i, version int) []byte {
+			return []byte(fmt.Sprintf("value-%04d-%d", i, version))
+		}
+
+		// The buffer holds about half of the keys, and each SST a tenth of them.
+		adder := NewBulkAdder(e, BulkAdderOptions{BufferSize: 50 << 10, SSTSize: 2 << 10})
+		defer adder.Close(ctx)
+
+		// Add every key in random order, and then every even key again. Some of
+		// the keys are added twice within the same flush, others are overwritten
+		// by a later flush.
+		var added int64
+		for version, step := range []int{1, 2} {
+			for _, i := range rand.Perm(numKeys) {
+				if i%step != 0 {
+					continue
+				}
+				if err := adder.Add(ctx, key(i), value(i, version)); err != nil {
+					t.Fatal(err)
+				}
+				added++
+			}
+		}
+		if stats := adder.Stats(); stats.Files == 0 {
+			t.Fatal("expected the adder to flush once its buffer was full")
+		}
+		if err := adder.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if size := adder.BufferedSize(); size != 0 {
+			t.Fatalf("expected empty buffer after flush, found %d", size)
+		}
+
+		i := 0
+		if err := e.Iterate(roachpb.KeyMin, roachpb.KeyMax, func(kv MVCCKeyValue) (bool, error) {
+			expVersion := 0
+			if i%2 == 0 {
+				expVersion = 1
+			}
+			if !kv.Key.Equal(key(i)) || string(kv.Value) != string(value(i, expVersion)) {
+				t.Fatalf("%d: expected %s=%s, found %s=%s",
+					i, key(i), value(i, expVersion), kv.Key, kv.Value)
+			}
+			i++
+			return false, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if i != numKeys {
+			t.Fatalf("expected %d keys, found %d", numKeys, i)
+		}
+
+		stats := adder.Stats()
+		if stats.Files < 10 {
+			t.Fatalf("expected at least 10 SSTs to be ingested, found %+v", stats)
+		}
+		// Duplicates which were flushed separately are both ingested.
+		if ingested := stats.DataSize / int64(len(key(0).Key)+len(value(0, 0))); ingested+stats.Duplicates != added {
+			t.Fatalf("expected %d keys to be ingested or deduplicated, found %+v", added, stats)
+		}
+		if stats.Duplicates == 0 {
+			t.Fatalf("expected duplicate keys, found %+v", stats)
+		}
+	}, t)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/pkg/errors"
 )
 
@@ -59,10 +60,27 @@ type SimpleIterator interface {
 	UnsafeValue() []byte
 }
 
-// IteratorStats is returned from (Iterator).Stats.
+// IteratorStats is returned from (Iterator).Stats. The counters are
+// cumulative over the lifetime of the iterator. RocksDB iterators only
+// populate them when created with IterOptions.WithStats.
 type IteratorStats struct {
 	InternalDeleteSkippedCount int
 	TimeBoundNumSSTs           int
+	// SeekCount and StepCount are the number of seeks and the number of
+	// next/prev steps performed by the iterator, including those performed
+	// internally by MVCCGet and MVCCScan.
+	SeekCount int
+	StepCount int
+	// InternalKeySkippedCount is the number of overwritten or deleted internal
+	// keys the storage engine stepped over, and BlockReadBytes the number of
+	// bytes of blocks read from disk. Pebble does not expose these and always
+	// reports zero.
+	InternalKeySkippedCount int
+	BlockReadBytes          int64
+	// VersionsSkipped is the number of MVCC versions newer than the read
+	// timestamp that MVCCGet and MVCCScan stepped over. Versions bypassed
+	// entirely by an internal seek are not counted.
+	VersionsSkipped int
 }
 
 // Iterator is an interface for iterating over key/value pairs in an
@@ -74,6 +92,12 @@ type Iterator interface {
 	// SeekReverse advances the iterator to the first key in the engine which
 	// is <= the provided key.
 	SeekReverse(key MVCCKey)
+	// SeekLT positions the iterator at the newest version (or the metadata
+	// record, if any) of the greatest key less than key.Key, whose timestamp is
+	// ignored. This is the key a reverse scan ending at key.Key visits first,
+	// which makes SeekLT, followed by Next, convenient for stepping backwards
+	// one key at a time. It must not be used with prefix iterators.
+	SeekLT(key MVCCKey)
 	// Prev moves the iterator backward to the previous key/value
 	// in the iteration. After this call, Valid() will be true if the
 	// iterator was not positioned at the first key.
@@ -167,6 +191,22 @@ type IterOptions struct {
 	// [start, end] time range. If you must guarantee that you never see a key
 	// outside of the time bounds, perform your own filtering.
 	MinTimestampHint, MaxTimestampHint hlc.Timestamp
+	// ReadAheadSize, if positive, is the number of bytes the iterator should
+	// read ahead of its current position. It is intended for long sequential
+	// scans such as those issued by backups and exports: RocksDB additionally
+	// bypasses the block cache for such iterators so that they don't evict
+	// blocks in use by foreground traffic. The vendored version of Pebble has
+	// no per-iterator readahead or cache-filling option, so it is ignored by
+	// Pebble iterators.
+	ReadAheadSize int
+	// AsyncPrefetchDepth, if positive, is the number of blocks a Pebble
+	// iterator fetches ahead of its position, concurrently with its use. This
+	// overlaps the latency of reading blocks from high-latency storage with
+	// the decoding of the data already read. It only applies to forward
+	// iteration and MVCC scans, which return the same results regardless of
+	// the depth. It is ignored by prefix iterators, by iterators on batches
+	// and by RocksDB iterators.
+	AsyncPrefetchDepth int
 }
 
 // Reader is the read interface to an engine's data.
@@ -326,6 +366,8 @@ type Engine interface {
 	GetCompactionStats() string
 	// GetStats retrieves stats from the engine.
 	GetStats() (*Stats, error)
+	// GetMetrics retrieves a snapshot of the engine's LSM metrics.
+	GetMetrics() (*Metrics, error)
 	// GetTickersAndHistograms retrieves maps of all RocksDB tickers and histograms.
 	// It differs from `GetStats` by getting _every_ ticker and histogram, and by not
 	// getting anything else (DB properties, for example).
@@ -367,6 +409,13 @@ type Engine interface {
 	// released relatively quickly, inexpensive. Snapshots are released
 	// by invoking Close(). Note that snapshots must not be used after the
 	// original engine has been stopped.
+	//
+	// All of the reads and iterators of a snapshot observe the same view of
+	// the engine, regardless of the writes committed after its creation, so a
+	// snapshot can be shared by several scans which must be consistent with
+	// one another. The data a snapshot may read, including sstables which
+	// compactions made obsolete, can't be reclaimed until it and all of its
+	// iterators are closed.
 	NewSnapshot() Reader
 	// Type returns engine type.
 	Type() enginepb.EngineType
@@ -382,8 +431,25 @@ type Engine interface {
 	// CompactRange ensures that the specified range of key value pairs is
 	// optimized for space efficiency. The forceBottommost parameter ensures
 	// that the key range is compacted all the way to the bottommost level of
-	// SSTables, which is necessary to pick up changes to bloom filters.
+	// SSTables, which is necessary to pick up changes to bloom filters. The
+	// compaction is performed synchronously. A nil start or end key leaves
+	// that side of the range unbounded.
 	CompactRange(start, end roachpb.Key, forceBottommost bool) error
+	// SuggestCompaction asks the engine to compact [start, end) soon, for
+	// instance after ingesting sstables into that span. The compaction is
+	// performed asynchronously, and suggestions for overlapping spans which
+	// are still pending are coalesced into a single compaction. The reason is
+	// only used for logging. A nil start or end key leaves that side of the
+	// range unbounded.
+	SuggestCompaction(start, end roachpb.Key, reason string)
+	// RegisterEventListener registers listener to be notified of the
+	// completion of the engine's flushes and compactions, for instance to warm
+	// caches or to record metrics. Any number of listeners can be registered,
+	// and each of them is notified of every event completing after its
+	// registration. Listeners are invoked synchronously by the background
+	// flushes and compactions, and must not block. Only Pebble engines support
+	// listeners: RocksDB engines return an error.
+	RegisterEventListener(listener EngineEventListener) error
 	// InMem returns true if the receiver is an in-memory engine and false
 	// otherwise.
 	//
@@ -409,6 +475,13 @@ type Engine interface {
 	// the engine implementation. For RocksDB, this means using the Env responsible for the file
 	// which may handle extra logic (eg: copy encryption settings for EncryptedEnv).
 	LinkFile(oldname, newname string) error
+	// Env returns the filesystem the engine was opened with, so that sideband
+	// files such as SSTs staged for ingestion can be created and read in the
+	// same namespace as the engine's own files, including when the engine is
+	// in memory. Files written through it are unknown to the engine: the
+	// caller is responsible for not clobbering the engine's files and for
+	// cleaning up after itself.
+	Env() vfs.FS
 	// CreateCheckpoint creates a checkpoint of the engine in the given directory,
 	// which must not exist. The directory should be on the same file system so
 	// that hard links can be used.
@@ -420,7 +493,10 @@ type Batch interface {
 	ReadWriter
 	// Commit atomically applies any batched updates to the underlying
 	// engine. This is a noop unless the batch was created via NewBatch(). If
-	// sync is true, the batch is synchronously committed to disk.
+	// sync is true, the batch is synchronously committed to disk. Otherwise it
+	// is written to the WAL without waiting for the WAL to be synced, and may be
+	// lost on a crash. The WAL is synced in order, so a sync commit also makes
+	// all earlier commits durable, including those which did not sync.
 	Commit(sync bool) error
 	// Distinct returns a view of the existing batch which only sees writes that
 	// were performed before the Distinct batch was created. That is, the
@@ -442,6 +518,10 @@ type Batch interface {
 	// TODO(itsbilal): Improve comments around how/why distinct batches are an
 	// optimization in the rocksdb write path.
 	Distinct() ReadWriter
+	// WriteOnly returns whether the batch was created by
+	// Engine.NewWriteOnlyBatch, in which case it can't be read from. Its writes
+	// can still be read from its representation, see NewMultiReaderIterator.
+	WriteOnly() bool
 	// Empty returns whether the batch has been written to or not.
 	Empty() bool
 	// Len returns the size of the underlying representation of the batch.
@@ -449,6 +529,12 @@ type Batch interface {
 	// not be used interchangeably with Empty. The method avoids the memory copy
 	// that Repr imposes, but it still may require flushing the batch's mutations.
 	Len() int
+	// Count returns the number of memtable-modifying operations in the batch,
+	// i.e. its writes, deletions and merges, but not its log data. Together
+	// with Len, it lets callers accumulating many operations flush the batch
+	// before it grows too large. Like Len, it avoids the memory copy that Repr
+	// imposes, but it still may require flushing the batch's mutations.
+	Count() int
 	// Repr returns the underlying representation of the batch and can be used to
 	// reconstitute the batch on a remote node using Writer.ApplyBatchRepr().
 	Repr() []byte
@@ -477,6 +563,110 @@ type Stats struct {
 	TableReadersMemEstimate        int64
 	PendingCompactionBytesEstimate int64
 	L0FileCount                    int64
+	// PendingSuggestedCompactions is the number of compactions requested
+	// through SuggestCompaction that are queued or in progress.
+	PendingSuggestedCompactions int64
+	// Corruptions is the number of reads that failed due to corrupt data.
+	// Only tracked by Pebble.
+	Corruptions int64
+}
+
+// EngineEventListener is notified of the completion of the flushes and
+// compactions of an engine. See Engine.RegisterEventListener. Either callback
+// may be nil.
+type EngineEventListener struct {
+	OnFlushEnd      func(FlushInfo)
+	OnCompactionEnd func(CompactionInfo)
+}
+
+// FlushInfo describes a completed flush of memtables to L0.
+type FlushInfo struct {
+	// Tables and Bytes are the number and total size of the sstables written.
+	Tables int
+	Bytes  int64
+	// Duration is the duration of the flush.
+	Duration time.Duration
+	// Err is set if the flush failed.
+	Err error
+}
+
+// CompactionInfo describes a completed compaction.
+type CompactionInfo struct {
+	// InputLevel and OutputLevel are the levels compacted from and into.
+	InputLevel, OutputLevel int
+	// InputBytes and OutputBytes are the total sizes of the sstables read and
+	// written.
+	InputBytes, OutputBytes int64
+	// Duration is the duration of the compaction.
+	Duration time.Duration
+	// Err is set if the compaction failed.
+	Err error
+}
+
+// Metrics is a point-in-time snapshot of the LSM metrics of an engine: the
+// shape of the tree, cache effectiveness, and the size of the memtables and
+// write-ahead log. Metrics which an engine does not track are left zero.
+type Metrics struct {
+	// LevelFiles and LevelBytes are the number and total size of the sstables
+	// in each level of the LSM, indexed by level.
+	LevelFiles []int64
+	LevelBytes []int64
+
+	BlockCacheHits   int64
+	BlockCacheMisses int64
+	BlockCacheSize   int64
+	FilterHits       int64
+	FilterMisses     int64
+
+	// MemTableCount is the number of memtables, including the mutable memtable
+	// and the immutable memtables which are waiting to be flushed.
+	MemTableCount int64
+	MemTableSize  int64
+
+	FlushCount      int64
+	CompactionCount int64
+	// CompactionDebtBytes is an estimate of the number of bytes which need to be
+	// compacted before the LSM reaches a stable shape.
+	CompactionDebtBytes int64
+
+	WALFiles int64
+	WALSize  int64
+	// WALSyncs and WALSyncDuration are the number and total duration of the
+	// syncs of the write-ahead log, from which the average latency of syncs
+	// over an interval can be derived.
+	WALSyncs        int64
+	WALSyncDuration time.Duration
+}
+
+// L0Files returns the number of sstables in L0.
+func (m *Metrics) L0Files() int64 {
+	if len(m.LevelFiles) == 0 {
+		return 0
+	}
+	return m.LevelFiles[0]
+}
+
+// ReadAmplification returns the number of sorted runs which a point lookup may
+// need to consult: every memtable, every sstable in L0, and every non-empty
+// level below L0.
+func (m *Metrics) ReadAmplification() int64 {
+	ramp := m.MemTableCount + m.L0Files()
+	for level := 1; level < len(m.LevelFiles); level++ {
+		if m.LevelFiles[level] > 0 {
+			ramp++
+		}
+	}
+	return ramp
+}
+
+// BlockCacheHitRate returns the fraction of block cache lookups which were
+// hits, or zero if there were no lookups.
+func (m *Metrics) BlockCacheHitRate() float64 {
+	total := m.BlockCacheHits + m.BlockCacheMisses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.BlockCacheHits) / float64(total)
 }
 
 // EnvStats is a set of RocksDB env stats, including encryption status.
@@ -0,0 +1,132 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import "github.com/cockroachdb/cockroach/pkg/roachpb"
+
+// EngineKey is a key as it is stored by the engine, i.e. the encoding of an
+// MVCCKey. An EngineKey read from an engine isn't guaranteed to be a valid
+// encoding.
+type EngineKey []byte
+
+// Decode decodes the key into an MVCCKey, returning an error if it is
+// malformed.
+func (k EngineKey) Decode() (MVCCKey, error) {
+	return DecodeMVCCKey(k)
+}
+
+// EngineIterator iterates over the raw keys and values of an engine, without
+// splitting keys into their MVCC key and timestamp. It is meant for low-level
+// inspection, such as by debug tools: it never decodes keys itself, and so
+// doesn't trip over malformed ones. Use an Iterator to read MVCC data.
+type EngineIterator interface {
+	// Close frees up the resources held by the iterator.
+	Close()
+	// SeekGE positions the iterator at the first key greater than or equal to
+	// key, which needn't be a valid encoding.
+	SeekGE(key EngineKey)
+	// Valid returns true if the iterator is positioned at a key, and an error
+	// if the iteration failed.
+	Valid() (bool, error)
+	// Next advances the iterator to the next key.
+	Next()
+	// Prev moves the iterator to the previous key.
+	Prev()
+	// UnsafeRawKey returns the current key. The memory is invalidated by the
+	// next repositioning of the iterator. Returns nil if the iterator isn't
+	// valid.
+	UnsafeRawKey() []byte
+	// UnsafeValue returns the current value, with the same lifetime as
+	// UnsafeRawKey. Returns nil if the iterator isn't valid.
+	UnsafeValue() []byte
+}
+
+// rawIterator is implemented by iterators which can seek to, and return,
+// the undecoded keys of the underlying engine.
+type rawIterator interface {
+	seekRawGE(key []byte)
+	unsafeRawKey() []byte
+}
+
+// NewEngineIterator returns an EngineIterator over the reader's keys. Like
+// Reader.NewIterator, opts must specify bounds; iterators without bounds or
+// a prefix are bounded above by roachpb.KeyMax rather than panicking.
+//
+// Pebble iterators expose the stored keys directly. Iterators over RocksDB,
+// whose iterators decode keys before returning them, re-encode the decoded
+// keys and seek to malformed keys as if they were unversioned keys.
+func NewEngineIterator(reader Reader, opts IterOptions) EngineIterator {
+	if !opts.Prefix && len(opts.UpperBound) == 0 && len(opts.LowerBound) == 0 {
+		opts.UpperBound = roachpb.KeyMax
+	}
+	return &engineIterator{iter: reader.NewIterator(opts)}
+}
+
+// engineIterator implements EngineIterator on top of an Iterator.
+type engineIterator struct {
+	iter   Iterator
+	keyBuf []byte
+}
+
+var _ EngineIterator = &engineIterator{}
+
+// Close implements the EngineIterator interface.
+func (e *engineIterator) Close() {
+	e.iter.Close()
+}
+
+// SeekGE implements the EngineIterator interface.
+func (e *engineIterator) SeekGE(key EngineKey) {
+	if raw, ok := e.iter.(rawIterator); ok {
+		raw.seekRawGE(key)
+		return
+	}
+	mvccKey, err := key.Decode()
+	if err != nil {
+		mvccKey = MakeMVCCMetadataKey(roachpb.Key(key))
+	}
+	e.iter.Seek(mvccKey)
+}
+
+// Valid implements the EngineIterator interface.
+func (e *engineIterator) Valid() (bool, error) {
+	return e.iter.Valid()
+}
+
+// Next implements the EngineIterator interface.
+func (e *engineIterator) Next() {
+	e.iter.Next()
+}
+
+// Prev implements the EngineIterator interface.
+func (e *engineIterator) Prev() {
+	e.iter.Prev()
+}
+
+// UnsafeRawKey implements the EngineIterator interface.
+func (e *engineIterator) UnsafeRawKey() []byte {
+	if ok, err := e.iter.Valid(); !ok || err != nil {
+		return nil
+	}
+	if raw, ok := e.iter.(rawIterator); ok {
+		return raw.unsafeRawKey()
+	}
+	e.keyBuf = EncodeKeyToBuf(e.keyBuf[:0], e.iter.UnsafeKey())
+	return e.keyBuf
+}
+
+// UnsafeValue implements the EngineIterator interface.
+func (e *engineIterator) UnsafeValue() []byte {
+	if ok, err := e.iter.Valid(); !ok || err != nil {
+		return nil
+	}
+	return e.iter.UnsafeValue()
+}
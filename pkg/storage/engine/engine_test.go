@@ -15,7 +15,9 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -680,6 +682,343 @@ func TestFlushWithSSTables(t *testing.T) {
 	}, t)
 }
 
+func TestEngineGetMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		for i := 0; i < 100; i++ {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i))
+			if err := engine.Put(MVCCKey{Key: key}, []byte("foobar")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := engine.GetMetrics()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var numFiles int64
+		for _, n := range m.LevelFiles {
+			numFiles += n
+		}
+		if expected := int64(len(engine.GetSSTables())); numFiles != expected {
+			t.Fatalf("expected %d sstables, got %d", expected, numFiles)
+		}
+		if m.FlushCount == 0 {
+			t.Fatal("expected a non-zero flush count")
+		}
+		if m.ReadAmplification() < m.L0Files() {
+			t.Fatalf("read amplification %d less than L0 file count %d", m.ReadAmplification(), m.L0Files())
+		}
+		if r := m.BlockCacheHitRate(); r < 0 || r > 1 {
+			t.Fatalf("unexpected block cache hit rate %f", r)
+		}
+	}, t)
+}
+
+func TestEngineIterReadAhead(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		const numKeys = 1000
+		for i := 0; i < numKeys; i++ {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i))
+			if err := engine.Put(MVCCKey{Key: key}, []byte("foobar")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		// An iterator requesting readahead sees the same data.
+		iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax, ReadAheadSize: 1 << 20})
+		defer iter.Close()
+		var count int
+		for iter.Seek(MVCCKey{Key: roachpb.KeyMin}); ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				break
+			}
+			if expected := uint32(count); binary.BigEndian.Uint32(iter.UnsafeKey().Key) != expected {
+				t.Fatalf("expected key %d, got %s", expected, iter.UnsafeKey())
+			}
+			count++
+		}
+		if count != numKeys {
+			t.Fatalf("expected %d keys, got %d", numKeys, count)
+		}
+	}, t)
+}
+
+func TestEngineIterAsyncPrefetch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		// Write enough data to span more than a hundred blocks.
+		const numKeys = 1000
+		ts := hlc.Timestamp{WallTime: 1}
+		value := make([]byte, 4<<10)
+		for i := 0; i < numKeys; i++ {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i))
+			value[0] = byte(i)
+			if err := engine.Put(MVCCKey{Key: key, Timestamp: ts}, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		iterate := func(r Reader, depth int, nextKey bool) []MVCCKeyValue {
+			iter := r.NewIterator(IterOptions{UpperBound: roachpb.KeyMax, AsyncPrefetchDepth: depth})
+			defer iter.Close()
+			var kvs []MVCCKeyValue
+			for iter.Seek(MVCCKey{Key: roachpb.KeyMin}); ; {
+				if ok, err := iter.Valid(); err != nil {
+					t.Fatal(err)
+				} else if !ok {
+					break
+				}
+				kvs = append(kvs, MVCCKeyValue{Key: iter.Key(), Value: iter.Value()})
+				if nextKey {
+					iter.NextKey()
+				} else {
+					iter.Next()
+				}
+			}
+			return kvs
+		}
+		scan := func(r Reader, depth int) [][]byte {
+			iter := r.NewIterator(IterOptions{UpperBound: roachpb.KeyMax, AsyncPrefetchDepth: depth})
+			defer iter.Close()
+			kvData, numKVs, _, _, err := iter.MVCCScan(
+				roachpb.KeyMin, roachpb.KeyMax, numKeys, ts, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numKVs != numKeys {
+				t.Fatalf("expected %d keys, found %d", numKeys, numKVs)
+			}
+			return kvData
+		}
+
+		snap := engine.NewSnapshot()
+		defer snap.Close()
+		for _, r := range []Reader{engine, snap} {
+			expKVs, expData := iterate(r, 0, false), scan(r, 0)
+			if len(expKVs) != numKeys {
+				t.Fatalf("expected %d keys, found %d", numKeys, len(expKVs))
+			}
+			// The results are identical regardless of the prefetch depth.
+			for _, depth := range []int{1, 4, 64} {
+				for _, nextKey := range []bool{false, true} {
+					if kvs := iterate(r, depth, nextKey); !reflect.DeepEqual(expKVs, kvs) {
+						t.Fatalf("depth %d, nextKey %t: iteration returned different results", depth, nextKey)
+					}
+				}
+				if data := scan(r, depth); !reflect.DeepEqual(expData, data) {
+					t.Fatalf("depth %d: scan returned different results", depth)
+				}
+			}
+		}
+	}, t)
+}
+
+func TestEngineIterator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	runWithAllEngines(func(e Engine, t *testing.T) {
+		keys := []MVCCKey{
+			mvccKey("a"),
+			{Key: roachpb.Key("b"), Timestamp: hlc.Timestamp{WallTime: 2}},
+			{Key: roachpb.Key("b"), Timestamp: hlc.Timestamp{WallTime: 1}},
+			mvccKey("c"),
+		}
+		for _, key := range keys {
+			if err := e.Put(key, []byte(key.String())); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		iter := NewEngineIterator(e, IterOptions{})
+		defer iter.Close()
+		check := func(expIdx int) {
+			t.Helper()
+			ok, err := iter.Valid()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expIdx < 0 || expIdx >= len(keys) {
+				if ok {
+					t.Fatalf("expected invalid iterator, found %x", iter.UnsafeRawKey())
+				}
+				if iter.UnsafeRawKey() != nil || iter.UnsafeValue() != nil {
+					t.Fatal("expected nil key and value from invalid iterator")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected %s, found invalid iterator", keys[expIdx])
+			}
+			if exp := EncodeKey(keys[expIdx]); !bytes.Equal(iter.UnsafeRawKey(), exp) {
+				t.Fatalf("expected key %x, found %x", exp, iter.UnsafeRawKey())
+			}
+			if exp := keys[expIdx].String(); string(iter.UnsafeValue()) != exp {
+				t.Fatalf("expected value %q, found %q", exp, iter.UnsafeValue())
+			}
+		}
+
+		iter.SeekGE(nil)
+		for i := range keys {
+			check(i)
+			iter.Next()
+		}
+		check(len(keys))
+
+		iter.SeekGE(EncodeKey(keys[2]))
+		check(2)
+		iter.Prev()
+		check(1)
+		iter.Prev()
+		check(0)
+
+		// Seeking doesn't require a valid encoding.
+		iter.SeekGE(EngineKey("b"))
+		check(1)
+		iter.SeekGE(EngineKey("z"))
+		check(-1)
+	}, t)
+}
+
+func TestEngineIteratorSeekLT(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	runWithAllEngines(func(e Engine, t *testing.T) {
+		ts := func(wallTime int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wallTime} }
+		keys := []MVCCKey{
+			{Key: roachpb.Key("a"), Timestamp: ts(3)},
+			{Key: roachpb.Key("a"), Timestamp: ts(1)},
+			mvccKey("b"),
+			{Key: roachpb.Key("b"), Timestamp: ts(2)},
+			{Key: roachpb.Key("c"), Timestamp: ts(5)},
+			{Key: roachpb.Key("c"), Timestamp: ts(4)},
+			{Key: roachpb.Key("c"), Timestamp: ts(1)},
+		}
+		for _, key := range keys {
+			if err := e.Put(key, []byte(key.String())); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		testCases := []struct {
+			seek MVCCKey
+			exp  MVCCKey
+		}{
+			{mvccKey("a"), MVCCKey{}},
+			{MVCCKey{Key: roachpb.Key("a"), Timestamp: ts(2)}, MVCCKey{}},
+			{mvccKey("a\x00"), keys[0]},
+			{mvccKey("b"), keys[0]},
+			{MVCCKey{Key: roachpb.Key("b"), Timestamp: ts(1)}, keys[0]},
+			{mvccKey("c"), keys[2]},
+			{mvccKey("d"), keys[4]},
+			{mvccKey("z"), keys[4]},
+		}
+		for _, batch := range []bool{false, true} {
+			var r Reader = e
+			if batch {
+				b := e.NewBatch()
+				defer b.Close()
+				r = b
+			}
+			iter := r.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			for _, tc := range testCases {
+				iter.SeekLT(tc.seek)
+				ok, err := iter.Valid()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(tc.exp.Key) == 0 {
+					if ok {
+						t.Errorf("SeekLT(%s): expected invalid iterator, found %s", tc.seek, iter.UnsafeKey())
+					}
+					continue
+				}
+				if !ok {
+					t.Errorf("SeekLT(%s): expected %s, found invalid iterator", tc.seek, tc.exp)
+				} else if !iter.UnsafeKey().Equal(tc.exp) {
+					t.Errorf("SeekLT(%s): expected %s, found %s", tc.seek, tc.exp, iter.UnsafeKey())
+				}
+			}
+
+			// SeekLT followed by Next visits all versions of the preceding key.
+			iter.SeekLT(mvccKey("d"))
+			for _, exp := range keys[4:] {
+				if ok, err := iter.Valid(); err != nil || !ok {
+					t.Fatalf("expected %s, found %t, %v", exp, ok, err)
+				}
+				if !iter.UnsafeKey().Equal(exp) {
+					t.Fatalf("expected %s, found %s", exp, iter.UnsafeKey())
+				}
+				iter.Next()
+			}
+			iter.Close()
+		}
+	}, t)
+}
+
+func TestEngineCompactRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		keyAt := func(i int) roachpb.Key {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(i))
+			return key
+		}
+		for _, bounds := range []struct{ start, end roachpb.Key }{
+			{keyAt(0), keyAt(100)},
+			{nil, nil},
+		} {
+			for i := 0; i < 100; i++ {
+				if err := engine.Put(MVCCKey{Key: keyAt(i)}, []byte("foobar")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := engine.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := engine.ClearRange(MVCCKey{Key: keyAt(0)}, MVCCKey{Key: keyAt(100)}); err != nil {
+				t.Fatal(err)
+			}
+			if err := engine.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := engine.CompactRange(bounds.start, bounds.end, true /* forceBottommost */); err != nil {
+				t.Fatal(err)
+			}
+			m, err := engine.GetMetrics()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := m.L0Files(); n != 0 {
+				t.Fatalf("[%s, %s): expected no L0 files after compaction, got %d", bounds.start, bounds.end, n)
+			}
+			kvs, err := Scan(engine, keyAt(0), keyAt(100), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 0 {
+				t.Fatalf("[%s, %s): expected no keys after compaction, got %d", bounds.start, bounds.end, len(kvs))
+			}
+		}
+	}, t)
+}
+
 func TestEngineScan1(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	runWithAllEngines(func(engine Engine, t *testing.T) {
@@ -1055,3 +1394,178 @@ func TestIngestDelayLimit(t *testing.T) {
 		require.Equal(t, tc.exp, calculatePreIngestDelay(s, &tc.stats))
 	}
 }
+
+func TestEngineEnv(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		fs := engine.Env()
+
+		// Files created through the env are visible to the engine.
+		f, err := fs.Create("staged.sst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("foo")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := engine.ReadFile("staged.sst"); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "foo" {
+			t.Fatalf("expected foo, found %q", data)
+		}
+
+		// And vice versa.
+		if err := engine.WriteFile("written.sst", []byte("bar")); err != nil {
+			t.Fatal(err)
+		}
+		f, err = fs.Open("written.sst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "bar" {
+			t.Fatalf("expected bar, found %q", data)
+		}
+		if info, err := f.Stat(); err != nil {
+			t.Fatal(err)
+		} else if info.Size() != 3 {
+			t.Fatalf("expected size 3, found %d", info.Size())
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, name := range []string{"staged.sst", "written.sst"} {
+			if err := fs.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := engine.ReadFile(name); !os.IsNotExist(err) {
+				t.Fatalf("%s: expected file to be removed, found %v", name, err)
+			}
+		}
+
+		// The env of an in-memory engine doesn't touch the real filesystem.
+		lock, err := fs.Lock("env.lock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat("env.lock"); !os.IsNotExist(err) {
+			t.Fatalf("expected no lock file on disk, found %v", err)
+		}
+		if err := lock.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}, t)
+}
+
+func TestMultiReaderIterator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := func(wallTime int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wallTime} }
+	runWithAllEngines(func(engine Engine, t *testing.T) {
+		for _, kv := range []MVCCKeyValue{
+			{Key: MVCCKey{Key: roachpb.Key("a"), Timestamp: ts(1)}, Value: []byte("a1")},
+			{Key: MVCCKey{Key: roachpb.Key("b"), Timestamp: ts(1)}, Value: []byte("b1")},
+			{Key: MVCCKey{Key: roachpb.Key("c"), Timestamp: ts(1)}, Value: []byte("c1")},
+			{Key: MVCCKey{Key: roachpb.Key("d"), Timestamp: ts(1)}, Value: []byte("d1")},
+			{Key: MVCCKey{Key: roachpb.Key("e"), Timestamp: ts(1)}, Value: []byte("e1")},
+		} {
+			if err := engine.Put(kv.Key, kv.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		batch := engine.NewWriteOnlyBatch()
+		defer batch.Close()
+		// An overwrite of an engine version, an MVCC tombstone shadowing the
+		// engine's version at the MVCC level, a deletion of an engine version,
+		// and a range deletion followed by a write within the range.
+		if err := batch.Put(MVCCKey{Key: roachpb.Key("a"), Timestamp: ts(1)}, []byte("a1'")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Put(MVCCKey{Key: roachpb.Key("b"), Timestamp: ts(2)}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Clear(MVCCKey{Key: roachpb.Key("c"), Timestamp: ts(1)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Put(MVCCKey{Key: roachpb.Key("d"), Timestamp: ts(3)}, []byte("d3")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.ClearRange(mvccKey("d"), mvccKey("f")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Put(MVCCKey{Key: roachpb.Key("e"), Timestamp: ts(2)}, []byte("e2")); err != nil {
+			t.Fatal(err)
+		}
+		// A key only present in the batch.
+		if err := batch.Put(MVCCKey{Key: roachpb.Key("f"), Timestamp: ts(2)}, []byte("f2")); err != nil {
+			t.Fatal(err)
+		}
+
+		iter, err := NewMultiReaderIterator(IterOptions{UpperBound: roachpb.KeyMax}, engine, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+		var kvs []string
+		for iter.Seek(MVCCKey{Key: roachpb.KeyMin}); ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				break
+			}
+			key := iter.UnsafeKey()
+			kvs = append(kvs, fmt.Sprintf("%s@%d=%s", string(key.Key), key.Timestamp.WallTime, iter.UnsafeValue()))
+		}
+		expected := []string{
+			"a@1=a1'",
+			"b@2=",
+			"b@1=b1",
+			"e@2=e2",
+			"f@2=f2",
+		}
+		if !reflect.DeepEqual(kvs, expected) {
+			t.Fatalf("expected %q, got %q", expected, kvs)
+		}
+
+		// The batch doesn't shadow the engine when placed below it.
+		iter2, err := NewMultiReaderIterator(IterOptions{UpperBound: roachpb.Key("b")}, batch, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter2.Close()
+		iter2.Seek(MVCCKey{Key: roachpb.KeyMin})
+		if ok, err := iter2.Valid(); err != nil || !ok {
+			t.Fatalf("expected a key, got ok=%t, err=%v", ok, err)
+		}
+		if val := string(iter2.UnsafeValue()); val != "a1" {
+			t.Fatalf("expected a1, got %s", val)
+		}
+		iter2.Next()
+		if ok, err := iter2.Valid(); err != nil || ok {
+			t.Fatalf("expected the iterator to be exhausted, got ok=%t, err=%v", ok, err)
+		}
+
+		if _, err := NewMultiReaderIterator(IterOptions{Prefix: true}, engine, batch); !testutils.IsError(err, "prefix iteration is not supported") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		mergeBatch := engine.NewWriteOnlyBatch()
+		defer mergeBatch.Close()
+		if err := mergeBatch.Merge(mvccKey("g"), appender("g")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewMultiReaderIterator(IterOptions{UpperBound: roachpb.KeyMax}, engine, mergeBatch); !testutils.IsError(err, "unsupported batch entry type") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}, t)
+}
@@ -13,6 +13,8 @@ package enginepb
 import (
 	"math"
 	"sort"
+
+	"github.com/pkg/errors"
 )
 
 // TxnEpoch is a zero-indexed epoch for a transaction. When a transaction
@@ -154,6 +156,85 @@ func (ms *MVCCStats) Subtract(oms MVCCStats) {
 	ms.SysCount -= oms.SysCount
 }
 
+// SafeAdd is like Add, but returns an error instead if the sum of any field
+// overflows, or is negative while neither ms nor oms contains estimates. ms is
+// left unchanged in that case. It is meant for maintaining the stats of a
+// span, which are never negative unless they are estimates, so that drift
+// caused by bugs is caught where it is introduced; deltas, which may well be
+// negative, should be combined with Add.
+func (ms *MVCCStats) SafeAdd(oms MVCCStats) error {
+	if err := ms.checkArithmetic(oms, false /* subtract */); err != nil {
+		return err
+	}
+	ms.Add(oms)
+	return nil
+}
+
+// SafeSubtract is like Subtract, but returns an error in the same cases as
+// SafeAdd, leaving ms unchanged.
+func (ms *MVCCStats) SafeSubtract(oms MVCCStats) error {
+	if err := ms.checkArithmetic(oms, true /* subtract */); err != nil {
+		return err
+	}
+	ms.Subtract(oms)
+	return nil
+}
+
+// checkArithmetic returns an error if adding oms to ms, or subtracting it if
+// subtract is set, would overflow or make a field negative. See SafeAdd.
+func (ms *MVCCStats) checkArithmetic(oms MVCCStats, subtract bool) error {
+	// Age both operands as Add and Subtract do.
+	a, b := *ms, oms
+	a.Forward(b.LastUpdateNanos)
+	b.Forward(a.LastUpdateNanos)
+	estimates := a.ContainsEstimates || b.ContainsEstimates
+	op := "sum"
+	if subtract {
+		op = "difference"
+	}
+	bFields := b.int64Fields()
+	for i, f := range a.int64Fields() {
+		x, y := *f.val, *bFields[i].val
+		if subtract {
+			if y == math.MinInt64 {
+				return errors.Errorf("MVCCStats.%s: %s of %d and %d overflows", f.name, op, x, y)
+			}
+			y = -y
+		}
+		r := x + y
+		if (y > 0 && r < x) || (y < 0 && r > x) {
+			return errors.Errorf("MVCCStats.%s: %s of %d and %d overflows", f.name, op, x, *bFields[i].val)
+		}
+		if r < 0 && !estimates {
+			return errors.Errorf("MVCCStats.%s: %s of %d and %d is negative", f.name, op, x, *bFields[i].val)
+		}
+	}
+	return nil
+}
+
+type mvccStatsField struct {
+	name string
+	val  *int64
+}
+
+// int64Fields returns the fields of ms which Add and Subtract combine.
+func (ms *MVCCStats) int64Fields() []mvccStatsField {
+	return []mvccStatsField{
+		{"IntentAge", &ms.IntentAge},
+		{"GCBytesAge", &ms.GCBytesAge},
+		{"LiveBytes", &ms.LiveBytes},
+		{"KeyBytes", &ms.KeyBytes},
+		{"ValBytes", &ms.ValBytes},
+		{"IntentBytes", &ms.IntentBytes},
+		{"LiveCount", &ms.LiveCount},
+		{"KeyCount", &ms.KeyCount},
+		{"ValCount", &ms.ValCount},
+		{"IntentCount", &ms.IntentCount},
+		{"SysBytes", &ms.SysBytes},
+		{"SysCount", &ms.SysCount},
+	}
+}
+
 // IsInline returns true if the value is inlined in the metadata.
 func (meta MVCCMetadata) IsInline() bool {
 	return meta.RawBytes != nil
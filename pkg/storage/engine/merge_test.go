@@ -11,6 +11,7 @@
 package engine
 
 import (
+	"bytes"
 	"math"
 	"math/rand"
 	"reflect"
@@ -18,8 +19,10 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 	"github.com/gogo/protobuf/proto"
 )
 
@@ -601,3 +604,68 @@ func unmarshalTimeSeries(t testing.TB, b []byte) roachpb.InternalTimeSeriesData
 	}
 	return valueTS
 }
+
+// TestMergeTimeSeries verifies that MergeTimeSeries matches the merge operator
+// used by Pebble, and that merging samples at distinct offsets is independent
+// of the order in which the updates are merged.
+func TestMergeTimeSeries(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	rng, _ := randutil.NewPseudoRand()
+	const numUpdates = 20
+	updates := make([][]byte, numUpdates)
+	for i := range updates {
+		updates[i] = timeSeriesColumn(0, 1000, true, tsColumnSample{
+			offset: int32(i), last: float64(i), count: 1, first: float64(i),
+			sum: float64(i), max: float64(i), min: float64(i),
+		})
+	}
+
+	expected, err := mergeValuesPebble(false /* reverse */, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTS := unmarshalTimeSeries(t, expected)
+
+	for i := 0; i < 10; i++ {
+		var merged []byte
+		for _, j := range rng.Perm(numUpdates) {
+			if merged, err = MergeTimeSeries(merged, updates[j]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if mergedTS := unmarshalTimeSeries(t, merged); !reflect.DeepEqual(expectedTS, mergedTS) {
+			t.Fatalf("merge order dependent: expected %v, got %v", expectedTS, mergedTS)
+		}
+	}
+
+	// A single merge matches what Pebble does for two operands.
+	merged, err := MergeTimeSeries(updates[1], updates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err = mergeValuesPebble(false /* reverse */, [][]byte{updates[1], updates[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, merged) {
+		t.Fatalf("expected %x, got %x", expected, merged)
+	}
+
+	// Samples at the same offset are not commutative: the update wins.
+	older := timeSeriesColumn(0, 1000, false, tsColumnSample{offset: 1, last: 1})
+	newer := timeSeriesColumn(0, 1000, false, tsColumnSample{offset: 1, last: 2})
+	merged, err = MergeTimeSeries(older, newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mergedTS := unmarshalTimeSeries(t, merged); !reflect.DeepEqual(
+		mergedTS, unmarshalTimeSeries(t, newer),
+	) {
+		t.Fatalf("expected %v, got %v", unmarshalTimeSeries(t, newer), mergedTS)
+	}
+
+	if _, err := MergeTimeSeries(older, []byte("garbage")); !testutils.IsError(err, "corrupted operand") {
+		t.Fatalf("expected corrupted operand error, got %v", err)
+	}
+}
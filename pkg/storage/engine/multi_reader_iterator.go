@@ -0,0 +1,331 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/pkg/errors"
+)
+
+// NewMultiReaderIterator returns an iterator over the merged contents of the
+// given readers, which are layered from bottom to top: a key present in
+// several of them, with the same timestamp, has the value of the topmost one,
+// and the deletions of a reader hide the keys of the readers below it. Keys
+// of different timestamps are all returned, in MVCC order, so that versions
+// written by an upper reader shadow those below them at the MVCC level, e.g.
+// when read by the MVCC functions.
+//
+// The readers are iterated with opts, which must not set Prefix. Write-only
+// batches, whose writes can't otherwise be read back (see
+// Engine.NewWriteOnlyBatch), are supported: their writes, including point and
+// range deletions, are read from their representation, at the time of the
+// call. This allows a transaction to read its own writes on top of the
+// engine without indexing its batch. Merges aren't supported in write-only
+// batches, and result in an error.
+func NewMultiReaderIterator(opts IterOptions, readers ...Reader) (SimpleIterator, error) {
+	if opts.Prefix {
+		return nil, errors.New("prefix iteration is not supported by multi-reader iterators")
+	}
+	iter := &multiReaderIterator{
+		lowerBound: opts.LowerBound,
+		upperBound: opts.UpperBound,
+		cur:        -1,
+	}
+	for _, r := range readers {
+		if b, ok := r.(Batch); ok && b.WriteOnly() {
+			writes, err := newBatchWritesIterator(b.Repr())
+			if err != nil {
+				iter.Close()
+				return nil, err
+			}
+			iter.sources = append(iter.sources, multiReaderSource{iter: writes, writes: writes})
+			continue
+		}
+		iter.sources = append(iter.sources, multiReaderSource{iter: r.NewIterator(opts)})
+	}
+	return iter, nil
+}
+
+// multiReaderSource is one of the layers of a multiReaderIterator.
+type multiReaderSource struct {
+	iter SimpleIterator
+	// writes is set if the source is a write-only batch, which may contain
+	// deletions. It is then the same iterator as iter.
+	writes *batchWritesIterator
+}
+
+// multiReaderIterator merges the keys of several readers. See
+// NewMultiReaderIterator.
+type multiReaderIterator struct {
+	// sources holds the layers of the iterator, from bottom to top.
+	sources                []multiReaderSource
+	lowerBound, upperBound roachpb.Key
+	// cur is the index of the source positioned at the current key, or -1 if
+	// the iterator is exhausted.
+	cur int
+	err error
+	// For allocation avoidance in advance.
+	keyBuf []byte
+}
+
+var _ SimpleIterator = &multiReaderIterator{}
+
+// Close implements the SimpleIterator interface.
+func (m *multiReaderIterator) Close() {
+	for _, s := range m.sources {
+		s.iter.Close()
+	}
+	m.sources = nil
+}
+
+// Seek implements the SimpleIterator interface.
+func (m *multiReaderIterator) Seek(key MVCCKey) {
+	if len(m.lowerBound) > 0 && key.Key.Compare(m.lowerBound) < 0 {
+		key = MakeMVCCMetadataKey(m.lowerBound)
+	}
+	for _, s := range m.sources {
+		s.iter.Seek(key)
+	}
+	m.findCur()
+}
+
+// findCur positions the iterator at the smallest key of the sources which
+// isn't deleted by the topmost source containing it, or by a range deletion
+// of a source above that one.
+func (m *multiReaderIterator) findCur() {
+	for {
+		m.cur = -1
+		var curKey MVCCKey
+		for i, s := range m.sources {
+			ok, err := s.iter.Valid()
+			if err != nil {
+				m.err = err
+				return
+			}
+			if !ok {
+				continue
+			}
+			// Iterate from bottom to top so that the topmost source wins ties.
+			if key := s.iter.UnsafeKey(); m.cur == -1 || !curKey.Less(key) {
+				m.cur, curKey = i, key
+			}
+		}
+		if m.cur == -1 {
+			return
+		}
+		if len(m.upperBound) > 0 && curKey.Key.Compare(m.upperBound) >= 0 {
+			m.cur = -1
+			return
+		}
+		if !m.deleted(m.cur, curKey) {
+			return
+		}
+		m.advance()
+	}
+}
+
+// deleted returns whether key, as found in the source at index i, is deleted
+// by that source or by one above it.
+func (m *multiReaderIterator) deleted(i int, key MVCCKey) bool {
+	if w := m.sources[i].writes; w != nil && w.deleted() {
+		return true
+	}
+	for _, s := range m.sources[i+1:] {
+		if s.writes != nil && s.writes.rangeDeleted(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// advance moves all of the sources positioned at the current key past it.
+func (m *multiReaderIterator) advance() {
+	curKey := m.sources[m.cur].iter.UnsafeKey()
+	m.keyBuf = append(m.keyBuf[:0], curKey.Key...)
+	key := MVCCKey{Key: m.keyBuf, Timestamp: curKey.Timestamp}
+	for _, s := range m.sources {
+		if ok, _ := s.iter.Valid(); ok && s.iter.UnsafeKey().Equal(key) {
+			s.iter.Next()
+		}
+	}
+}
+
+// Valid implements the SimpleIterator interface.
+func (m *multiReaderIterator) Valid() (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	return m.cur != -1, nil
+}
+
+// Next implements the SimpleIterator interface.
+func (m *multiReaderIterator) Next() {
+	if ok, _ := m.Valid(); !ok {
+		return
+	}
+	m.advance()
+	m.findCur()
+}
+
+// NextKey implements the SimpleIterator interface.
+func (m *multiReaderIterator) NextKey() {
+	if ok, _ := m.Valid(); !ok {
+		return
+	}
+	start := append([]byte(nil), m.UnsafeKey().Key...)
+	for m.Next(); m.cur != -1 && m.err == nil && bytes.Equal(start, m.UnsafeKey().Key); m.Next() {
+	}
+}
+
+// UnsafeKey implements the SimpleIterator interface.
+func (m *multiReaderIterator) UnsafeKey() MVCCKey {
+	if m.cur == -1 {
+		return MVCCKey{}
+	}
+	return m.sources[m.cur].iter.UnsafeKey()
+}
+
+// UnsafeValue implements the SimpleIterator interface.
+func (m *multiReaderIterator) UnsafeValue() []byte {
+	if m.cur == -1 {
+		return nil
+	}
+	return m.sources[m.cur].iter.UnsafeValue()
+}
+
+// batchWrite is the latest write of a key in a batch.
+type batchWrite struct {
+	key     MVCCKey
+	value   []byte
+	deleted bool
+}
+
+// batchWritesIterator iterates over the writes of a batch, in key order, as
+// decoded from its representation. Deletions are returned as keys for which
+// deleted returns true.
+type batchWritesIterator struct {
+	writes []batchWrite
+	// rangeDels are the range deletions of the batch, which delete the keys of
+	// the readers below the batch.
+	rangeDels []MVCCKey
+	pos       int
+}
+
+var _ SimpleIterator = &batchWritesIterator{}
+
+func newBatchWritesIterator(repr []byte) (*batchWritesIterator, error) {
+	r, err := NewRocksDBBatchReader(repr)
+	if err != nil {
+		return nil, err
+	}
+	// The latest write of each key, by encoded key.
+	latest := make(map[string]batchWrite)
+	it := &batchWritesIterator{}
+	for r.Next() {
+		key, err := r.MVCCKey()
+		if err != nil {
+			return nil, err
+		}
+		switch r.BatchType() {
+		case BatchTypeValue:
+			latest[string(r.Key())] = batchWrite{key: key, value: r.Value()}
+		case BatchTypeDeletion, BatchTypeSingleDeletion:
+			latest[string(r.Key())] = batchWrite{key: key, deleted: true}
+		case BatchTypeRangeDeletion:
+			endKey, err := r.MVCCEndKey()
+			if err != nil {
+				return nil, err
+			}
+			for k, w := range latest {
+				if !w.key.Less(key) && w.key.Less(endKey) {
+					delete(latest, k)
+				}
+			}
+			it.rangeDels = append(it.rangeDels, key, endKey)
+		case BatchTypeLogData:
+		default:
+			return nil, errors.Errorf("unsupported batch entry type %d for key %s", r.BatchType(), key)
+		}
+	}
+	if err := r.Error(); err != nil {
+		return nil, err
+	}
+	it.writes = make([]batchWrite, 0, len(latest))
+	for _, w := range latest {
+		it.writes = append(it.writes, w)
+	}
+	sort.Slice(it.writes, func(i, j int) bool {
+		return it.writes[i].key.Less(it.writes[j].key)
+	})
+	it.pos = len(it.writes)
+	return it, nil
+}
+
+// deleted returns whether the current write is a deletion.
+func (b *batchWritesIterator) deleted() bool {
+	return b.writes[b.pos].deleted
+}
+
+// rangeDeleted returns whether key is within one of the range deletions of
+// the batch.
+func (b *batchWritesIterator) rangeDeleted(key MVCCKey) bool {
+	for i := 0; i < len(b.rangeDels); i += 2 {
+		if !key.Less(b.rangeDels[i]) && key.Less(b.rangeDels[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close implements the SimpleIterator interface.
+func (b *batchWritesIterator) Close() {}
+
+// Seek implements the SimpleIterator interface.
+func (b *batchWritesIterator) Seek(key MVCCKey) {
+	b.pos = sort.Search(len(b.writes), func(i int) bool {
+		return !b.writes[i].key.Less(key)
+	})
+}
+
+// Valid implements the SimpleIterator interface.
+func (b *batchWritesIterator) Valid() (bool, error) {
+	return b.pos < len(b.writes), nil
+}
+
+// Next implements the SimpleIterator interface.
+func (b *batchWritesIterator) Next() {
+	if b.pos < len(b.writes) {
+		b.pos++
+	}
+}
+
+// NextKey implements the SimpleIterator interface.
+func (b *batchWritesIterator) NextKey() {
+	if b.pos >= len(b.writes) {
+		return
+	}
+	key := b.writes[b.pos].key.Key
+	for b.pos++; b.pos < len(b.writes) && b.writes[b.pos].key.Key.Equal(key); b.pos++ {
+	}
+}
+
+// UnsafeKey implements the SimpleIterator interface.
+func (b *batchWritesIterator) UnsafeKey() MVCCKey {
+	return b.writes[b.pos].key
+}
+
+// UnsafeValue implements the SimpleIterator interface.
+func (b *batchWritesIterator) UnsafeValue() []byte {
+	return b.writes[b.pos].value
+}
@@ -12,11 +12,17 @@ package engine
 
 import (
 	"bytes"
+	"container/heap"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"math"
+	"math/bits"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -85,7 +91,13 @@ func (k MVCCKey) Next() MVCCKey {
 	}
 }
 
-// Less compares two keys.
+// Less compares two keys. Keys are ordered by their roachpb.Key and then, for
+// a given roachpb.Key, the metadata key (with an empty timestamp) comes first
+// and is followed by the versions in descending timestamp order, comparing
+// the wall times and then the logical ticks. The order is total: two versions
+// of a key with the same wall time are ordered by their logical ticks, and
+// two keys with equal timestamps are the same key. It matches the order of
+// MVCCKeyCompare over encoded keys, which is that of the engines.
 func (k MVCCKey) Less(l MVCCKey) bool {
 	if c := k.Key.Compare(l.Key); c != 0 {
 		return c < 0
@@ -610,7 +622,9 @@ func updateStatsOnGC(
 
 // MVCCGetProto fetches the value at the specified key and unmarshals it into
 // msg if msg is non-nil. Returns true on success or false if the key was not
-// found.
+// found. The checksum of the value is verified before it is unmarshaled, so
+// that a corrupted value results in an error rather than in a message which
+// may or may not decode.
 //
 // See the documentation for MVCCGet for the semantics of the MVCCGetOptions.
 func MVCCGetProto(
@@ -626,9 +640,13 @@ func MVCCGetProto(
 	found := value != nil
 	// If we found a result, parse it regardless of the error returned by MVCCGet.
 	if found && msg != nil {
-		// If the unmarshal failed, return its result. Otherwise, pass
-		// through the underlying error (which may be a WriteIntentError
-		// to be handled specially alongside the returned value).
+		// If the verification or the unmarshal failed, return its result.
+		// Otherwise, pass through the underlying error (which may be a
+		// WriteIntentError to be handled specially alongside the returned
+		// value).
+		if err := value.Verify(key); err != nil {
+			return found, err
+		}
 		if err := value.GetProto(msg); err != nil {
 			return found, err
 		}
@@ -719,9 +737,12 @@ type MVCCGetOptions struct {
 // Otherwise, a deletion tombstone results in a nil roachpb.Value.
 //
 // In inconsistent mode, if an intent is encountered, it will be placed in the
-// dedicated return parameter. By contrast, in consistent mode, an intent will
-// generate a WriteIntentError with the intent embedded within, and the intent
-// result parameter will be nil.
+// dedicated return parameter alongside the most recent committed value below
+// the intent (if any), and no error is returned. This allows callers to
+// inspect the intents on a set of keys without resolving them. By contrast, in
+// consistent mode, an intent will generate a WriteIntentError with the intent
+// embedded within, and the intent result parameter will be nil. Both modes
+// behave identically when no intent is present.
 //
 // Note that transactional gets must be consistent. Put another way, only
 // non-transactional gets may be inconsistent.
@@ -760,6 +781,211 @@ func MVCCGetAsTxn(
 		}})
 }
 
+// MVCCGetIntent returns the intent on key, if any, along with the timestamp
+// at which it was written, which callers can compare to the current time to
+// compute the age of the intent, for instance to decide whether to push its
+// transaction. Unlike MVCCGet, it only reads the metadata of key, and doesn't
+// return an error if an intent exists. If there is no intent on key, a nil
+// intent is returned without error.
+//
+// The engine doesn't know about the status of transactions: the returned
+// intent is PENDING even if its transaction has since committed or aborted,
+// until the intent is resolved. Callers must consult the transaction record
+// to learn its status.
+func MVCCGetIntent(reader Reader, key roachpb.Key) (*roachpb.Intent, hlc.Timestamp, error) {
+	var meta enginepb.MVCCMetadata
+	ok, _, _, err := reader.GetProto(MakeMVCCMetadataKey(key), &meta)
+	if err != nil || !ok || meta.Txn == nil {
+		return nil, hlc.Timestamp{}, err
+	}
+	intent := &roachpb.Intent{
+		Span:   roachpb.Span{Key: append(roachpb.Key(nil), key...)},
+		Txn:    *meta.Txn,
+		Status: roachpb.PENDING,
+	}
+	return intent, hlc.Timestamp(meta.Timestamp), nil
+}
+
+// MVCCGetTimestamp returns the timestamp of the latest version of key visible
+// at asOf, and whether that version is a deletion tombstone, without
+// decoding its value, which makes it cheaper than MVCCGet for callers only
+// interested in the freshness of a key. If key has no version visible at
+// asOf, an empty timestamp is returned.
+//
+// As with a consistent MVCCGet, an intent visible at asOf results in a
+// WriteIntentError, and intents above asOf are ignored. Inline values have no
+// timestamp, and result in an error.
+func MVCCGetTimestamp(
+	reader Reader, key roachpb.Key, asOf hlc.Timestamp,
+) (_ hlc.Timestamp, tombstone bool, _ error) {
+	if len(key) == 0 {
+		return hlc.Timestamp{}, false, emptyKeyError()
+	}
+	iter := reader.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	metaKey := MakeMVCCMetadataKey(key)
+	iter.Seek(metaKey)
+	if ok, err := iter.Valid(); err != nil || !ok {
+		return hlc.Timestamp{}, false, err
+	}
+	if unsafeKey := iter.UnsafeKey(); !unsafeKey.IsValue() && unsafeKey.Key.Equal(key) {
+		var meta enginepb.MVCCMetadata
+		if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+			return hlc.Timestamp{}, false, err
+		}
+		if meta.IsInline() {
+			return hlc.Timestamp{}, false, errors.Errorf("key %s has an inline value without a timestamp", key)
+		}
+		if meta.Txn != nil && !asOf.Less(hlc.Timestamp(meta.Timestamp)) {
+			return hlc.Timestamp{}, false, &roachpb.WriteIntentError{
+				Intents: []roachpb.Intent{{Span: roachpb.Span{Key: key}, Status: roachpb.PENDING, Txn: *meta.Txn}},
+			}
+		}
+	}
+
+	// Versions above asOf, including the provisional value of an intent, are
+	// skipped by the seek.
+	iter.Seek(MVCCKey{Key: key, Timestamp: asOf})
+	if ok, err := iter.Valid(); err != nil || !ok {
+		return hlc.Timestamp{}, false, err
+	}
+	unsafeKey := iter.UnsafeKey()
+	if !unsafeKey.IsValue() || !unsafeKey.Key.Equal(key) {
+		return hlc.Timestamp{}, false, nil
+	}
+	return unsafeKey.Timestamp, len(iter.UnsafeValue()) == 0, nil
+}
+
+// MVCCGetResult holds the result of a single key lookup performed by
+// MVCCGetBatch. Value and Intent are as returned by MVCCGet.
+type MVCCGetResult struct {
+	Value  *roachpb.Value
+	Intent *roachpb.Intent
+}
+
+// MVCCGetBatch is like calling MVCCGet for each of the specified keys, but
+// uses a single iterator and performs the lookups in key order, which is
+// considerably cheaper than a loop of MVCCGet calls. The returned results are
+// in the same order as keys.
+//
+// In consistent mode, the intents encountered on any of the keys are returned
+// together in a single WriteIntentError once all keys have been looked up.
+func MVCCGetBatch(
+	ctx context.Context,
+	eng Reader,
+	keys []roachpb.Key,
+	timestamp hlc.Timestamp,
+	opts MVCCGetOptions,
+) ([]MVCCGetResult, error) {
+	if timestamp.WallTime < 0 {
+		return nil, errors.Errorf("cannot read at negative timestamp %s", timestamp)
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return keys[order[i]].Compare(keys[order[j]]) < 0
+	})
+
+	iter := eng.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	results := make([]MVCCGetResult, len(keys))
+	var wiErr *roachpb.WriteIntentError
+	for _, i := range order {
+		value, intent, err := iter.MVCCGet(keys[i], timestamp, opts)
+		if err != nil {
+			if tErr, ok := err.(*roachpb.WriteIntentError); ok {
+				if wiErr == nil {
+					wiErr = tErr
+				} else {
+					wiErr.Intents = append(wiErr.Intents, tErr.Intents...)
+				}
+				continue
+			}
+			return nil, err
+		}
+		results[i] = MVCCGetResult{Value: value, Intent: intent}
+	}
+	if wiErr != nil {
+		return nil, wiErr
+	}
+	return results, nil
+}
+
+// MVCCGetVersionsOptions bundles options for MVCCGetVersions.
+type MVCCGetVersionsOptions struct {
+	// MaxVersions, if positive, limits the number of versions returned, not
+	// counting the metadata record. The most recent versions are returned.
+	MaxVersions int64
+}
+
+// MVCCGetVersions returns every version of key in descending timestamp order,
+// including deletion tombstones, which have an empty value. It is intended for
+// debugging and audit tools and doesn't perform any transactional checks.
+//
+// If key has an explicit metadata record, i.e. if it is an inline value or
+// has an intent, the record is returned first. Its key has no timestamp
+// (MVCCKey.IsValue returns false) and its value is an encoded
+// enginepb.MVCCMetadata. For an intent, it is followed by the intent's
+// provisional value at the intent's timestamp, and then by the committed
+// versions.
+func MVCCGetVersions(
+	ctx context.Context, engine Reader, key roachpb.Key, opts MVCCGetVersionsOptions,
+) ([]MVCCKeyValue, error) {
+	if len(key) == 0 {
+		return nil, emptyKeyError()
+	}
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	var kvs []MVCCKeyValue
+	var versions int64
+	for iter.Seek(MakeMVCCMetadataKey(key)); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, err
+		} else if !ok || !iter.UnsafeKey().Key.Equal(key) {
+			break
+		}
+		if iter.UnsafeKey().IsValue() {
+			if opts.MaxVersions > 0 && versions == opts.MaxVersions {
+				break
+			}
+			versions++
+		}
+		kvs = append(kvs, MVCCKeyValue{Key: iter.Key(), Value: iter.Value()})
+	}
+	return kvs, nil
+}
+
+// MVCCKeyVersions holds the versions of a key, as returned by a GroupByKey
+// scan (see GroupMVCCScanResults).
+type MVCCKeyVersions struct {
+	Key    roachpb.Key
+	Values []MVCCKeyValue
+}
+
+// GroupMVCCScanResults splits the key-value pairs returned by a GroupByKey
+// scan (see MVCCScanOptions) into the versions of each of their keys, in the
+// order in which they were returned.
+func GroupMVCCScanResults(kvs []roachpb.KeyValue) []MVCCKeyVersions {
+	var res []MVCCKeyVersions
+	for _, kv := range kvs {
+		if len(res) == 0 || !res[len(res)-1].Key.Equal(kv.Key) {
+			res = append(res, MVCCKeyVersions{Key: kv.Key})
+		}
+		last := &res[len(res)-1]
+		last.Values = append(last.Values, MVCCKeyValue{
+			Key:   MVCCKey{Key: kv.Key, Timestamp: kv.Value.Timestamp},
+			Value: kv.Value.RawBytes,
+		})
+	}
+	return res
+}
+
 // mvccGetMetadata returns or reconstructs the meta key for the given key.
 // A prefix scan using the iterator is performed, resulting in one of the
 // following successful outcomes:
@@ -1072,6 +1298,12 @@ func (b *putBuffer) putMeta(
 // single row and never accumulate more than a single value. Successive
 // zero timestamp writes to a key replace the value and deletes clear
 // the value. In addition, zero timestamp values may be merged.
+//
+// The value is written as is: its checksum, if any, is neither computed nor
+// verified, so values checksummed upstream, e.g. by bulk loaders, cost nothing
+// more to write. A wrong checksum is stored as provided and reported by the
+// reads which verify checksums, such as MVCCGetProto and scans with
+// MVCCScanOptions.VerifyChecksums.
 func MVCCPut(
 	ctx context.Context,
 	eng ReadWriter,
@@ -1092,6 +1324,128 @@ func MVCCPut(
 	return mvccPutUsingIter(ctx, eng, iter, ms, key, timestamp, value, txn, nil /* valueFn */)
 }
 
+// MVCCWriteOptions bundles options for MVCCPutWithOptions,
+// MVCCDeleteWithOptions and MVCCConditionalPutWithOptions.
+type MVCCWriteOptions struct {
+	// ReturnPrevValue, if true, causes the value which was the latest version
+	// of the key as of the write's read timestamp to be returned. The value is
+	// read using the same iterator the put uses to look up the key's metadata.
+	// Only supported by MVCCPutWithOptions.
+	ReturnPrevValue bool
+	// SkipTombstoneIfAbsent, if true, causes MVCCDeleteWithOptions to not write
+	// a deletion tombstone when the key has no live value. The latest version of
+	// the key is considered regardless of its timestamp, so a live value below
+	// or above the write timestamp, or the transaction's own provisional value,
+	// is still deleted. An intent of another transaction results in a
+	// WriteIntentError, as it would for the delete itself.
+	SkipTombstoneIfAbsent bool
+	// SkipStats, if true, causes the MVCCStats argument to be ignored, skipping
+	// the incremental stats update of the write. This is intended for bulk
+	// writes, such as those of a RESTORE, which recompute the stats of the
+	// written span afterwards; a caller setting it takes responsibility for
+	// doing so.
+	SkipStats bool
+	// SingleDelete, if true, causes MVCCDeleteWithOptions to remove an inline
+	// value with a single deletion (see Writer.SingleClear) instead of a
+	// regular one. A single deletion and the value it deletes are both
+	// dropped as soon as a flush or compaction sees them together, whereas a
+	// regular deletion has to be kept until it reaches the bottom of the LSM,
+	// which makes single deletions much cheaper for keys which are written
+	// and deleted in quick succession. It is only supported for inline
+	// values, i.e. with a zero timestamp and no transaction.
+	//
+	// The caller must guarantee that the key was written exactly once since it
+	// was last deleted, by a single put which hasn't been overwritten or
+	// merged into: a single deletion only removes the most recent write of the
+	// key, so older writes would otherwise reappear, and the outcome of mixing
+	// it with other writes of the key is undefined. Misuse can't be detected
+	// and silently corrupts the key.
+	SingleDelete bool
+	// DryRun, if true, causes the write to perform all of its checks, and to
+	// return the same errors as the write would, e.g. a WriteIntentError, a
+	// WriteTooOldError or a ConditionFailedError, without writing anything. The
+	// MVCCStats argument is left untouched. This allows a batch of writes to be
+	// validated before it is performed. Note that a WriteTooOldError, which a
+	// write returns once it has been performed at a higher timestamp, doesn't
+	// imply that anything was written in dry-run mode.
+	DryRun bool
+}
+
+// dryRunWriter is a Writer which discards all writes. It implements
+// MVCCWriteOptions.DryRun.
+type dryRunWriter struct{}
+
+var _ Writer = dryRunWriter{}
+
+func (dryRunWriter) ApplyBatchRepr(repr []byte, sync bool) error                     { return nil }
+func (dryRunWriter) Clear(key MVCCKey) error                                         { return nil }
+func (dryRunWriter) SingleClear(key MVCCKey) error                                   { return nil }
+func (dryRunWriter) ClearRange(start, end MVCCKey) error                             { return nil }
+func (dryRunWriter) ClearIterRange(iter Iterator, start, end roachpb.Key) error      { return nil }
+func (dryRunWriter) Merge(key MVCCKey, value []byte) error                           { return nil }
+func (dryRunWriter) Put(key MVCCKey, value []byte) error                             { return nil }
+func (dryRunWriter) LogData(data []byte) error                                       { return nil }
+func (dryRunWriter) LogLogicalOp(op MVCCLogicalOpType, details MVCCLogicalOpDetails) {}
+
+// writerWithOptions returns the writer and the stats to be used by a write
+// with opts, which writes to w and stats to ms.
+func writerWithOptions(w Writer, ms *enginepb.MVCCStats, opts MVCCWriteOptions) (Writer, *enginepb.MVCCStats) {
+	if opts.SkipStats {
+		ms = nil
+	}
+	if opts.DryRun {
+		return dryRunWriter{}, nil
+	}
+	return w, ms
+}
+
+// MVCCPutWithOptions is like MVCCPut, but supports the options described on
+// MVCCWriteOptions. When opts.ReturnPrevValue is set, the value which was
+// visible to the write is returned, or nil if there was none (or it was a
+// deletion tombstone). For a transactional write this is the value as of the
+// transaction's read timestamp, including the transaction's own earlier
+// writes; for a non-transactional write that is pushed above an existing
+// value, it is the latest value as of the new write timestamp. Inline puts
+// return the previous inline value.
+func MVCCPutWithOptions(
+	ctx context.Context,
+	eng ReadWriter,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	value roachpb.Value,
+	txn *roachpb.Transaction,
+	opts MVCCWriteOptions,
+) (*roachpb.Value, error) {
+	w, ms := writerWithOptions(eng, ms, opts)
+	if !opts.ReturnPrevValue && !opts.DryRun {
+		return nil, MVCCPut(ctx, eng, ms, key, timestamp, value, txn)
+	}
+	if value.Timestamp != (hlc.Timestamp{}) {
+		return nil, errors.Errorf("cannot have timestamp set in value on Put")
+	}
+
+	iter := eng.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	if !opts.ReturnPrevValue {
+		return nil, mvccPutUsingIter(ctx, w, iter, ms, key, timestamp, value, txn, nil /* valueFn */)
+	}
+	var prevValue *roachpb.Value
+	valueFn := func(existVal *roachpb.Value) ([]byte, error) {
+		if existVal != nil {
+			// The value may point into the iterator's memory, which is released
+			// when the iterator is closed.
+			v := *existVal
+			v.RawBytes = append([]byte(nil), existVal.RawBytes...)
+			prevValue = &v
+		}
+		return value.RawBytes, nil
+	}
+	err := mvccPutUsingIter(ctx, w, iter, ms, key, timestamp, noValue, txn, valueFn)
+	return prevValue, err
+}
+
 // MVCCBlindPut is a fast-path of MVCCPut. See the MVCCPut comments for details
 // of the semantics. MVCCBlindPut skips retrieving the existing metadata for
 // the key requiring the caller to guarantee no versions for the key currently
@@ -1134,6 +1488,87 @@ func MVCCDelete(
 	return mvccPutUsingIter(ctx, engine, iter, ms, key, timestamp, noValue, txn, nil /* valueFn */)
 }
 
+// MVCCDeleteWithOptions is like MVCCDelete, but supports the options described
+// on MVCCWriteOptions. It returns whether a deletion tombstone was written,
+// which is always the case unless opts.SkipTombstoneIfAbsent is set. With
+// opts.SingleDelete, it returns whether an inline value was deleted.
+func MVCCDeleteWithOptions(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	txn *roachpb.Transaction,
+	opts MVCCWriteOptions,
+) (bool, error) {
+	if opts.ReturnPrevValue {
+		return false, errors.Errorf("ReturnPrevValue is not supported by MVCCDeleteWithOptions")
+	}
+	w, ms := writerWithOptions(engine, ms, opts)
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	if opts.SkipTombstoneIfAbsent {
+		// Read the latest version at any timestamp: a delete below a newer live
+		// value is pushed above it, and must not be skipped.
+		existVal, _, err := iter.MVCCGet(key, hlc.MaxTimestamp, MVCCGetOptions{Txn: txn})
+		if err != nil {
+			return false, err
+		}
+		if existVal == nil {
+			return false, nil
+		}
+	}
+	if opts.SingleDelete {
+		return mvccSingleDeleteInline(ctx, w, iter, ms, key, timestamp, txn)
+	}
+	err := mvccPutUsingIter(ctx, w, iter, ms, key, timestamp, noValue, txn, nil /* valueFn */)
+	if _, ok := err.(*roachpb.WriteTooOldError); ok {
+		// The tombstone was written at a higher timestamp.
+		return true, err
+	}
+	return err == nil, err
+}
+
+// mvccSingleDeleteInline implements MVCCWriteOptions.SingleDelete. It returns
+// whether a value was deleted.
+func mvccSingleDeleteInline(
+	ctx context.Context,
+	engine Writer,
+	iter Iterator,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	txn *roachpb.Transaction,
+) (bool, error) {
+	if len(key) == 0 {
+		return false, emptyKeyError()
+	}
+	metaKey := MakeMVCCMetadataKey(key)
+	if timestamp != (hlc.Timestamp{}) || txn != nil {
+		return false, errors.Errorf("%q: single deletes are only supported for inline values", metaKey)
+	}
+	var meta enginepb.MVCCMetadata
+	ok, origMetaKeySize, origMetaValSize, err := mvccGetMetadata(iter, metaKey, &meta)
+	if err != nil || !ok {
+		return false, err
+	}
+	if !meta.IsInline() {
+		return false, errors.Errorf("%q: single delete of a non-inline value", metaKey)
+	}
+	if err := engine.SingleClear(metaKey); err != nil {
+		return false, err
+	}
+	if ms != nil {
+		updateStatsForInline(ms, key, origMetaKeySize, origMetaValSize, 0, 0)
+	}
+	engine.LogLogicalOp(MVCCWriteValueOpType, MVCCLogicalOpDetails{
+		Key:  key,
+		Safe: true,
+	})
+	return true, nil
+}
+
 var noValue = roachpb.Value{}
 
 // mvccPutUsingIter sets the value for a specified key using the provided
@@ -1673,7 +2108,19 @@ func MVCCIncrement(
 ) (int64, error) {
 	iter := engine.NewIterator(IterOptions{Prefix: true})
 	defer iter.Close()
+	return mvccIncrementUsingIter(ctx, engine, iter, ms, key, timestamp, txn, inc)
+}
 
+func mvccIncrementUsingIter(
+	ctx context.Context,
+	engine Writer,
+	iter Iterator,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	txn *roachpb.Transaction,
+	inc int64,
+) (int64, error) {
 	var int64Val int64
 	var newInt64Val int64
 	err := mvccPutUsingIter(ctx, engine, iter, ms, key, timestamp, noValue, txn, func(value *roachpb.Value) ([]byte, error) {
@@ -1705,16 +2152,125 @@ func MVCCIncrement(
 	return newInt64Val, err
 }
 
-// CPutMissingBehavior describes the handling a non-existing expected value.
-type CPutMissingBehavior bool
+// MVCCIncrementBatch is like calling MVCCIncrement for each of the keys of
+// deltas, incrementing it by its delta, but uses a single iterator and
+// performs the increments in key order, which is considerably cheaper than a
+// loop of MVCCIncrement calls. The new values are returned by key. The values
+// are stored with the same integer encoding as MVCCIncrement.
+//
+// The increments are written to rw, which should be a batch for them to be
+// applied atomically. If an increment fails, e.g. with an
+// IntegerOverflowError, the error is returned and the batch must be
+// discarded. A WriteTooOldError for any of the keys doesn't prevent the other
+// increments: it is returned once all of them have been performed, along with
+// the new values, and holds the highest timestamp the keys were written at.
+func MVCCIncrementBatch(
+	ctx context.Context,
+	rw ReadWriter,
+	ms *enginepb.MVCCStats,
+	timestamp hlc.Timestamp,
+	txn *roachpb.Transaction,
+	deltas map[string]int64,
+) (map[string]int64, error) {
+	keys := make([]string, 0, len(deltas))
+	for key := range deltas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	iter := rw.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	results := make(map[string]int64, len(deltas))
+	var wtoErr *roachpb.WriteTooOldError
+	for _, key := range keys {
+		newVal, err := mvccIncrementUsingIter(
+			ctx, rw, iter, ms, roachpb.Key(key), timestamp, txn, deltas[key])
+		if err != nil {
+			if tErr, ok := err.(*roachpb.WriteTooOldError); ok {
+				if wtoErr == nil {
+					wtoErr = tErr
+				} else {
+					wtoErr.ActualTimestamp.Forward(tErr.ActualTimestamp)
+				}
+			} else {
+				return nil, err
+			}
+		}
+		results[key] = newVal
+	}
+	if wtoErr != nil {
+		return results, wtoErr
+	}
+	return results, nil
+}
+
+// MVCCIncrementWithBounds is like MVCCIncrement, but clamps the incremented
+// value into [min, max] before storing it. It returns the new value, and
+// whether it was clamped. An increment which would overflow an int64 is
+// clamped as well instead of returning an IntegerOverflowError. The value is
+// stored with the same integer encoding as MVCCIncrement.
+func MVCCIncrementWithBounds(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	txn *roachpb.Transaction,
+	inc, min, max int64,
+) (newInt64Val int64, clamped bool, _ error) {
+	if min > max {
+		return 0, false, errors.Errorf("invalid bounds [%d, %d]", min, max)
+	}
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	err := mvccPutUsingIter(ctx, engine, iter, ms, key, timestamp, noValue, txn, func(value *roachpb.Value) ([]byte, error) {
+		var int64Val int64
+		if value.IsPresent() {
+			var err error
+			if int64Val, err = value.GetInt(); err != nil {
+				return nil, errors.Errorf("key %q does not contain an integer value", key)
+			}
+		}
+
+		switch {
+		case willOverflow(int64Val, inc) && inc > 0:
+			newInt64Val, clamped = max, true
+		case willOverflow(int64Val, inc):
+			newInt64Val, clamped = min, true
+		case int64Val+inc > max:
+			newInt64Val, clamped = max, true
+		case int64Val+inc < min:
+			newInt64Val, clamped = min, true
+		default:
+			newInt64Val = int64Val + inc
+		}
+
+		newValue := roachpb.Value{}
+		newValue.SetInt(newInt64Val)
+		newValue.InitChecksum(key)
+		return newValue.RawBytes, nil
+	})
+	return newInt64Val, clamped, err
+}
+
+// CPutMissingBehavior describes the handling a non-existing expected value. A
+// key which has never been written and a key whose latest value is a deletion
+// tombstone are both considered to not exist.
+type CPutMissingBehavior int
 
 const (
-	// CPutAllowIfMissing is used to indicate a CPut can also succeed when the
-	// expected entry does not exist.
-	CPutAllowIfMissing CPutMissingBehavior = true
 	// CPutFailIfMissing is used to indicate the existing value must match the
 	// expected value exactly i.e. if a value is expected, it must exist.
-	CPutFailIfMissing CPutMissingBehavior = false
+	CPutFailIfMissing CPutMissingBehavior = iota
+	// CPutAllowIfMissing is used to indicate a CPut can also succeed when the
+	// expected entry does not exist.
+	CPutAllowIfMissing
+	// CPutRequireMissing is used to indicate a CPut must only succeed when the
+	// entry does not exist. The expected value is ignored. This is useful for
+	// idempotent upserts which treat a deleted key as absent.
+	CPutRequireMissing
 )
 
 // MVCCConditionalPut sets the value for a specified key only if the
@@ -1744,6 +2300,32 @@ func MVCCConditionalPut(
 	return mvccConditionalPutUsingIter(ctx, engine, iter, ms, key, timestamp, value, expVal, allowIfDoesNotExist, txn)
 }
 
+// MVCCConditionalPutWithOptions is like MVCCConditionalPut, but supports the
+// SkipStats and DryRun options described on MVCCWriteOptions. With
+// opts.DryRun, it returns the ConditionFailedError the conditional put would
+// return, if any, without writing anything.
+func MVCCConditionalPutWithOptions(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	value roachpb.Value,
+	expVal *roachpb.Value,
+	allowIfDoesNotExist CPutMissingBehavior,
+	txn *roachpb.Transaction,
+	opts MVCCWriteOptions,
+) error {
+	if opts.ReturnPrevValue || opts.SkipTombstoneIfAbsent || opts.SingleDelete {
+		return errors.Errorf("only the SkipStats and DryRun options are supported by MVCCConditionalPutWithOptions")
+	}
+	w, ms := writerWithOptions(engine, ms, opts)
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	return mvccConditionalPutUsingIter(ctx, w, iter, ms, key, timestamp, value, expVal, allowIfDoesNotExist, txn)
+}
+
 // MVCCBlindConditionalPut is a fast-path of MVCCConditionalPut. See the
 // MVCCConditionalPut comments for details of the
 // semantics. MVCCBlindConditionalPut skips retrieving the existing metadata
@@ -1782,14 +2364,19 @@ func mvccConditionalPutUsingIter(
 	return mvccPutUsingIter(
 		ctx, engine, iter, ms, key, timestamp, noValue, txn,
 		func(existVal *roachpb.Value) ([]byte, error) {
-			if expValPresent, existValPresent := expVal != nil, existVal.IsPresent(); expValPresent && existValPresent {
+			var ok bool
+			switch expValPresent, existValPresent := expVal != nil, existVal.IsPresent(); {
+			case allowNoExisting == CPutRequireMissing:
+				ok = !existValPresent
+			case expValPresent && existValPresent:
 				// Every type flows through here, so we can't use the typed getters.
-				if !expVal.EqualData(*existVal) {
-					return nil, &roachpb.ConditionFailedError{
-						ActualValue: existVal.ShallowClone(),
-					}
-				}
-			} else if expValPresent != existValPresent && (existValPresent || !bool(allowNoExisting)) {
+				ok = expVal.EqualData(*existVal)
+			case expValPresent:
+				ok = allowNoExisting == CPutAllowIfMissing
+			default:
+				ok = !existValPresent
+			}
+			if !ok {
 				return nil, &roachpb.ConditionFailedError{
 					ActualValue: existVal.ShallowClone(),
 				}
@@ -1822,6 +2409,45 @@ func MVCCInitPut(
 	return mvccInitPutUsingIter(ctx, engine, iter, ms, key, timestamp, value, failOnTombstones, txn)
 }
 
+// MVCCInitPutIdempotent is like MVCCInitPut, but it is idempotent for retries
+// of non-transactional writes: it succeeds whenever the newest committed
+// value of the key is equal to value, even if that version is at or above
+// timestamp, which would fail MVCCInitPut with a WriteTooOldError. If
+// bumpTimestamp is set and the equal version is below timestamp, the value is
+// rewritten at timestamp, keeping the key fresh; otherwise nothing is written.
+// Differing values fail with a ConditionFailedError, as for MVCCInitPut.
+//
+// Transactional writes, and writes to keys with intents, behave exactly like
+// MVCCInitPut.
+func MVCCInitPutIdempotent(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	key roachpb.Key,
+	timestamp hlc.Timestamp,
+	value roachpb.Value,
+	failOnTombstones bool,
+	bumpTimestamp bool,
+	txn *roachpb.Transaction,
+) error {
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+	if txn == nil {
+		existVal, intent, err := iter.MVCCGet(key, hlc.MaxTimestamp, MVCCGetOptions{
+			Inconsistent: true,
+			Tombstones:   true,
+		})
+		if err != nil {
+			return err
+		}
+		if intent == nil && existVal.IsPresent() && existVal.EqualData(value) &&
+			(!bumpTimestamp || !existVal.Timestamp.Less(timestamp)) {
+			return nil
+		}
+	}
+	return mvccInitPutUsingIter(ctx, engine, iter, ms, key, timestamp, value, failOnTombstones, txn)
+}
+
 // MVCCBlindInitPut is a fast-path of MVCCInitPut. See the MVCCInitPut
 // comments for details of the semantics. MVCCBlindInitPut skips
 // retrieving the existing metadata for the key requiring the caller
@@ -1933,6 +2559,13 @@ func MVCCMerge(
 // which have timestamps in the span (startTime, endTime]. This can have the
 // apparent effect of "reverting" the range to startTime if all of the older
 // revisions of cleared keys are still available (i.e. have not been GC'ed).
+// A key all of whose versions are cleared is removed entirely.
+//
+// This is destructive: the versions are cleared rather than shadowed by
+// deletion tombstones, so they are lost to reads at any timestamp, including
+// historical reads at or above startTime which have already been served. It
+// must only be used on spans which are not receiving writes in the time span,
+// and fails with a WriteIntentError if it encounters an intent in it.
 //
 // Long runs of keys that all qualify for clearing will be cleared via a single
 // clear-range operation. Once maxBatchSize Clear and ClearRange operations are
@@ -1941,10 +2574,9 @@ func MVCCMerge(
 // buffer of keys selected for deletion but not yet flushed (as done to detect
 // long runs for cleaning in a single ClearRange).
 //
-// This function does not handle the stats computations to determine the correct
-// incremental deltas of clearing these keys (and correctly determining if it
-// does or not not change the live and gc keys) so the caller is responsible for
-// recomputing stats over the resulting span if needed.
+// If ms is non-nil, it is updated with the stats delta of the clears, taking
+// into account the older revisions which become the latest version of their
+// keys.
 func MVCCClearTimeRange(
 	ctx context.Context,
 	batch ReadWriter,
@@ -2111,9 +2743,13 @@ func MVCCClearTimeRange(
 }
 
 // MVCCDeleteRange deletes the range of key/value pairs specified by start and
-// end keys. It returns the range of keys deleted when returnedKeys is set,
+// end keys. It returns the range of keys deleted when returnKeys is set,
 // the next span to resume from, and the number of keys deleted.
 // The returned resume span is nil if max keys aren't processed.
+//
+// The returned keys are exactly the keys which were written a deletion
+// tombstone, in ascending order: at most max of them, with the resume span
+// starting after the last one. No keys are returned if an error occurs.
 func MVCCDeleteRange(
 	ctx context.Context,
 	engine ReadWriter,
@@ -2168,6 +2804,65 @@ func MVCCDeleteRange(
 	return keys, resumeSpan, int64(len(kvs)), err
 }
 
+// errPredicateDeleteRangeLimit is used to stop the scan performed by
+// MVCCPredicateDeleteRange once maxBatchBytes is reached.
+var errPredicateDeleteRangeLimit = errors.New("predicate delete range limit reached")
+
+// MVCCPredicateDeleteRange deletes the keys in the range [key, endKey) whose
+// most recent value satisfies the supplied predicate, by writing deletion
+// tombstones at the specified timestamp. The predicate is invoked with the
+// MVCC key (including the timestamp of the version) and the raw value bytes of
+// the latest version of each live key; deleted keys are not passed to it.
+//
+// No more than maxBatchBytes worth of tombstones are written by a single call.
+// Once that limit is reached, the remaining part of the range is returned as
+// a resume span. A maxBatchBytes of zero means no limit. Like MVCCDeleteRange,
+// the versions inspected are not limited by timestamp, so that newer writes
+// result in a WriteTooOldError and intents result in a WriteIntentError.
+func MVCCPredicateDeleteRange(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	key, endKey roachpb.Key,
+	timestamp hlc.Timestamp,
+	predicate func(MVCCKey, []byte) (bool, error),
+	maxBatchBytes int64,
+) (*roachpb.Span, error) {
+	var matches []roachpb.Key
+	var batchBytes int64
+	var resumeSpan *roachpb.Span
+	_, _, err := MVCCScanCallback(
+		ctx, engine, key, endKey, math.MaxInt64, hlc.MaxTimestamp, MVCCScanOptions{},
+		func(k MVCCKey, v []byte) error {
+			if maxBatchBytes > 0 && batchBytes >= maxBatchBytes {
+				resumeSpan = &roachpb.Span{Key: append(roachpb.Key(nil), k.Key...), EndKey: endKey}
+				return errPredicateDeleteRangeLimit
+			}
+			ok, err := predicate(k, v)
+			if err != nil || !ok {
+				return err
+			}
+			matches = append(matches, append(roachpb.Key(nil), k.Key...))
+			batchBytes += int64(len(k.Key)) + MVCCVersionTimestampSize
+			return nil
+		})
+	if err != nil && err != errPredicateDeleteRangeLimit {
+		return nil, err
+	}
+
+	buf := newPutBuffer()
+	defer buf.release()
+	iter := engine.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+
+	for _, k := range matches {
+		if err := mvccPutInternal(ctx, engine, iter, ms, k, timestamp, nil, nil, buf, nil); err != nil {
+			return nil, err
+		}
+	}
+	return resumeSpan, nil
+}
+
 // mvccScanToKvs converts the raw key/value pairs returned by Iterator.MVCCScan
 // into a slice of roachpb.KeyValues.
 func mvccScanToKvs(
@@ -2182,23 +2877,145 @@ func mvccScanToKvs(
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	kvs, err := mvccScanDecodeKvs(kvData, numKVs, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return kvs, resumeSpan, intents, nil
+}
+
+// mvccScanDecodeKvs decodes the numKVs key-value pairs of kvData, as returned
+// by Iterator.MVCCScan, verifying and transforming their values as requested
+// by opts.
+func mvccScanDecodeKvs(
+	kvData [][]byte, numKVs int64, opts MVCCScanOptions,
+) ([]roachpb.KeyValue, error) {
 	kvs := make([]roachpb.KeyValue, numKVs)
 	var k MVCCKey
 	var rawBytes []byte
 	var i int
+	var err error
 	for _, data := range kvData {
 		for len(data) > 0 {
 			k, rawBytes, data, err = MVCCScanDecodeKeyValue(data)
 			if err != nil {
-				return nil, nil, nil, err
+				return nil, err
 			}
 			kvs[i].Key = k.Key
 			kvs[i].Value.RawBytes = rawBytes
 			kvs[i].Value.Timestamp = k.Timestamp
+			if opts.VerifyChecksums {
+				if err := kvs[i].Value.Verify(k.Key); err != nil {
+					return nil, err
+				}
+			}
+			if opts.ValueTransform != nil {
+				rawBytes, err = opts.ValueTransform(k, rawBytes)
+				if err == ErrDropKey {
+					continue
+				} else if err != nil {
+					return nil, err
+				}
+				kvs[i].Value.RawBytes = rawBytes
+			}
 			i++
 		}
 	}
-	return kvs, resumeSpan, intents, err
+	return kvs[:i], nil
+}
+
+// ErrDropKey is returned by MVCCScanOptions.ValueTransform to omit a
+// key-value pair from the results of a scan.
+var ErrDropKey = errors.New("drop key")
+
+// mvccScanTransformValues applies transform to the values in kvData, the
+// encoded result of a scan, and returns the transformed result and the number
+// of pairs in it. See MVCCScanOptions.ValueTransform.
+func mvccScanTransformValues(
+	kvData [][]byte, transform func(MVCCKey, []byte) ([]byte, error),
+) ([][]byte, int64, error) {
+	var results pebbleResults
+	var keyBuf []byte
+	for _, data := range kvData {
+		for len(data) > 0 {
+			k, rawBytes, rest, err := MVCCScanDecodeKeyValue(data)
+			if err != nil {
+				return nil, 0, err
+			}
+			data = rest
+			value, err := transform(k, rawBytes)
+			if err == ErrDropKey {
+				continue
+			} else if err != nil {
+				return nil, 0, err
+			}
+			keyBuf = EncodeKeyToBuf(keyBuf[:0], k)
+			results.put(keyBuf, value)
+		}
+	}
+	return results.finish(), results.count, nil
+}
+
+// mvccScanVerifyChecksums verifies the checksums of the values in kvData, the
+// encoded result of a scan. See MVCCScanOptions.VerifyChecksums.
+func mvccScanVerifyChecksums(kvData [][]byte) error {
+	for _, data := range kvData {
+		for len(data) > 0 {
+			k, rawBytes, rest, err := MVCCScanDecodeKeyValue(data)
+			if err != nil {
+				return err
+			}
+			value := roachpb.Value{RawBytes: rawBytes}
+			if err := value.Verify(k.Key); err != nil {
+				return err
+			}
+			data = rest
+		}
+	}
+	return nil
+}
+
+// mvccScanIntents implements MVCCScanOptions.IntentsOnly on top of iter. Only
+// metadata keys are read: after each key, the iterator seeks straight to the
+// metadata key of the next possible user key, skipping all of the versions of
+// the current key without reading their values.
+func mvccScanIntents(
+	iter Iterator, start, end roachpb.Key, max int64, opts MVCCScanOptions,
+) (*roachpb.Span, []roachpb.Intent, error) {
+	if opts.Reverse {
+		return nil, nil, errors.Errorf("intents-only scans cannot be reversed")
+	}
+	var intents []roachpb.Intent
+	var meta enginepb.MVCCMetadata
+	iter.Seek(MakeMVCCMetadataKey(start))
+	for {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			return nil, intents, nil
+		}
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.Key.Compare(end) >= 0 {
+			return nil, intents, nil
+		}
+		if !unsafeKey.IsValue() {
+			if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+				return nil, nil, err
+			}
+			if meta.Txn != nil {
+				key := append(roachpb.Key(nil), unsafeKey.Key...)
+				if int64(len(intents)) == max {
+					return &roachpb.Span{Key: key, EndKey: end}, intents, nil
+				}
+				intents = append(intents, roachpb.Intent{
+					Span:   roachpb.Span{Key: key},
+					Status: roachpb.PENDING,
+					Txn:    *meta.Txn,
+				})
+			}
+		}
+		iter.Seek(MakeMVCCMetadataKey(unsafeKey.Key.Next()))
+	}
 }
 
 func buildScanIntents(data []byte) ([]roachpb.Intent, error) {
@@ -2248,13 +3065,279 @@ type MVCCScanOptions struct {
 	IgnoreSequence bool
 	Reverse        bool
 	Txn            *roachpb.Transaction
+	// TargetBytes, if positive, stops the scan once the key and value bytes
+	// returned reach or exceed it, in addition to the max parameter. The
+	// key-value pair crossing the target is returned in full, so a scan always
+	// makes progress and never returns a partial pair. A resume span is
+	// returned if the scan is stopped by this limit.
+	TargetBytes int64
+	// MinTimestamp, if set, restricts the scan to keys whose most recent
+	// version at or below the scan timestamp is newer than MinTimestamp. Keys
+	// whose visible version is at or below MinTimestamp are skipped entirely,
+	// as are inline values, which have no timestamp. Intents are surfaced as
+	// usual regardless of their timestamp.
+	MinTimestamp hlc.Timestamp
+	// Prefix, if set, declares that the scan is restricted to keys starting
+	// with Prefix, and the scan span [key, endKey) must be contained within
+	// [Prefix, Prefix.PrefixEnd()); an error is returned otherwise. The bloom
+	// filters of both storage engines are built over complete user keys, so they
+	// can only be consulted when Prefix is itself the scanned key, i.e. for
+	// forward scans of [Prefix, Prefix.Next()). Such scans use a prefix iterator
+	// (see IterOptions.Prefix) which skips sstables not containing the key.
+	Prefix roachpb.Key
+	// IntentsOnly, if set, makes the scan return only the intents in the span,
+	// regardless of their timestamp, with max limiting the number of intents
+	// returned. No key-value pairs are returned, no WriteIntentError is raised
+	// for the intents found, and committed values are never read: the scan
+	// seeks from one metadata key to the next. Reverse scans are not supported.
+	IntentsOnly bool
+	// VerifyChecksums, if set, verifies the checksum of every returned value
+	// (see roachpb.Value.Verify), failing the scan with an error naming the
+	// offending key on the first corrupt value. Values without a checksum are
+	// returned as is.
+	VerifyChecksums bool
+	// StopAtFirstIntent, if set, makes a consistent MVCCScan stop at the first
+	// conflicting intent in scan order instead of failing with a
+	// WriteIntentError. The key-value pairs preceding the intent are returned
+	// along with the intent, in place of the inconsistent intents, and a
+	// resume span starting at the intent. The pairs are exactly the prefix of
+	// the result of a scan without the intent. It cannot be combined with
+	// Inconsistent.
+	StopAtFirstIntent bool
+	// MaxIntents, if positive, makes a consistent MVCCScan return the conflicting
+	// intents it runs into, along with the committed key-value pairs, instead
+	// of failing with a WriteIntentError, as long as there are at most
+	// MaxIntents of them. The keys of the intents are omitted from the
+	// key-value pairs, which are otherwise those of a scan without the intents,
+	// and the intents are returned in scan order. Past MaxIntents, the scan
+	// fails with a WriteIntentError holding the first MaxIntents intents, so
+	// that the caller can resolve them in a batch before retrying. The max
+	// parameter and TargetBytes limit the key-value pairs as usual, intents not
+	// counting towards them; when the scan stops, only the intents preceding
+	// the resume span are returned. It is only supported by MVCCScan and
+	// cannot be combined with Inconsistent or StopAtFirstIntent.
+	MaxIntents int
+	// ColumnFamilyIDs, if set, restricts the scan to the keys of the given
+	// column families of the rows of SQL tables, as identified by the family
+	// suffix appended by keys.MakeFamilyKey. Keys of other families are
+	// skipped by the engine, along with their intents, and don't count towards
+	// max or TargetBytes. Keys other than table keys, and table keys ending in
+	// something other than a family suffix, are returned regardless. Since
+	// secondary index keys carry the suffix of family 0, the option should
+	// only be used to scan primary indexes. It is ignored by IntentsOnly scans.
+	ColumnFamilyIDs []uint32
+	// KeysOnly, if set, returns the keys found by the scan with empty values,
+	// e.g. for counting rows or checking for their existence. The scan still
+	// visits the same versions as it otherwise would, but doesn't copy their
+	// values into the results, which makes wide values cheap to skip. Neither
+	// engine stores values apart from keys, so they are still read from disk.
+	// TargetBytes only counts the returned keys. When combined with
+	// Tombstones, deleted keys can't be told apart from the others.
+	KeysOnly bool
+	// GCThreshold, if set, is the GC threshold of the range being scanned.
+	// Versions at or below it may have been garbage collected, so a scan at a
+	// timestamp at or below it fails with a BatchTimestampBeforeGCError instead
+	// of returning data which may be incomplete. This matches the check the
+	// replica performs on the timestamps of incoming batches.
+	GCThreshold hlc.Timestamp
+	// Trace, if set, records the milestones of MVCCScan and MVCCScanToBytes
+	// scans as events of the tracing span of their context, if it is
+	// recording: the opening of the iterator, the first key returned, the
+	// number of keys and bytes returned every 1000 keys, and the completion of
+	// the scan. Scans of RocksDB engines only record the opening and the
+	// completion, since their keys are collected by C++ code. Scans which
+	// aren't traced don't bear any of the cost.
+	Trace bool
+	// MaxVersionsPerKey, if positive, bounds the number of versions of a key
+	// which the scanner steps over one at a time, whether looking for the
+	// version visible at the scan timestamp or moving past the older ones to
+	// the next key. Past the bound, the scanner seeks instead, which costs
+	// more for a few versions but doesn't depend on their number, so keys
+	// with long histories don't make the scan read all of them. The visible
+	// version of every key is still returned, so the results are unchanged.
+	// The scanners otherwise adapt the bound between 1 and 10 versions.
+	MaxVersionsPerKey int
+	// ValueTransform, if set, is applied to the value of every key-value pair
+	// returned by MVCCScan and MVCCScanToBytes (and thus MVCCScanToBatchRepr),
+	// or passed to the callback of MVCCScanCallback, including the empty
+	// values of tombstones and of KeysOnly scans, e.g. to redact sensitive
+	// data before it leaves the engine layer. The pair is returned with the
+	// value returned by the transform, which may modify val in place but must
+	// not retain it, or is omitted from the results if the transform returns
+	// ErrDropKey. Any other error fails the scan. Omitted pairs still count
+	// towards max and TargetBytes, so the resume span is unaffected. When
+	// combined with VerifyChecksums, checksums are verified before the
+	// transform.
+	//
+	// The transform runs on the results of the scan once it is complete, so
+	// it costs a pass over them in Go on top of the scan, and a call per
+	// value. MVCCScanToBytes otherwise returns the buffers filled in by the
+	// engine as is; with a transform, the pairs are copied into new buffers.
+	ValueTransform func(key MVCCKey, val []byte) ([]byte, error)
+	// AllVersionsDescending, if set, makes MVCCScan return every version of
+	// the keys of the span at or below the scan timestamp, including deletion
+	// tombstones, which have empty values, in descending timestamp order
+	// across all of the keys, e.g. to build an audit timeline of a key or of a
+	// small span. Versions with equal timestamps are ordered by key. This
+	// differs from Reverse, which reverses the order of the keys and returns
+	// the visible version of each of them. The returned values carry the
+	// timestamps of their versions. Inline values have no timestamp and are
+	// skipped. Intents at or below the scan timestamp result in a
+	// WriteIntentError for consistent scans, or are returned for inconsistent
+	// ones, without their provisional values.
+	//
+	// The max parameter, which must be positive, limits the number of versions
+	// returned, which are the newest ones. As the order isn't that of the
+	// keys, no resume span is
+	// returned: to continue the scan, set TimeWindow.Hi to the timestamp of
+	// the last version returned, and skip the versions returned before at that
+	// timestamp, which are those of the keys up to the last one returned. The
+	// whole span is read regardless of max, so it should be small. It cannot
+	// be combined with Reverse, Txn, IntentsOnly, StopAtFirstIntent,
+	// MaxIntents, MinTimestamp or TargetBytes, and is only supported by
+	// MVCCScan.
+	AllVersionsDescending bool
+	// TimeWindow, if set, restricts the versions returned by an
+	// AllVersionsDescending scan to the given time window.
+	TimeWindow MVCCTimeWindow
+	// GroupByKey, if set, makes MVCCScan return every version of the keys of
+	// the span at or below the scan timestamp, including deletion tombstones,
+	// which have empty values, grouped by key, e.g. for history or diff views.
+	// The keys are in ascending order and the versions of each key in
+	// descending timestamp order; GroupMVCCScanResults splits the results into
+	// the versions of each key. The returned values carry the timestamps of
+	// their versions. Inline values and intents are handled as by
+	// AllVersionsDescending scans.
+	//
+	// The max parameter counts whole keys rather than versions: at most max
+	// keys are returned, with all of their versions, and the resume span
+	// starts at the next key. As for other scans, a max of zero returns no
+	// keys and a resume span covering the whole span. It cannot be combined
+	// with Reverse, Txn, IntentsOnly, StopAtFirstIntent, MaxIntents,
+	// MinTimestamp, TargetBytes, AllVersionsDescending or TimeWindow, and is
+	// only supported by MVCCScan.
+	GroupByKey bool
+
+	// trace is set for scans which are being traced. See Trace.
+	trace *mvccScanTrace
+}
+
+// MVCCTimeWindow is the time window [Lo, Hi] of an AllVersionsDescending scan
+// (see MVCCScanOptions). Both bounds are inclusive. A zero Lo doesn't
+// restrict the versions returned, and neither does a zero Hi, in which case
+// versions are returned up to the scan timestamp. Versions above the scan
+// timestamp are never returned.
+type MVCCTimeWindow struct {
+	Lo, Hi hlc.Timestamp
+}
+
+// columnFamilySuffixes returns the suffixes appended to the keys of the given
+// column families by keys.MakeFamilyKey, or nil if ids is empty.
+func columnFamilySuffixes(ids []uint32) [][]byte {
+	if len(ids) == 0 {
+		return nil
+	}
+	suffixes := make([][]byte, len(ids))
+	for i, id := range ids {
+		suffixes[i] = keys.MakeFamilyKey(nil, id)
+	}
+	return suffixes
+}
+
+// encodeColumnFamilySuffixes encodes the suffixes of the given column
+// families for the C++ scanner: each suffix is preceded by its length.
+func encodeColumnFamilySuffixes(ids []uint32) []byte {
+	var buf []byte
+	for _, suffix := range columnFamilySuffixes(ids) {
+		buf = append(buf, byte(len(suffix)))
+		buf = append(buf, suffix...)
+	}
+	return buf
+}
+
+// wantColumnFamily returns whether a scan restricted to the column families
+// with the given suffixes should return key. See
+// MVCCScanOptions.ColumnFamilyIDs. Mirrors mvccScanner::wantFamily in
+// libroach.
+func wantColumnFamily(key []byte, suffixes [][]byte) bool {
+	if len(suffixes) == 0 || len(key) == 0 || encoding.PeekType(key) != encoding.Int {
+		return true
+	}
+	// The last byte of a family key holds the length of the encoded family ID
+	// preceding it, as a single-byte uvarint.
+	_, familyLen, err := encoding.DecodeUvarintAscending(key[len(key)-1:])
+	if err != nil || familyLen > 9 || int(familyLen)+1 >= len(key) {
+		return true
+	}
+	suffix := key[len(key)-int(familyLen)-1:]
+	for _, s := range suffixes {
+		if bytes.Equal(suffix, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// mvccScanIterOptions returns the options for the iterator used to scan
+// [key, endKey) at timestamp, validating opts.GCThreshold and opts.Prefix if
+// set.
+func mvccScanIterOptions(
+	key, endKey roachpb.Key, timestamp hlc.Timestamp, opts MVCCScanOptions,
+) (IterOptions, error) {
+	if opts.GCThreshold != (hlc.Timestamp{}) && !opts.GCThreshold.Less(timestamp) {
+		return IterOptions{}, &roachpb.BatchTimestampBeforeGCError{
+			Timestamp: timestamp,
+			Threshold: opts.GCThreshold,
+		}
+	}
+	iterOpts := IterOptions{LowerBound: key, UpperBound: endKey}
+	if opts.Prefix == nil {
+		return iterOpts, nil
+	}
+	if key.Compare(opts.Prefix) < 0 || endKey.Compare(opts.Prefix.PrefixEnd()) > 0 {
+		return IterOptions{}, errors.Errorf(
+			"scan span [%s,%s) is not contained in prefix %s", key, endKey, opts.Prefix)
+	}
+	iterOpts.Prefix = !opts.Reverse && key.Equal(opts.Prefix) && endKey.Equal(opts.Prefix.Next())
+	return iterOpts, nil
+}
+
+// MVCCScanResult groups the values returned by MVCCScanToBytes.
+type MVCCScanResult struct {
+	// KVData holds the returned key-value pairs encoded in the format accepted
+	// by MVCCScanDecodeKeyValue.
+	KVData [][]byte
+	// NumKeys is the number of key-value pairs in KVData.
+	NumKeys int64
+	// NumBytes is the sum of the encoded key and value sizes in KVData.
+	NumBytes int64
+	// ResumeSpan is non-nil if the scan stopped because of max or TargetBytes.
+	// It covers exactly the part of the scanned span that was not returned:
+	// [resumeKey, endKey) for forward scans and [key, resumeKey.Next()) for
+	// reverse scans, where resumeKey is the next key that would have been
+	// returned. Re-issuing the scan over it yields the remaining keys without
+	// duplicates or gaps.
+	ResumeSpan *roachpb.Span
+	// Intents holds the encountered intents for inconsistent scans.
+	Intents []roachpb.Intent
+	// KeysOnly is set if the scan was a MVCCScanOptions.KeysOnly scan, in
+	// which case all values in KVData are empty.
+	KeysOnly bool
 }
 
 // MVCCScan scans the key range [key, endKey) in the provided engine up to some
-// maximum number of results in ascending order. If it hits max, it returns a
-// "resume span" to be used in the next call to this function. If the limit is
-// not hit, the resume span will be nil. Otherwise, it will be the sub-span of
-// [key, endKey) that has not been scanned.
+// maximum number of results in ascending order. If it hits max (or
+// opts.TargetBytes), it returns a "resume span" to be used in the next call to
+// this function. If the limit is not hit, the resume span will be nil.
+// Otherwise, it will be the sub-span of [key, endKey) that has not been
+// scanned.
+//
+// If opts.Reverse is set, the scan returns keys in descending order. The span
+// scanned is still [key, endKey), so endKey is an exclusive bound in both
+// directions: to continue a reverse scan strictly below a key K that has
+// already been returned, pass K as endKey rather than appending a zero byte to
+// it. The resume span of a reverse scan is [key, nextKey.Next()), where nextKey
+// is the first key that was not returned; it can be passed back verbatim.
 //
 // For an unbounded scan, specify a max of MaxInt64. A max of zero means to
 // return no keys at all, which is probably not what you intend.
@@ -2289,113 +3372,855 @@ func MVCCScan(
 	timestamp hlc.Timestamp,
 	opts MVCCScanOptions,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
-	iter := engine.NewIterator(IterOptions{LowerBound: key, UpperBound: endKey})
+	iterOpts, err := mvccScanIterOptions(key, endKey, timestamp, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	trace := newMVCCScanTrace(ctx, key, endKey, opts)
+	iter := engine.NewIterator(iterOpts)
 	defer iter.Close()
-	return mvccScanToKvs(ctx, iter, key, endKey, max, timestamp, opts)
+	if trace != nil {
+		trace.opened()
+		opts.trace = trace
+	}
+	var kvs []roachpb.KeyValue
+	var resumeSpan *roachpb.Span
+	var intents []roachpb.Intent
+	if opts.AllVersionsDescending {
+		kvs, intents, err = mvccScanAllVersionsDescending(iter, key, endKey, max, timestamp, opts)
+	} else if opts.GroupByKey {
+		kvs, resumeSpan, intents, err = mvccScanGroupByKey(iter, key, endKey, max, timestamp, opts)
+	} else if opts.StopAtFirstIntent && opts.MaxIntents > 0 {
+		err = errors.Errorf("cannot both stop at the first intent and collect up to %d intents", opts.MaxIntents)
+	} else if opts.StopAtFirstIntent {
+		kvs, resumeSpan, intents, err = mvccScanToFirstIntent(ctx, iter, key, endKey, max, timestamp, opts)
+	} else if opts.MaxIntents > 0 {
+		kvs, resumeSpan, intents, err = mvccScanCollectIntents(ctx, iter, key, endKey, max, timestamp, opts)
+	} else {
+		kvs, resumeSpan, intents, err = mvccScanToKvs(ctx, iter, key, endKey, max, timestamp, opts)
+	}
+	if trace != nil {
+		var numBytes int64
+		for i := range kvs {
+			numBytes += int64(len(kvs[i].Key) + len(kvs[i].Value.RawBytes))
+		}
+		trace.done(int64(len(kvs)), numBytes, err)
+	}
+	return kvs, resumeSpan, intents, err
 }
 
-// MVCCScanToBytes is like MVCCScan, but it returns the results in a byte array.
-func MVCCScanToBytes(
+// mvccScanToFirstIntent implements MVCCScanOptions.StopAtFirstIntent. If the
+// scan runs into intents, the part of the span preceding the first of them is
+// scanned again, which is known to be free of intents.
+func mvccScanToFirstIntent(
 	ctx context.Context,
-	engine Reader,
+	iter Iterator,
 	key, endKey roachpb.Key,
 	max int64,
 	timestamp hlc.Timestamp,
 	opts MVCCScanOptions,
-) ([][]byte, int64, *roachpb.Span, []roachpb.Intent, error) {
-	iter := engine.NewIterator(IterOptions{LowerBound: key, UpperBound: endKey})
-	defer iter.Close()
-	return iter.MVCCScan(key, endKey, max, timestamp, opts)
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	if opts.Inconsistent {
+		return nil, nil, nil, errors.Errorf("cannot stop at the first intent of an inconsistent scan")
+	}
+	kvs, resumeSpan, intents, err := mvccScanToKvs(ctx, iter, key, endKey, max, timestamp, opts)
+	wiErr, ok := err.(*roachpb.WriteIntentError)
+	if !ok || len(wiErr.Intents) == 0 {
+		return kvs, resumeSpan, intents, err
+	}
+	first := wiErr.Intents[0]
+	for _, intent := range wiErr.Intents[1:] {
+		if c := intent.Key.Compare(first.Key); (c < 0) != opts.Reverse && c != 0 {
+			first = intent
+		}
+	}
+
+	// The clean part of the span, and the rest of it.
+	clean := roachpb.Span{Key: key, EndKey: first.Key}
+	rest := roachpb.Span{Key: first.Key, EndKey: endKey}
+	if opts.Reverse {
+		clean = roachpb.Span{Key: first.Key.Next(), EndKey: endKey}
+		rest = roachpb.Span{Key: key, EndKey: first.Key.Next()}
+	}
+	kvs, resumeSpan = nil, nil
+	if clean.Key.Compare(clean.EndKey) < 0 {
+		kvs, resumeSpan, _, err = mvccScanToKvs(ctx, iter, clean.Key, clean.EndKey, max, timestamp, opts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if resumeSpan == nil {
+		resumeSpan = &rest
+	} else if opts.Reverse {
+		resumeSpan.Key = key
+	} else {
+		resumeSpan.EndKey = endKey
+	}
+	return kvs, resumeSpan, []roachpb.Intent{first}, nil
 }
 
-// MVCCIterate iterates over the key range [start,end). At each step of the
-// iteration, f() is invoked with the current key/value pair. If f returns
-// true (done) or an error, the iteration stops and the error is propagated.
-// If the reverse is flag set the iterator will be moved in reverse order.
-func MVCCIterate(
+// mvccScanCollectIntents implements MVCCScanOptions.MaxIntents. If the scan
+// runs into at most opts.MaxIntents intents, the parts of the span between
+// them, which are known to be free of intents up to where the scan stopped,
+// are scanned again.
+func mvccScanCollectIntents(
 	ctx context.Context,
-	engine Reader,
+	iter Iterator,
 	key, endKey roachpb.Key,
+	max int64,
 	timestamp hlc.Timestamp,
 	opts MVCCScanOptions,
-	f func(roachpb.KeyValue) (bool, error),
-) ([]roachpb.Intent, error) {
-	iter := engine.NewIterator(IterOptions{LowerBound: key, UpperBound: endKey})
-	defer iter.Close()
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	if opts.Inconsistent {
+		return nil, nil, nil, errors.Errorf("cannot collect the intents of an inconsistent scan")
+	}
+	kvs, resumeSpan, intents, err := mvccScanToKvs(ctx, iter, key, endKey, max, timestamp, opts)
+	wiErr, ok := err.(*roachpb.WriteIntentError)
+	if !ok || len(wiErr.Intents) == 0 {
+		return kvs, resumeSpan, intents, err
+	}
+	intents = wiErr.Intents
+	sort.Slice(intents, func(i, j int) bool {
+		return (intents[i].Key.Compare(intents[j].Key) < 0) != opts.Reverse
+	})
+	if len(intents) > opts.MaxIntents {
+		wiErr.Intents = intents[:opts.MaxIntents]
+		return nil, nil, nil, wiErr
+	}
 
-	var intents []roachpb.Intent
-	var wiErr error
+	// The span split into the clean spans around the intents, in scan order.
+	// Clean span i is followed by intent i, if any.
+	scanned := roachpb.Span{Key: key, EndKey: endKey}
+	clean := make([]roachpb.Span, 0, len(intents)+1)
+	for _, intent := range intents {
+		if opts.Reverse {
+			clean = append(clean, roachpb.Span{Key: intent.Key.Next(), EndKey: scanned.EndKey})
+			scanned.EndKey = intent.Key
+		} else {
+			clean = append(clean, roachpb.Span{Key: scanned.Key, EndKey: intent.Key})
+			scanned.Key = intent.Key.Next()
+		}
+	}
+	clean = append(clean, scanned)
 
-	for {
-		const maxKeysPerScan = 1000
-		kvs, resume, newIntents, err := mvccScanToKvs(
-			ctx, iter, key, endKey, maxKeysPerScan, timestamp, opts)
-		if err != nil {
-			switch tErr := err.(type) {
-			case *roachpb.WriteIntentError:
-				// In the case of WriteIntentErrors, accumulate affected keys but continue scan.
-				if wiErr == nil {
-					wiErr = tErr
-				} else {
-					wiErr.(*roachpb.WriteIntentError).Intents = append(
-						wiErr.(*roachpb.WriteIntentError).Intents, tErr.Intents...)
+	// The clean spans are scanned in turn, each with what remains of max and
+	// TargetBytes after the spans before it. Where the limits run out, the
+	// scan stops with a resume span covering the rest of the span, and the
+	// intents beyond that point are left to the resumed scan. The pairs
+	// omitted by opts.ValueTransform count towards the limits, as in the
+	// first scan.
+	resume := func(resumeKey roachpb.Key) *roachpb.Span {
+		if opts.Reverse {
+			return &roachpb.Span{Key: key, EndKey: resumeKey}
+		}
+		return &roachpb.Span{Key: resumeKey, EndKey: endKey}
+	}
+	hasTargetBytes := opts.TargetBytes > 0
+	// pos is the boundary of the part of the span scanned so far.
+	pos := key
+	if opts.Reverse {
+		pos = endKey
+	}
+	kvs = nil
+	for i, span := range clean {
+		if i > 0 && (max <= 0 || (hasTargetBytes && opts.TargetBytes <= 0)) {
+			return kvs, resume(pos), intents[:i-1], nil
+		}
+		if span.Key.Compare(span.EndKey) < 0 {
+			kvData, numKVs, spanResume, _, err := iter.MVCCScan(
+				span.Key, span.EndKey, max, timestamp, opts)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			spanKVs, err := mvccScanDecodeKvs(kvData, numKVs, opts)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			kvs = append(kvs, spanKVs...)
+			if spanResume != nil {
+				if opts.Reverse {
+					return kvs, resume(spanResume.EndKey), intents[:i], nil
 				}
-			default:
-				return nil, err
+				return kvs, resume(spanResume.Key), intents[:i], nil
+			}
+			max -= numKVs
+			if hasTargetBytes {
+				opts.TargetBytes -= mvccScanNumBytes(kvData, numKVs)
 			}
 		}
+		if opts.Reverse {
+			pos = span.Key
+		} else {
+			pos = span.EndKey
+		}
+	}
+	return kvs, nil, intents, nil
+}
 
-		if len(newIntents) > 0 {
-			if intents == nil {
-				intents = newIntents
-			} else {
-				intents = append(intents, newIntents...)
-			}
+// mvccScanAllVersionsDescending implements
+// MVCCScanOptions.AllVersionsDescending.
+func mvccScanAllVersionsDescending(
+	iter Iterator,
+	key, endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+) ([]roachpb.KeyValue, []roachpb.Intent, error) {
+	for _, unsupported := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.Reverse, "Reverse"},
+		{opts.Txn != nil, "Txn"},
+		{opts.IntentsOnly, "IntentsOnly"},
+		{opts.StopAtFirstIntent, "StopAtFirstIntent"},
+		{opts.MaxIntents > 0, "MaxIntents"},
+		{opts.MinTimestamp != (hlc.Timestamp{}), "MinTimestamp"},
+		{opts.TargetBytes > 0, "TargetBytes"},
+		{opts.GroupByKey, "GroupByKey"},
+	} {
+		if unsupported.set {
+			return nil, nil, errors.Errorf("%s is not supported by AllVersionsDescending scans", unsupported.name)
 		}
+	}
+	if max <= 0 {
+		// Other scans return a resume span covering the whole span, which this
+		// one can't.
+		return nil, nil, errors.Errorf("AllVersionsDescending scans require a positive max, got %d", max)
+	}
+	hi := timestamp
+	if opts.TimeWindow.Hi != (hlc.Timestamp{}) && opts.TimeWindow.Hi.Less(hi) {
+		hi = opts.TimeWindow.Hi
+	}
+	lo := opts.TimeWindow.Lo
+	suffixes := columnFamilySuffixes(opts.ColumnFamilyIDs)
 
-		for i := range kvs {
-			done, err := f(kvs[i])
-			if err != nil {
-				return nil, err
+	var kvs []roachpb.KeyValue
+	var intents []roachpb.Intent
+	var meta enginepb.MVCCMetadata
+	var intentKey roachpb.Key
+	var intentTS hlc.Timestamp
+	for iter.Seek(MakeMVCCMetadataKey(key)); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.Key.Compare(endKey) >= 0 {
+			break
+		}
+		if !wantColumnFamily(unsafeKey.Key, suffixes) {
+			continue
+		}
+		if !unsafeKey.IsValue() {
+			if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+				return nil, nil, err
 			}
-			if done {
-				// TODO(peter): This isn't quite the same semantics as mvccIterateOld
-				// as we can return intents for keys that are "past" what we've invoked
-				// the callback on. That's fine as none of the callers use the returned
-				// intents.
-				return intents, wiErr
+			if meta.Txn != nil && !timestamp.Less(hlc.Timestamp(meta.Timestamp)) {
+				intentKey = append(roachpb.Key(nil), unsafeKey.Key...)
+				intentTS = hlc.Timestamp(meta.Timestamp)
+				intents = append(intents, roachpb.Intent{
+					Span: roachpb.Span{Key: intentKey}, Status: roachpb.PENDING, Txn: *meta.Txn,
+				})
 			}
+			continue
 		}
-
-		if resume == nil {
-			break
+		if unsafeKey.Timestamp == intentTS && unsafeKey.Key.Equal(intentKey) {
+			// The provisional value of an intent.
+			continue
 		}
-		if opts.Reverse {
-			endKey = resume.EndKey
-		} else {
-			key = resume.Key
+		if hi.Less(unsafeKey.Timestamp) || unsafeKey.Timestamp.Less(lo) {
+			continue
+		}
+		kv := roachpb.KeyValue{Key: append(roachpb.Key(nil), unsafeKey.Key...)}
+		kv.Value.Timestamp = unsafeKey.Timestamp
+		if !opts.KeysOnly {
+			kv.Value.RawBytes = append([]byte(nil), iter.UnsafeValue()...)
+			if len(kv.Value.RawBytes) == 0 {
+				kv.Value.RawBytes = nil
+			}
+		}
+		if opts.VerifyChecksums {
+			if err := kv.Value.Verify(kv.Key); err != nil {
+				return nil, nil, err
+			}
 		}
+		kvs = append(kvs, kv)
+	}
+	if len(intents) > 0 && !opts.Inconsistent {
+		return nil, nil, &roachpb.WriteIntentError{Intents: intents}
 	}
 
-	return intents, wiErr
+	// The versions are in key order, and in descending timestamp order for
+	// each key.
+	sort.SliceStable(kvs, func(i, j int) bool {
+		return kvs[j].Value.Timestamp.Less(kvs[i].Value.Timestamp)
+	})
+	if int64(len(kvs)) > max {
+		kvs = kvs[:max]
+	}
+	if opts.ValueTransform != nil {
+		// Omitted versions count towards max, as for other scans.
+		n := 0
+		for _, kv := range kvs {
+			rawBytes, err := opts.ValueTransform(MVCCKey{Key: kv.Key, Timestamp: kv.Value.Timestamp}, kv.Value.RawBytes)
+			if err == ErrDropKey {
+				continue
+			} else if err != nil {
+				return nil, nil, err
+			}
+			kv.Value.RawBytes = rawBytes
+			kvs[n] = kv
+			n++
+		}
+		kvs = kvs[:n]
+	}
+	return kvs, intents, nil
 }
 
-// MVCCResolveWriteIntent either commits or aborts (rolls back) an
-// extant write intent for a given txn according to commit parameter.
-// ResolveWriteIntent will skip write intents of other txns.
-//
-// Transaction epochs deserve a bit of explanation. The epoch for a
-// transaction is incremented on transaction retries. A transaction
-// retry is different from an abort. Retries can occur in SSI
-// transactions when the commit timestamp is not equal to the proposed
-// transaction timestamp. On a retry, the epoch is incremented instead
-// of creating an entirely new transaction. This allows the intents
-// that were written on previous runs to serve as locks which prevent
-// concurrent reads from further incrementing the timestamp cache,
-// making further transaction retries less likely.
-//
-// Because successive retries of a transaction may end up writing to
-// different keys, the epochs serve to classify which intents get
+// mvccScanGroupByKey implements MVCCScanOptions.GroupByKey.
+func mvccScanGroupByKey(
+	iter Iterator,
+	key, endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	for _, unsupported := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.Reverse, "Reverse"},
+		{opts.Txn != nil, "Txn"},
+		{opts.IntentsOnly, "IntentsOnly"},
+		{opts.StopAtFirstIntent, "StopAtFirstIntent"},
+		{opts.MaxIntents > 0, "MaxIntents"},
+		{opts.MinTimestamp != (hlc.Timestamp{}), "MinTimestamp"},
+		{opts.TargetBytes > 0, "TargetBytes"},
+		{opts.TimeWindow != (MVCCTimeWindow{}), "TimeWindow"},
+	} {
+		if unsupported.set {
+			return nil, nil, nil, errors.Errorf("%s is not supported by GroupByKey scans", unsupported.name)
+		}
+	}
+	if max < 0 {
+		return nil, nil, nil, errors.Errorf("GroupByKey scans require a non-negative max, got %d", max)
+	} else if max == 0 {
+		return nil, &roachpb.Span{Key: key, EndKey: endKey}, nil, nil
+	}
+	suffixes := columnFamilySuffixes(opts.ColumnFamilyIDs)
+
+	var kvs []roachpb.KeyValue
+	var resumeSpan *roachpb.Span
+	var intents []roachpb.Intent
+	var meta enginepb.MVCCMetadata
+	var intentKey, lastKey roachpb.Key
+	var intentTS hlc.Timestamp
+	var numKeys int64
+	for iter.Seek(MakeMVCCMetadataKey(key)); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, nil, nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.Key.Compare(endKey) >= 0 {
+			break
+		}
+		if !wantColumnFamily(unsafeKey.Key, suffixes) {
+			continue
+		}
+		if numKeys == max && !unsafeKey.Key.Equal(lastKey) {
+			resumeSpan = &roachpb.Span{Key: append(roachpb.Key(nil), unsafeKey.Key...), EndKey: endKey}
+			break
+		}
+		if !unsafeKey.IsValue() {
+			if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+				return nil, nil, nil, err
+			}
+			if meta.Txn != nil && !timestamp.Less(hlc.Timestamp(meta.Timestamp)) {
+				intentKey = append(roachpb.Key(nil), unsafeKey.Key...)
+				intentTS = hlc.Timestamp(meta.Timestamp)
+				intents = append(intents, roachpb.Intent{
+					Span: roachpb.Span{Key: intentKey}, Status: roachpb.PENDING, Txn: *meta.Txn,
+				})
+			}
+			continue
+		}
+		if unsafeKey.Timestamp == intentTS && unsafeKey.Key.Equal(intentKey) {
+			// The provisional value of an intent.
+			continue
+		}
+		if timestamp.Less(unsafeKey.Timestamp) {
+			continue
+		}
+		if !unsafeKey.Key.Equal(lastKey) {
+			// Keys count towards max even if ValueTransform omits all of their
+			// versions, as for other scans.
+			lastKey = append(lastKey[:0], unsafeKey.Key...)
+			numKeys++
+		}
+		kv := roachpb.KeyValue{Key: append(roachpb.Key(nil), unsafeKey.Key...)}
+		kv.Value.Timestamp = unsafeKey.Timestamp
+		if !opts.KeysOnly {
+			kv.Value.RawBytes = append([]byte(nil), iter.UnsafeValue()...)
+			if len(kv.Value.RawBytes) == 0 {
+				kv.Value.RawBytes = nil
+			}
+		}
+		if opts.VerifyChecksums {
+			if err := kv.Value.Verify(kv.Key); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		if opts.ValueTransform != nil {
+			rawBytes, err := opts.ValueTransform(MVCCKey{Key: kv.Key, Timestamp: kv.Value.Timestamp}, kv.Value.RawBytes)
+			if err == ErrDropKey {
+				continue
+			} else if err != nil {
+				return nil, nil, nil, err
+			}
+			kv.Value.RawBytes = rawBytes
+		}
+		kvs = append(kvs, kv)
+	}
+	if len(intents) > 0 && !opts.Inconsistent {
+		return nil, nil, nil, &roachpb.WriteIntentError{Intents: intents}
+	}
+	return kvs, resumeSpan, intents, nil
+}
+
+// MVCCScanToBytes is like MVCCScan, but it returns the results in a byte array.
+func MVCCScanToBytes(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+) (MVCCScanResult, error) {
+	iterOpts, err := mvccScanIterOptions(key, endKey, timestamp, opts)
+	if err != nil {
+		return MVCCScanResult{}, err
+	}
+	trace := newMVCCScanTrace(ctx, key, endKey, opts)
+	iter := engine.NewIterator(iterOpts)
+	defer iter.Close()
+	if trace != nil {
+		trace.opened()
+		opts.trace = trace
+	}
+	kvData, numKVs, resumeSpan, intents, err := iter.MVCCScan(key, endKey, max, timestamp, opts)
+	if trace != nil {
+		trace.done(numKVs, mvccScanNumBytes(kvData, numKVs), err)
+	}
+	if err == nil && opts.VerifyChecksums {
+		if err := mvccScanVerifyChecksums(kvData); err != nil {
+			return MVCCScanResult{}, err
+		}
+	}
+	if err == nil && opts.ValueTransform != nil {
+		if kvData, numKVs, err = mvccScanTransformValues(kvData, opts.ValueTransform); err != nil {
+			return MVCCScanResult{}, err
+		}
+	}
+	res := MVCCScanResult{
+		KVData:     kvData,
+		NumKeys:    numKVs,
+		NumBytes:   mvccScanNumBytes(kvData, numKVs),
+		ResumeSpan: resumeSpan,
+		Intents:    intents,
+		KeysOnly:   opts.KeysOnly,
+	}
+	return res, err
+}
+
+// mvccScanNumBytes returns the sum of the key and value sizes in the kvData
+// returned by Iterator.MVCCScan, excluding the per-pair length prefixes.
+func mvccScanNumBytes(kvData [][]byte, numKVs int64) int64 {
+	// Each pair is prefixed with its value and key lengths (2 x Uint32).
+	const kvLenSize = 8
+	var n int64
+	for _, data := range kvData {
+		n += int64(len(data))
+	}
+	return n - kvLenSize*numKVs
+}
+
+// mvccScanBatchReprTag is the prefix of the LogData entry that opens the batch
+// representations returned by MVCCScanToBatchRepr. It is followed by a single
+// byte holding the format version.
+const mvccScanBatchReprTag = "mvcc-scan-batch-repr"
+
+// MVCCScanBatchReprVersion is the version of the format of the batch
+// representations returned by MVCCScanToBatchRepr. It must be bumped whenever
+// the format changes incompatibly.
+const MVCCScanBatchReprVersion byte = 1
+
+// MVCCScanBatchReprResult groups the values returned by MVCCScanToBatchRepr.
+type MVCCScanBatchReprResult struct {
+	// Repr holds the returned key-value pairs as a batch representation which
+	// can be passed to Writer.ApplyBatchRepr, after checking it with
+	// CheckMVCCScanBatchRepr. Each pair is a put of the returned version of a
+	// key at its MVCC timestamp.
+	Repr []byte
+	// NumKeys is the number of key-value pairs in Repr.
+	NumKeys int64
+	// ResumeSpan and Intents are as in MVCCScanResult.
+	ResumeSpan *roachpb.Span
+	Intents    []roachpb.Intent
+}
+
+// MVCCScanToBatchRepr is like MVCCScanToBytes, but it returns the results as a
+// batch representation, so that a remote node can apply them without decoding
+// and re-encoding every key-value pair. The representation starts with a
+// LogData entry tagging its format version, which is ignored when the batch is
+// applied.
+func MVCCScanToBatchRepr(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+) (MVCCScanBatchReprResult, error) {
+	res, err := MVCCScanToBytes(ctx, engine, key, endKey, max, timestamp, opts)
+	if err != nil {
+		return MVCCScanBatchReprResult{}, err
+	}
+	var b RocksDBBatchBuilder
+	b.LogData(append([]byte(mvccScanBatchReprTag), MVCCScanBatchReprVersion))
+	for _, data := range res.KVData {
+		for len(data) > 0 {
+			var k MVCCKey
+			var rawBytes []byte
+			k, rawBytes, data, err = MVCCScanDecodeKeyValue(data)
+			if err != nil {
+				return MVCCScanBatchReprResult{}, err
+			}
+			b.Put(k, rawBytes)
+		}
+	}
+	return MVCCScanBatchReprResult{
+		Repr:       b.Finish(),
+		NumKeys:    res.NumKeys,
+		ResumeSpan: res.ResumeSpan,
+		Intents:    res.Intents,
+	}, nil
+}
+
+// CheckMVCCScanBatchRepr verifies that repr was returned by
+// MVCCScanToBatchRepr in a format version understood by this node, returning
+// an error otherwise.
+func CheckMVCCScanBatchRepr(repr []byte) error {
+	r, err := NewRocksDBBatchReader(repr)
+	if err != nil {
+		return err
+	}
+	if !r.Next() || r.BatchType() != BatchTypeLogData ||
+		!bytes.HasPrefix(r.Key(), []byte(mvccScanBatchReprTag)) ||
+		len(r.Key()) != len(mvccScanBatchReprTag)+1 {
+		return errors.Errorf("batch repr is not the result of an MVCC scan")
+	}
+	if v := r.Key()[len(mvccScanBatchReprTag)]; v != MVCCScanBatchReprVersion {
+		return errors.Errorf("unsupported MVCC scan batch repr version %d, expected %d",
+			v, MVCCScanBatchReprVersion)
+	}
+	return nil
+}
+
+// MVCCMultiRangeFuncs are the callbacks of MVCCScanMultiRange.
+type MVCCMultiRangeFuncs struct {
+	// LookupRange returns the descriptor of the range containing key.
+	LookupRange func(key roachpb.RKey) (*roachpb.RangeDescriptor, error)
+	// OnRange is invoked with each chunk of the key-value pairs and intents
+	// scanned in the range described by desc, in key order. The chunks of a
+	// range are bounded in size, so a range may yield several of them. If
+	// OnRange returns an error the scan is aborted and the error is returned.
+	OnRange func(desc *roachpb.RangeDescriptor, kvs []roachpb.KeyValue, intents []roachpb.Intent) error
+}
+
+// MVCCScanMultiRange scans the global keys [start,end) at timestamp, which
+// may span multiple ranges. The ranges are resolved in turn with
+// fns.LookupRange, starting from the range containing start, and each of them
+// is scanned over its portion of the span, with the results passed
+// incrementally to fns.OnRange. The resume spans of the scans within a range,
+// and across range boundaries, are followed transparently. It is meant for
+// tooling operating on the local ranges of a single store, whose descriptors
+// are known.
+//
+// The options are interpreted as for MVCCScan, except that reverse scans
+// aren't supported, and that TargetBytes, if set, only bounds the size of the
+// chunks passed to fns.OnRange.
+func MVCCScanMultiRange(
+	ctx context.Context,
+	reader Reader,
+	start, end roachpb.Key,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+	fns MVCCMultiRangeFuncs,
+) error {
+	const maxKeysPerScan = 1000
+	return mvccScanMultiRange(ctx, reader, start, end, timestamp, opts, fns, maxKeysPerScan)
+}
+
+func mvccScanMultiRange(
+	ctx context.Context,
+	reader Reader,
+	start, end roachpb.Key,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+	fns MVCCMultiRangeFuncs,
+	maxKeysPerScan int64,
+) error {
+	if opts.Reverse {
+		return errors.Errorf("reverse scans are not supported across multiple ranges")
+	}
+	if keys.IsLocal(start) || keys.IsLocal(end) {
+		return errors.Errorf("cannot scan local keys across multiple ranges: [%s,%s)", start, end)
+	}
+	for key := start; key.Compare(end) < 0; {
+		rKey := roachpb.RKey(key)
+		desc, err := fns.LookupRange(rKey)
+		if err != nil {
+			return err
+		}
+		if desc == nil {
+			return errors.Errorf("no range descriptor for key %s", key)
+		}
+		if !desc.ContainsKey(rKey) {
+			return errors.Errorf("range descriptor %s does not contain key %s", desc, key)
+		}
+		rangeEnd := end
+		if descEnd := desc.EndKey.AsRawKey(); descEnd.Compare(rangeEnd) < 0 {
+			rangeEnd = descEnd
+		}
+		for key.Compare(rangeEnd) < 0 {
+			kvs, resumeSpan, intents, err := MVCCScan(
+				ctx, reader, key, rangeEnd, maxKeysPerScan, timestamp, opts)
+			if err != nil {
+				return err
+			}
+			if len(kvs) > 0 || len(intents) > 0 {
+				if err := fns.OnRange(desc, kvs, intents); err != nil {
+					return err
+				}
+			}
+			if resumeSpan == nil {
+				break
+			}
+			key = resumeSpan.Key
+		}
+		key = rangeEnd
+	}
+	return nil
+}
+
+// MVCCScanCallback is like MVCCScan, but instead of returning the scanned
+// key-value pairs it invokes f on each of them in scan order. Only a bounded
+// number of pairs is buffered at any time, which makes it suitable for large
+// scans. If f returns an error the scan is aborted and the error is returned.
+// The key and value passed to f must not be retained after f returns.
+//
+// The max parameter and opts are interpreted as for MVCCScan, and the returned
+// resume span and intents are equivalent to those returned by MVCCScan. The
+// options only supported by MVCCScan, StopAtFirstIntent, MaxIntents,
+// AllVersionsDescending and GroupByKey, result in an error, as does a negative
+// max.
+//
+// The pairs are scanned in chunks, and f is invoked on those of a chunk before
+// the next one is scanned. If a later chunk fails, e.g. with a
+// WriteIntentError because a consistent scan ran into intents, f has thus
+// already been invoked on the pairs of the preceding chunks, which the caller
+// must be prepared to discard. No resume span is returned with the error.
+func MVCCScanCallback(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+	f func(MVCCKey, []byte) error,
+) (*roachpb.Span, []roachpb.Intent, error) {
+	for _, unsupported := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.StopAtFirstIntent, "StopAtFirstIntent"},
+		{opts.MaxIntents > 0, "MaxIntents"},
+		{opts.AllVersionsDescending, "AllVersionsDescending"},
+		{opts.GroupByKey, "GroupByKey"},
+	} {
+		if unsupported.set {
+			return nil, nil, errors.Errorf("%s is not supported by MVCCScanCallback", unsupported.name)
+		}
+	}
+	if max < 0 {
+		return nil, nil, errors.Errorf("MVCCScanCallback requires a non-negative max, got %d", max)
+	}
+	iterOpts, err := mvccScanIterOptions(key, endKey, timestamp, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	iter := engine.NewIterator(iterOpts)
+	defer iter.Close()
+
+	var intents []roachpb.Intent
+	for {
+		const maxKeysPerScan = 1000
+		chunkMax := max
+		if chunkMax > maxKeysPerScan {
+			chunkMax = maxKeysPerScan
+		}
+		kvData, numKVs, resumeSpan, newIntents, err := iter.MVCCScan(
+			key, endKey, chunkMax, timestamp, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		intents = append(intents, newIntents...)
+
+		for _, data := range kvData {
+			for len(data) > 0 {
+				var k MVCCKey
+				var v []byte
+				k, v, data, err = MVCCScanDecodeKeyValue(data)
+				if err != nil {
+					return nil, nil, err
+				}
+				if opts.VerifyChecksums {
+					value := roachpb.Value{RawBytes: v}
+					if err := value.Verify(k.Key); err != nil {
+						return nil, nil, err
+					}
+				}
+				if opts.ValueTransform != nil {
+					v, err = opts.ValueTransform(k, v)
+					if err == ErrDropKey {
+						continue
+					} else if err != nil {
+						return nil, nil, err
+					}
+				}
+				if err := f(k, v); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+
+		if resumeSpan == nil {
+			return nil, intents, nil
+		}
+		max -= numKVs
+		if max == 0 {
+			return resumeSpan, intents, nil
+		}
+		if opts.TargetBytes > 0 {
+			opts.TargetBytes -= mvccScanNumBytes(kvData, numKVs)
+			if opts.TargetBytes <= 0 {
+				return resumeSpan, intents, nil
+			}
+		}
+		if opts.Reverse {
+			endKey = resumeSpan.EndKey
+		} else {
+			key = resumeSpan.Key
+		}
+	}
+}
+
+// MVCCIterate iterates over the key range [start,end). At each step of the
+// iteration, f() is invoked with the current key/value pair. If f returns
+// true (done) or an error, the iteration stops and the error is propagated.
+// If the reverse is flag set the iterator will be moved in reverse order.
+func MVCCIterate(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.Key,
+	timestamp hlc.Timestamp,
+	opts MVCCScanOptions,
+	f func(roachpb.KeyValue) (bool, error),
+) ([]roachpb.Intent, error) {
+	iterOpts, err := mvccScanIterOptions(key, endKey, timestamp, opts)
+	if err != nil {
+		return nil, err
+	}
+	iter := engine.NewIterator(iterOpts)
+	defer iter.Close()
+
+	var intents []roachpb.Intent
+	var wiErr error
+
+	for {
+		const maxKeysPerScan = 1000
+		kvs, resume, newIntents, err := mvccScanToKvs(
+			ctx, iter, key, endKey, maxKeysPerScan, timestamp, opts)
+		if err != nil {
+			switch tErr := err.(type) {
+			case *roachpb.WriteIntentError:
+				// In the case of WriteIntentErrors, accumulate affected keys but continue scan.
+				if wiErr == nil {
+					wiErr = tErr
+				} else {
+					wiErr.(*roachpb.WriteIntentError).Intents = append(
+						wiErr.(*roachpb.WriteIntentError).Intents, tErr.Intents...)
+				}
+			default:
+				return nil, err
+			}
+		}
+
+		if len(newIntents) > 0 {
+			if intents == nil {
+				intents = newIntents
+			} else {
+				intents = append(intents, newIntents...)
+			}
+		}
+
+		for i := range kvs {
+			done, err := f(kvs[i])
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				// TODO(peter): This isn't quite the same semantics as mvccIterateOld
+				// as we can return intents for keys that are "past" what we've invoked
+				// the callback on. That's fine as none of the callers use the returned
+				// intents.
+				return intents, wiErr
+			}
+		}
+
+		if resume == nil {
+			break
+		}
+		if opts.Reverse {
+			endKey = resume.EndKey
+		} else {
+			key = resume.Key
+		}
+	}
+
+	return intents, wiErr
+}
+
+// MVCCResolveWriteIntent either commits or aborts (rolls back) an
+// extant write intent for a given txn according to commit parameter.
+// ResolveWriteIntent will skip write intents of other txns.
+//
+// Transaction epochs deserve a bit of explanation. The epoch for a
+// transaction is incremented on transaction retries. A transaction
+// retry is different from an abort. Retries can occur in SSI
+// transactions when the commit timestamp is not equal to the proposed
+// transaction timestamp. On a retry, the epoch is incremented instead
+// of creating an entirely new transaction. This allows the intents
+// that were written on previous runs to serve as locks which prevent
+// concurrent reads from further incrementing the timestamp cache,
+// making further transaction retries less likely.
+//
+// Because successive retries of a transaction may end up writing to
+// different keys, the epochs serve to classify which intents get
 // committed in the event the transaction succeeds (all those with
 // epoch matching the commit epoch), and which intents get aborted,
 // even if the transaction succeeds.
@@ -2774,6 +4599,27 @@ func MVCCResolveWriteIntentRange(
 	return MVCCResolveWriteIntentRangeUsingIter(ctx, engine, iterAndBuf, ms, intent, max)
 }
 
+// MVCCResolveWriteIntentRangeWithMaxBytes is like MVCCResolveWriteIntentRange,
+// but also stops once the resolved intents reach or exceed maxBytes, so that
+// the resolution of a large range of intents can be chunked to bound the size
+// of each batch. The size of an intent is the size of its metadata key and
+// value plus the size of its provisional value. The intent crossing the limit
+// is resolved in full, so each call makes progress. As with max, a resume
+// span covering the unresolved part of the range is returned if the limit is
+// reached, and ms is only updated for the intents that were resolved. A
+// maxBytes of zero or less means no limit.
+func MVCCResolveWriteIntentRangeWithMaxBytes(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	intent roachpb.Intent,
+	max, maxBytes int64,
+) (int64, *roachpb.Span, error) {
+	iterAndBuf := GetIterAndBuf(engine, IterOptions{UpperBound: intent.Span.EndKey})
+	defer iterAndBuf.Cleanup()
+	return mvccResolveWriteIntentRange(ctx, engine, iterAndBuf, ms, intent, max, maxBytes)
+}
+
 // MVCCResolveWriteIntentRangeUsingIter commits or aborts (rolls back)
 // the range of write intents specified by start and end keys for a
 // given txn. ResolveWriteIntentRange will skip write intents of other
@@ -2786,6 +4632,17 @@ func MVCCResolveWriteIntentRangeUsingIter(
 	ms *enginepb.MVCCStats,
 	intent roachpb.Intent,
 	max int64,
+) (int64, *roachpb.Span, error) {
+	return mvccResolveWriteIntentRange(ctx, engine, iterAndBuf, ms, intent, max, 0 /* maxBytes */)
+}
+
+func mvccResolveWriteIntentRange(
+	ctx context.Context,
+	engine ReadWriter,
+	iterAndBuf IterAndBuf,
+	ms *enginepb.MVCCStats,
+	intent roachpb.Intent,
+	max, maxBytes int64,
 ) (int64, *roachpb.Span, error) {
 	encKey := MakeMVCCMetadataKey(intent.Key)
 	encEndKey := MakeMVCCMetadataKey(intent.EndKey)
@@ -2793,10 +4650,11 @@ func MVCCResolveWriteIntentRangeUsingIter(
 
 	var keyBuf []byte
 	num := int64(0)
+	numBytes := int64(0)
 	intent.EndKey = nil
 
 	for {
-		if num == max {
+		if num == max || (maxBytes > 0 && numBytes >= maxBytes) {
 			return num, &roachpb.Span{Key: nextKey.Key, EndKey: encEndKey.Key}, nil
 		}
 
@@ -2816,16 +4674,23 @@ func MVCCResolveWriteIntentRangeUsingIter(
 
 		var err error
 		var ok bool
+		var intentBytes int64
 		if !key.IsValue() {
-			intent.Key = key.Key
-			ok, err = mvccResolveWriteIntent(
-				ctx, engine, iterAndBuf.iter, ms, intent, iterAndBuf.buf, true, /* forRange */
-			)
+			if maxBytes > 0 {
+				intentBytes, err = mvccIntentBytes(key, iterAndBuf.iter.UnsafeValue())
+			}
+			if err == nil {
+				intent.Key = key.Key
+				ok, err = mvccResolveWriteIntent(
+					ctx, engine, iterAndBuf.iter, ms, intent, iterAndBuf.buf, true, /* forRange */
+				)
+			}
 		}
 		if err != nil {
 			log.Warningf(ctx, "failed to resolve intent for key %q: %+v", key.Key, err)
 		} else if ok {
 			num++
+			numBytes += intentBytes
 		}
 
 		// nextKey is already a metadata key...
@@ -2840,6 +4705,20 @@ func MVCCResolveWriteIntentRangeUsingIter(
 	return num, nil, nil
 }
 
+// mvccIntentBytes returns the size of the intent with the given metadata key
+// and value, including its provisional value. Zero is returned for inline
+// values, which aren't intents.
+func mvccIntentBytes(metaKey MVCCKey, metaValue []byte) (int64, error) {
+	var meta enginepb.MVCCMetadata
+	if err := protoutil.Unmarshal(metaValue, &meta); err != nil {
+		return 0, err
+	}
+	if meta.Txn == nil {
+		return 0, nil
+	}
+	return int64(metaKey.EncodedSize()+len(metaValue)) + meta.KeyBytes + meta.ValBytes, nil
+}
+
 // MVCCGarbageCollect creates an iterator on the engine. In parallel
 // it iterates through the keys listed for garbage collection by the
 // keys slice. The engine iterator is seeked in turn to each listed
@@ -2852,30 +4731,105 @@ func MVCCGarbageCollect(
 	keys []roachpb.GCRequest_GCKey,
 	timestamp hlc.Timestamp,
 ) error {
+	_, err := mvccGarbageCollect(ctx, engine, ms, keys, timestamp, MVCCGarbageCollectOptions{})
+	return err
+}
+
+// MVCCGarbageCollectWithLimit is like MVCCGarbageCollect, but bounds the
+// amount of work done by a single call so that the caller can yield between
+// chunks. Once maxKeys of the GC keys have been processed, or once at least
+// maxBytes worth of keys and values have been cleared, the keys which have not
+// been processed yet are returned. Passing those to a subsequent call finishes
+// the collection without revisiting the keys that were already collected. A
+// limit of zero means no limit.
+//
+// GC keys are never partially processed, so maxBytes may be exceeded by the
+// versions of a single key. ms is updated only for the keys which were
+// processed.
+func MVCCGarbageCollectWithLimit(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	keys []roachpb.GCRequest_GCKey,
+	timestamp hlc.Timestamp,
+	maxKeys, maxBytes int64,
+) (resume []roachpb.GCRequest_GCKey, _ error) {
+	return mvccGarbageCollect(ctx, engine, ms, keys, timestamp, MVCCGarbageCollectOptions{
+		MaxKeys:  maxKeys,
+		MaxBytes: maxBytes,
+	})
+}
+
+// MVCCGarbageCollectOptions bundles options for MVCCGarbageCollectWithOptions.
+type MVCCGarbageCollectOptions struct {
+	// MaxKeys and MaxBytes limit the work done by a single call, as described
+	// on MVCCGarbageCollectWithLimit. Zero means no limit.
+	MaxKeys, MaxBytes int64
+	// PreserveLatestTombstone, if true, keeps the latest version of a key if
+	// it is a deletion tombstone, even if the GC timestamp is at or above it,
+	// and only the versions beneath it are collected. A replica which lags
+	// behind the GC would otherwise be able to serve stale reads of the
+	// deleted value while the tombstone is gone but the older versions are
+	// not.
+	PreserveLatestTombstone bool
+}
+
+// MVCCGarbageCollectWithOptions is like MVCCGarbageCollect, but supports the
+// options described on MVCCGarbageCollectOptions. Keys which have not been
+// processed because of the limits are returned.
+func MVCCGarbageCollectWithOptions(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	keys []roachpb.GCRequest_GCKey,
+	timestamp hlc.Timestamp,
+	opts MVCCGarbageCollectOptions,
+) (resume []roachpb.GCRequest_GCKey, _ error) {
+	return mvccGarbageCollect(ctx, engine, ms, keys, timestamp, opts)
+}
+
+func mvccGarbageCollect(
+	ctx context.Context,
+	engine ReadWriter,
+	ms *enginepb.MVCCStats,
+	keys []roachpb.GCRequest_GCKey,
+	timestamp hlc.Timestamp,
+	opts MVCCGarbageCollectOptions,
+) ([]roachpb.GCRequest_GCKey, error) {
+	maxKeys, maxBytes := opts.MaxKeys, opts.MaxBytes
 	// We're allowed to use a prefix iterator because we always Seek() the
 	// iterator when handling a new user key.
 	iter := engine.NewIterator(IterOptions{Prefix: true})
 	defer iter.Close()
 
-	var count int64
+	var count, numKeys, clearedBytes int64
 	defer func(begin time.Time) {
 		log.Eventf(ctx, "done with GC evaluation for %d keys at %.2f keys/sec. Deleted %d entries",
-			len(keys), float64(len(keys))*1e9/float64(timeutil.Since(begin)), count)
+			numKeys, float64(numKeys)*1e9/float64(timeutil.Since(begin)), count)
 	}(timeutil.Now())
 
 	// Iterate through specified GC keys.
 	meta := &enginepb.MVCCMetadata{}
-	for _, gcKey := range keys {
+	for i, gcKey := range keys {
+		if (maxKeys > 0 && numKeys >= maxKeys) || (maxBytes > 0 && clearedBytes >= maxBytes) {
+			return keys[i:], nil
+		}
+		numKeys++
 		encKey := MakeMVCCMetadataKey(gcKey.Key)
 		ok, metaKeySize, metaValSize, err := mvccGetMetadata(iter, encKey, meta)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if !ok {
 			continue
 		}
 		inlinedValue := meta.IsInline()
 		implicitMeta := iter.UnsafeKey().IsValue()
+		// The latest tombstone is preserved along with the key's (implicit)
+		// meta, so the key itself is never removed.
+		latestTimestamp := hlc.Timestamp(meta.Timestamp)
+		preserveTombstone := opts.PreserveLatestTombstone && meta.Deleted &&
+			meta.Txn == nil && !inlinedValue
 		// First, check whether all values of the key are being deleted.
 		//
 		// Note that we naively can't terminate GC'ing keys loop early if we
@@ -2884,16 +4838,16 @@ func MVCCGarbageCollect(
 		// being removed. We had this faulty functionality at some point; it
 		// should no longer be necessary since the higher levels already make
 		// sure each individual GCRequest does bounded work.
-		if !gcKey.Timestamp.Less(hlc.Timestamp(meta.Timestamp)) {
+		if !gcKey.Timestamp.Less(latestTimestamp) && !preserveTombstone {
 			// For version keys, don't allow GC'ing the meta key if it's
 			// not marked deleted. However, for inline values we allow it;
 			// they are internal and GCing them directly saves the extra
 			// deletion step.
 			if !meta.Deleted && !inlinedValue {
-				return errors.Errorf("request to GC non-deleted, latest value of %q", gcKey.Key)
+				return nil, errors.Errorf("request to GC non-deleted, latest value of %q", gcKey.Key)
 			}
 			if meta.Txn != nil {
-				return errors.Errorf("request to GC intent at %q", gcKey.Key)
+				return nil, errors.Errorf("request to GC intent at %q", gcKey.Key)
 			}
 			if ms != nil {
 				if inlinedValue {
@@ -2905,9 +4859,10 @@ func MVCCGarbageCollect(
 			}
 			if !implicitMeta {
 				if err := engine.Clear(iter.UnsafeKey()); err != nil {
-					return err
+					return nil, err
 				}
 				count++
+				clearedBytes += metaKeySize + metaValSize
 			}
 		}
 
@@ -2931,7 +4886,7 @@ func MVCCGarbageCollect(
 		prevNanos := timestamp.WallTime
 		for ; ; iter.Next() {
 			if ok, err := iter.Valid(); err != nil {
-				return err
+				return nil, err
 			} else if !ok {
 				break
 			}
@@ -2942,6 +4897,10 @@ func MVCCGarbageCollect(
 			if !unsafeIterKey.IsValue() {
 				break
 			}
+			if preserveTombstone && unsafeIterKey.Timestamp == latestTimestamp {
+				prevNanos = unsafeIterKey.Timestamp.WallTime
+				continue
+			}
 			if !gcKey.Timestamp.Less(unsafeIterKey.Timestamp) {
 				if ms != nil {
 					// FIXME: use prevNanos instead of unsafeIterKey.Timestamp, except
@@ -2959,15 +4918,135 @@ func MVCCGarbageCollect(
 						valSize, nil, fromNS))
 				}
 				count++
+				clearedBytes += int64(unsafeIterKey.Len() + len(iter.UnsafeValue()))
 				if err := engine.Clear(unsafeIterKey); err != nil {
-					return err
+					return nil, err
 				}
 			}
 			prevNanos = unsafeIterKey.Timestamp.WallTime
 		}
 	}
 
-	return nil
+	return nil, nil
+}
+
+// MVCCGarbageCollectRange garbage collects the versions of the keys in [start,
+// end) which are no longer needed to serve reads at or above gcThreshold: for
+// each key, all of the versions below its latest version at or below the
+// threshold, and that version too if it's a deletion tombstone, in which case
+// the key is removed entirely if the tombstone is its latest version. Unlike
+// MVCCGarbageCollect, callers don't need to enumerate the keys to collect and
+// their GC timestamps beforehand, which is convenient for spans of keys with
+// uniform GC needs.
+//
+// Intents, and the provisional values beneath them, are never collected,
+// though the committed versions beneath them are subject to the rules above.
+// Inline values aren't collected either, as they have no timestamp.
+//
+// If maxBytes is positive, the collection stops once at least maxBytes worth
+// of keys and values are to be cleared, and the key at which it stopped is
+// returned so that a subsequent call can resume from it. Keys are never
+// partially collected, so maxBytes may be exceeded by the versions of a
+// single key. A nil resume key is returned once the whole span is collected.
+func MVCCGarbageCollectRange(
+	ctx context.Context,
+	rw ReadWriter,
+	ms *enginepb.MVCCStats,
+	start, end roachpb.Key,
+	gcThreshold hlc.Timestamp,
+	maxBytes int64,
+) (resumeKey roachpb.Key, _ error) {
+	// The keys to collect are gathered before any of their versions is
+	// cleared, since iterators on batches may not be used across writes.
+	gcKeys, resumeKey, err := mvccGarbageCollectRangeKeys(rw, start, end, gcThreshold, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	// The versions of the collected keys up to their GC timestamp are never
+	// the latest live versions, so the timestamp used to age them doesn't
+	// matter. See mvccGarbageCollect.
+	if _, err := mvccGarbageCollect(
+		ctx, rw, ms, gcKeys, gcThreshold, MVCCGarbageCollectOptions{},
+	); err != nil {
+		return nil, err
+	}
+	return resumeKey, nil
+}
+
+// mvccGarbageCollectRangeKeys returns the GC keys to collect for
+// MVCCGarbageCollectRange, along with the resume key.
+func mvccGarbageCollectRangeKeys(
+	reader Reader, start, end roachpb.Key, gcThreshold hlc.Timestamp, maxBytes int64,
+) ([]roachpb.GCRequest_GCKey, roachpb.Key, error) {
+	iter := reader.NewIterator(IterOptions{UpperBound: end})
+	defer iter.Close()
+
+	var gcKeys []roachpb.GCRequest_GCKey
+	var gcBytes int64
+	var meta enginepb.MVCCMetadata
+	for iter.Seek(MakeMVCCMetadataKey(start)); ; {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			return gcKeys, nil, nil
+		}
+		unsafeKey := iter.UnsafeKey()
+		if maxBytes > 0 && gcBytes >= maxBytes {
+			return gcKeys, append(roachpb.Key(nil), unsafeKey.Key...), nil
+		}
+		key := append(roachpb.Key(nil), unsafeKey.Key...)
+
+		var intentTS hlc.Timestamp
+		if !unsafeKey.IsValue() {
+			if err := iter.ValueProto(&meta); err != nil {
+				return nil, nil, err
+			}
+			if meta.IsInline() {
+				iter.NextKey()
+				continue
+			}
+			if meta.Txn != nil {
+				intentTS = hlc.Timestamp(meta.Timestamp)
+			}
+			iter.Next()
+		}
+
+		// Find the latest committed version at or below the threshold. Every
+		// version beneath it is collected, and so is the version itself if it
+		// is a deletion.
+		var gcKey roachpb.GCRequest_GCKey
+		var found, collecting bool
+		for ; ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				return nil, nil, err
+			} else if !ok {
+				break
+			}
+			unsafeKey := iter.UnsafeKey()
+			if !unsafeKey.IsValue() || !unsafeKey.Key.Equal(key) {
+				break
+			}
+			valLen := len(iter.UnsafeValue())
+			if !collecting {
+				if (intentTS != hlc.Timestamp{} && unsafeKey.Timestamp == intentTS) ||
+					gcThreshold.Less(unsafeKey.Timestamp) {
+					continue
+				}
+				collecting = true
+				if valLen != 0 {
+					continue
+				}
+			}
+			if !found {
+				gcKey = roachpb.GCRequest_GCKey{Key: key, Timestamp: unsafeKey.Timestamp}
+				found = true
+			}
+			gcBytes += int64(unsafeKey.Len() + valLen)
+		}
+		if found {
+			gcKeys = append(gcKeys, gcKey)
+		}
+	}
 }
 
 // MVCCFindSplitKey finds a key from the given span such that the left side of
@@ -2975,6 +5054,26 @@ func MVCCGarbageCollect(
 // from the key ranges listed in keys.NoSplitSpans.
 func MVCCFindSplitKey(
 	ctx context.Context, engine Reader, key, endKey roachpb.RKey, targetSize int64,
+) (roachpb.Key, error) {
+	return MVCCFindSplitKeyWithRowStart(ctx, engine, key, endKey, targetSize, nil /* rowStart */)
+}
+
+// MVCCFindSplitKeyWithRowStart is like MVCCFindSplitKey, but never splits
+// within a row as defined by rowStart, which maps any key to the first key of
+// the row containing it. All of the keys of a row must have that first key as
+// a prefix. The returned split key is always the first key of a row, and is
+// never chosen from within the first row of the span, which could otherwise
+// make the split a no-op.
+//
+// A nil rowStart uses SQL rows, which are made of one key per column family:
+// see keys.EnsureSafeSplitKey. Unlike a custom rowStart, it allows splitting
+// between a row and its interleaved rows.
+func MVCCFindSplitKeyWithRowStart(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.RKey,
+	targetSize int64,
+	rowStart func(roachpb.Key) (roachpb.Key, error),
 ) (roachpb.Key, error) {
 	if key.Less(roachpb.RKey(keys.LocalMax)) {
 		key = roachpb.RKey(keys.LocalMax)
@@ -3033,30 +5132,317 @@ func MVCCFindSplitKey(
 	} else if !ok {
 		return nil, nil
 	}
-	var minSplitKey roachpb.Key
-	if _, _, err := keys.DecodeTablePrefix(it.UnsafeKey().Key); err == nil {
-		// The first key in this range represents a row in a SQL table. Advance the
-		// minSplitKey past this row to avoid the problems described above.
-		firstRowKey, err := keys.EnsureSafeSplitKey(it.Key().Key)
+	var minSplitKey roachpb.Key
+	if rowStart != nil {
+		// The first row of the range ends before the first key that doesn't have
+		// its first key as a prefix.
+		firstRowKey, err := rowStart(it.Key().Key)
+		if err != nil {
+			return nil, err
+		}
+		minSplitKey = firstRowKey.PrefixEnd()
+	} else if _, _, err := keys.DecodeTablePrefix(it.UnsafeKey().Key); err == nil {
+		// The first key in this range represents a row in a SQL table. Advance the
+		// minSplitKey past this row to avoid the problems described above.
+		firstRowKey, err := keys.EnsureSafeSplitKey(it.Key().Key)
+		if err != nil {
+			return nil, err
+		}
+		// Allow a split key before other rows in the same table or before any
+		// rows in interleaved tables.
+		minSplitKey = encoding.EncodeInterleavedSentinel(firstRowKey)
+	} else {
+		// The first key in the range does not represent a row in a SQL table.
+		// Allow a split at any key that sorts after it.
+		minSplitKey = it.Key().Key.Next()
+	}
+
+	splitKey, err := it.FindSplitKey(key.AsRawKey(), endKey.AsRawKey(), minSplitKey, targetSize)
+	if err != nil {
+		return nil, err
+	}
+	if rowStart != nil {
+		if splitKey.Key == nil {
+			return nil, nil
+		}
+		return rowStart(splitKey.Key)
+	}
+	// Ensure the key is a valid split point that does not fall in the middle of a
+	// SQL row by removing the column family ID, if any, from the end of the key.
+	return keys.EnsureSafeSplitKey(splitKey.Key)
+}
+
+// MVCCFindSplitKeyWithMinBytes is like MVCCFindSplitKey, but refuses to return
+// a split key that would leave either side of the split with fewer than
+// minBytes of key and value data. A nil key is returned in that case, which
+// is also what MVCCFindSplitKey returns when no split key could be found.
+// This avoids churning on ranges whose data is too skewed to be usefully
+// halved.
+func MVCCFindSplitKeyWithMinBytes(
+	ctx context.Context, engine Reader, key, endKey roachpb.RKey, targetSize, minBytes int64,
+) (roachpb.Key, error) {
+	splitKey, err := MVCCFindSplitKey(ctx, engine, key, endKey, targetSize)
+	if err != nil || splitKey == nil || minBytes <= 0 {
+		return splitKey, err
+	}
+	if key.Less(roachpb.RKey(keys.LocalMax)) {
+		key = roachpb.RKey(keys.LocalMax)
+	}
+
+	it := engine.NewIterator(IterOptions{UpperBound: endKey.AsRawKey()})
+	defer it.Close()
+
+	if ok, err := splitHasMinBytes(it, key, endKey, splitKey, minBytes); err != nil || !ok {
+		return nil, err
+	}
+	return splitKey, nil
+}
+
+// splitHasMinBytes returns whether splitting the span at splitKey leaves both
+// sides of the split with at least minBytes of key and value data.
+func splitHasMinBytes(
+	it Iterator, key, endKey roachpb.RKey, splitKey roachpb.Key, minBytes int64,
+) (bool, error) {
+	for _, span := range []roachpb.Span{
+		{Key: key.AsRawKey(), EndKey: splitKey},
+		{Key: splitKey, EndKey: endKey.AsRawKey()},
+	} {
+		ms, err := it.ComputeStats(span.Key, span.EndKey, 0 /* nowNanos */)
+		if err != nil {
+			return false, err
+		}
+		if ms.KeyBytes+ms.ValBytes < minBytes {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// MVCCFindSplitKeyWeighted finds a key from the given span such that the left
+// side of the split carries roughly half of the span's weight, as given by
+// weight for every key and version in the span. This allows choosing split
+// points by load, e.g. using sampled request counts, rather than by size. Like
+// MVCCFindSplitKey, the split key is never chosen from within the first row of
+// the span, from within a SQL row, or from the key ranges listed in
+// keys.NoSplitSpans, and a nil key is returned if no split key could be found.
+// Like MVCCFindSplitKeyWithMinBytes, a nil key is also returned if either side
+// of the split would have fewer than minBytes of key and value data.
+//
+// If all keys carry the same weight, or no weight at all, the weights make no
+// difference and the span is halved by size instead.
+func MVCCFindSplitKeyWeighted(
+	ctx context.Context,
+	engine Reader,
+	key, endKey roachpb.RKey,
+	minBytes int64,
+	weight func(MVCCKey) float64,
+) (roachpb.Key, error) {
+	if key.Less(roachpb.RKey(keys.LocalMax)) {
+		key = roachpb.RKey(keys.LocalMax)
+	}
+
+	it := engine.NewIterator(IterOptions{UpperBound: endKey.AsRawKey()})
+	defer it.Close()
+
+	// Compute the total weight of the span, and whether it is uniform.
+	var totalWeight, firstWeight float64
+	uniform := true
+	first := true
+	for it.Seek(MakeMVCCMetadataKey(key.AsRawKey())); ; it.Next() {
+		if ok, err := it.Valid(); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		w := weight(it.UnsafeKey())
+		if first {
+			firstWeight = w
+			first = false
+		} else if w != firstWeight {
+			uniform = false
+		}
+		totalWeight += w
+	}
+	if first {
+		// The span is empty.
+		return nil, nil
+	}
+	if uniform || totalWeight <= 0 {
+		ms, err := it.ComputeStats(key.AsRawKey(), endKey.AsRawKey(), 0 /* nowNanos */)
 		if err != nil {
 			return nil, err
 		}
-		// Allow a split key before other rows in the same table or before any
-		// rows in interleaved tables.
-		minSplitKey = encoding.EncodeInterleavedSentinel(firstRowKey)
-	} else {
-		// The first key in the range does not represent a row in a SQL table.
-		// Allow a split at any key that sorts after it.
-		minSplitKey = it.Key().Key.Next()
+		return MVCCFindSplitKeyWithMinBytes(
+			ctx, engine, key, endKey, (ms.KeyBytes+ms.ValBytes)/2, minBytes)
+	}
+
+	// Find the start of the row whose preceding keys carry the weight closest
+	// to half of the total. See MVCCFindSplitKeyWithRowStart for why splits
+	// within the first row of the span are avoided.
+	targetWeight := totalWeight / 2
+	var minSplitKey, prevRow, bestSplitKey roachpb.Key
+	bestDiff := math.Inf(1)
+	var weightSoFar float64
+	for it.Seek(MakeMVCCMetadataKey(key.AsRawKey())); ; it.Next() {
+		if ok, err := it.Valid(); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := it.UnsafeKey()
+		if minSplitKey == nil {
+			firstKey := unsafeKey.Key
+			if _, _, err := keys.DecodeTablePrefix(firstKey); err == nil {
+				firstRowKey, err := keys.EnsureSafeSplitKey(firstKey)
+				if err != nil {
+					return nil, err
+				}
+				minSplitKey = encoding.EncodeInterleavedSentinel(firstRowKey)
+			} else {
+				minSplitKey = append(roachpb.Key(nil), firstKey...).Next()
+			}
+		}
+		if row, err := keys.EnsureSafeSplitKey(unsafeKey.Key); err == nil && !row.Equal(prevRow) {
+			prevRow = append(prevRow[:0], row...)
+			diff := math.Abs(targetWeight - weightSoFar)
+			if diff > bestDiff {
+				break
+			}
+			if row.Compare(minSplitKey) >= 0 && isValidSplitKey(row, keys.NoSplitSpans) {
+				bestDiff = diff
+				bestSplitKey = append(bestSplitKey[:0], row...)
+			}
+		}
+		weightSoFar += weight(unsafeKey)
 	}
+	if bestSplitKey == nil {
+		return nil, nil
+	}
+	if minBytes > 0 {
+		if ok, err := splitHasMinBytes(it, key, endKey, bestSplitKey, minBytes); err != nil || !ok {
+			return nil, err
+		}
+	}
+	return bestSplitKey, nil
+}
 
-	splitKey, err := it.FindSplitKey(key.AsRawKey(), endKey.AsRawKey(), minSplitKey, targetSize)
-	if err != nil {
-		return nil, err
+// MVCCSampleKeys returns up to n distinct keys in [start, end), sampled in a
+// single pass over iter, in ascending order. It is much cheaper than
+// computing split keys repeatedly, and is meant to produce split point
+// candidates (e.g. for load-based splitting) or to visualize the distribution
+// of the data in a span.
+//
+// Keys are sampled without replacement, weighted by the bytes stored for
+// them, i.e. the sum of the key and value bytes of all of their versions
+// (including intents), so that the sample is approximately uniform over the
+// stored bytes. More precisely, the first key picked by the sampler has a
+// probability of being picked which is exactly proportional to its weight,
+// and every subsequent key is picked proportionally to its weight among the
+// keys not yet picked (weighted reservoir sampling, as described by
+// Efraimidis and Spirakis). Inclusion probabilities are therefore only
+// approximately proportional to the weights: they're close to it when n is
+// small compared to the number of keys and no key holds a large share of the
+// bytes, while heavy keys are underrepresented (no key is sampled twice)
+// otherwise. If the span contains n keys or fewer, all of them are returned.
+func MVCCSampleKeys(iter SimpleIterator, start, end roachpb.Key, n int) ([]roachpb.Key, error) {
+	return mvccSampleKeys(iter, start, end, n, rand.New(rand.NewSource(timeutil.Now().UnixNano())))
+}
+
+func mvccSampleKeys(
+	iter SimpleIterator, start, end roachpb.Key, n int, rng *rand.Rand,
+) ([]roachpb.Key, error) {
+	if n <= 0 {
+		return nil, nil
 	}
-	// Ensure the key is a valid split point that does not fall in the middle of a
-	// SQL row by removing the column family ID, if any, from the end of the key.
-	return keys.EnsureSafeSplitKey(splitKey.Key)
+	r := sampleReservoir{size: n}
+	var curKey roachpb.Key
+	var curBytes int64
+	offer := func() {
+		if curBytes > 0 {
+			r.offer(curKey, curBytes, rng)
+		}
+	}
+	for iter.Seek(MakeMVCCMetadataKey(start)); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.Key.Compare(end) >= 0 {
+			break
+		}
+		if !unsafeKey.Key.Equal(curKey) {
+			offer()
+			curKey = append(curKey[:0], unsafeKey.Key...)
+			curBytes = 0
+		}
+		curBytes += int64(unsafeKey.EncodedSize() + len(iter.UnsafeValue()))
+	}
+	offer()
+
+	sampled := make([]roachpb.Key, len(r.items))
+	for i := range r.items {
+		sampled[i] = r.items[i].key
+	}
+	sort.Slice(sampled, func(i, j int) bool {
+		return sampled[i].Compare(sampled[j]) < 0
+	})
+	return sampled, nil
+}
+
+// sampleItem is a key held by a sampleReservoir, along with its priority.
+type sampleItem struct {
+	key      roachpb.Key
+	priority float64
+}
+
+// sampleReservoir holds the size keys of highest priority offered to it. It
+// implements heap.Interface as a min-heap on the priorities, so that the key
+// to evict is at the root.
+type sampleReservoir struct {
+	size  int
+	items []sampleItem
+}
+
+var _ heap.Interface = &sampleReservoir{}
+
+// offer considers key, with the given weight, for the reservoir. The key is
+// copied if it's kept.
+func (r *sampleReservoir) offer(key roachpb.Key, weight int64, rng *rand.Rand) {
+	// The priority is log(u)/weight for a uniform u in (0, 1], which orders
+	// the keys like u^(1/weight) without losing precision for large weights.
+	priority := math.Log(1-rng.Float64()) / float64(weight)
+	if len(r.items) < r.size {
+		heap.Push(r, sampleItem{key: append(roachpb.Key(nil), key...), priority: priority})
+		return
+	}
+	if priority <= r.items[0].priority {
+		return
+	}
+	// Reuse the evicted key's memory.
+	r.items[0].key = append(r.items[0].key[:0], key...)
+	r.items[0].priority = priority
+	heap.Fix(r, 0)
+}
+
+// Len implements heap.Interface.
+func (r *sampleReservoir) Len() int { return len(r.items) }
+
+// Less implements heap.Interface.
+func (r *sampleReservoir) Less(i, j int) bool { return r.items[i].priority < r.items[j].priority }
+
+// Swap implements heap.Interface.
+func (r *sampleReservoir) Swap(i, j int) { r.items[i], r.items[j] = r.items[j], r.items[i] }
+
+// Push implements heap.Interface.
+func (r *sampleReservoir) Push(x interface{}) { r.items = append(r.items, x.(sampleItem)) }
+
+// Pop implements heap.Interface.
+func (r *sampleReservoir) Pop() interface{} {
+	item := r.items[len(r.items)-1]
+	r.items = r.items[:len(r.items)-1]
+	return item
 }
 
 // willOverflow returns true iff adding both inputs would under- or overflow
@@ -3252,6 +5638,541 @@ func ComputeStatsGo(
 	return ms, nil
 }
 
+// MVCCComputeStatsSampled approximates the stats computed by ComputeStatsGo by
+// only visiting a pseudo-random sample of the user keys in [start, end) and
+// scaling the resulting counters by 1/sampleRate. A user key is either
+// sampled with all of its versions or skipped entirely. The sample is
+// determined by the seed, so repeated calls with the same seed over the same
+// data return the same result.
+//
+// The returned stats have ContainsEstimates set, unless sampleRate is 1, in
+// which case every key is visited and the result is identical to that of
+// ComputeStatsGo.
+func MVCCComputeStatsSampled(
+	iter SimpleIterator, start, end roachpb.Key, nowNanos int64, sampleRate float64, seed int64,
+) (enginepb.MVCCStats, error) {
+	if sampleRate <= 0 || sampleRate > 1 {
+		return enginepb.MVCCStats{}, errors.Errorf("sample rate %f must be in (0, 1]", sampleRate)
+	}
+	if sampleRate == 1 {
+		return ComputeStatsGo(iter, start, end, nowNanos)
+	}
+
+	sampled := &sampledIterator{
+		SimpleIterator: iter,
+		end:            end,
+		threshold:      sampleThreshold(sampleRate),
+	}
+	binary.BigEndian.PutUint64(sampled.seed[:], uint64(seed))
+	ms, err := ComputeStatsGo(sampled, start, end, nowNanos)
+	if err != nil {
+		return ms, err
+	}
+
+	scale := func(v int64) int64 {
+		return int64(math.Round(float64(v) / sampleRate))
+	}
+	ms.LiveBytes = scale(ms.LiveBytes)
+	ms.KeyBytes = scale(ms.KeyBytes)
+	ms.ValBytes = scale(ms.ValBytes)
+	ms.IntentBytes = scale(ms.IntentBytes)
+	ms.LiveCount = scale(ms.LiveCount)
+	ms.KeyCount = scale(ms.KeyCount)
+	ms.ValCount = scale(ms.ValCount)
+	ms.IntentCount = scale(ms.IntentCount)
+	ms.IntentAge = scale(ms.IntentAge)
+	ms.GCBytesAge = scale(ms.GCBytesAge)
+	ms.SysBytes = scale(ms.SysBytes)
+	ms.SysCount = scale(ms.SysCount)
+	ms.ContainsEstimates = true
+	return ms, nil
+}
+
+// sampleThreshold returns the hash threshold below which a key is sampled at
+// the given rate. The product is computed in floating point, in which
+// math.MaxUint64 is 2^64, and the conversion to a uint64 of values which don't
+// fit is implementation-defined, so the threshold is clamped.
+func sampleThreshold(sampleRate float64) uint64 {
+	if f := sampleRate * math.MaxUint64; f < 1<<64 {
+		return uint64(f)
+	}
+	return math.MaxUint64
+}
+
+// sampledIterator wraps a SimpleIterator, hiding all versions of the user keys
+// which are not part of the sample used by MVCCComputeStatsSampled. A user key
+// is sampled if the hash of the seed and the key falls below threshold.
+type sampledIterator struct {
+	SimpleIterator
+	end       roachpb.Key
+	seed      [8]byte
+	threshold uint64
+}
+
+func (s *sampledIterator) Seek(key MVCCKey) {
+	s.SimpleIterator.Seek(key)
+	s.skipUnsampled()
+}
+
+func (s *sampledIterator) Next() {
+	s.SimpleIterator.Next()
+	s.skipUnsampled()
+}
+
+func (s *sampledIterator) NextKey() {
+	s.SimpleIterator.NextKey()
+	s.skipUnsampled()
+}
+
+func (s *sampledIterator) skipUnsampled() {
+	for {
+		if ok, err := s.SimpleIterator.Valid(); !ok || err != nil {
+			return
+		}
+		key := s.UnsafeKey().Key
+		if key.Compare(s.end) >= 0 {
+			return
+		}
+		h := fnv.New64a()
+		_, _ = h.Write(s.seed[:])
+		_, _ = h.Write(key)
+		if h.Sum64() < s.threshold {
+			return
+		}
+		s.SimpleIterator.NextKey()
+	}
+}
+
+// sizeHistogramBuckets is the number of buckets of a SizeHistogram, enough for
+// sizes up to 4 GB.
+const sizeHistogramBuckets = 33
+
+// SizeHistogram is a distribution of the sizes of the physical key-value pairs
+// visited by MVCCComputeStatsWithHistogram. Sizes are bucketed by powers of
+// two: bucket 0 counts empty keys or values, and bucket i > 0 counts sizes in
+// [2^(i-1), 2^i). Sizes beyond the last bucket are counted in it.
+type SizeHistogram struct {
+	// KeySizes is the distribution of encoded MVCC key sizes.
+	KeySizes [sizeHistogramBuckets]int64
+	// ValueSizes is the distribution of value sizes, including those of intent
+	// metadata records.
+	ValueSizes [sizeHistogramBuckets]int64
+}
+
+func sizeHistogramBucket(size int) int {
+	b := bits.Len(uint(size))
+	if b >= sizeHistogramBuckets {
+		b = sizeHistogramBuckets - 1
+	}
+	return b
+}
+
+func (h *SizeHistogram) record(keySize, valSize int) {
+	h.KeySizes[sizeHistogramBucket(keySize)]++
+	h.ValueSizes[sizeHistogramBucket(valSize)]++
+}
+
+// MVCCComputeStatsWithHistogram computes the stats for [start, end) like
+// iter.ComputeStats. If withHistogram is true, it also builds a SizeHistogram
+// of the key and value sizes in the same pass over the data; this uses the Go
+// implementation of ComputeStats, which is slower than the native one used
+// otherwise. The returned histogram is nil if withHistogram is false.
+func MVCCComputeStatsWithHistogram(
+	iter Iterator, start, end roachpb.Key, nowNanos int64, withHistogram bool,
+) (enginepb.MVCCStats, *SizeHistogram, error) {
+	if !withHistogram {
+		ms, err := iter.ComputeStats(start, end, nowNanos)
+		return ms, nil, err
+	}
+	h := &SizeHistogram{}
+	ms, err := ComputeStatsGo(iter, start, end, nowNanos, func(key MVCCKey, value []byte) error {
+		h.record(key.EncodedSize(), len(value))
+		return nil
+	})
+	if err != nil {
+		return enginepb.MVCCStats{}, nil, err
+	}
+	return ms, h, nil
+}
+
+// versionHistogramMaxVersions is the number of versions past which the keys of
+// a VersionHistogram are counted together.
+const versionHistogramMaxVersions = 64
+
+// VersionHistogram is a distribution of the number of versions of the keys
+// visited by MVCCAnalyzeVersions, along with an estimate of the data which GC
+// could reclaim.
+type VersionHistogram struct {
+	// Keys is the number of versioned keys. Inline values aren't counted.
+	Keys int64
+	// Versions[n] is the number of keys with n versions, including the
+	// provisional value of an intent. Keys with versionHistogramMaxVersions
+	// versions or more are counted in the last bucket.
+	Versions [versionHistogramMaxVersions + 1]int64
+	// MaxVersions is the highest number of versions of a key.
+	MaxVersions int64
+	// ReclaimableVersions and ReclaimableBytes are the number and the size of
+	// the encoded keys and values of the versions which GC would collect at
+	// the GC threshold: the versions beneath the latest committed version at
+	// or below it, and that version too if it is a deletion tombstone. These
+	// are the versions collected by MVCCGarbageCollectRange.
+	ReclaimableVersions int64
+	ReclaimableBytes    int64
+}
+
+// MVCCAnalyzeVersions computes a VersionHistogram of the keys of [start, end)
+// in a single pass over iter, e.g. to prioritize the ranges to garbage
+// collect, estimating the reclaimable data at gcThreshold. The iterator must
+// not be a prefix iterator.
+func MVCCAnalyzeVersions(
+	iter SimpleIterator, start, end roachpb.Key, gcThreshold hlc.Timestamp,
+) (VersionHistogram, error) {
+	var h VersionHistogram
+	var meta enginepb.MVCCMetadata
+	var keyBuf roachpb.Key
+	for iter.Seek(MakeMVCCMetadataKey(start)); ; {
+		if ok, err := iter.Valid(); err != nil {
+			return VersionHistogram{}, err
+		} else if !ok || iter.UnsafeKey().Key.Compare(end) >= 0 {
+			return h, nil
+		}
+		unsafeKey := iter.UnsafeKey()
+		keyBuf = append(keyBuf[:0], unsafeKey.Key...)
+
+		var intentTS hlc.Timestamp
+		if !unsafeKey.IsValue() {
+			if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+				return VersionHistogram{}, errors.Wrapf(err, "unable to decode MVCCMetadata of %s", keyBuf)
+			}
+			if meta.IsInline() {
+				iter.NextKey()
+				continue
+			}
+			if meta.Txn != nil {
+				intentTS = hlc.Timestamp(meta.Timestamp)
+			}
+			iter.Next()
+		}
+
+		// See mvccGarbageCollectRangeKeys for the versions which are collected.
+		var versions int64
+		var collecting bool
+		for ; ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				return VersionHistogram{}, err
+			} else if !ok {
+				break
+			}
+			unsafeKey := iter.UnsafeKey()
+			if !unsafeKey.IsValue() || !unsafeKey.Key.Equal(keyBuf) {
+				break
+			}
+			versions++
+			valLen := len(iter.UnsafeValue())
+			if !collecting {
+				if (intentTS != hlc.Timestamp{} && unsafeKey.Timestamp == intentTS) ||
+					gcThreshold.Less(unsafeKey.Timestamp) {
+					continue
+				}
+				collecting = true
+				if valLen != 0 {
+					continue
+				}
+			}
+			h.ReclaimableVersions++
+			h.ReclaimableBytes += int64(unsafeKey.Len() + valLen)
+		}
+
+		h.Keys++
+		if versions > h.MaxVersions {
+			h.MaxVersions = versions
+		}
+		if versions > versionHistogramMaxVersions {
+			versions = versionHistogramMaxVersions
+		}
+		h.Versions[versions]++
+	}
+}
+
+// MVCCVerifyStats recomputes the stats of the span [start, end) at nowNanos
+// and compares them to the claimed stats, returning the recomputed stats and
+// whether they match. The claimed stats may have been last updated at a
+// different time than nowNanos: both are aged to the later of the two before
+// they are compared, so that drift is only reported for counters which are
+// actually inconsistent. The ContainsEstimates flag is not compared; callers
+// which tolerate mismatches of estimated stats must check it themselves.
+//
+// The drift of a mismatch is the recomputed stats minus the claimed stats, as
+// computed by MVCCStats.Subtract.
+func MVCCVerifyStats(
+	ctx context.Context,
+	reader Reader,
+	start, end roachpb.Key,
+	claimed enginepb.MVCCStats,
+	nowNanos int64,
+) (enginepb.MVCCStats, bool, error) {
+	iter := reader.NewIterator(IterOptions{LowerBound: start, UpperBound: end})
+	defer iter.Close()
+	recomputed, err := iter.ComputeStats(start, end, nowNanos)
+	if err != nil {
+		return enginepb.MVCCStats{}, false, err
+	}
+	delta := recomputed
+	delta.Subtract(claimed)
+	delta.LastUpdateNanos = 0
+	delta.ContainsEstimates = false
+	if delta != (enginepb.MVCCStats{}) {
+		log.VEventf(ctx, 2, "stats of [%s,%s) drifted by %+v", start, end, delta)
+		return recomputed, false, nil
+	}
+	return recomputed, true, nil
+}
+
+// MVCCExportToSST exports the changes to the key span [start, end) made in the
+// time interval (startTS, endTS] into an SSTable. If exportAllRevisions is
+// true, every version of a key in the interval is exported, otherwise only the
+// latest version of each key within the interval is. Deletion tombstones are
+// exported if all revisions are requested or if startTS is non-zero, so that
+// an incremental backup can restore them; a full backup of only the latest
+// versions doesn't need them.
+//
+// If targetSize is positive, the export stops once the exported keys and
+// values exceed it, and resumeKey is set to the first key that was not
+// exported. Exports only stop between keys, so all exported revisions of a key
+// are always in the same SSTable. A nil sst is returned if nothing was
+// exported. A WriteIntentError is returned if an intent is encountered in the
+// time interval.
+//
+// This is the Go counterpart to ExportToSst and works with any Reader.
+func MVCCExportToSST(
+	ctx context.Context,
+	reader Reader,
+	start, end roachpb.Key,
+	startTS, endTS hlc.Timestamp,
+	exportAllRevisions bool,
+	targetSize int64,
+) (sst []byte, summary roachpb.BulkOpSummary, resumeKey roachpb.Key, _ error) {
+	sstWriter, err := MakeRocksDBSstFileWriter()
+	if err != nil {
+		return nil, roachpb.BulkOpSummary{}, nil, err
+	}
+	defer sstWriter.Close()
+
+	iter := NewMVCCIncrementalIterator(reader, MVCCIncrementalIterOptions{
+		StartTime:  startTS,
+		EndTime:    endTS,
+		UpperBound: end,
+	})
+	defer iter.Close()
+
+	var rows rowCounter
+	var curKey roachpb.Key // only used when exportAllRevisions is true
+	skipTombstones := !exportAllRevisions && startTS.IsEmpty()
+	for iter.Seek(MakeMVCCMetadataKey(start)); ; {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, roachpb.BulkOpSummary{}, nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := iter.UnsafeKey()
+		unsafeValue := iter.UnsafeValue()
+
+		isNewKey := !exportAllRevisions || !unsafeKey.Key.Equal(curKey)
+		if isNewKey && targetSize > 0 && rows.DataSize >= targetSize {
+			resumeKey = append(roachpb.Key(nil), unsafeKey.Key...)
+			break
+		}
+		if exportAllRevisions && isNewKey {
+			curKey = append(curKey[:0], unsafeKey.Key...)
+		}
+
+		if !(skipTombstones && len(unsafeValue) == 0) {
+			if err := rows.count(unsafeKey.Key); err != nil {
+				return nil, roachpb.BulkOpSummary{}, nil, err
+			}
+			rows.DataSize += int64(len(unsafeKey.Key) + len(unsafeValue))
+			if err := sstWriter.Put(unsafeKey, unsafeValue); err != nil {
+				return nil, roachpb.BulkOpSummary{}, nil, err
+			}
+		}
+
+		if exportAllRevisions {
+			iter.Next()
+		} else {
+			iter.NextKey()
+		}
+	}
+
+	if sstWriter.DataSize() == 0 {
+		return nil, rows.BulkOpSummary, resumeKey, nil
+	}
+	sst, err = sstWriter.Finish()
+	if err != nil {
+		return nil, roachpb.BulkOpSummary{}, nil, err
+	}
+	return sst, rows.BulkOpSummary, resumeKey, nil
+}
+
+// InconsistencyReport describes a key whose MVCC metadata disagrees with the
+// versioned data stored for it, as found by MVCCCheckConsistency.
+type InconsistencyReport struct {
+	Key         MVCCKey
+	Description string
+}
+
+func (r InconsistencyReport) String() string {
+	return fmt.Sprintf("%s: %s", r.Key, r.Description)
+}
+
+// MVCCCheckConsistency walks the span [start, end) in a single forward pass
+// and reports keys whose MVCCMetadata disagrees with the versioned data. The
+// following inconsistencies are detected:
+//
+// - metadata records that cannot be decoded;
+// - intents without a provisional value at the intent's timestamp;
+// - intents whose recorded value size or deletion status does not match the
+//   provisional value;
+// - inline values which also have versioned values;
+// - metadata records that are neither an intent nor an inline value.
+//
+// MVCCCheckConsistency is intended for debugging and never modifies the
+// underlying engine. An error is only returned if the engine itself could not
+// be read.
+func MVCCCheckConsistency(
+	ctx context.Context, reader Reader, start, end roachpb.Key,
+) ([]InconsistencyReport, error) {
+	iter := reader.NewIterator(IterOptions{UpperBound: end})
+	defer iter.Close()
+
+	var reports []InconsistencyReport
+	report := func(key MVCCKey, format string, args ...interface{}) {
+		reports = append(reports, InconsistencyReport{
+			Key:         MVCCKey{Key: append(roachpb.Key(nil), key.Key...), Timestamp: key.Timestamp},
+			Description: fmt.Sprintf(format, args...),
+		})
+	}
+
+	var meta enginepb.MVCCMetadata
+	for iter.Seek(MakeMVCCMetadataKey(start)); ; {
+		if ok, err := iter.Valid(); err != nil {
+			return nil, err
+		} else if !ok {
+			break
+		}
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.IsValue() {
+			// Versioned values without a metadata record are committed values.
+			iter.Next()
+			continue
+		}
+
+		metaKey := unsafeKey
+		if err := protoutil.Unmarshal(iter.UnsafeValue(), &meta); err != nil {
+			report(metaKey, "unable to decode MVCCMetadata: %v", err)
+			iter.NextKey()
+			continue
+		}
+		metaKey.Key = append(roachpb.Key(nil), metaKey.Key...)
+
+		// Step to the newest version of the key, if any. The loop will continue
+		// from there.
+		iter.Next()
+		hasVersion, err := iter.Valid()
+		if err != nil {
+			return nil, err
+		}
+		hasVersion = hasVersion && iter.UnsafeKey().Key.Equal(metaKey.Key)
+
+		switch {
+		case meta.IsInline():
+			if hasVersion {
+				report(metaKey, "inline value has versioned values")
+			}
+		case meta.Txn == nil:
+			report(metaKey, "metadata record is neither an intent nor an inline value")
+		case !hasVersion || iter.UnsafeKey().Timestamp != hlc.Timestamp(meta.Timestamp):
+			report(metaKey, "intent at %s has no provisional value", hlc.Timestamp(meta.Timestamp))
+		default:
+			valBytes := int64(len(iter.UnsafeValue()))
+			if valBytes != meta.ValBytes {
+				report(metaKey, "intent records %d value bytes, but provisional value has %d",
+					meta.ValBytes, valBytes)
+			}
+			if meta.Deleted != (valBytes == 0) {
+				report(metaKey, "intent deleted=%t disagrees with provisional value of %d bytes",
+					meta.Deleted, valBytes)
+			}
+		}
+	}
+	return reports, nil
+}
+
+// MVCCFingerprintOptions bundles options for MVCCFingerprint.
+type MVCCFingerprintOptions struct {
+	// OrderDependent, if set, makes the fingerprint depend on the order of the
+	// key-value pairs, e.g. to compare streams of data. By default, the
+	// fingerprint is the sum of the hashes of the pairs.
+	OrderDependent bool
+	// IncludeTimestamps, if set, includes the timestamps of the visible
+	// versions in the fingerprint, in addition to the keys and values.
+	IncludeTimestamps bool
+	// IncludeTombstones, if set, includes the keys whose visible version is a
+	// deletion tombstone in the fingerprint. They are excluded by default, as
+	// tombstones may have been garbage collected on some replicas but not on
+	// others.
+	IncludeTombstones bool
+}
+
+// MVCCFingerprint returns a fingerprint of the key-value pairs of [start, end)
+// visible at timestamp, which allows two replicas to be compared without
+// shipping their data: consistent replicas produce identical fingerprints, and
+// only replicas whose fingerprints differ need a full comparison. Values are
+// hashed with their checksums, as stored. Intents visible at timestamp result
+// in a WriteIntentError, as for MVCCScan.
+//
+// The fingerprint is not a cryptographic hash, and is only meant to detect
+// accidental inconsistencies.
+func MVCCFingerprint(
+	ctx context.Context,
+	reader Reader,
+	start, end roachpb.Key,
+	timestamp hlc.Timestamp,
+	opts MVCCFingerprintOptions,
+) (uint64, error) {
+	var fingerprint uint64
+	h := fnv.New64a()
+	var buf [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		// Lengths are written so that the boundaries of the fields are hashed.
+		_, _ = h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))])
+		_, _ = h.Write(b)
+	}
+	_, _, err := MVCCScanCallback(ctx, reader, start, end, math.MaxInt64, timestamp,
+		MVCCScanOptions{Tombstones: opts.IncludeTombstones},
+		func(key MVCCKey, value []byte) error {
+			if !opts.OrderDependent {
+				h.Reset()
+			}
+			writeBytes(key.Key)
+			if opts.IncludeTimestamps {
+				_, _ = h.Write(buf[:binary.PutVarint(buf[:], key.Timestamp.WallTime)])
+				_, _ = h.Write(buf[:binary.PutVarint(buf[:], int64(key.Timestamp.Logical))])
+			}
+			writeBytes(value)
+			if !opts.OrderDependent {
+				fingerprint += h.Sum64()
+			}
+			return nil
+		})
+	if err != nil {
+		return 0, err
+	}
+	if opts.OrderDependent {
+		return h.Sum64(), nil
+	}
+	return fingerprint, nil
+}
+
 // computeCapacity returns capacity details for the engine's available storage,
 // by querying the underlying file system.
 func computeCapacity(path string, maxSizeBytes int64) (roachpb.StoreCapacity, error) {
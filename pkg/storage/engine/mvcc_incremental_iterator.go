@@ -11,9 +11,12 @@
 package engine
 
 import (
+	"context"
+
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/pkg/errors"
 )
@@ -58,6 +61,11 @@ type MVCCIncrementalIterator struct {
 	e          Reader
 	sanityIter Iterator
 
+	// verifyIter, if set, is a non-time-bound MVCCIncrementalIterator moved in
+	// lockstep with this one to verify its output. See
+	// MVCCIncrementalIterOptions.VerifyTimeBounds.
+	verifyIter *MVCCIncrementalIterator
+
 	startTime hlc.Timestamp
 	endTime   hlc.Timestamp
 	err       error
@@ -76,6 +84,16 @@ type MVCCIncrementalIterOptions struct {
 	UpperBound                          roachpb.Key
 	WithStats                           bool
 	EnableTimeBoundIteratorOptimization bool
+	// VerifyTimeBounds, if set along with EnableTimeBoundIteratorOptimization,
+	// cross-checks the time-bound iterator against a full scan. The iterator
+	// then reads all of the data a second time through a regular iterator, and
+	// any key it returns that is outside of (StartTime, EndTime] or that differs
+	// from the key the full scan returns, including a key the time-bound
+	// iterator skipped, is logged and surfaced as an error from Valid. This is
+	// a debugging aid which doubles the cost of iteration. It requires the
+	// Reader to be a consistent snapshot, as concurrent writes would otherwise
+	// be reported as discrepancies.
+	VerifyTimeBounds bool
 }
 
 // NewMVCCIncrementalIterator creates an MVCCIncrementalIterator with the
@@ -109,6 +127,15 @@ func NewMVCCIncrementalIterator(
 		})
 	}
 
+	var verifyIter *MVCCIncrementalIterator
+	if opts.VerifyTimeBounds && sanityIter != nil {
+		verifyIter = NewMVCCIncrementalIterator(e, MVCCIncrementalIterOptions{
+			StartTime:  opts.StartTime,
+			EndTime:    opts.EndTime,
+			UpperBound: opts.UpperBound,
+		})
+	}
+
 	return &MVCCIncrementalIterator{
 		e:          e,
 		upperBound: opts.UpperBound,
@@ -116,6 +143,7 @@ func NewMVCCIncrementalIterator(
 		startTime:  opts.StartTime,
 		endTime:    opts.EndTime,
 		sanityIter: sanityIter,
+		verifyIter: verifyIter,
 	}
 }
 
@@ -126,6 +154,10 @@ func (i *MVCCIncrementalIterator) Seek(startKey MVCCKey) {
 	i.err = nil
 	i.valid = true
 	i.advance()
+	if i.verifyIter != nil {
+		i.verifyIter.Seek(startKey)
+		i.verify()
+	}
 }
 
 // Close frees up resources held by the iterator.
@@ -134,6 +166,9 @@ func (i *MVCCIncrementalIterator) Close() {
 	if i.sanityIter != nil {
 		i.sanityIter.Close()
 	}
+	if i.verifyIter != nil {
+		i.verifyIter.Close()
+	}
 }
 
 // Next advances the iterator to the next key/value in the iteration. After this
@@ -142,6 +177,10 @@ func (i *MVCCIncrementalIterator) Close() {
 func (i *MVCCIncrementalIterator) Next() {
 	i.iter.Next()
 	i.advance()
+	if i.verifyIter != nil {
+		i.verifyIter.Next()
+		i.verify()
+	}
 }
 
 // NextKey advances the iterator to the next MVCC key. This operation is
@@ -151,6 +190,10 @@ func (i *MVCCIncrementalIterator) Next() {
 func (i *MVCCIncrementalIterator) NextKey() {
 	i.iter.NextKey()
 	i.advance()
+	if i.verifyIter != nil {
+		i.verifyIter.NextKey()
+		i.verify()
+	}
 }
 
 func (i *MVCCIncrementalIterator) advance() {
@@ -232,6 +275,37 @@ func (i *MVCCIncrementalIterator) advance() {
 	}
 }
 
+// verify checks the position of the iterator against that of verifyIter,
+// setting i.err if they differ or if the current key is outside of the time
+// range. See MVCCIncrementalIterOptions.VerifyTimeBounds.
+func (i *MVCCIncrementalIterator) verify() {
+	if i.err != nil {
+		return
+	}
+	expOK, expErr := i.verifyIter.Valid()
+	if expErr != nil {
+		// The same error is expected to be surfaced by this iterator, in which
+		// case it is handled above.
+		i.err = errors.Wrap(expErr, "time-bound iterator verification")
+	} else if !i.valid && expOK {
+		i.err = errors.Errorf("time-bound iterator skipped key %s", i.verifyIter.UnsafeKey())
+	} else if i.valid && !expOK {
+		i.err = errors.Errorf("time-bound iterator returned unexpected key %s", i.UnsafeKey())
+	} else if i.valid {
+		key, expKey := i.UnsafeKey(), i.verifyIter.UnsafeKey()
+		if ts := key.Timestamp; key.IsValue() && (!i.startTime.Less(ts) || i.endTime.Less(ts)) {
+			i.err = errors.Errorf("time-bound iterator returned key %s outside of time range (%s, %s]",
+				key, i.startTime, i.endTime)
+		} else if !key.Equal(expKey) {
+			i.err = errors.Errorf("time-bound iterator returned key %s, expected %s", key, expKey)
+		}
+	}
+	if i.err != nil {
+		i.valid = false
+		log.Errorf(context.TODO(), "%v", i.err)
+	}
+}
+
 // sanityCheckMetadataKey looks up the current `i.iter` key using a normal,
 // non-time-bound iterator and returns the value if the normal iterator also
 // sees that exact key. Otherwise, it returns false. It's used in the workaround
@@ -293,6 +293,73 @@ func TestMVCCIncrementalIterator(t *testing.T) {
 	}, t)
 }
 
+func TestMVCCIncrementalIteratorVerifyTimeBounds(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	runWithAllEngines(func(e Engine, t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			ts := hlc.Timestamp{WallTime: int64(i)}
+			for _, key := range []roachpb.Key{roachpb.Key("a"), roachpb.Key("b"), roachpb.Key("c")} {
+				if err := MVCCPut(ctx, e, nil, key, ts, roachpb.MakeValueFromString("v"), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Flush after each timestamp so that table properties are collected.
+			if err := e.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		newIter := func() *MVCCIncrementalIterator {
+			iter := NewMVCCIncrementalIterator(e, MVCCIncrementalIterOptions{
+				StartTime:                           hlc.Timestamp{WallTime: 1},
+				EndTime:                             hlc.Timestamp{WallTime: 2},
+				UpperBound:                          roachpb.KeyMax,
+				EnableTimeBoundIteratorOptimization: true,
+				VerifyTimeBounds:                    true,
+			})
+			if iter.verifyIter == nil {
+				t.Fatal("expected verification iterator")
+			}
+			return iter
+		}
+
+		t.Run("consistent", func(t *testing.T) {
+			iter := newIter()
+			defer iter.Close()
+			var count int
+			for iter.Seek(MakeMVCCMetadataKey(roachpb.KeyMin)); ; iter.Next() {
+				if ok, err := iter.Valid(); err != nil {
+					t.Fatal(err)
+				} else if !ok {
+					break
+				}
+				count++
+			}
+			if count != 3 {
+				t.Fatalf("expected 3 keys, found %d", count)
+			}
+		})
+
+		t.Run("inconsistent", func(t *testing.T) {
+			iter := newIter()
+			defer iter.Close()
+			iter.Seek(MakeMVCCMetadataKey(roachpb.KeyMin))
+			if ok, err := iter.Valid(); !ok || err != nil {
+				t.Fatalf("expected valid iterator, got %t, %v", ok, err)
+			}
+			// Simulate the time-bound iterator skipping a key by advancing only
+			// the verification iterator.
+			iter.verifyIter.Next()
+			iter.Next()
+			if _, err := iter.Valid(); !testutils.IsError(err, `time-bound iterator returned key "b"/0.000000002,0, expected "c"/0.000000002,0`) {
+				t.Fatalf("expected verification error, got %v", err)
+			}
+		})
+	}, t)
+}
+
 func slurpKVsInTimeRange(
 	e Reader, prefix roachpb.Key, startTime, endTime hlc.Timestamp,
 ) ([]MVCCKeyValue, error) {
@@ -384,3 +451,136 @@ func TestMVCCIncrementalIteratorIntentRewrittenConcurrently(t *testing.T) {
 		}
 	}, t)
 }
+
+func TestMVCCExportToSST(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	ts := func(i int64) hlc.Timestamp { return hlc.Timestamp{WallTime: i} }
+	val := roachpb.MakeValueFromString("value")
+
+	readSST := func(t *testing.T, sst []byte) []MVCCKey {
+		t.Helper()
+		if sst == nil {
+			return nil
+		}
+		iter, err := NewMemSSTIterator(sst, false /* verify */)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+		var keys []MVCCKey
+		for iter.Seek(MVCCKey{Key: keyMin}); ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				break
+			}
+			keys = append(keys, iter.UnsafeKey())
+			keys[len(keys)-1].Key = append(roachpb.Key(nil), iter.UnsafeKey().Key...)
+		}
+		return keys
+	}
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			e := engineImpl.create()
+			defer e.Close()
+
+			// a: versions at 1, 2 and 3.
+			// b: version at 1, deleted at 2.
+			// c: version at 4.
+			for _, kv := range []struct {
+				key string
+				ts  int64
+			}{{"a", 1}, {"a", 2}, {"a", 3}, {"b", 1}, {"c", 4}} {
+				if err := MVCCPut(ctx, e, nil, roachpb.Key(kv.key), ts(kv.ts), val, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := MVCCDelete(ctx, e, nil, roachpb.Key("b"), ts(2), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			testCases := []struct {
+				name         string
+				start, end   hlc.Timestamp
+				allRevisions bool
+				targetSize   int64
+				expKeys      []MVCCKey
+				expResume    roachpb.Key
+			}{
+				{
+					name: "latest", end: ts(3),
+					expKeys: []MVCCKey{mvccVersionKey(roachpb.Key("a"), ts(3))},
+				},
+				{
+					name: "incremental latest", start: ts(1), end: ts(3),
+					expKeys: []MVCCKey{
+						mvccVersionKey(roachpb.Key("a"), ts(3)),
+						mvccVersionKey(roachpb.Key("b"), ts(2)),
+					},
+				},
+				{
+					name: "incremental all revisions", start: ts(1), end: ts(4), allRevisions: true,
+					expKeys: []MVCCKey{
+						mvccVersionKey(roachpb.Key("a"), ts(3)),
+						mvccVersionKey(roachpb.Key("a"), ts(2)),
+						mvccVersionKey(roachpb.Key("b"), ts(2)),
+						mvccVersionKey(roachpb.Key("c"), ts(4)),
+					},
+				},
+				{
+					name: "target size", end: ts(4), allRevisions: true, targetSize: 1,
+					expKeys: []MVCCKey{
+						mvccVersionKey(roachpb.Key("a"), ts(3)),
+						mvccVersionKey(roachpb.Key("a"), ts(2)),
+						mvccVersionKey(roachpb.Key("a"), ts(1)),
+					},
+					expResume: roachpb.Key("b"),
+				},
+				{
+					name: "empty", start: ts(4), end: ts(5),
+				},
+			}
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					sst, summary, resumeKey, err := MVCCExportToSST(
+						ctx, e, keyMin, keyMax, tc.start, tc.end, tc.allRevisions, tc.targetSize)
+					if err != nil {
+						t.Fatal(err)
+					}
+					keys := readSST(t, sst)
+					if len(keys) != len(tc.expKeys) {
+						t.Fatalf("expected %v, got %v", tc.expKeys, keys)
+					}
+					for i := range keys {
+						if !keys[i].Equal(tc.expKeys[i]) {
+							t.Fatalf("expected %v, got %v", tc.expKeys, keys)
+						}
+					}
+					if !resumeKey.Equal(tc.expResume) {
+						t.Fatalf("expected resume key %s, got %s", tc.expResume, resumeKey)
+					}
+					if (summary.DataSize == 0) != (len(tc.expKeys) == 0) {
+						t.Fatalf("unexpected data size %d for %d keys", summary.DataSize, len(keys))
+					}
+				})
+			}
+
+			// An intent in the time window results in an error.
+			txn := roachpb.MakeTransaction("test", nil, 0, ts(5), 0)
+			if err := MVCCPut(ctx, e, nil, roachpb.Key("d"), txn.OrigTimestamp, val, &txn); err != nil {
+				t.Fatal(err)
+			}
+			_, _, _, err := MVCCExportToSST(ctx, e, keyMin, keyMax, ts(4), ts(6), false, 0)
+			if _, ok := err.(*roachpb.WriteIntentError); !ok {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			}
+			// An intent outside of the time window is ignored.
+			if _, _, _, err := MVCCExportToSST(ctx, e, keyMin, keyMax, ts(0), ts(4), false, 0); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/errors"
+)
+
+// LockStrength is the strength of a lock acquired with MVCCAcquireLock.
+type LockStrength byte
+
+const (
+	// LockShared is compatible with the shared locks of other transactions,
+	// but conflicts with their exclusive locks and intents.
+	LockShared LockStrength = iota + 1
+	// LockExclusive conflicts with the locks and intents of all other
+	// transactions. It is the strength used by SELECT ... FOR UPDATE.
+	LockExclusive
+)
+
+func (s LockStrength) String() string {
+	switch s {
+	case LockShared:
+		return "shared"
+	case LockExclusive:
+		return "exclusive"
+	default:
+		return "unknown"
+	}
+}
+
+// LockRecord describes a lock held by a transaction on a key.
+type LockRecord struct {
+	Key      roachpb.Key
+	Txn      enginepb.TxnMeta
+	Strength LockStrength
+}
+
+// Lock records are stored as inline values at keys.LockKey(key, txnID), so
+// that they are replicated, split and merged along with the range containing
+// the locked key. The value is the lock strength followed by the marshaled
+// TxnMeta of the lock holder.
+
+func encodeLockRecord(txn *enginepb.TxnMeta, strength LockStrength) ([]byte, error) {
+	b, err := protoutil.Marshal(txn)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(strength)}, b...), nil
+}
+
+func decodeLockRecord(key roachpb.Key, b []byte) (LockRecord, error) {
+	if len(b) == 0 {
+		return LockRecord{}, errors.Errorf("empty lock record for key %s", key)
+	}
+	rec := LockRecord{Key: key, Strength: LockStrength(b[0])}
+	if err := protoutil.Unmarshal(b[1:], &rec.Txn); err != nil {
+		return LockRecord{}, errors.Wrapf(err, "decoding lock record for key %s", key)
+	}
+	return rec, nil
+}
+
+// mvccIterateLocks invokes f for each lock record stored in the range-local
+// keyspace [start, end).
+func mvccIterateLocks(
+	reader Reader, start, end roachpb.Key, f func(LockRecord) (bool, error),
+) error {
+	var meta enginepb.MVCCMetadata
+	return reader.Iterate(start, end, func(kv MVCCKeyValue) (bool, error) {
+		// Lock records are inline, so any versioned key belongs to some other
+		// range-local record, such as a range descriptor.
+		if kv.Key.IsValue() {
+			return false, nil
+		}
+		lockedKey, suffix, _, err := keys.DecodeRangeKey(kv.Key.Key)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(suffix, keys.LocalRangeLockSuffix) {
+			return false, nil
+		}
+		if err := protoutil.Unmarshal(kv.Value, &meta); err != nil {
+			return false, err
+		}
+		b, err := MakeValue(meta).GetBytes()
+		if err != nil {
+			return false, err
+		}
+		rec, err := decodeLockRecord(lockedKey, b)
+		if err != nil {
+			return false, err
+		}
+		return f(rec)
+	})
+}
+
+// MVCCScanLocks returns the locks held on keys in the span [key, endKey),
+// ordered by key. Conflict detection uses it to find the lock records which a
+// write or a locking read has to wait on.
+func MVCCScanLocks(
+	ctx context.Context, reader Reader, key, endKey roachpb.Key,
+) ([]LockRecord, error) {
+	if len(endKey) == 0 {
+		return nil, emptyKeyError()
+	}
+	var locks []LockRecord
+	err := mvccIterateLocks(reader,
+		keys.MakeRangeKeyPrefix(roachpb.RKey(key)), keys.MakeRangeKeyPrefix(roachpb.RKey(endKey)),
+		func(rec LockRecord) (bool, error) {
+			locks = append(locks, rec)
+			return false, nil
+		})
+	return locks, err
+}
+
+// MVCCAcquireLock records that txn holds a lock of the given strength on key,
+// without writing a provisional value. The lock conflicts with the incompatible
+// locks of other transactions on key and with their intents, in which case a
+// WriteIntentError listing the conflicting transactions is returned.
+//
+// Reacquiring a lock the transaction already holds, at the same or a weaker
+// strength, is a no-op. Reacquiring it at a stronger strength upgrades it. A
+// lock held from an earlier epoch of the transaction is replaced.
+func MVCCAcquireLock(
+	ctx context.Context,
+	rw ReadWriter,
+	ms *enginepb.MVCCStats,
+	txn *roachpb.Transaction,
+	key roachpb.Key,
+	strength LockStrength,
+) error {
+	if len(key) == 0 {
+		return emptyKeyError()
+	}
+	if txn == nil {
+		return errors.Errorf("cannot lock %s outside of a transaction", key)
+	}
+	if strength != LockShared && strength != LockExclusive {
+		return errors.Errorf("cannot lock %s with invalid strength %d", key, strength)
+	}
+
+	var existing *LockRecord
+	var conflicts []roachpb.Intent
+	prefix := keys.LockKeyPrefix(key)
+	if err := mvccIterateLocks(rw, prefix, prefix.PrefixEnd(), func(rec LockRecord) (bool, error) {
+		if rec.Txn.ID == txn.ID {
+			existing = &rec
+		} else if strength == LockExclusive || rec.Strength == LockExclusive {
+			conflicts = append(conflicts, roachpb.Intent{
+				Span: roachpb.Span{Key: key}, Status: roachpb.PENDING, Txn: rec.Txn,
+			})
+		}
+		return false, nil
+	}); err != nil {
+		return err
+	}
+
+	iter := rw.NewIterator(IterOptions{Prefix: true})
+	defer iter.Close()
+	var meta enginepb.MVCCMetadata
+	ok, _, _, err := mvccGetMetadata(iter, MakeMVCCMetadataKey(key), &meta)
+	if err != nil {
+		return err
+	}
+	if ok && meta.Txn != nil && !IsIntentOf(&meta, txn) {
+		conflicts = append(conflicts, roachpb.Intent{
+			Span: roachpb.Span{Key: key}, Status: roachpb.PENDING, Txn: *meta.Txn,
+		})
+	}
+	if len(conflicts) > 0 {
+		return &roachpb.WriteIntentError{Intents: conflicts}
+	}
+
+	if existing != nil && existing.Txn.Epoch == txn.Epoch && existing.Strength >= strength {
+		return nil
+	}
+	b, err := encodeLockRecord(&txn.TxnMeta, strength)
+	if err != nil {
+		return err
+	}
+	lockKey := keys.LockKey(key, txn.ID)
+	var value roachpb.Value
+	value.SetBytes(b)
+	value.InitChecksum(lockKey)
+	return MVCCPut(ctx, rw, ms, lockKey, hlc.Timestamp{}, value, nil /* txn */)
+}
+
+// MVCCReleaseLock releases the lock held by txn on key, if any.
+func MVCCReleaseLock(
+	ctx context.Context,
+	rw ReadWriter,
+	ms *enginepb.MVCCStats,
+	txn *roachpb.Transaction,
+	key roachpb.Key,
+) error {
+	if len(key) == 0 {
+		return emptyKeyError()
+	}
+	if txn == nil {
+		return errors.Errorf("cannot unlock %s outside of a transaction", key)
+	}
+	return MVCCDelete(ctx, rw, ms, keys.LockKey(key, txn.ID), hlc.Timestamp{}, nil /* txn */)
+}
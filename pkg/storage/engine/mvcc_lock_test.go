@@ -0,0 +1,168 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+func TestMVCCAcquireLock(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			txn3 := *txn2
+			txn3.ID = uuid.MakeV4()
+			var ms enginepb.MVCCStats
+
+			expectLocks := func(key, endKey roachpb.Key, expLocks ...LockRecord) {
+				t.Helper()
+				locks, err := MVCCScanLocks(ctx, engine, key, endKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(locks) != len(expLocks) {
+					t.Fatalf("expected %d locks, found %+v", len(expLocks), locks)
+				}
+				for i := range expLocks {
+					if !locks[i].Key.Equal(expLocks[i].Key) || locks[i].Txn.ID != expLocks[i].Txn.ID ||
+						locks[i].Strength != expLocks[i].Strength {
+						t.Fatalf("%d: expected lock %+v, found %+v", i, expLocks[i], locks[i])
+					}
+				}
+			}
+			expectConflict := func(err error, expTxns ...*roachpb.Transaction) {
+				t.Helper()
+				wiErr, ok := err.(*roachpb.WriteIntentError)
+				if !ok {
+					t.Fatalf("expected WriteIntentError, found %v", err)
+				}
+				if len(wiErr.Intents) != len(expTxns) {
+					t.Fatalf("expected %d conflicts, found %+v", len(expTxns), wiErr.Intents)
+				}
+				for i, txn := range expTxns {
+					if wiErr.Intents[i].Txn.ID != txn.ID {
+						t.Fatalf("%d: expected conflict with %s, found %+v", i, txn.ID, wiErr.Intents[i])
+					}
+				}
+			}
+
+			// txn1 locks key2 exclusively, txn2 and txn3 share a lock on key3.
+			if err := MVCCAcquireLock(ctx, engine, &ms, txn1, testKey2, LockExclusive); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCAcquireLock(ctx, engine, &ms, txn2, testKey3, LockShared); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCAcquireLock(ctx, engine, &ms, &txn3, testKey3, LockShared); err != nil {
+				t.Fatal(err)
+			}
+			shared2 := LockRecord{Key: testKey3, Txn: txn2.TxnMeta, Strength: LockShared}
+			shared3 := LockRecord{Key: testKey3, Txn: txn3.TxnMeta, Strength: LockShared}
+			if bytes.Compare(txn3.ID.GetBytes(), txn2.ID.GetBytes()) < 0 {
+				shared2, shared3 = shared3, shared2
+			}
+			exclusive1 := LockRecord{Key: testKey2, Txn: txn1.TxnMeta, Strength: LockExclusive}
+			expectLocks(testKey1, testKey6, exclusive1, shared2, shared3)
+			expectLocks(testKey3, testKey6, shared2, shared3)
+			expectLocks(testKey1, testKey2)
+
+			// Locks live in the range-local keyspace, not next to the locked key.
+			if val, _, err := MVCCGet(ctx, engine, testKey2, hlc.MaxTimestamp, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if val != nil {
+				t.Fatalf("expected no value at locked key, found %v", val)
+			}
+
+			// Reacquiring a lock by the same transaction, at the same or a weaker
+			// strength, is a no-op.
+			for _, strength := range []LockStrength{LockExclusive, LockShared} {
+				batch := engine.NewBatch()
+				before := ms
+				if err := MVCCAcquireLock(ctx, batch, &ms, txn1, testKey2, strength); err != nil {
+					t.Fatal(err)
+				}
+				if !batch.Empty() {
+					t.Fatalf("%s: expected reacquisition to not write", strength)
+				}
+				if !reflect.DeepEqual(before, ms) {
+					t.Fatalf("%s: expected unchanged stats, found diff %+v", strength, ms)
+				}
+				batch.Close()
+			}
+
+			// Conflicting locks by other transactions.
+			expectConflict(MVCCAcquireLock(ctx, engine, &ms, txn2, testKey2, LockShared), txn1)
+			expectConflict(MVCCAcquireLock(ctx, engine, &ms, txn1, testKey3, LockExclusive), txn2, &txn3)
+			expectConflict(MVCCAcquireLock(ctx, engine, &ms, txn2, testKey3, LockExclusive), &txn3)
+
+			// Intents of other transactions conflict, the transaction's own intents
+			// don't.
+			if err := MVCCPut(ctx, engine, &ms, testKey4, txn1.OrigTimestamp, value1, txn1); err != nil {
+				t.Fatal(err)
+			}
+			expectConflict(MVCCAcquireLock(ctx, engine, &ms, txn2, testKey4, LockShared), txn1)
+			if err := MVCCAcquireLock(ctx, engine, &ms, txn1, testKey4, LockExclusive); err != nil {
+				t.Fatal(err)
+			}
+
+			// Releasing the other share allows txn2 to upgrade its lock.
+			if err := MVCCReleaseLock(ctx, engine, &ms, &txn3, testKey3); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCAcquireLock(ctx, engine, &ms, txn2, testKey3, LockExclusive); err != nil {
+				t.Fatal(err)
+			}
+			exclusive4 := LockRecord{Key: testKey4, Txn: txn1.TxnMeta, Strength: LockExclusive}
+			expectLocks(testKey3, testKey6,
+				LockRecord{Key: testKey3, Txn: txn2.TxnMeta, Strength: LockExclusive}, exclusive4)
+
+			// Releasing a lock that isn't held is a no-op.
+			if err := MVCCReleaseLock(ctx, engine, &ms, &txn3, testKey3); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCReleaseLock(ctx, engine, &ms, txn2, testKey3); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCReleaseLock(ctx, engine, &ms, txn1, testKey2); err != nil {
+				t.Fatal(err)
+			}
+			expectLocks(testKey1, testKey6, exclusive4)
+
+			// The lock records are accounted for as system data.
+			iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			actMS, err := iter.ComputeStats(roachpb.KeyMin, roachpb.KeyMax, ms.LastUpdateNanos)
+			iter.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ms.SysCount != 1 {
+				t.Fatalf("expected a single system key, found %+v", ms)
+			}
+			if !reflect.DeepEqual(ms, actMS) {
+				t.Fatalf("expected stats %+v, computed %+v", ms, actMS)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils/mvccdata"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
+)
+
+// writeMVCCTestData writes the versions and intents of d to rw.
+func writeMVCCTestData(t testing.TB, rw ReadWriter, d *mvccdata.Data) {
+	t.Helper()
+	ctx := context.Background()
+	for i := range d.Keys {
+		k := &d.Keys[i]
+		for j := len(k.Versions) - 1; j >= 0; j-- {
+			v := k.Versions[j]
+			var err error
+			if v.Value.IsPresent() {
+				err = MVCCPut(ctx, rw, nil /* ms */, k.Key, v.Timestamp, v.Value, nil /* txn */)
+			} else {
+				err = MVCCDelete(ctx, rw, nil /* ms */, k.Key, v.Timestamp, nil /* txn */)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if k.Intent != nil {
+			txn := &roachpb.Transaction{
+				TxnMeta:       d.IntentTxn(k),
+				OrigTimestamp: k.Intent.Timestamp,
+			}
+			if err := MVCCPut(ctx, rw, nil /* ms */, k.Key, k.Intent.Timestamp, k.Intent.Value, txn); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func checkIntents(t *testing.T, debug string, intents, expIntents []roachpb.Intent) {
+	t.Helper()
+	if len(intents) != len(expIntents) {
+		t.Fatalf("%s: expected intents %v, got %v", debug, expIntents, intents)
+	}
+	for i := range intents {
+		if !intents[i].Key.Equal(expIntents[i].Key) || intents[i].Txn.ID != expIntents[i].Txn.ID ||
+			intents[i].Txn.Timestamp != expIntents[i].Txn.Timestamp {
+			t.Fatalf("%s: expected intents %v, got %v", debug, expIntents, intents)
+		}
+	}
+}
+
+// TestMVCCOracle compares the results of gets and scans over random data to
+// those of the mvccdata oracle.
+func TestMVCCOracle(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	rng, seed := randutil.NewPseudoRand()
+	log.Infof(ctx, "seed is %d", seed)
+	d := mvccdata.New(seed, mvccdata.Options{
+		NumKeys:        500,
+		MaxVersions:    5,
+		ValueBytes:     16,
+		TombstoneRatio: 0.2,
+		IntentRatio:    0.1,
+	})
+
+	randKey := func() roachpb.Key {
+		k := d.Keys[rng.Intn(len(d.Keys))].Key
+		if rng.Intn(2) == 0 {
+			// Keys in between the generated ones.
+			k = k.Next()
+		}
+		return k
+	}
+	randTimestamp := func() hlc.Timestamp {
+		return hlc.Timestamp{WallTime: 1 + rng.Int63n(d.MaxTimestamp.WallTime+10)}
+	}
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+			writeMVCCTestData(t, engine, d)
+
+			for i := 0; i < 200; i++ {
+				ts := randTimestamp()
+				tombstones := rng.Intn(2) == 0
+
+				key := randKey()
+				value, intent, err := MVCCGet(ctx, engine, key, ts, MVCCGetOptions{
+					Inconsistent: true, Tombstones: tombstones,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expValue, expIntent := d.Get(key, ts, tombstones)
+				if (value == nil) != (expValue == nil) ||
+					(value != nil && (!bytes.Equal(value.RawBytes, expValue.RawBytes) || value.Timestamp != expValue.Timestamp)) {
+					t.Fatalf("get %s@%s: expected %v, got %v", key, ts, expValue, value)
+				}
+				var intents, expIntents []roachpb.Intent
+				if intent != nil {
+					intents = append(intents, *intent)
+				}
+				if expIntent != nil {
+					expIntents = append(expIntents, *expIntent)
+				}
+				checkIntents(t, "get", intents, expIntents)
+
+				start, end := randKey(), randKey()
+				if end.Compare(start) < 0 {
+					start, end = end, start
+				}
+				kvs, _, intents, err := MVCCScan(ctx, engine, start, end.Next(), math.MaxInt64, ts, MVCCScanOptions{
+					Inconsistent: true, Tombstones: tombstones,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expKVs, expIntents := d.Scan(start, end.Next(), ts, tombstones)
+				if len(kvs) != len(expKVs) {
+					t.Fatalf("scan [%s,%s]@%s: expected %d kvs, got %d", start, end, ts, len(expKVs), len(kvs))
+				}
+				for j := range kvs {
+					if !kvs[j].Key.Equal(expKVs[j].Key) || kvs[j].Value.Timestamp != expKVs[j].Value.Timestamp ||
+						!bytes.Equal(kvs[j].Value.RawBytes, expKVs[j].Value.RawBytes) {
+						t.Fatalf("scan [%s,%s]@%s: expected %v at %d, got %v", start, end, ts, expKVs[j], j, kvs[j])
+					}
+				}
+				checkIntents(t, "scan", intents, expIntents)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// mvccScanTraceInterval is the number of keys between the progress events of
+// a traced scan.
+const mvccScanTraceInterval = 1000
+
+// mvccScanTrace records the milestones of a scan as events of the tracing
+// span of its context. See MVCCScanOptions.Trace.
+type mvccScanTrace struct {
+	ctx   context.Context
+	start time.Time
+	// next is the number of keys at which the next progress event is recorded.
+	next int64
+}
+
+// newMVCCScanTrace returns a trace for a scan with the given options, or nil
+// if the scan isn't to be traced.
+func newMVCCScanTrace(
+	ctx context.Context, key, endKey roachpb.Key, opts MVCCScanOptions,
+) *mvccScanTrace {
+	if !opts.Trace {
+		return nil
+	}
+	if sp := opentracing.SpanFromContext(ctx); sp == nil || !tracing.IsRecording(sp) {
+		return nil
+	}
+	log.Eventf(ctx, "scan %s: opening iterator", roachpb.Span{Key: key, EndKey: endKey})
+	return &mvccScanTrace{ctx: ctx, start: timeutil.Now(), next: 1}
+}
+
+// opened records that the iterator of the scan was opened.
+func (t *mvccScanTrace) opened() {
+	log.Eventf(t.ctx, "scan: iterator opened after %s", timeutil.Since(t.start))
+}
+
+// added records that the scan returned a key, bringing the totals of the keys
+// and of their key and value bytes to numKeys and numBytes.
+func (t *mvccScanTrace) added(numKeys, numBytes int64) {
+	if numKeys < t.next {
+		return
+	}
+	if numKeys == 1 {
+		log.Eventf(t.ctx, "scan: first key after %s", timeutil.Since(t.start))
+		t.next = mvccScanTraceInterval
+		return
+	}
+	log.Eventf(t.ctx, "scan: %d keys, %d bytes after %s", numKeys, numBytes, timeutil.Since(t.start))
+	t.next += mvccScanTraceInterval
+}
+
+// done records the completion of the scan.
+func (t *mvccScanTrace) done(numKeys, numBytes int64, err error) {
+	if err != nil {
+		log.Eventf(t.ctx, "scan: failed after %d keys, %d bytes in %s: %v",
+			numKeys, numBytes, timeutil.Since(t.start), err)
+		return
+	}
+	log.Eventf(t.ctx, "scan: done with %d keys, %d bytes in %s",
+		numKeys, numBytes, timeutil.Since(t.start))
+}
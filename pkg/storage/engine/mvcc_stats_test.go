@@ -13,6 +13,7 @@ package engine
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 	"testing"
@@ -1599,3 +1600,239 @@ func TestMVCCComputeStatsError(t *testing.T) {
 		})
 	}
 }
+
+func TestMVCCComputeStatsWithHistogram(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// 10 small values and 5 large ones, two versions each.
+			for i := 0; i < 15; i++ {
+				size := 10
+				if i >= 10 {
+					size = 1000
+				}
+				key := roachpb.Key(fmt.Sprintf("key-%02d", i))
+				value := roachpb.MakeValueFromBytes(make([]byte, size))
+				for ts := int64(1); ts <= 2; ts++ {
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: ts}, value, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			defer iter.Close()
+
+			expMS, h, err := MVCCComputeStatsWithHistogram(iter, keyMin, keyMax, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != nil {
+				t.Fatalf("unexpected histogram %+v", h)
+			}
+			ms, h, err := MVCCComputeStatsWithHistogram(iter, keyMin, keyMax, 10, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ms != expMS {
+				t.Fatalf("expected stats %+v, got %+v", expMS, ms)
+			}
+
+			var numKeys, numValues int64
+			for i := range h.KeySizes {
+				numKeys += h.KeySizes[i]
+				numValues += h.ValueSizes[i]
+			}
+			if numKeys != 30 || numValues != 30 {
+				t.Fatalf("expected 30 keys and values, got %d and %d", numKeys, numValues)
+			}
+			// Values carry a 5 byte header: 15 bytes fall in [8, 16) and 1005 bytes
+			// in [512, 1024).
+			if a := h.ValueSizes[4]; a != 20 {
+				t.Errorf("expected 20 values in bucket 4, got %d", a)
+			}
+			if a := h.ValueSizes[10]; a != 10 {
+				t.Errorf("expected 10 values in bucket 10, got %d", a)
+			}
+		})
+	}
+}
+
+func TestMVCCComputeStatsSampled(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	const numKeys = 2000
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for i := 0; i < numKeys; i++ {
+				key := roachpb.Key(fmt.Sprintf("key-%05d", i))
+				value := roachpb.MakeValueFromString(fmt.Sprintf("value-%d", i))
+				ts := hlc.Timestamp{WallTime: int64(i%3) + 1}
+				if err := MVCCPut(ctx, engine, nil, key, ts, value, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			defer iter.Close()
+
+			exact, err := iter.ComputeStats(roachpb.KeyMin, roachpb.KeyMax, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A sample rate of 1 computes exact stats.
+			ms, err := MVCCComputeStatsSampled(iter, roachpb.KeyMin, roachpb.KeyMax, 100, 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t, exact, ms)
+
+			// Sampled stats are deterministic for a given seed and are flagged as
+			// estimates.
+			ms1, err := MVCCComputeStatsSampled(iter, roachpb.KeyMin, roachpb.KeyMax, 100, 0.5, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms2, err := MVCCComputeStatsSampled(iter, roachpb.KeyMin, roachpb.KeyMax, 100, 0.5, 42)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.Equal(t, ms1, ms2)
+			if !ms1.ContainsEstimates {
+				t.Fatal("expected sampled stats to contain estimates")
+			}
+			if ms1.KeyCount < numKeys*8/10 || ms1.KeyCount > numKeys*12/10 {
+				t.Fatalf("expected key count near %d, got %d", numKeys, ms1.KeyCount)
+			}
+			if ms1.LiveBytes < exact.LiveBytes*8/10 || ms1.LiveBytes > exact.LiveBytes*12/10 {
+				t.Fatalf("expected live bytes near %d, got %d", exact.LiveBytes, ms1.LiveBytes)
+			}
+
+			// A sample rate just below 1 samples every key but still returns
+			// estimates.
+			ms, err = MVCCComputeStatsSampled(
+				iter, roachpb.KeyMin, roachpb.KeyMax, 100, 0.9999999999999999, 42,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ms.KeyCount != exact.KeyCount || ms.LiveBytes != exact.LiveBytes {
+				t.Fatalf("expected %d keys and %d live bytes, got %d and %d",
+					exact.KeyCount, exact.LiveBytes, ms.KeyCount, ms.LiveBytes)
+			}
+
+			for _, rate := range []float64{0, -0.5, 1.5} {
+				if _, err := MVCCComputeStatsSampled(
+					iter, roachpb.KeyMin, roachpb.KeyMax, 100, rate, 0,
+				); !testutils.IsError(err, "must be in") {
+					t.Fatalf("rate %f: expected error, got %v", rate, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	if th := sampleThreshold(0.9999999999999999); th < math.MaxUint64-1<<11 {
+		t.Fatalf("expected a threshold close to %d, got %d", uint64(math.MaxUint64), th)
+	}
+	if th := sampleThreshold(1); th != math.MaxUint64 {
+		t.Fatalf("expected %d, got %d", uint64(math.MaxUint64), th)
+	}
+	if th := sampleThreshold(0.5); th != 1<<63 {
+		t.Fatalf("expected %d, got %d", uint64(1<<63), th)
+	}
+}
+
+func TestMVCCVerifyStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// Write a live key, a deleted key and an intent, so that the stats
+			// contain ages.
+			var ms enginepb.MVCCStats
+			ts1, ts2 := hlc.Timestamp{WallTime: 1e9}, hlc.Timestamp{WallTime: 2e9}
+			if err := MVCCPut(ctx, engine, &ms, testKey1, ts1, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, &ms, testKey2, ts1, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCDelete(ctx, engine, &ms, testKey2, ts2, nil); err != nil {
+				t.Fatal(err)
+			}
+			txn := makeTxn(*txn1, ts2)
+			if err := MVCCPut(ctx, engine, &ms, testKey3, txn.OrigTimestamp, value3, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			// The claimed stats were last updated at ts2, and are aged to match.
+			for _, nowNanos := range []int64{ts2.WallTime, 10e9} {
+				recomputed, ok, err := MVCCVerifyStats(ctx, engine, roachpb.KeyMin, roachpb.KeyMax, ms, nowNanos)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					t.Fatalf("now=%d: expected stats %+v to match %+v", nowNanos, ms, recomputed)
+				}
+				if recomputed.LastUpdateNanos != nowNanos {
+					t.Fatalf("expected stats computed at %d, found %+v", nowNanos, recomputed)
+				}
+				if recomputed.GCBytesAge == 0 || recomputed.IntentAge == 0 {
+					t.Fatalf("expected non-zero ages, found %+v", recomputed)
+				}
+			}
+
+			// A deliberate error in any counter is detected, including the ages.
+			for _, corrupt := range []func(*enginepb.MVCCStats){
+				func(ms *enginepb.MVCCStats) { ms.LiveBytes++ },
+				func(ms *enginepb.MVCCStats) { ms.KeyCount-- },
+				func(ms *enginepb.MVCCStats) { ms.GCBytesAge += 10 },
+				func(ms *enginepb.MVCCStats) { ms.IntentAge-- },
+			} {
+				claimed := ms
+				corrupt(&claimed)
+				_, ok, err := MVCCVerifyStats(ctx, engine, roachpb.KeyMin, roachpb.KeyMax, claimed, 10e9)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					t.Fatalf("expected claimed stats %+v to mismatch", claimed)
+				}
+			}
+
+			// Neither the update time nor the estimates flag count as a mismatch.
+			claimed := ms
+			claimed.ContainsEstimates = true
+			if _, ok, err := MVCCVerifyStats(ctx, engine, roachpb.KeyMin, roachpb.KeyMax, claimed, 10e9); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				t.Fatalf("expected claimed stats %+v to match", claimed)
+			}
+
+			// Stats are verified for the requested span only.
+			if _, ok, err := MVCCVerifyStats(ctx, engine, testKey1, testKey2, ms, 10e9); err != nil {
+				t.Fatal(err)
+			} else if ok {
+				t.Fatal("expected stats of the whole keyspace to mismatch a sub-span")
+			}
+		})
+	}
+}
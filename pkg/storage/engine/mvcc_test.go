@@ -36,10 +36,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 	"github.com/cockroachdb/cockroach/pkg/util/shuffle"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/gogo/protobuf/proto"
 	"github.com/kr/pretty"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -303,12 +305,77 @@ func TestMVCCStatsAddSubForward(t *testing.T) {
 	cmp(neg, exp)
 }
 
+func TestMVCCStatsSafeAddSubtract(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ms := enginepb.MVCCStats{KeyBytes: 10, KeyCount: 1, LiveBytes: 10, LiveCount: 1}
+	delta := enginepb.MVCCStats{KeyBytes: 5, KeyCount: 1}
+
+	// Without overflows or negative fields, the results are those of Add and
+	// Subtract.
+	expMS := ms
+	expMS.Add(delta)
+	if err := ms.SafeAdd(delta); err != nil {
+		t.Fatal(err)
+	}
+	if ms != expMS {
+		t.Fatalf("expected %+v, got %+v", expMS, ms)
+	}
+	expMS.Subtract(delta)
+	if err := ms.SafeSubtract(delta); err != nil {
+		t.Fatal(err)
+	}
+	if ms != expMS {
+		t.Fatalf("expected %+v, got %+v", expMS, ms)
+	}
+
+	// Underflows are reported, leaving the stats unchanged.
+	if err := ms.SafeSubtract(delta); err != nil {
+		t.Fatal(err)
+	}
+	expMS = ms
+	if err := ms.SafeSubtract(delta); !testutils.IsError(err, `MVCCStats.KeyCount: difference of 0 and 1 is negative`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if ms != expMS {
+		t.Fatalf("expected %+v, got %+v", expMS, ms)
+	}
+	neg := enginepb.MVCCStats{LiveBytes: -20}
+	if err := ms.SafeAdd(neg); !testutils.IsError(err, `MVCCStats.LiveBytes: sum of 10 and -20 is negative`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Estimates may be negative.
+	estimate := delta
+	estimate.ContainsEstimates = true
+	if err := ms.SafeSubtract(estimate); err != nil {
+		t.Fatal(err)
+	}
+	if ms.KeyCount != -1 || !ms.ContainsEstimates {
+		t.Fatalf("unexpected stats %+v", ms)
+	}
+
+	// Overflows are reported in both directions.
+	big := enginepb.MVCCStats{SysBytes: math.MaxInt64}
+	if err := big.SafeAdd(enginepb.MVCCStats{SysBytes: 1}); !testutils.IsError(err, `MVCCStats.SysBytes: sum of .* overflows`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := big.SafeSubtract(enginepb.MVCCStats{SysBytes: -1}); !testutils.IsError(err, `MVCCStats.SysBytes: difference of .* overflows`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if big.SysBytes != math.MaxInt64 {
+		t.Fatalf("expected the stats to be left unchanged, got %+v", big)
+	}
+}
+
 // Verify the sort ordering of successive keys with metadata and
 // versioned values. In particular, the following sequence of keys /
 // versions:
 //
 // a
 // a<t=max>
+// a<t=1,2>
+// a<t=1,1>
 // a<t=1>
 // a<t=0>
 // a\x00
@@ -322,6 +389,8 @@ func TestMVCCKeys(t *testing.T) {
 	keys := mvccKeys{
 		mvccKey(aKey),
 		mvccVersionKey(aKey, hlc.Timestamp{WallTime: math.MaxInt64}),
+		mvccVersionKey(aKey, hlc.Timestamp{WallTime: 1, Logical: 2}),
+		mvccVersionKey(aKey, hlc.Timestamp{WallTime: 1, Logical: 1}),
 		mvccVersionKey(aKey, hlc.Timestamp{WallTime: 1}),
 		mvccVersionKey(aKey, hlc.Timestamp{Logical: 1}),
 		mvccKey(a0Key),
@@ -336,6 +405,77 @@ func TestMVCCKeys(t *testing.T) {
 	if !reflect.DeepEqual(sortKeys, keys) {
 		t.Errorf("expected keys to sort in order %s, but got %s", keys, sortKeys)
 	}
+
+	// The comparator of the engines orders the encoded keys the same way.
+	for i := range keys {
+		for j := range keys {
+			if c, expected := MVCCKeyCompare(EncodeKey(keys[i]), EncodeKey(keys[j])), compareInts(i, j); c != expected {
+				t.Errorf("MVCCKeyCompare(%s, %s) = %d, expected %d", keys[i], keys[j], c, expected)
+			}
+		}
+	}
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// TestMVCCEqualWallTimeOrder verifies that the versions of a key with the same
+// wall time, which result from clock collisions, are iterated in descending
+// order of their logical ticks regardless of the order they were written in.
+func TestMVCCEqualWallTimeOrder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	rng, _ := randutil.NewPseudoRand()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			const numVersions = 10
+			logicals := rng.Perm(numVersions)
+			for i, logical := range logicals {
+				// Write the versions directly: MVCCPut would push those below the
+				// latest one above it.
+				ts := hlc.Timestamp{WallTime: 5, Logical: int32(logical)}
+				if err := engine.Put(mvccVersionKey(testKey1, ts), value1.RawBytes); err != nil {
+					t.Fatal(err)
+				}
+				// Flush midway so that the versions are split across the memtable
+				// and sstables.
+				if i == numVersions/2 {
+					if err := engine.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			iter := engine.NewIterator(IterOptions{UpperBound: testKey2})
+			defer iter.Close()
+			var found []hlc.Timestamp
+			for iter.Seek(MakeMVCCMetadataKey(testKey1)); ; iter.Next() {
+				if ok, err := iter.Valid(); err != nil {
+					t.Fatal(err)
+				} else if !ok {
+					break
+				}
+				found = append(found, iter.UnsafeKey().Timestamp)
+			}
+			var expected []hlc.Timestamp
+			for logical := numVersions - 1; logical >= 0; logical-- {
+				expected = append(expected, hlc.Timestamp{WallTime: 5, Logical: int32(logical)})
+			}
+			if !reflect.DeepEqual(found, expected) {
+				t.Fatalf("expected versions %s, found %s", expected, found)
+			}
+		})
+	}
 }
 
 func TestMVCCEmptyKey(t *testing.T) {
@@ -473,6 +613,211 @@ func TestMVCCPutWithoutTxn(t *testing.T) {
 	}
 }
 
+func TestMVCCPutWithOptionsReturnPrevValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	opts := MVCCWriteOptions{ReturnPrevValue: true}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			expectPrev := func(prev *roachpb.Value, exp *roachpb.Value) {
+				t.Helper()
+				if exp == nil {
+					if prev != nil {
+						t.Fatalf("expected no previous value, got %v", prev)
+					}
+					return
+				}
+				if prev == nil || !bytes.Equal(prev.RawBytes, exp.RawBytes) {
+					t.Fatalf("expected previous value %v, got %v", exp, prev)
+				}
+			}
+
+			// Versioned puts.
+			prev, err := MVCCPutWithOptions(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, nil)
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 3}, value2, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, &value1)
+
+			// A write below the latest version is pushed above it, and sees the
+			// value that is latest as of the new write timestamp.
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 2}, value3, nil, opts)
+			if _, ok := err.(*roachpb.WriteTooOldError); !ok {
+				t.Fatalf("expected WriteTooOldError, got %v", err)
+			}
+			expectPrev(prev, &value2)
+
+			// A deletion tombstone is not returned as a previous value.
+			if err := MVCCDelete(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 5}, nil); err != nil {
+				t.Fatal(err)
+			}
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 6}, value4, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, nil)
+
+			// Transactional writes see the transaction's own earlier writes.
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 10})
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey2, txn.OrigTimestamp, value1, txn, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, nil)
+			txn.Sequence++
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey2, txn.OrigTimestamp, value2, txn, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, &value1)
+
+			// The returned value doesn't alias the memory of the engine, which
+			// can be overwritten after the call.
+			txn.Sequence++
+			if err := MVCCPut(ctx, engine, nil, testKey2, txn.OrigTimestamp, value3, txn); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 100; i++ {
+				key := roachpb.Key(fmt.Sprintf("overwrite-%03d", i))
+				if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expectPrev(prev, &value1)
+
+			// Inline puts.
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey3, hlc.Timestamp{}, value1, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, nil)
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey3, hlc.Timestamp{}, value2, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, &value1)
+
+			// Without ReturnPrevValue, no value is returned.
+			prev, err = MVCCPutWithOptions(ctx, engine, nil, testKey3, hlc.Timestamp{}, value3, nil, MVCCWriteOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPrev(prev, nil)
+
+			for key, exp := range map[string]roachpb.Value{string(testKey1): value4, string(testKey3): value3} {
+				value, _, err := MVCCGet(ctx, engine, roachpb.Key(key), hlc.Timestamp{WallTime: 6}, MVCCGetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if value == nil || !bytes.Equal(value.RawBytes, exp.RawBytes) {
+					t.Fatalf("%s: expected %v, got %v", key, exp, value)
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCWriteOptionsDryRun(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	dryRun := MVCCWriteOptions{DryRun: true}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			var ms enginepb.MVCCStats
+			if err := MVCCPut(ctx, engine, &ms, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 2})
+			if err := MVCCPut(ctx, engine, &ms, testKey2, txn.OrigTimestamp, value2, txn); err != nil {
+				t.Fatal(err)
+			}
+			expKVs, err := Scan(engine, keys.MinKey, keys.MaxKey, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expMS := ms
+
+			ts := hlc.Timestamp{WallTime: 5}
+			for i, tc := range []struct {
+				write  func() error
+				expErr string
+			}{
+				{write: func() error {
+					_, err := MVCCPutWithOptions(ctx, engine, &ms, testKey3, ts, value3, nil, dryRun)
+					return err
+				}},
+				{write: func() error {
+					_, err := MVCCPutWithOptions(ctx, engine, &ms, testKey3, ts, value3, nil,
+						MVCCWriteOptions{DryRun: true, ReturnPrevValue: true})
+					return err
+				}},
+				{write: func() error {
+					_, err := MVCCPutWithOptions(ctx, engine, &ms, testKey2, ts, value3, nil, dryRun)
+					return err
+				}, expErr: "conflicting intents"},
+				{write: func() error {
+					_, err := MVCCPutWithOptions(ctx, engine, &ms, testKey1, hlc.Timestamp{Logical: 1}, value3, nil, dryRun)
+					return err
+				}, expErr: "WriteTooOldError"},
+				{write: func() error {
+					return MVCCConditionalPutWithOptions(ctx, engine, &ms, testKey1, ts, value3, &value1,
+						CPutFailIfMissing, nil, dryRun)
+				}},
+				{write: func() error {
+					return MVCCConditionalPutWithOptions(ctx, engine, &ms, testKey1, ts, value3, &value2,
+						CPutFailIfMissing, nil, dryRun)
+				}, expErr: "unexpected value"},
+				{write: func() error {
+					_, err := MVCCDeleteWithOptions(ctx, engine, &ms, testKey1, ts, nil, dryRun)
+					return err
+				}},
+			} {
+				if err := tc.write(); !testutils.IsError(err, tc.expErr) {
+					t.Fatalf("%d: expected error %q, got %v", i, tc.expErr, err)
+				}
+				// Neither the engine nor the stats are modified.
+				kvs, err := Scan(engine, keys.MinKey, keys.MaxKey, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(kvs, expKVs) {
+					t.Fatalf("%d: expected engine contents %v, got %v", i, expKVs, kvs)
+				}
+				if ms != expMS {
+					t.Fatalf("%d: expected stats %+v, got %+v", i, expMS, ms)
+				}
+			}
+
+			// The same writes are performed without the option.
+			if err := MVCCConditionalPutWithOptions(ctx, engine, &ms, testKey1, ts, value3, &value1,
+				CPutFailIfMissing, nil, MVCCWriteOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if ms == expMS {
+				t.Fatal("expected the stats to be updated")
+			}
+			if val, _, err := MVCCGet(ctx, engine, testKey1, ts, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if val == nil || !bytes.Equal(val.RawBytes, value3.RawBytes) {
+				t.Fatalf("expected %v, got %v", value3, val)
+			}
+		})
+	}
+}
+
 // TestMVCCPutOutOfOrder tests a scenario where a put operation of an
 // older timestamp comes after a put operation of a newer timestamp.
 func TestMVCCPutOutOfOrder(t *testing.T) {
@@ -638,6 +983,155 @@ func TestMVCCIncrement(t *testing.T) {
 	}
 }
 
+func TestMVCCIncrementWithBounds(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for i, tc := range []struct {
+				inc, min, max int64
+				expVal        int64
+				expClamped    bool
+			}{
+				{5, 0, 10, 5, false},
+				{5, 0, 10, 10, false},
+				{1, 0, 10, 10, true},
+				{-15, 0, 10, 0, true},
+				{-1, -5, 10, -1, false},
+				// Overflow is clamped too.
+				{math.MaxInt64, 0, math.MaxInt64, math.MaxInt64 - 1, false},
+				{2, 0, math.MaxInt64, math.MaxInt64, true},
+				{math.MinInt64, math.MinInt64, 0, -1, false},
+			} {
+				ts := hlc.Timestamp{WallTime: int64(i + 1)}
+				newVal, clamped, err := MVCCIncrementWithBounds(
+					ctx, engine, nil, testKey1, ts, nil, tc.inc, tc.min, tc.max)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if newVal != tc.expVal || clamped != tc.expClamped {
+					t.Errorf("%d: expected %d (clamped=%t), got %d (clamped=%t)",
+						i, tc.expVal, tc.expClamped, newVal, clamped)
+				}
+				// The value is readable as a regular integer.
+				val, _, err := MVCCGet(ctx, engine, testKey1, ts, MVCCGetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i, err := val.GetInt(); err != nil {
+					t.Fatal(err)
+				} else if i != newVal {
+					t.Errorf("expected stored value %d, got %d", newVal, i)
+				}
+			}
+
+			if _, _, err := MVCCIncrementWithBounds(
+				ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 100}, nil, 1, 10, 0,
+			); !testutils.IsError(err, "invalid bounds") {
+				t.Fatalf("expected invalid bounds error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCIncrementBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts1 := hlc.Timestamp{WallTime: 1}
+			if _, err := MVCCIncrement(ctx, engine, nil, testKey2, ts1, nil, 5); err != nil {
+				t.Fatal(err)
+			}
+
+			var ms, expMS enginepb.MVCCStats
+			ts2 := hlc.Timestamp{WallTime: 2}
+			results, err := MVCCIncrementBatch(ctx, engine, &ms, ts2, nil, map[string]int64{
+				string(testKey3): 3,
+				string(testKey1): 1,
+				string(testKey2): -2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := map[string]int64{
+				string(testKey1): 1,
+				string(testKey2): 3,
+				string(testKey3): 3,
+			}
+			if !reflect.DeepEqual(results, expected) {
+				t.Fatalf("expected %v, got %v", expected, results)
+			}
+			// The values are stored as with MVCCIncrement, and the stats match those
+			// of individual increments.
+			for key, expVal := range expected {
+				val, _, err := MVCCGet(ctx, engine, roachpb.Key(key), ts2, MVCCGetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i, err := val.GetInt(); err != nil {
+					t.Fatal(err)
+				} else if i != expVal {
+					t.Errorf("%s: expected stored value %d, got %d", key, expVal, i)
+				}
+			}
+			expEngine := engineImpl.create()
+			defer expEngine.Close()
+			if _, err := MVCCIncrement(ctx, expEngine, nil, testKey2, ts1, nil, 5); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				if _, err := MVCCIncrement(ctx, expEngine, &expMS, key, ts2, nil, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if ms != expMS {
+				t.Errorf("expected stats %+v, got %+v", expMS, ms)
+			}
+
+			// A WriteTooOldError doesn't prevent the other increments.
+			results, err = MVCCIncrementBatch(ctx, engine, nil, ts1, nil, map[string]int64{
+				string(testKey1): 1,
+				string(testKey4): 1,
+			})
+			expTS := hlc.Timestamp{WallTime: 2, Logical: 1}
+			if wtoErr, ok := err.(*roachpb.WriteTooOldError); !ok || wtoErr.ActualTimestamp != expTS {
+				t.Fatalf("expected WriteTooOldError with actual time = %s; got %v", expTS, err)
+			}
+			expected = map[string]int64{string(testKey1): 2, string(testKey4): 1}
+			if !reflect.DeepEqual(results, expected) {
+				t.Fatalf("expected %v, got %v", expected, results)
+			}
+
+			// Non-integer values and overflows are errors.
+			if err := MVCCPut(ctx, engine, nil, testKey5, ts2, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			ts3 := hlc.Timestamp{WallTime: 3}
+			if _, err := MVCCIncrementBatch(ctx, engine, nil, ts3, nil, map[string]int64{
+				string(testKey1): 1,
+				string(testKey5): 1,
+			}); !testutils.IsError(err, "does not contain an integer value") {
+				t.Fatalf("expected integer value error, got %v", err)
+			}
+			ts4 := hlc.Timestamp{WallTime: 4}
+			if _, err := MVCCIncrementBatch(ctx, engine, nil, ts4, nil, map[string]int64{
+				string(testKey1): math.MaxInt64,
+			}); !testutils.IsError(err, "overflow") {
+				t.Fatalf("expected overflow error, got %v", err)
+			}
+		})
+	}
+}
+
 // TestMVCCIncrementTxn verifies increment behavior within a txn.
 func TestMVCCIncrementTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)()
@@ -868,34 +1362,310 @@ func TestMVCCGetNoMoreOldVersion(t *testing.T) {
 	}
 }
 
-// TestMVCCGetUncertainty verifies that the appropriate error results when
-// a transaction reads a key at a timestamp that has versions newer than that
-// timestamp, but older than the transaction's MaxTimestamp.
-func TestMVCCGetUncertainty(t *testing.T) {
+// TestMVCCGetBatch verifies that MVCCGetBatch returns the same results as
+// MVCCGet for each of the keys, in the order of the keys.
+func TestMVCCGetBatch(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
 	ctx := context.Background()
-
 	for _, engineImpl := range mvccEngineImpls {
 		t.Run(engineImpl.name, func(t *testing.T) {
-			for _, impl := range mvccGetImpls {
-				t.Run(impl.name, func(t *testing.T) {
-					mvccGet := impl.fn
-					engine := engineImpl.create()
-					defer engine.Close()
-
-					// Txn with read timestamp 7 and MaxTimestamp 10.
-					txn := &roachpb.Transaction{
-						TxnMeta: enginepb.TxnMeta{
-							ID:        uuid.MakeV4(),
-							Timestamp: hlc.Timestamp{WallTime: 7},
-						},
-						MaxTimestamp: hlc.Timestamp{WallTime: 10},
-					}
-					getOptsTxn := MVCCGetOptions{Txn: txn}
-					scanOptsTxn := MVCCScanOptions{Txn: txn}
+			engine := engineImpl.create()
+			defer engine.Close()
 
-					// Same txn but with a MaxTimestamp reduced to 9.
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 3}, value3, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey4, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			// Keys are deliberately unsorted, repeated, and include a missing key.
+			keys := []roachpb.Key{testKey4, testKey2, testKey3, testKey1, testKey2}
+			for _, ts := range []hlc.Timestamp{{WallTime: 2}, {WallTime: 4}} {
+				results, err := MVCCGetBatch(ctx, engine, keys, ts, MVCCGetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(results) != len(keys) {
+					t.Fatalf("expected %d results, got %d", len(keys), len(results))
+				}
+				for i, key := range keys {
+					expValue, _, err := MVCCGet(ctx, engine, key, ts, MVCCGetOptions{})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(expValue, results[i].Value) {
+						t.Errorf("%d: %s@%s: expected %v, got %v", i, key, ts, expValue, results[i].Value)
+					}
+				}
+			}
+
+			// Intents on several keys are returned together.
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 5})
+			for _, key := range []roachpb.Key{testKey1, testKey3} {
+				if err := MVCCPut(ctx, engine, nil, key, txn.OrigTimestamp, value5, txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts := hlc.Timestamp{WallTime: 6}
+			_, err := MVCCGetBatch(ctx, engine, keys, ts, MVCCGetOptions{})
+			if wiErr, ok := err.(*roachpb.WriteIntentError); !ok {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			} else if len(wiErr.Intents) != 2 ||
+				!wiErr.Intents[0].Key.Equal(testKey1) || !wiErr.Intents[1].Key.Equal(testKey3) {
+				t.Fatalf("unexpected intents %v", wiErr.Intents)
+			}
+
+			results, err := MVCCGetBatch(ctx, engine, keys, ts, MVCCGetOptions{Inconsistent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[2].Intent == nil || !results[2].Intent.Key.Equal(testKey3) || results[2].Value != nil {
+				t.Fatalf("expected intent and no value for %s, got %+v", testKey3, results[2])
+			}
+			if results[3].Intent == nil || !bytes.Equal(results[3].Value.RawBytes, value1.RawBytes) {
+				t.Fatalf("expected intent and value for %s, got %+v", testKey1, results[3])
+			}
+		})
+	}
+}
+
+func TestMVCCGetVersions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := func(i int64) hlc.Timestamp { return hlc.Timestamp{WallTime: i} }
+			if err := MVCCPut(ctx, engine, nil, testKey1, ts(1), value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCDelete(ctx, engine, nil, testKey1, ts(2), nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey1, ts(3), value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			txn := makeTxn(*txn1, ts(4))
+			if err := MVCCPut(ctx, engine, nil, testKey1, txn.OrigTimestamp, value3, txn); err != nil {
+				t.Fatal(err)
+			}
+			// Versions of neighboring keys aren't returned.
+			if err := MVCCPut(ctx, engine, nil, testKey1.Next(), ts(1), value4, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			kvs, err := MVCCGetVersions(ctx, engine, testKey1, MVCCGetVersionsOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 5 {
+				t.Fatalf("expected 5 records, got %v", kvs)
+			}
+			// The intent's metadata comes first.
+			var meta enginepb.MVCCMetadata
+			if kvs[0].Key.IsValue() {
+				t.Fatalf("expected metadata record first, got %s", kvs[0].Key)
+			} else if err := protoutil.Unmarshal(kvs[0].Value, &meta); err != nil {
+				t.Fatal(err)
+			} else if meta.Txn == nil || meta.Txn.ID != txn.ID {
+				t.Fatalf("unexpected intent metadata %+v", meta)
+			}
+			for i, exp := range []struct {
+				ts    hlc.Timestamp
+				value []byte
+			}{
+				{ts(4), value3.RawBytes},
+				{ts(3), value2.RawBytes},
+				{ts(2), nil},
+				{ts(1), value1.RawBytes},
+			} {
+				kv := kvs[i+1]
+				if !kv.Key.Key.Equal(testKey1) || kv.Key.Timestamp != exp.ts || !bytes.Equal(kv.Value, exp.value) {
+					t.Errorf("%d: expected %s@%s=%x, got %s=%x", i, testKey1, exp.ts, exp.value, kv.Key, kv.Value)
+				}
+			}
+
+			// The number of versions is limited by MaxVersions.
+			kvs, err = MVCCGetVersions(ctx, engine, testKey1, MVCCGetVersionsOptions{MaxVersions: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 3 || kvs[2].Key.Timestamp != ts(3) {
+				t.Fatalf("expected metadata and 2 most recent versions, got %v", kvs)
+			}
+
+			// Missing keys have no versions.
+			if kvs, err := MVCCGetVersions(ctx, engine, testKey2, MVCCGetVersionsOptions{}); err != nil {
+				t.Fatal(err)
+			} else if len(kvs) != 0 {
+				t.Fatalf("expected no versions, got %v", kvs)
+			}
+		})
+	}
+}
+
+func TestMVCCScanGroupByKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := func(i int64) hlc.Timestamp { return hlc.Timestamp{WallTime: i} }
+			// testKey1 has three versions including a tombstone, testKey2 has an
+			// intent on top of a version, and testKey3 has a single version.
+			for _, kv := range []struct {
+				key   roachpb.Key
+				ts    int64
+				value *roachpb.Value
+			}{
+				{testKey1, 1, &value1},
+				{testKey1, 2, nil},
+				{testKey1, 3, &value2},
+				{testKey2, 1, &value3},
+				{testKey3, 1, &value4},
+			} {
+				var err error
+				if kv.value == nil {
+					err = MVCCDelete(ctx, engine, nil, kv.key, ts(kv.ts), nil)
+				} else {
+					err = MVCCPut(ctx, engine, nil, kv.key, ts(kv.ts), *kv.value, nil)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			txn := makeTxn(*txn1, ts(4))
+			if err := MVCCPut(ctx, engine, nil, testKey2, txn.OrigTimestamp, value5, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			format := func(kvs []roachpb.KeyValue) []string {
+				var out []string
+				for _, group := range GroupMVCCScanResults(kvs) {
+					var versions []string
+					for _, kv := range group.Values {
+						if !kv.Key.Key.Equal(group.Key) {
+							t.Fatalf("version %s grouped under %s", kv.Key, group.Key)
+						}
+						versions = append(versions, fmt.Sprint(kv.Key.Timestamp.WallTime))
+					}
+					out = append(out, fmt.Sprintf("%s: %s", string(group.Key), strings.Join(versions, " ")))
+				}
+				return out
+			}
+
+			testCases := []struct {
+				max       int64
+				ts        int64
+				expected  []string
+				resumeKey roachpb.Key
+			}{
+				{math.MaxInt64, 3, []string{`/db1: 3 2 1`, `/db2: 1`, `/db3: 1`}, nil},
+				// max counts keys, not versions.
+				{2, 3, []string{`/db1: 3 2 1`, `/db2: 1`}, testKey3},
+				{3, 3, []string{`/db1: 3 2 1`, `/db2: 1`, `/db3: 1`}, nil},
+				{1, 2, []string{`/db1: 2 1`}, testKey2},
+				{0, 3, nil, testKey1},
+			}
+			for i, c := range testCases {
+				kvs, resumeSpan, intents, err := MVCCScan(ctx, engine, testKey1, testKey4, c.max, ts(c.ts),
+					MVCCScanOptions{GroupByKey: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(intents) != 0 {
+					t.Errorf("%d: unexpected intents %v", i, intents)
+				}
+				if out := format(kvs); !reflect.DeepEqual(out, c.expected) {
+					t.Errorf("%d: expected %q, got %q", i, c.expected, out)
+				}
+				if c.resumeKey == nil {
+					if resumeSpan != nil {
+						t.Errorf("%d: unexpected resume span %s", i, resumeSpan)
+					}
+				} else if resumeSpan == nil || !resumeSpan.Key.Equal(c.resumeKey) || !resumeSpan.EndKey.Equal(testKey4) {
+					t.Errorf("%d: expected resume span [%s,%s), got %v", i, c.resumeKey, testKey4, resumeSpan)
+				}
+			}
+
+			// The intent conflicts with consistent scans at or above its
+			// timestamp, and is returned without its provisional value by
+			// inconsistent ones.
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey4, math.MaxInt64, ts(4),
+				MVCCScanOptions{GroupByKey: true}); !testutils.IsError(err, "conflicting intents") {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			}
+			kvs, _, intents, err := MVCCScan(ctx, engine, testKey1, testKey4, math.MaxInt64, ts(4),
+				MVCCScanOptions{GroupByKey: true, Inconsistent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := []string{`/db1: 3 2 1`, `/db2: 1`, `/db3: 1`}; !reflect.DeepEqual(format(kvs), exp) {
+				t.Fatalf("expected %q, got %q", exp, format(kvs))
+			}
+			if len(intents) != 1 || !intents[0].Key.Equal(testKey2) {
+				t.Fatalf("unexpected intents %v", intents)
+			}
+
+			for _, c := range []struct {
+				max  int64
+				opts MVCCScanOptions
+				err  string
+			}{
+				{-1, MVCCScanOptions{GroupByKey: true}, "require a non-negative max"},
+				{1, MVCCScanOptions{GroupByKey: true, Reverse: true}, "Reverse is not supported"},
+				{1, MVCCScanOptions{GroupByKey: true, AllVersionsDescending: true}, "GroupByKey is not supported"},
+			} {
+				if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey4, c.max, ts(3), c.opts); !testutils.IsError(err, c.err) {
+					t.Fatalf("%+v: expected error %q, got %v", c.opts, c.err, err)
+				}
+			}
+		})
+	}
+}
+
+// TestMVCCGetUncertainty verifies that the appropriate error results when
+// a transaction reads a key at a timestamp that has versions newer than that
+// timestamp, but older than the transaction's MaxTimestamp.
+func TestMVCCGetUncertainty(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			for _, impl := range mvccGetImpls {
+				t.Run(impl.name, func(t *testing.T) {
+					mvccGet := impl.fn
+					engine := engineImpl.create()
+					defer engine.Close()
+
+					// Txn with read timestamp 7 and MaxTimestamp 10.
+					txn := &roachpb.Transaction{
+						TxnMeta: enginepb.TxnMeta{
+							ID:        uuid.MakeV4(),
+							Timestamp: hlc.Timestamp{WallTime: 7},
+						},
+						MaxTimestamp: hlc.Timestamp{WallTime: 10},
+					}
+					getOptsTxn := MVCCGetOptions{Txn: txn}
+					scanOptsTxn := MVCCScanOptions{Txn: txn}
+
+					// Same txn but with a MaxTimestamp reduced to 9.
 					txnMaxTS9 := txn.Clone()
 					txnMaxTS9.MaxTimestamp = hlc.Timestamp{WallTime: 9}
 					getOptsTxnMaxTS9 := MVCCGetOptions{Txn: txnMaxTS9}
@@ -1429,6 +2199,136 @@ func TestMVCCGetWriteIntentError(t *testing.T) {
 	}
 }
 
+func TestMVCCGetIntent(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// Neither missing keys nor committed values have intents.
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []roachpb.Key{testKey1, testKey2} {
+				if intent, ts, err := MVCCGetIntent(engine, key); err != nil || intent != nil || ts != (hlc.Timestamp{}) {
+					t.Fatalf("%s: expected no intent, got %v at %s, err=%v", key, intent, ts, err)
+				}
+			}
+
+			// Pending intents are returned along with their timestamp.
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 2})
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				if err := MVCCPut(ctx, engine, nil, key, txn.OrigTimestamp, value2, txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				intent, ts, err := MVCCGetIntent(engine, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if intent == nil {
+					t.Fatalf("%s: expected an intent", key)
+				}
+				if !intent.Key.Equal(key) || intent.Txn.ID != txn.ID || intent.Status != roachpb.PENDING {
+					t.Fatalf("%s: unexpected intent %v", key, intent)
+				}
+				if ts != txn.Timestamp {
+					t.Fatalf("%s: expected intent at %s, got %s", key, txn.Timestamp, ts)
+				}
+			}
+
+			// Once the intents of committed and aborted transactions are
+			// resolved, they're no longer returned. The pending one is.
+			for _, status := range []roachpb.TransactionStatus{roachpb.COMMITTED, roachpb.ABORTED} {
+				key := testKey1
+				if status == roachpb.ABORTED {
+					key = testKey2
+				}
+				if err := MVCCResolveWriteIntent(ctx, engine, nil, roachpb.Intent{
+					Span: roachpb.Span{Key: key}, Txn: txn.TxnMeta, Status: status,
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if intent, _, err := MVCCGetIntent(engine, key); err != nil || intent != nil {
+					t.Fatalf("%s: expected no intent, got %v, err=%v", status, intent, err)
+				}
+			}
+			if intent, _, err := MVCCGetIntent(engine, testKey3); err != nil || intent == nil {
+				t.Fatalf("expected a pending intent, got %v, err=%v", intent, err)
+			}
+		})
+	}
+}
+
+func TestMVCCGetTimestamp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts1, ts3, ts5 := hlc.Timestamp{WallTime: 1}, hlc.Timestamp{WallTime: 3}, hlc.Timestamp{WallTime: 5}
+			for _, key := range []roachpb.Key{testKey1, testKey2} {
+				if err := MVCCPut(ctx, engine, nil, key, ts1, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := MVCCDelete(ctx, engine, nil, testKey1, ts3, nil); err != nil {
+				t.Fatal(err)
+			}
+			txn := makeTxn(*txn1, ts5)
+			if err := MVCCPut(ctx, engine, nil, testKey2, txn.OrigTimestamp, value2, txn); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey3, hlc.Timestamp{}, value3, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, tc := range []struct {
+				key          roachpb.Key
+				asOf         hlc.Timestamp
+				expTS        hlc.Timestamp
+				expTombstone bool
+				expErr       string
+			}{
+				{key: testKey1, asOf: hlc.Timestamp{Logical: 1}},
+				{key: testKey1, asOf: ts1, expTS: ts1},
+				{key: testKey1, asOf: hlc.Timestamp{WallTime: 2}, expTS: ts1},
+				{key: testKey1, asOf: ts5, expTS: ts3, expTombstone: true},
+				// The intent above asOf is ignored, and the one at or below it is an
+				// error.
+				{key: testKey2, asOf: hlc.Timestamp{WallTime: 4}, expTS: ts1},
+				{key: testKey2, asOf: ts5, expErr: "conflicting intents"},
+				{key: testKey3, asOf: ts5, expErr: "inline value"},
+				{key: testKey4, asOf: ts5},
+			} {
+				ts, tombstone, err := MVCCGetTimestamp(engine, tc.key, tc.asOf)
+				if tc.expErr != "" {
+					if !testutils.IsError(err, tc.expErr) {
+						t.Errorf("%d: expected error %q, got %v", i, tc.expErr, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%d: %+v", i, err)
+				}
+				if ts != tc.expTS || tombstone != tc.expTombstone {
+					t.Errorf("%d: expected %s (tombstone=%t), got %s (tombstone=%t)",
+						i, tc.expTS, tc.expTombstone, ts, tombstone)
+				}
+			}
+		})
+	}
+}
+
 func mkVal(s string, ts hlc.Timestamp) roachpb.Value {
 	v := roachpb.MakeValueFromString(s)
 	v.Timestamp = ts
@@ -1732,6 +2632,47 @@ func TestMVCCGetProtoInconsistent(t *testing.T) {
 	}
 }
 
+func TestMVCCGetProtoVerifiesChecksum(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			if err := MVCCPutProto(ctx, engine, nil, testKey1, ts, nil, &ts); err != nil {
+				t.Fatal(err)
+			}
+			var val hlc.Timestamp
+			if found, err := MVCCGetProto(ctx, engine, testKey1, ts, &val, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if !found || val != ts {
+				t.Fatalf("expected %s, found %s (found=%t)", ts, val, found)
+			}
+
+			// Write the same value to another key, without recomputing its
+			// checksum.
+			value, _, err := MVCCGet(ctx, engine, testKey1, ts, MVCCGetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			value.Timestamp = hlc.Timestamp{}
+			if err := MVCCPut(ctx, engine, nil, testKey2, ts, *value, nil); err != nil {
+				t.Fatal(err)
+			}
+			found, err := MVCCGetProto(ctx, engine, testKey2, ts, &val, MVCCGetOptions{})
+			if !testutils.IsError(err, "invalid checksum") {
+				t.Fatalf("expected checksum error, found %v", err)
+			}
+			if !found {
+				t.Fatal("expected the value to be found")
+			}
+		})
+	}
+}
+
 // Regression test for #28205: MVCCGet and MVCCScan, FindSplitKey, and
 // ComputeStats need to invalidate the cached iterator data.
 func TestMVCCInvalidateIterator(t *testing.T) {
@@ -1890,21 +2831,2028 @@ func mvccScanTest(ctx context.Context, t *testing.T, engine Engine) {
 	}
 }
 
-func TestMVCCScan(t *testing.T) {
-	defer leaktest.AfterTest(t)()
+func TestMVCCScan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			mvccScanTest(ctx, t, engine)
+		})
+	}
+}
+
+func TestMVCCScanMaxNum(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey3, hlc.Timestamp{WallTime: 1}, value3, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey4, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey6, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			kvs, resumeSpan, _, err := MVCCScan(ctx, engine, testKey2, testKey4, 1,
+				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 ||
+				!bytes.Equal(kvs[0].Key, testKey2) ||
+				!bytes.Equal(kvs[0].Value.RawBytes, value2.RawBytes) {
+				t.Fatal("the value should not be empty")
+			}
+			if expected := (roachpb.Span{Key: testKey3, EndKey: testKey4}); !resumeSpan.EqualValue(expected) {
+				t.Fatalf("expected = %+v, resumeSpan = %+v", expected, resumeSpan)
+			}
+
+			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey2, testKey4, 0,
+				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 0 {
+				t.Fatal("the value should be empty")
+			}
+			if expected := (roachpb.Span{Key: testKey2, EndKey: testKey4}); !resumeSpan.EqualValue(expected) {
+				t.Fatalf("expected = %+v, resumeSpan = %+v", expected, resumeSpan)
+			}
+
+			// Note: testKey6, though not scanned directly, is important in testing that
+			// the computed resume span does not extend beyond the upper bound of a scan.
+			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey4, testKey5, 1,
+				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 {
+				t.Fatalf("expected 1 key but got %d", len(kvs))
+			}
+			if resumeSpan != nil {
+				t.Fatalf("resumeSpan = %+v", resumeSpan)
+			}
+
+			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey5, testKey6.Next(), 1,
+				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{Reverse: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 {
+				t.Fatalf("expected 1 key but got %d", len(kvs))
+			}
+			if resumeSpan != nil {
+				t.Fatalf("resumeSpan = %+v", resumeSpan)
+			}
+		})
+	}
+}
+
+func TestMVCCScanTargetBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			keys := []roachpb.Key{testKey1, testKey2, testKey3, testKey4}
+			values := []roachpb.Value{value1, value2, value3, value4}
+			for i := range keys {
+				if err := MVCCPut(ctx, engine, nil, keys[i], ts, values[i], nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// All keys and values have the same length.
+			kvSize := int64(len(EncodeKey(MVCCKey{Key: testKey1, Timestamp: ts})) + len(value1.RawBytes))
+
+			testCases := []struct {
+				targetBytes int64
+				reverse     bool
+				expKeys     []roachpb.Key
+				expResume   *roachpb.Span
+			}{
+				{0, false, keys, nil},
+				{1, false, keys[:1], &roachpb.Span{Key: testKey2, EndKey: testKey5}},
+				{kvSize, false, keys[:1], &roachpb.Span{Key: testKey2, EndKey: testKey5}},
+				{kvSize + 1, false, keys[:2], &roachpb.Span{Key: testKey3, EndKey: testKey5}},
+				{3 * kvSize, false, keys[:3], &roachpb.Span{Key: testKey4, EndKey: testKey5}},
+				{4 * kvSize, false, keys, nil},
+				{1, true, []roachpb.Key{testKey4}, &roachpb.Span{Key: testKey1, EndKey: testKey3.Next()}},
+				{kvSize + 1, true, []roachpb.Key{testKey4, testKey3}, &roachpb.Span{Key: testKey1, EndKey: testKey2.Next()}},
+				{4 * kvSize, true, []roachpb.Key{testKey4, testKey3, testKey2, testKey1}, nil},
+			}
+			for _, tc := range testCases {
+				t.Run(fmt.Sprintf("target=%d,reverse=%t", tc.targetBytes, tc.reverse), func(t *testing.T) {
+					res, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+						MVCCScanOptions{TargetBytes: tc.targetBytes, Reverse: tc.reverse})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var actual []roachpb.Key
+					for _, data := range res.KVData {
+						for len(data) > 0 {
+							var k MVCCKey
+							k, _, data, err = MVCCScanDecodeKeyValue(data)
+							if err != nil {
+								t.Fatal(err)
+							}
+							actual = append(actual, k.Key)
+						}
+					}
+					if !reflect.DeepEqual(tc.expKeys, actual) {
+						t.Fatalf("expected keys %s, got %s", tc.expKeys, actual)
+					}
+					if res.NumKeys != int64(len(tc.expKeys)) {
+						t.Fatalf("expected %d keys, got %d", len(tc.expKeys), res.NumKeys)
+					}
+					if expBytes := kvSize * int64(len(tc.expKeys)); res.NumBytes != expBytes {
+						t.Fatalf("expected %d bytes, got %d", expBytes, res.NumBytes)
+					}
+					if !reflect.DeepEqual(tc.expResume, res.ResumeSpan) {
+						t.Fatalf("expected resume span %+v, got %+v", tc.expResume, res.ResumeSpan)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestMVCCScanCallback(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// Write enough keys to require multiple internal scans, deleting every
+			// tenth key.
+			const numKeys = 2500
+			for i := 0; i < numKeys; i++ {
+				key := roachpb.Key(fmt.Sprintf("key-%05d", i))
+				value := roachpb.MakeValueFromString(fmt.Sprintf("value-%d", i))
+				if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 1}, value, nil); err != nil {
+					t.Fatal(err)
+				}
+				if i%10 == 0 {
+					if err := MVCCDelete(ctx, engine, nil, key, hlc.Timestamp{WallTime: 2}, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			start, end := roachpb.Key("key-"), roachpb.Key("key-99999")
+			ts := hlc.Timestamp{WallTime: 3}
+			for _, max := range []int64{0, 1, 999, 1000, 1001, 2100, math.MaxInt64} {
+				for _, reverse := range []bool{false, true} {
+					for _, tombstones := range []bool{false, true} {
+						name := fmt.Sprintf("max=%d,reverse=%t,tombstones=%t", max, reverse, tombstones)
+						t.Run(name, func(t *testing.T) {
+							opts := MVCCScanOptions{Reverse: reverse, Tombstones: tombstones}
+							expKVs, expResume, _, err := MVCCScan(ctx, engine, start, end, max, ts, opts)
+							if err != nil {
+								t.Fatal(err)
+							}
+							var kvs []roachpb.KeyValue
+							resume, _, err := MVCCScanCallback(ctx, engine, start, end, max, ts, opts,
+								func(k MVCCKey, v []byte) error {
+									kvs = append(kvs, roachpb.KeyValue{
+										Key: append(roachpb.Key(nil), k.Key...),
+										Value: roachpb.Value{
+											RawBytes:  append([]byte(nil), v...),
+											Timestamp: k.Timestamp,
+										},
+									})
+									return nil
+								})
+							if err != nil {
+								t.Fatal(err)
+							}
+							if len(kvs) != len(expKVs) {
+								t.Fatalf("expected %d kvs, got %d", len(expKVs), len(kvs))
+							}
+							for i := range kvs {
+								if !kvs[i].Key.Equal(expKVs[i].Key) ||
+									!bytes.Equal(kvs[i].Value.RawBytes, expKVs[i].Value.RawBytes) ||
+									kvs[i].Value.Timestamp != expKVs[i].Value.Timestamp {
+									t.Fatalf("%d: expected %v, got %v", i, expKVs[i], kvs[i])
+								}
+							}
+							if !reflect.DeepEqual(expResume, resume) {
+								t.Fatalf("expected resume span %+v, got %+v", expResume, resume)
+							}
+						})
+					}
+				}
+			}
+
+			// An error returned by the callback aborts the scan.
+			expErr := errors.New("abort")
+			var calls int
+			_, _, err := MVCCScanCallback(ctx, engine, start, end, math.MaxInt64, ts, MVCCScanOptions{},
+				func(MVCCKey, []byte) error {
+					calls++
+					if calls == 5 {
+						return expErr
+					}
+					return nil
+				})
+			if err != expErr {
+				t.Fatalf("expected %v, got %v", expErr, err)
+			}
+			if calls != 5 {
+				t.Fatalf("expected callback to be invoked 5 times, got %d", calls)
+			}
+
+			// A value transform is applied as for MVCCScan.
+			opts := MVCCScanOptions{
+				ValueTransform: func(k MVCCKey, v []byte) ([]byte, error) {
+					if k.Key[len(k.Key)-1]%2 == 1 {
+						return nil, ErrDropKey
+					}
+					return []byte("redacted"), nil
+				},
+			}
+			expKVs, _, _, err := MVCCScan(ctx, engine, start, end, math.MaxInt64, ts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kvs []string
+			if _, _, err := MVCCScanCallback(ctx, engine, start, end, math.MaxInt64, ts, opts,
+				func(k MVCCKey, v []byte) error {
+					kvs = append(kvs, string(k.Key)+"="+string(v))
+					return nil
+				}); err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != len(expKVs) {
+				t.Fatalf("expected %d kvs, got %d", len(expKVs), len(kvs))
+			}
+			for i := range kvs {
+				if exp := string(expKVs[i].Key) + "=" + string(expKVs[i].Value.RawBytes); kvs[i] != exp {
+					t.Fatalf("%d: expected %s, got %s", i, exp, kvs[i])
+				}
+			}
+
+			// The options only supported by MVCCScan are rejected.
+			for _, opts := range []MVCCScanOptions{
+				{StopAtFirstIntent: true},
+				{MaxIntents: 1},
+				{AllVersionsDescending: true},
+				{GroupByKey: true},
+			} {
+				if _, _, err := MVCCScanCallback(ctx, engine, start, end, math.MaxInt64, ts, opts,
+					func(MVCCKey, []byte) error { return nil },
+				); !testutils.IsError(err, "is not supported by MVCCScanCallback") {
+					t.Fatalf("%+v: unexpected error %v", opts, err)
+				}
+			}
+			if _, _, err := MVCCScanCallback(ctx, engine, start, end, -1, ts, MVCCScanOptions{},
+				func(MVCCKey, []byte) error { return nil },
+			); !testutils.IsError(err, "requires a non-negative max") {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// An intent in a later chunk fails the scan after the callback was
+			// invoked on the pairs of the preceding chunks.
+			txn := makeTxn(*txn1, ts)
+			if err := MVCCPut(ctx, engine, nil, roachpb.Key("key-01999"), txn.OrigTimestamp, value1, txn); err != nil {
+				t.Fatal(err)
+			}
+			calls = 0
+			resume, intents, err := MVCCScanCallback(ctx, engine, start, end, math.MaxInt64, ts, MVCCScanOptions{},
+				func(MVCCKey, []byte) error {
+					calls++
+					return nil
+				})
+			if _, ok := err.(*roachpb.WriteIntentError); !ok {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			}
+			if resume != nil || intents != nil {
+				t.Fatalf("unexpected resume span %v and intents %v", resume, intents)
+			}
+			if calls == 0 {
+				t.Fatal("expected the callback to be invoked on the preceding chunks")
+			}
+		})
+	}
+}
+
+// TestMVCCReverseScanExclusiveEndKey verifies that a reverse scan can be
+// resumed strictly below the last key it returned by passing that key as the
+// exclusive end key.
+func TestMVCCReverseScanExclusiveEndKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3, testKey4} {
+				if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := MVCCScanOptions{Reverse: true}
+			ts := hlc.Timestamp{WallTime: 1}
+			kvs, resumeSpan, _, err := MVCCScan(ctx, engine, testKey1, testKey5, 2, ts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 2 || !kvs[0].Key.Equal(testKey4) || !kvs[1].Key.Equal(testKey3) {
+				t.Fatalf("unexpected scan results %v", kvs)
+			}
+			if expSpan := (roachpb.Span{Key: testKey1, EndKey: testKey2.Next()}); resumeSpan == nil ||
+				!resumeSpan.Equal(expSpan) {
+				t.Fatalf("expected resume span %s, got %v", expSpan, resumeSpan)
+			}
+
+			// Resuming strictly below the last returned key, with the limit hit again
+			// exactly at the end of the span.
+			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey1, kvs[1].Key, 2, ts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 2 || !kvs[0].Key.Equal(testKey2) || !kvs[1].Key.Equal(testKey1) {
+				t.Fatalf("unexpected scan results %v", kvs)
+			}
+			if resumeSpan != nil {
+				t.Fatalf("expected no resume span, got %s", resumeSpan)
+			}
+
+			// The end key itself is never returned.
+			kvs, _, _, err = MVCCScan(ctx, engine, testKey1, testKey2, math.MaxInt64, ts, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 || !kvs[0].Key.Equal(testKey1) {
+				t.Fatalf("unexpected scan results %v", kvs)
+			}
+		})
+	}
+}
+
+func TestMVCCScanPrefix(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			keys := []roachpb.Key{
+				roachpb.Key("a"), roachpb.Key("a/1"), roachpb.Key("a/2"), roachpb.Key("b"),
+			}
+			for _, key := range keys {
+				for i := int64(1); i <= 2; i++ {
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: i}, value1, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			ts := hlc.Timestamp{WallTime: 1}
+			for _, tc := range []struct {
+				prefix, key, endKey roachpb.Key
+				reverse             bool
+				expKeys             []roachpb.Key
+			}{
+				// A prefix spanning several keys.
+				{keys[0], keys[0], keys[0].PrefixEnd(), false, keys[:3]},
+				{keys[0], keys[1], keys[0].PrefixEnd(), true, keys[1:3]},
+				// A prefix scan of a single key uses a prefix iterator.
+				{keys[1], keys[1], keys[1].Next(), false, keys[1:2]},
+				{keys[1], keys[1], keys[1].Next(), true, keys[1:2]},
+				{roachpb.Key("a/0"), roachpb.Key("a/0"), roachpb.Key("a/0").Next(), false, nil},
+			} {
+				kvs, _, _, err := MVCCScan(ctx, engine, tc.key, tc.endKey, math.MaxInt64, ts,
+					MVCCScanOptions{Prefix: tc.prefix, Reverse: tc.reverse})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var actual []roachpb.Key
+				for _, kv := range kvs {
+					actual = append(actual, kv.Key)
+					if kv.Value.Timestamp != ts {
+						t.Errorf("%s: expected timestamp %s, got %s", kv.Key, ts, kv.Value.Timestamp)
+					}
+				}
+				if tc.reverse {
+					for i, j := 0, len(actual)-1; i < j; i, j = i+1, j-1 {
+						actual[i], actual[j] = actual[j], actual[i]
+					}
+				}
+				if !reflect.DeepEqual(actual, tc.expKeys) {
+					t.Errorf("scan of prefix %s over [%s,%s): expected %v, got %v",
+						tc.prefix, tc.key, tc.endKey, tc.expKeys, actual)
+				}
+			}
+
+			// The scan span must be contained within the prefix.
+			if _, _, _, err := MVCCScan(ctx, engine, keys[0], keys[3], math.MaxInt64, ts,
+				MVCCScanOptions{Prefix: keys[1]}); !testutils.IsError(err, "not contained in prefix") {
+				t.Fatalf("expected prefix containment error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanIntentsOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				for i := int64(1); i <= 3; i++ {
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: i}, value1, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			txn1ts := makeTxn(*txn1, hlc.Timestamp{WallTime: 5})
+			if err := MVCCPut(ctx, engine, nil, testKey2, txn1ts.OrigTimestamp, value2, txn1ts); err != nil {
+				t.Fatal(err)
+			}
+			txn2ts := makeTxn(*txn2, hlc.Timestamp{WallTime: 6})
+			if err := MVCCPut(ctx, engine, nil, testKey4, txn2ts.OrigTimestamp, value2, txn2ts); err != nil {
+				t.Fatal(err)
+			}
+
+			// Intents are returned regardless of the read timestamp, and without
+			// raising a WriteIntentError.
+			opts := MVCCScanOptions{IntentsOnly: true}
+			kvs, resumeSpan, intents, err := MVCCScan(
+				ctx, engine, testKey1, testKey5, math.MaxInt64, hlc.Timestamp{WallTime: 1}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 0 || resumeSpan != nil {
+				t.Fatalf("expected only intents, got %v and resume span %v", kvs, resumeSpan)
+			}
+			if len(intents) != 2 ||
+				!intents[0].Key.Equal(testKey2) || intents[0].Txn.ID != txn1.ID ||
+				!intents[1].Key.Equal(testKey4) || intents[1].Txn.ID != txn2.ID {
+				t.Fatalf("unexpected intents %v", intents)
+			}
+
+			// The number of intents is limited by max.
+			_, resumeSpan, intents, err = MVCCScan(
+				ctx, engine, testKey1, testKey5, 1, hlc.Timestamp{WallTime: 1}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(intents) != 1 || !intents[0].Key.Equal(testKey2) {
+				t.Fatalf("unexpected intents %v", intents)
+			}
+			if expSpan := (roachpb.Span{Key: testKey4, EndKey: testKey5}); resumeSpan == nil ||
+				!resumeSpan.Equal(expSpan) {
+				t.Fatalf("expected resume span %s, got %v", expSpan, resumeSpan)
+			}
+
+			opts.Reverse = true
+			if _, _, _, err := MVCCScan(
+				ctx, engine, testKey1, testKey5, math.MaxInt64, hlc.Timestamp{WallTime: 1}, opts,
+			); !testutils.IsError(err, "cannot be reversed") {
+				t.Fatalf("expected reverse scan error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanColumnFamilyIDs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	tablePrefix := roachpb.Key(keys.MakeTablePrefix(50))
+	familyKey := func(row int, family uint32) roachpb.Key {
+		key := encoding.EncodeVarintAscending(append(roachpb.Key(nil), tablePrefix...), int64(row))
+		return keys.MakeFamilyKey(key, family)
+	}
+	// A table key without a family suffix is always returned.
+	unsuffixed := encoding.EncodeBytesAscending(append(roachpb.Key(nil), tablePrefix...), []byte("x"))
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			for row := 0; row < 3; row++ {
+				for family := uint32(0); family < 3; family++ {
+					if err := MVCCPut(ctx, engine, nil, familyKey(row, family), ts, value1, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := MVCCPut(ctx, engine, nil, unsuffixed, ts, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			// An intent in a skipped family doesn't fail the scan.
+			txn := makeTxn(*txn2, hlc.Timestamp{WallTime: 2})
+			if err := MVCCPut(ctx, engine, nil, familyKey(1, 2), txn.OrigTimestamp, value2, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			readTS := hlc.Timestamp{WallTime: 3}
+			testCases := []struct {
+				families  []uint32
+				max       int64
+				reverse   bool
+				expKeys   []roachpb.Key
+				expResume bool
+			}{
+				{
+					families: []uint32{1},
+					max:      math.MaxInt64,
+					expKeys:  []roachpb.Key{familyKey(0, 1), familyKey(1, 1), familyKey(2, 1), unsuffixed},
+				},
+				{
+					families: []uint32{1},
+					max:      math.MaxInt64,
+					reverse:  true,
+					expKeys:  []roachpb.Key{unsuffixed, familyKey(2, 1), familyKey(1, 1), familyKey(0, 1)},
+				},
+				{
+					families:  []uint32{0, 1},
+					max:       3,
+					expKeys:   []roachpb.Key{familyKey(0, 0), familyKey(0, 1), familyKey(1, 0)},
+					expResume: true,
+				},
+			}
+			for _, tc := range testCases {
+				t.Run(fmt.Sprintf("families=%v/max=%d/reverse=%t", tc.families, tc.max, tc.reverse), func(t *testing.T) {
+					kvs, resumeSpan, _, err := MVCCScan(ctx, engine, tablePrefix, tablePrefix.PrefixEnd(), tc.max,
+						readTS, MVCCScanOptions{ColumnFamilyIDs: tc.families, Reverse: tc.reverse})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(kvs) != len(tc.expKeys) {
+						t.Fatalf("expected keys %v, found %v", tc.expKeys, kvs)
+					}
+					for i := range kvs {
+						if !kvs[i].Key.Equal(tc.expKeys[i]) {
+							t.Fatalf("expected keys %v, found %v", tc.expKeys, kvs)
+						}
+					}
+					if (resumeSpan != nil) != tc.expResume {
+						t.Fatalf("unexpected resume span %v", resumeSpan)
+					}
+				})
+			}
+
+			// Without the projection, the intent is encountered.
+			if _, _, _, err := MVCCScan(ctx, engine, tablePrefix, tablePrefix.PrefixEnd(), math.MaxInt64,
+				readTS, MVCCScanOptions{}); !testutils.IsError(err, "conflicting intents") {
+				t.Fatalf("expected WriteIntentError, found %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanKeysOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts1 := hlc.Timestamp{WallTime: 1}
+			ts2 := hlc.Timestamp{WallTime: 2}
+			ts3 := hlc.Timestamp{WallTime: 3}
+			for i, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				if err := MVCCPut(ctx, engine, nil, key, ts1, []roachpb.Value{value1, value2, value3}[i], nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := MVCCDelete(ctx, engine, nil, testKey3, ts2, nil); err != nil {
+				t.Fatal(err)
+			}
+			txn := makeTxn(*txn1, ts3)
+			if err := MVCCPut(ctx, engine, nil, testKey4, txn.OrigTimestamp, value4, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			decode := func(res MVCCScanResult) ([]roachpb.Key, [][]byte) {
+				t.Helper()
+				var keys []roachpb.Key
+				var values [][]byte
+				for _, data := range res.KVData {
+					for len(data) > 0 {
+						var k MVCCKey
+						var v []byte
+						var err error
+						k, v, data, err = MVCCScanDecodeKeyValue(data)
+						if err != nil {
+							t.Fatal(err)
+						}
+						keys = append(keys, k.Key)
+						values = append(values, v)
+					}
+				}
+				return keys, values
+			}
+
+			for _, reverse := range []bool{false, true} {
+				for _, tombstones := range []bool{false, true} {
+					t.Run(fmt.Sprintf("reverse=%t,tombstones=%t", reverse, tombstones), func(t *testing.T) {
+						opts := MVCCScanOptions{Txn: txn, Reverse: reverse, Tombstones: tombstones}
+						full, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts3, opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						opts.KeysOnly = true
+						res, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts3, opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if full.KeysOnly || !res.KeysOnly {
+							t.Fatalf("expected only the keys-only scan to be flagged, found %t and %t",
+								full.KeysOnly, res.KeysOnly)
+						}
+
+						expKeys := []roachpb.Key{testKey1, testKey2, testKey4}
+						if tombstones {
+							expKeys = []roachpb.Key{testKey1, testKey2, testKey3, testKey4}
+						}
+						if reverse {
+							for i, j := 0, len(expKeys)-1; i < j; i, j = i+1, j-1 {
+								expKeys[i], expKeys[j] = expKeys[j], expKeys[i]
+							}
+						}
+						if fullKeys, _ := decode(full); !reflect.DeepEqual(expKeys, fullKeys) {
+							t.Fatalf("expected keys %s, got %s", expKeys, fullKeys)
+						}
+						keys, values := decode(res)
+						if !reflect.DeepEqual(expKeys, keys) {
+							t.Fatalf("expected keys %s, got %s", expKeys, keys)
+						}
+						if res.NumKeys != int64(len(expKeys)) {
+							t.Fatalf("expected %d keys, got %d", len(expKeys), res.NumKeys)
+						}
+						for i, v := range values {
+							if len(v) != 0 {
+								t.Fatalf("%s: expected empty value, got %x", keys[i], v)
+							}
+						}
+						if res.NumBytes >= full.NumBytes {
+							t.Fatalf("expected fewer than %d bytes, got %d", full.NumBytes, res.NumBytes)
+						}
+
+						kvs, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts3, opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if len(kvs) != len(expKeys) {
+							t.Fatalf("expected %d kvs, got %d", len(expKeys), len(kvs))
+						}
+						for i, kv := range kvs {
+							if !kv.Key.Equal(expKeys[i]) || len(kv.Value.RawBytes) != 0 {
+								t.Fatalf("%d: expected %s with an empty value, got %s=%x",
+									i, expKeys[i], kv.Key, kv.Value.RawBytes)
+							}
+						}
+					})
+				}
+			}
+
+			// TargetBytes only counts the returned keys.
+			target := int64(MVCCKey{Key: testKey1, Timestamp: ts1}.EncodedSize()) + 1
+			for _, keysOnly := range []bool{false, true} {
+				res, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts3,
+					MVCCScanOptions{TargetBytes: target, KeysOnly: keysOnly})
+				if err != nil {
+					t.Fatal(err)
+				}
+				expKeys := []roachpb.Key{testKey1}
+				expResume := &roachpb.Span{Key: testKey2, EndKey: testKey5}
+				if keysOnly {
+					expKeys = []roachpb.Key{testKey1, testKey2}
+					expResume = &roachpb.Span{Key: testKey3, EndKey: testKey5}
+				}
+				if keys, _ := decode(res); !reflect.DeepEqual(expKeys, keys) {
+					t.Fatalf("keysOnly=%t: expected keys %s, got %s", keysOnly, expKeys, keys)
+				}
+				if !reflect.DeepEqual(expResume, res.ResumeSpan) {
+					t.Fatalf("keysOnly=%t: expected resume span %+v, got %+v", keysOnly, expResume, res.ResumeSpan)
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCScanGCThreshold(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			threshold := hlc.Timestamp{WallTime: 5}
+			opts := MVCCScanOptions{GCThreshold: threshold}
+
+			scans := map[string]func(ts hlc.Timestamp) error{
+				"MVCCScan": func(ts hlc.Timestamp) error {
+					_, _, _, err := MVCCScan(ctx, engine, keyMin, keyMax, math.MaxInt64, ts, opts)
+					return err
+				},
+				"MVCCScanToBytes": func(ts hlc.Timestamp) error {
+					_, err := MVCCScanToBytes(ctx, engine, keyMin, keyMax, math.MaxInt64, ts, opts)
+					return err
+				},
+				"MVCCIterate": func(ts hlc.Timestamp) error {
+					_, err := MVCCIterate(ctx, engine, keyMin, keyMax, ts, opts,
+						func(roachpb.KeyValue) (bool, error) { return false, nil })
+					return err
+				},
+			}
+			for name, scan := range scans {
+				// Reads at or below the threshold are rejected, even though the data
+				// they would return is still there.
+				for _, ts := range []hlc.Timestamp{{WallTime: 2}, threshold} {
+					err := scan(ts)
+					gcErr, ok := err.(*roachpb.BatchTimestampBeforeGCError)
+					if !ok {
+						t.Fatalf("%s at %s: expected BatchTimestampBeforeGCError, found %v", name, ts, err)
+					}
+					if gcErr.Timestamp != ts || gcErr.Threshold != threshold {
+						t.Fatalf("%s at %s: unexpected error %+v", name, ts, gcErr)
+					}
+				}
+				if err := scan(threshold.Next()); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+
+			// Without a threshold, historical reads are not checked.
+			kvs, _, _, err := MVCCScan(ctx, engine, keyMin, keyMax, math.MaxInt64,
+				hlc.Timestamp{WallTime: 2}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 {
+				t.Fatalf("expected 1 key, found %d", len(kvs))
+			}
+		})
+	}
+}
+
+// TestMVCCScanTrace verifies that traced scans record their milestones in the
+// recording span of their context.
+func TestMVCCScanTrace(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const numKeys = 1500
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ctx := context.Background()
+			for i := 0; i < numKeys; i++ {
+				key := roachpb.Key(fmt.Sprintf("%05d", i))
+				if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, trace := range []bool{false, true} {
+				traceCtx, getRecording, cancel := tracing.ContextWithRecordingSpan(ctx, "test")
+				kvs, _, _, err := MVCCScan(traceCtx, engine, keyMin, keyMax, math.MaxInt64,
+					hlc.Timestamp{WallTime: 1}, MVCCScanOptions{Trace: trace})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(kvs) != numKeys {
+					t.Fatalf("expected %d keys, got %d", numKeys, len(kvs))
+				}
+				rec := getRecording()
+				cancel()
+
+				if !trace {
+					if strings.Contains(rec.String(), "scan") {
+						t.Fatalf("expected no scan events, got:\n%s", rec)
+					}
+					continue
+				}
+				expected := []string{
+					"scan: iterator opened",
+					fmt.Sprintf("scan: done with %d keys", numKeys),
+				}
+				if engineImpl.name == "pebble" {
+					expected = append(expected, "scan: first key", "scan: 1000 keys")
+				}
+				for _, msg := range expected {
+					if tracing.FindMsgInRecording(rec, msg) == -1 {
+						t.Errorf("expected %q in recording:\n%s", msg, rec)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestMVCCScanMaxVersionsPerKey verifies that bounding the versions stepped
+// over per key doesn't change the results of a scan, and makes the scanners
+// seek past long histories instead of stepping over them.
+func TestMVCCScanMaxVersionsPerKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const numVersions = 20
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				for i := 1; i <= numVersions; i++ {
+					val := roachpb.MakeValueFromString(fmt.Sprintf("%s-%d", key, i))
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: int64(i)}, val, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			scan := func(ts hlc.Timestamp, reverse bool, maxVersions int) ([]roachpb.KeyValue, IteratorStats) {
+				t.Helper()
+				iter := engine.NewIterator(IterOptions{UpperBound: keyMax, WithStats: true})
+				defer iter.Close()
+				opts := MVCCScanOptions{Reverse: reverse, MaxVersionsPerKey: maxVersions}
+				kvs, _, _, err := mvccScanToKvs(ctx, iter, keyMin, keyMax, math.MaxInt64, ts, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return kvs, iter.Stats()
+			}
+			for _, reverse := range []bool{false, true} {
+				for _, ts := range []hlc.Timestamp{{WallTime: 1}, {WallTime: 10}, {WallTime: numVersions}} {
+					expKVs, expStats := scan(ts, reverse, 0)
+					if len(expKVs) != 3 {
+						t.Fatalf("expected 3 keys, got %d", len(expKVs))
+					}
+					kvs, stats := scan(ts, reverse, 1)
+					if !reflect.DeepEqual(kvs, expKVs) {
+						t.Fatalf("reverse=%t ts=%s: expected %v, got %v", reverse, ts, expKVs, kvs)
+					}
+					if !reverse && stats.StepCount >= expStats.StepCount {
+						t.Fatalf("reverse=%t ts=%s: expected fewer than %d steps, got %d",
+							reverse, ts, expStats.StepCount, stats.StepCount)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCScanValueTransform(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			for i, key := range []roachpb.Key{testKey1, testKey2, testKey3, testKey4} {
+				value := roachpb.MakeValueFromString(fmt.Sprintf("value%d", i+1))
+				if err := MVCCPut(ctx, engine, nil, key, ts, value, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Redact the value of testKey2 and drop testKey3.
+			redacted := roachpb.MakeValueFromString("redacted")
+			transform := func(key MVCCKey, val []byte) ([]byte, error) {
+				switch {
+				case key.Key.Equal(testKey2):
+					return redacted.RawBytes, nil
+				case key.Key.Equal(testKey3):
+					return nil, ErrDropKey
+				}
+				return val, nil
+			}
+			expected := []string{"/db1=value1", "/db2=redacted", "/db4=value4"}
+			format := func(key roachpb.Key, rawBytes []byte) string {
+				v := roachpb.Value{RawBytes: rawBytes}
+				b, err := v.GetBytes()
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fmt.Sprintf("%s=%s", string(key), b)
+			}
+
+			kvs, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{ValueTransform: transform})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []string
+			for _, kv := range kvs {
+				found = append(found, format(kv.Key, kv.Value.RawBytes))
+			}
+			if !reflect.DeepEqual(found, expected) {
+				t.Fatalf("expected %s, found %s", expected, found)
+			}
+
+			res, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{ValueTransform: transform})
+			if err != nil {
+				t.Fatal(err)
+			}
+			found = nil
+			for _, data := range res.KVData {
+				for len(data) > 0 {
+					var k MVCCKey
+					var rawBytes []byte
+					k, rawBytes, data, err = MVCCScanDecodeKeyValue(data)
+					if err != nil {
+						t.Fatal(err)
+					}
+					found = append(found, format(k.Key, rawBytes))
+				}
+			}
+			if !reflect.DeepEqual(found, expected) {
+				t.Fatalf("expected %s, found %s", expected, found)
+			}
+			if res.NumKeys != int64(len(expected)) {
+				t.Fatalf("expected %d keys, found %d", len(expected), res.NumKeys)
+			}
+
+			// Dropped keys count towards max.
+			kvs, resumeSpan, _, err := MVCCScan(ctx, engine, testKey1, testKey5, 3, ts,
+				MVCCScanOptions{ValueTransform: transform})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 2 || resumeSpan == nil || !resumeSpan.Key.Equal(testKey4) {
+				t.Fatalf("expected 2 keys and a resume span at %s, found %v and %v", testKey4, kvs, resumeSpan)
+			}
+
+			// Other errors fail the scan.
+			failing := func(MVCCKey, []byte) ([]byte, error) { return nil, errors.New("boom") }
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{ValueTransform: failing}); !testutils.IsError(err, "boom") {
+				t.Fatalf("expected transform error, found %v", err)
+			}
+			if _, err := MVCCScanToBytes(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{ValueTransform: failing}); !testutils.IsError(err, "boom") {
+				t.Fatalf("expected transform error, found %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanMultiRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3, testKey4, testKey5, testKey6} {
+				if err := MVCCPut(ctx, engine, nil, key, ts, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			descs := []roachpb.RangeDescriptor{
+				{RangeID: 1, StartKey: roachpb.RKeyMin, EndKey: roachpb.RKey(testKey3)},
+				{RangeID: 2, StartKey: roachpb.RKey(testKey3), EndKey: roachpb.RKey(testKey5)},
+				{RangeID: 3, StartKey: roachpb.RKey(testKey5), EndKey: roachpb.RKeyMax},
+			}
+			lookups := 0
+			lookupRange := func(key roachpb.RKey) (*roachpb.RangeDescriptor, error) {
+				lookups++
+				for i := range descs {
+					if descs[i].ContainsKey(key) {
+						return &descs[i], nil
+					}
+				}
+				return nil, errors.Errorf("no range for key %s", key)
+			}
+			var found []string
+			onRange := func(desc *roachpb.RangeDescriptor, kvs []roachpb.KeyValue, _ []roachpb.Intent) error {
+				var chunk []string
+				for _, kv := range kvs {
+					chunk = append(chunk, string(kv.Key))
+				}
+				found = append(found, fmt.Sprintf("r%d:%s", desc.RangeID, strings.Join(chunk, ",")))
+				return nil
+			}
+
+			for _, maxKeysPerScan := range []int64{1, 1000} {
+				t.Run(fmt.Sprintf("maxKeysPerScan=%d", maxKeysPerScan), func(t *testing.T) {
+					found, lookups = nil, 0
+					if err := mvccScanMultiRange(ctx, engine, testKey2, testKey6, ts, MVCCScanOptions{},
+						MVCCMultiRangeFuncs{LookupRange: lookupRange, OnRange: onRange}, maxKeysPerScan,
+					); err != nil {
+						t.Fatal(err)
+					}
+					expected := []string{"r1:/db2", "r2:/db3,/db4", "r3:/db5"}
+					if maxKeysPerScan == 1 {
+						expected = []string{"r1:/db2", "r2:/db3", "r2:/db4", "r3:/db5"}
+					}
+					if !reflect.DeepEqual(found, expected) {
+						t.Fatalf("expected %s, found %s", expected, found)
+					}
+					if lookups != 3 {
+						t.Fatalf("expected 3 range lookups, found %d", lookups)
+					}
+				})
+			}
+
+			// Errors of the callbacks are returned.
+			onRangeErr := func(*roachpb.RangeDescriptor, []roachpb.KeyValue, []roachpb.Intent) error {
+				return errors.New("boom")
+			}
+			if err := MVCCScanMultiRange(ctx, engine, testKey1, testKey6, ts, MVCCScanOptions{},
+				MVCCMultiRangeFuncs{LookupRange: lookupRange, OnRange: onRangeErr},
+			); !testutils.IsError(err, "boom") {
+				t.Fatalf("expected callback error, found %v", err)
+			}
+
+			// A descriptor which doesn't contain the key it was looked up for is
+			// an error, rather than an infinite loop.
+			lookupWrong := func(roachpb.RKey) (*roachpb.RangeDescriptor, error) {
+				return &descs[0], nil
+			}
+			if err := MVCCScanMultiRange(ctx, engine, testKey1, testKey6, ts, MVCCScanOptions{},
+				MVCCMultiRangeFuncs{LookupRange: lookupWrong, OnRange: onRange},
+			); !testutils.IsError(err, "does not contain key") {
+				t.Fatalf("expected descriptor error, found %v", err)
+			}
+
+			if err := MVCCScanMultiRange(ctx, engine, testKey1, testKey6, ts,
+				MVCCScanOptions{Reverse: true},
+				MVCCMultiRangeFuncs{LookupRange: lookupRange, OnRange: onRange},
+			); !testutils.IsError(err, "reverse scans are not supported") {
+				t.Fatalf("expected reverse scan error, found %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanVerifyChecksums(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			good := roachpb.MakeValueFromString("good")
+			good.InitChecksum(testKey1)
+			// A value checksummed for a different key fails verification.
+			corrupt := roachpb.MakeValueFromString("corrupt")
+			corrupt.InitChecksum(testKey1)
+			noChecksum := roachpb.MakeValueFromString("unchecked")
+			for _, kv := range []struct {
+				key   roachpb.Key
+				value roachpb.Value
+			}{
+				{testKey1, good},
+				{testKey2, corrupt},
+				{testKey3, noChecksum},
+			} {
+				if err := MVCCPut(ctx, engine, nil, kv.key, hlc.Timestamp{WallTime: 1}, kv.value, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ts := hlc.Timestamp{WallTime: 2}
+
+			// Without verification, the corrupt value is returned.
+			kvs, _, _, err := MVCCScan(ctx, engine, testKey1, testKey4, math.MaxInt64, ts, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 3 {
+				t.Fatalf("expected 3 kvs, got %v", kvs)
+			}
+
+			opts := MVCCScanOptions{VerifyChecksums: true}
+			const expErr = `db2.*invalid checksum`
+			if _, _, _, err := MVCCScan(
+				ctx, engine, testKey1, testKey4, math.MaxInt64, ts, opts,
+			); !testutils.IsError(err, expErr) {
+				t.Fatalf("expected error %q, got %v", expErr, err)
+			}
+			if _, err := MVCCScanToBytes(
+				ctx, engine, testKey1, testKey4, math.MaxInt64, ts, opts,
+			); !testutils.IsError(err, expErr) {
+				t.Fatalf("expected error %q, got %v", expErr, err)
+			}
+			if _, _, err := MVCCScanCallback(
+				ctx, engine, testKey1, testKey4, math.MaxInt64, ts, opts,
+				func(MVCCKey, []byte) error { return nil },
+			); !testutils.IsError(err, expErr) {
+				t.Fatalf("expected error %q, got %v", expErr, err)
+			}
+
+			// Values that are intact or have no checksum pass verification.
+			for _, key := range []roachpb.Key{testKey1, testKey3} {
+				kvs, _, _, err := MVCCScan(ctx, engine, key, key.Next(), math.MaxInt64, ts, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(kvs) != 1 {
+					t.Fatalf("expected 1 kv, got %v", kvs)
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCScanToBatchRepr(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+			dest := engineImpl.create()
+			defer dest.Close()
+
+			for i, key := range []roachpb.Key{testKey1, testKey2, testKey3} {
+				for ts := int64(1); ts <= 2; ts++ {
+					value := roachpb.MakeValueFromString(fmt.Sprintf("%d@%d", i, ts))
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: ts}, value, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			ts := hlc.Timestamp{WallTime: 1}
+			res, err := MVCCScanToBatchRepr(ctx, engine, testKey1, testKey4, 2, ts, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.NumKeys != 2 || res.ResumeSpan == nil || !res.ResumeSpan.Key.Equal(testKey3) {
+				t.Fatalf("unexpected result: %d keys, resume span %v", res.NumKeys, res.ResumeSpan)
+			}
+			if err := CheckMVCCScanBatchRepr(res.Repr); err != nil {
+				t.Fatal(err)
+			}
+			if err := dest.ApplyBatchRepr(res.Repr, false /* sync */); err != nil {
+				t.Fatal(err)
+			}
+
+			// The destination holds exactly the scanned versions.
+			expKVs, _, _, err := MVCCScan(ctx, engine, testKey1, testKey3, math.MaxInt64, ts, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			kvs, _, _, err := MVCCScan(ctx, dest, keyMin, keyMax, math.MaxInt64, hlc.MaxTimestamp, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(kvs, expKVs) {
+				t.Fatalf("expected %v, got %v", expKVs, kvs)
+			}
+
+			// Reprs in other formats are rejected.
+			var b RocksDBBatchBuilder
+			b.Put(mvccKey(testKey1), []byte("foo"))
+			if err := CheckMVCCScanBatchRepr(b.Finish()); !testutils.IsError(err, "not the result of an MVCC scan") {
+				t.Fatalf("unexpected error %v", err)
+			}
+			b.LogData(append([]byte(mvccScanBatchReprTag), MVCCScanBatchReprVersion+1))
+			if err := CheckMVCCScanBatchRepr(b.Finish()); !testutils.IsError(err, "unsupported MVCC scan batch repr version") {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanStopAtFirstIntent(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := hlc.Timestamp{WallTime: 1}
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3, testKey4, testKey5} {
+				if err := MVCCPut(ctx, engine, nil, key, ts, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txn := makeTxn(*txn2, hlc.Timestamp{WallTime: 2})
+			for _, key := range []roachpb.Key{testKey2, testKey5} {
+				if err := MVCCPut(ctx, engine, nil, key, txn.OrigTimestamp, value2, txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			readTS := hlc.Timestamp{WallTime: 3}
+			for _, tc := range []struct {
+				name      string
+				max       int64
+				opts      MVCCScanOptions
+				expKeys   []roachpb.Key
+				expIntent roachpb.Key
+				expResume roachpb.Span
+			}{
+				{
+					name:      "forward",
+					max:       math.MaxInt64,
+					expKeys:   []roachpb.Key{testKey1},
+					expIntent: testKey2,
+					expResume: roachpb.Span{Key: testKey2, EndKey: testKey6},
+				},
+				{
+					name:      "reverse",
+					max:       math.MaxInt64,
+					opts:      MVCCScanOptions{Reverse: true},
+					expIntent: testKey5,
+					expResume: roachpb.Span{Key: testKey1, EndKey: testKey5.Next()},
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					opts := tc.opts
+					opts.StopAtFirstIntent = true
+					kvs, resumeSpan, intents, err := MVCCScan(ctx, engine, testKey1, testKey6, tc.max, readTS, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(kvs) != len(tc.expKeys) {
+						t.Fatalf("expected keys %v, got %v", tc.expKeys, kvs)
+					}
+					for i := range kvs {
+						if !kvs[i].Key.Equal(tc.expKeys[i]) {
+							t.Fatalf("expected keys %v, got %v", tc.expKeys, kvs)
+						}
+					}
+					if len(intents) != 1 || !intents[0].Key.Equal(tc.expIntent) || intents[0].Txn.ID != txn.ID {
+						t.Fatalf("expected intent on %s, got %v", tc.expIntent, intents)
+					}
+					if resumeSpan == nil || !resumeSpan.Equal(tc.expResume) {
+						t.Fatalf("expected resume span %s, got %v", tc.expResume, resumeSpan)
+					}
+				})
+			}
+
+			// The limit applies to the clean prefix too.
+			kvs, resumeSpan, intents, err := MVCCScan(ctx, engine, testKey3, testKey6, 1, readTS,
+				MVCCScanOptions{StopAtFirstIntent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 1 || !kvs[0].Key.Equal(testKey3) || len(intents) != 1 || !intents[0].Key.Equal(testKey5) ||
+				resumeSpan == nil || !resumeSpan.Equal(roachpb.Span{Key: testKey4, EndKey: testKey6}) {
+				t.Fatalf("unexpected result %v, %v, %v", kvs, resumeSpan, intents)
+			}
+
+			// The transaction's own intents don't stop the scan.
+			kvs, resumeSpan, intents, err = MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64,
+				readTS, MVCCScanOptions{StopAtFirstIntent: true, Txn: txn})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 5 || resumeSpan != nil || len(intents) != 0 {
+				t.Fatalf("unexpected result %v, %v, %v", kvs, resumeSpan, intents)
+			}
+
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, readTS,
+				MVCCScanOptions{StopAtFirstIntent: true, Inconsistent: true},
+			); !testutils.IsError(err, "cannot stop at the first intent of an inconsistent scan") {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanMaxIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for _, key := range []roachpb.Key{testKey1, testKey2, testKey3, testKey4, testKey5} {
+				if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// The intents of another transaction on testKey2 and testKey4 conflict
+			// with the scan, but not the scanning transaction's own intent on
+			// testKey3.
+			ts := hlc.Timestamp{WallTime: 2}
+			otherTxn := makeTxn(*txn2, ts)
+			for _, key := range []roachpb.Key{testKey2, testKey4} {
+				if err := MVCCPut(ctx, engine, nil, key, otherTxn.OrigTimestamp, value2, otherTxn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			txn := makeTxn(*txn1, ts)
+			if err := MVCCPut(ctx, engine, nil, testKey3, txn.OrigTimestamp, value3, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			format := func(kvs []roachpb.KeyValue) []string {
+				var res []string
+				for _, kv := range kvs {
+					b, err := kv.Value.GetBytes()
+					if err != nil {
+						t.Fatal(err)
+					}
+					res = append(res, fmt.Sprintf("%s=%s", string(kv.Key), b))
+				}
+				return res
+			}
+			for _, tc := range []struct {
+				name       string
+				max        int64
+				reverse    bool
+				expKVs     []string
+				expIntents []roachpb.Key
+				expResume  *roachpb.Span
+			}{
+				{
+					name:       "forward",
+					max:        math.MaxInt64,
+					expKVs:     []string{"/db1=testValue1", "/db3=testValue3", "/db5=testValue1"},
+					expIntents: []roachpb.Key{testKey2, testKey4},
+				},
+				{
+					name:       "reverse",
+					max:        math.MaxInt64,
+					reverse:    true,
+					expKVs:     []string{"/db5=testValue1", "/db3=testValue3", "/db1=testValue1"},
+					expIntents: []roachpb.Key{testKey4, testKey2},
+				},
+				{
+					name:       "max",
+					max:        2,
+					expKVs:     []string{"/db1=testValue1", "/db3=testValue3"},
+					expIntents: []roachpb.Key{testKey2},
+					expResume:  &roachpb.Span{Key: testKey4, EndKey: testKey6},
+				},
+				{
+					name:       "reverse max",
+					max:        2,
+					reverse:    true,
+					expKVs:     []string{"/db5=testValue1", "/db3=testValue3"},
+					expIntents: []roachpb.Key{testKey4},
+					expResume:  &roachpb.Span{Key: testKey1, EndKey: testKey2.Next()},
+				},
+				{
+					// The limit is reached at the last key of the span.
+					name:       "max at end",
+					max:        3,
+					expKVs:     []string{"/db1=testValue1", "/db3=testValue3", "/db5=testValue1"},
+					expIntents: []roachpb.Key{testKey2, testKey4},
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					kvs, resumeSpan, intents, err := MVCCScan(ctx, engine, testKey1, testKey6, tc.max, ts,
+						MVCCScanOptions{Txn: txn, Reverse: tc.reverse, MaxIntents: 2})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if found := format(kvs); !reflect.DeepEqual(found, tc.expKVs) {
+						t.Fatalf("expected %s, found %s", tc.expKVs, found)
+					}
+					var foundIntents []roachpb.Key
+					for _, intent := range intents {
+						if intent.Txn.ID != otherTxn.ID {
+							t.Fatalf("unexpected intent %v", intent)
+						}
+						foundIntents = append(foundIntents, intent.Key)
+					}
+					if !reflect.DeepEqual(foundIntents, tc.expIntents) {
+						t.Fatalf("expected intents on %v, found %v", tc.expIntents, foundIntents)
+					}
+					if !reflect.DeepEqual(resumeSpan, tc.expResume) {
+						t.Fatalf("expected resume span %v, found %v", tc.expResume, resumeSpan)
+					}
+				})
+			}
+
+			// Paginating with the resume spans returns the pairs and intents of an
+			// unbounded scan.
+			for _, max := range []int64{1, 2} {
+				for _, reverse := range []bool{false, true} {
+					opts := MVCCScanOptions{Txn: txn, Reverse: reverse, MaxIntents: 2}
+					expKVs, _, expIntents, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, ts, opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var kvs []roachpb.KeyValue
+					var intents []roachpb.Intent
+					span := &roachpb.Span{Key: testKey1, EndKey: testKey6}
+					for span != nil {
+						var pageKVs []roachpb.KeyValue
+						var pageIntents []roachpb.Intent
+						pageKVs, span, pageIntents, err = MVCCScan(ctx, engine, span.Key, span.EndKey, max, ts, opts)
+						if err != nil {
+							t.Fatal(err)
+						}
+						kvs = append(kvs, pageKVs...)
+						intents = append(intents, pageIntents...)
+					}
+					if !reflect.DeepEqual(format(kvs), format(expKVs)) {
+						t.Fatalf("max=%d,reverse=%t: expected %s, found %s", max, reverse, format(expKVs), format(kvs))
+					}
+					if len(intents) != len(expIntents) {
+						t.Fatalf("max=%d,reverse=%t: expected intents %v, found %v", max, reverse, expIntents, intents)
+					}
+					for i := range intents {
+						if !intents[i].Key.Equal(expIntents[i].Key) {
+							t.Fatalf("max=%d,reverse=%t: expected intents %v, found %v", max, reverse, expIntents, intents)
+						}
+					}
+				}
+			}
+
+			// Past the limit, the first intents are returned in a
+			// WriteIntentError.
+			_, _, _, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, ts,
+				MVCCScanOptions{Txn: txn, MaxIntents: 1})
+			if wiErr, ok := err.(*roachpb.WriteIntentError); !ok || len(wiErr.Intents) != 1 ||
+				!wiErr.Intents[0].Key.Equal(testKey2) {
+				t.Fatalf("expected WriteIntentError with an intent on %s, got %v", testKey2, err)
+			}
+
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, ts,
+				MVCCScanOptions{Inconsistent: true, MaxIntents: 1}); !testutils.IsError(err, "inconsistent") {
+				t.Fatalf("expected error, got %v", err)
+			}
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, ts,
+				MVCCScanOptions{StopAtFirstIntent: true, MaxIntents: 1}); !testutils.IsError(err, "cannot both") {
+				t.Fatalf("expected error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanAllVersionsDescending(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for _, w := range []struct {
+				key   roachpb.Key
+				ts    int64
+				value *roachpb.Value
+			}{
+				{testKey1, 1, &value1},
+				{testKey1, 3, &value2},
+				{testKey1, 5, nil},
+				{testKey2, 2, &value1},
+				{testKey2, 3, &value3},
+				{testKey2, 4, &value4},
+				{testKey3, 0, &value1},
+			} {
+				ts := hlc.Timestamp{WallTime: w.ts}
+				var err error
+				if w.value == nil {
+					err = MVCCDelete(ctx, engine, nil, w.key, ts, nil)
+				} else {
+					err = MVCCPut(ctx, engine, nil, w.key, ts, *w.value, nil)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 6})
+			if err := MVCCPut(ctx, engine, nil, testKey4, txn.OrigTimestamp, value1, txn); err != nil {
+				t.Fatal(err)
+			}
+
+			format := func(kvs []roachpb.KeyValue) []string {
+				var res []string
+				for _, kv := range kvs {
+					val := "<tombstone>"
+					if kv.Value.IsPresent() {
+						b, err := kv.Value.GetBytes()
+						if err != nil {
+							t.Fatal(err)
+						}
+						val = string(b)
+					}
+					res = append(res, fmt.Sprintf("%s@%d=%s", string(kv.Key), kv.Value.Timestamp.WallTime, val))
+				}
+				return res
+			}
+			for _, tc := range []struct {
+				name   string
+				ts     int64
+				max    int64
+				window MVCCTimeWindow
+				exp    []string
+			}{
+				{
+					name: "all",
+					ts:   5,
+					max:  math.MaxInt64,
+					exp: []string{"/db1@5=<tombstone>", "/db2@4=testValue4", "/db1@3=testValue2",
+						"/db2@3=testValue3", "/db2@2=testValue1", "/db1@1=testValue1"},
+				},
+				{
+					name: "timestamp",
+					ts:   3,
+					max:  math.MaxInt64,
+					exp:  []string{"/db1@3=testValue2", "/db2@3=testValue3", "/db2@2=testValue1", "/db1@1=testValue1"},
+				},
+				{
+					name:   "window",
+					ts:     5,
+					max:    math.MaxInt64,
+					window: MVCCTimeWindow{Lo: hlc.Timestamp{WallTime: 2}, Hi: hlc.Timestamp{WallTime: 3}},
+					exp:    []string{"/db1@3=testValue2", "/db2@3=testValue3", "/db2@2=testValue1"},
+				},
+				{
+					name: "max",
+					ts:   5,
+					max:  2,
+					exp:  []string{"/db1@5=<tombstone>", "/db2@4=testValue4"},
+				},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					kvs, resumeSpan, intents, err := MVCCScan(ctx, engine, testKey1, testKey5, tc.max,
+						hlc.Timestamp{WallTime: tc.ts},
+						MVCCScanOptions{AllVersionsDescending: true, TimeWindow: tc.window})
+					if err != nil {
+						t.Fatal(err)
+					}
+					if found := format(kvs); !reflect.DeepEqual(found, tc.exp) {
+						t.Fatalf("expected %s, found %s", tc.exp, found)
+					}
+					if resumeSpan != nil || len(intents) != 0 {
+						t.Fatalf("unexpected resume span %v and intents %v", resumeSpan, intents)
+					}
+				})
+			}
+
+			// Paginate two versions at a time, resuming at the timestamp of the
+			// last version returned and skipping those already returned at it.
+			// This crosses the versions of testKey1 and testKey2 that share
+			// timestamp 3.
+			var paginated []string
+			var window MVCCTimeWindow
+			var lastKey roachpb.Key
+			var atLast int64
+			for {
+				kvs, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, 2+atLast,
+					hlc.Timestamp{WallTime: 5},
+					MVCCScanOptions{AllVersionsDescending: true, TimeWindow: window})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var page []roachpb.KeyValue
+				for _, kv := range kvs {
+					if lastKey != nil && kv.Value.Timestamp == window.Hi && bytes.Compare(kv.Key, lastKey) <= 0 {
+						continue
+					}
+					page = append(page, kv)
+				}
+				if len(page) == 0 {
+					break
+				}
+				paginated = append(paginated, format(page)...)
+				for _, kv := range page {
+					if kv.Value.Timestamp != window.Hi {
+						window.Hi, atLast = kv.Value.Timestamp, 0
+					}
+					lastKey = kv.Key
+					atLast++
+				}
+			}
+			if exp := []string{"/db1@5=<tombstone>", "/db2@4=testValue4", "/db1@3=testValue2",
+				"/db2@3=testValue3", "/db2@2=testValue1", "/db1@1=testValue1"}; !reflect.DeepEqual(paginated, exp) {
+				t.Fatalf("expected %s, found %s", exp, paginated)
+			}
+
+			// The intent conflicts with consistent scans at or above its
+			// timestamp, and is returned without its provisional value by
+			// inconsistent ones.
+			ts := hlc.Timestamp{WallTime: 6}
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{AllVersionsDescending: true}); !testutils.IsError(err, "conflicting intents") {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			}
+			kvs, _, intents, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{AllVersionsDescending: true, Inconsistent: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != 6 || len(intents) != 1 || !intents[0].Key.Equal(testKey4) {
+				t.Fatalf("unexpected versions %s and intents %v", format(kvs), intents)
+			}
+
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, math.MaxInt64, ts,
+				MVCCScanOptions{AllVersionsDescending: true, Reverse: true}); !testutils.IsError(err, "Reverse is not supported") {
+				t.Fatalf("expected error, got %v", err)
+			}
+			if _, _, _, err := MVCCScan(ctx, engine, testKey1, testKey5, 0, ts,
+				MVCCScanOptions{AllVersionsDescending: true}); !testutils.IsError(err, "require a positive max") {
+				t.Fatalf("expected error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCDeleteSkipTombstoneIfAbsent(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	opts := MVCCWriteOptions{SkipTombstoneIfAbsent: true}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			numVersions := func(key roachpb.Key) int {
+				t.Helper()
+				var n int
+				if err := engine.Iterate(key, key.Next(), func(kv MVCCKeyValue) (bool, error) {
+					if kv.Key.IsValue() {
+						n++
+					}
+					return false, nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}
+			deleteKey := func(key roachpb.Key, ts hlc.Timestamp, txn *roachpb.Transaction) bool {
+				t.Helper()
+				written, err := MVCCDeleteWithOptions(ctx, engine, nil, key, ts, txn, opts)
+				if _, ok := err.(*roachpb.WriteTooOldError); err != nil && !ok {
+					t.Fatal(err)
+				}
+				return written
+			}
+
+			// Absent keys are not deleted, and the stats are untouched.
+			var ms enginepb.MVCCStats
+			if written, err := MVCCDeleteWithOptions(
+				ctx, engine, &ms, testKey1, hlc.Timestamp{WallTime: 1}, nil, opts,
+			); err != nil {
+				t.Fatal(err)
+			} else if written || numVersions(testKey1) != 0 || ms != (enginepb.MVCCStats{}) {
+				t.Fatalf("unexpected tombstone for absent key: written=%t, stats=%+v", written, ms)
+			}
+
+			// A live value is deleted, but a deleted key is not deleted again.
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !deleteKey(testKey1, hlc.Timestamp{WallTime: 2}, nil) {
+				t.Fatal("expected tombstone over live value")
+			}
+			if deleteKey(testKey1, hlc.Timestamp{WallTime: 3}, nil) {
+				t.Fatal("unexpected tombstone over tombstone")
+			}
+			if n := numVersions(testKey1); n != 2 {
+				t.Fatalf("expected 2 versions, found %d", n)
+			}
+
+			// A live value above the delete's timestamp is still deleted, with the
+			// tombstone pushed above it.
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 5}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !deleteKey(testKey2, hlc.Timestamp{WallTime: 4}, nil) {
+				t.Fatal("expected tombstone over newer live value")
+			}
+			if val, _, err := MVCCGet(ctx, engine, testKey2, hlc.MaxTimestamp, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if val != nil {
+				t.Fatalf("expected key to be deleted, found %v", val)
+			}
+
+			// A transaction's own provisional value is deleted.
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 10})
+			if err := MVCCPut(ctx, engine, nil, testKey3, txn.OrigTimestamp, value1, txn); err != nil {
+				t.Fatal(err)
+			}
+			txn.Sequence++
+			if !deleteKey(testKey3, txn.OrigTimestamp, txn) {
+				t.Fatal("expected tombstone over provisional value")
+			}
+
+			// Intents of other transactions are reported.
+			if _, err := MVCCDeleteWithOptions(
+				ctx, engine, nil, testKey3, hlc.Timestamp{WallTime: 11}, nil, opts,
+			); !testutils.IsError(err, "conflicting intents") {
+				t.Fatalf("expected write intent error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCWriteSkipStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			opts := MVCCWriteOptions{SkipStats: true}
+			var ms enginepb.MVCCStats
+			if _, err := MVCCPutWithOptions(
+				ctx, engine, &ms, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil, opts,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MVCCPutWithOptions(
+				ctx, engine, &ms, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil, opts,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MVCCDeleteWithOptions(
+				ctx, engine, &ms, testKey2, hlc.Timestamp{WallTime: 2}, nil, opts,
+			); err != nil {
+				t.Fatal(err)
+			}
+			if ms != (enginepb.MVCCStats{}) {
+				t.Fatalf("expected stats to be left untouched, found %+v", ms)
+			}
+
+			// The writes are performed regardless, and the stats can be recomputed.
+			if val, _, err := MVCCGet(ctx, engine, testKey1, hlc.Timestamp{WallTime: 3}, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if val == nil || !bytes.Equal(val.RawBytes, value1.RawBytes) {
+				t.Fatalf("expected %v, found %v", value1, val)
+			}
+			iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			defer iter.Close()
+			recomputed, err := iter.ComputeStats(roachpb.KeyMin, roachpb.KeyMax, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recomputed.LiveCount != 1 || recomputed.KeyCount != 2 || recomputed.ValCount != 3 {
+				t.Fatalf("unexpected recomputed stats %+v", recomputed)
+			}
+		})
+	}
+}
+
+func TestMVCCDeleteSingleDelete(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			opts := MVCCWriteOptions{SingleDelete: true}
+			var ms enginepb.MVCCStats
+			if err := MVCCPut(ctx, engine, &ms, testKey1, hlc.Timestamp{}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			for i, expDeleted := range []bool{true, false} {
+				deleted, err := MVCCDeleteWithOptions(ctx, engine, &ms, testKey1, hlc.Timestamp{}, nil, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if deleted != expDeleted {
+					t.Fatalf("%d: expected deleted=%t, found %t", i, expDeleted, deleted)
+				}
+			}
+			if val, _, err := MVCCGet(ctx, engine, testKey1, hlc.Timestamp{}, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if val != nil {
+				t.Fatalf("expected no value, found %v", val)
+			}
+			if ms != (enginepb.MVCCStats{}) {
+				t.Fatalf("expected empty stats, found %+v", ms)
+			}
+
+			// The key can be written and single deleted again.
+			if err := MVCCPut(ctx, engine, &ms, testKey1, hlc.Timestamp{}, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if deleted, err := MVCCDeleteWithOptions(
+				ctx, engine, &ms, testKey1, hlc.Timestamp{}, nil, opts,
+			); err != nil || !deleted {
+				t.Fatalf("expected the value to be deleted, found deleted=%t, err=%v", deleted, err)
+			}
+
+			// Versioned values can't be single deleted.
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MVCCDeleteWithOptions(
+				ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 2}, nil, opts,
+			); !testutils.IsError(err, "single deletes are only supported for inline values") {
+				t.Fatalf("expected an error, found %v", err)
+			}
+			if _, err := MVCCDeleteWithOptions(
+				ctx, engine, nil, testKey2, hlc.Timestamp{}, nil, opts,
+			); !testutils.IsError(err, "single delete of a non-inline value") {
+				t.Fatalf("expected an error, found %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCScanIteratorStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			for i := int64(1); i <= 3; i++ {
+				if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: i}, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			iter := engine.NewIterator(IterOptions{UpperBound: keyMax, WithStats: true})
+			defer iter.Close()
+
+			kvData, numKVs, _, _, err := iter.MVCCScan(
+				keyMin, keyMax, math.MaxInt64, hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numKVs != 2 || len(kvData) == 0 {
+				t.Fatalf("expected 2 keys, got %d", numKVs)
+			}
+
+			// The two versions of testKey1 above the read timestamp are stepped over.
+			stats := iter.Stats()
+			if stats.VersionsSkipped != 2 {
+				t.Errorf("expected 2 versions skipped, got %d", stats.VersionsSkipped)
+			}
+			if stats.SeekCount == 0 || stats.StepCount == 0 {
+				t.Errorf("expected seeks and steps to be counted, got %+v", stats)
+			}
+
+			// A read at a newer timestamp skips nothing, but the seek and step
+			// counters keep accumulating.
+			if _, _, _, _, err := iter.MVCCScan(
+				keyMin, keyMax, math.MaxInt64, hlc.Timestamp{WallTime: 3}, MVCCScanOptions{},
+			); err != nil {
+				t.Fatal(err)
+			}
+			newStats := iter.Stats()
+			if newStats.VersionsSkipped != 2 {
+				t.Errorf("expected 2 versions skipped, got %d", newStats.VersionsSkipped)
+			}
+			if newStats.SeekCount <= stats.SeekCount || newStats.StepCount <= stats.StepCount {
+				t.Errorf("expected counters to increase from %+v, got %+v", stats, newStats)
+			}
+		})
+	}
+}
+
+// TestMVCCScanPaginationResumeSpan verifies that paginating a scan using the
+// returned resume spans yields exactly the results of an unbounded scan, for
+// any MaxKeys and in either direction.
+func TestMVCCScanPaginationResumeSpan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// Write several versions of each key, leaving some of the keys deleted
+			// and some with a newer version above the read timestamp.
+			const numKeys = 10
+			for i := 0; i < numKeys; i++ {
+				key := roachpb.Key(fmt.Sprintf("key-%02d", i))
+				for j := 1; j <= 3; j++ {
+					value := roachpb.MakeValueFromString(fmt.Sprintf("value-%d-%d", i, j))
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: int64(j)}, value, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+				switch i % 3 {
+				case 1:
+					if err := MVCCDelete(ctx, engine, nil, key, hlc.Timestamp{WallTime: 4}, nil); err != nil {
+						t.Fatal(err)
+					}
+				case 2:
+					value := roachpb.MakeValueFromString("future")
+					if err := MVCCPut(ctx, engine, nil, key, hlc.Timestamp{WallTime: 10}, value, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			scanKeys := func(
+				start, end roachpb.Key, max int64, opts MVCCScanOptions,
+			) ([]roachpb.Key, *roachpb.Span) {
+				t.Helper()
+				res, err := MVCCScanToBytes(ctx, engine, start, end, max, hlc.Timestamp{WallTime: 5}, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var keys []roachpb.Key
+				for _, data := range res.KVData {
+					for len(data) > 0 {
+						var k MVCCKey
+						k, _, data, err = MVCCScanDecodeKeyValue(data)
+						if err != nil {
+							t.Fatal(err)
+						}
+						keys = append(keys, k.Key)
+					}
+				}
+				return keys, res.ResumeSpan
+			}
 
-	ctx := context.Background()
-	for _, engineImpl := range mvccEngineImpls {
-		t.Run(engineImpl.name, func(t *testing.T) {
-			engine := engineImpl.create()
-			defer engine.Close()
+			start, end := roachpb.Key("key-"), roachpb.Key("key-99")
+			for _, reverse := range []bool{false, true} {
+				for _, tombstones := range []bool{false, true} {
+					opts := MVCCScanOptions{Reverse: reverse, Tombstones: tombstones}
+					expected, resume := scanKeys(start, end, math.MaxInt64, opts)
+					if resume != nil {
+						t.Fatalf("unexpected resume span %+v", resume)
+					}
 
-			mvccScanTest(ctx, t, engine)
+					for max := int64(1); max <= int64(len(expected))+1; max++ {
+						t.Run(fmt.Sprintf("reverse=%t,tombstones=%t,max=%d", reverse, tombstones, max),
+							func(t *testing.T) {
+								var actual []roachpb.Key
+								span := &roachpb.Span{Key: start, EndKey: end}
+								for span != nil {
+									keys, resume := scanKeys(span.Key, span.EndKey, max, opts)
+									if int64(len(keys)) > max {
+										t.Fatalf("expected at most %d keys, got %d", max, len(keys))
+									}
+									if resume != nil && int64(len(keys)) != max {
+										t.Fatalf("resume span %+v returned after %d of %d keys", resume, len(keys), max)
+									}
+									actual = append(actual, keys...)
+									span = resume
+								}
+								if !reflect.DeepEqual(expected, actual) {
+									t.Fatalf("expected %s, got %s", expected, actual)
+								}
+							})
+					}
+				}
+			}
 		})
 	}
 }
 
-func TestMVCCScanMaxNum(t *testing.T) {
+func TestMVCCScanMinTimestamp(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
 	ctx := context.Background()
@@ -1913,72 +4861,69 @@ func TestMVCCScanMaxNum(t *testing.T) {
 			engine := engineImpl.create()
 			defer engine.Close()
 
-			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
-				t.Fatal(err)
-			}
-			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value2, nil); err != nil {
-				t.Fatal(err)
-			}
-			if err := MVCCPut(ctx, engine, nil, testKey3, hlc.Timestamp{WallTime: 1}, value3, nil); err != nil {
-				t.Fatal(err)
-			}
-			if err := MVCCPut(ctx, engine, nil, testKey4, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
-				t.Fatal(err)
-			}
-			if err := MVCCPut(ctx, engine, nil, testKey6, hlc.Timestamp{WallTime: 1}, value4, nil); err != nil {
-				t.Fatal(err)
-			}
-
-			kvs, resumeSpan, _, err := MVCCScan(ctx, engine, testKey2, testKey4, 1,
-				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
-			if err != nil {
-				t.Fatal(err)
-			}
-			if len(kvs) != 1 ||
-				!bytes.Equal(kvs[0].Key, testKey2) ||
-				!bytes.Equal(kvs[0].Value.RawBytes, value2.RawBytes) {
-				t.Fatal("the value should not be empty")
-			}
-			if expected := (roachpb.Span{Key: testKey3, EndKey: testKey4}); !resumeSpan.EqualValue(expected) {
-				t.Fatalf("expected = %+v, resumeSpan = %+v", expected, resumeSpan)
+			ts1 := hlc.Timestamp{WallTime: 1}
+			ts2 := hlc.Timestamp{WallTime: 2}
+			ts3 := hlc.Timestamp{WallTime: 3}
+			// testKey1: value @ 1
+			// testKey2: value @ 1, value @ 3
+			// testKey3: value @ 3
+			// testKey4: value @ 1, deletion @ 3
+			// testKey5: intent @ 2
+			for _, kv := range []struct {
+				key   roachpb.Key
+				ts    hlc.Timestamp
+				value roachpb.Value
+			}{
+				{testKey1, ts1, value1},
+				{testKey2, ts1, value2},
+				{testKey2, ts3, value3},
+				{testKey3, ts3, value3},
+				{testKey4, ts1, value4},
+			} {
+				if err := MVCCPut(ctx, engine, nil, kv.key, kv.ts, kv.value, nil); err != nil {
+					t.Fatal(err)
+				}
 			}
-
-			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey2, testKey4, 0,
-				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
-			if err != nil {
+			if err := MVCCDelete(ctx, engine, nil, testKey4, ts3, nil); err != nil {
 				t.Fatal(err)
 			}
-			if len(kvs) != 0 {
-				t.Fatal("the value should be empty")
-			}
-			if expected := (roachpb.Span{Key: testKey2, EndKey: testKey4}); !resumeSpan.EqualValue(expected) {
-				t.Fatalf("expected = %+v, resumeSpan = %+v", expected, resumeSpan)
-			}
-
-			// Note: testKey6, though not scanned directly, is important in testing that
-			// the computed resume span does not extend beyond the upper bound of a scan.
-			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey4, testKey5, 1,
-				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{})
-			if err != nil {
+			txn := makeTxn(*txn1, ts2)
+			if err := MVCCPut(ctx, engine, nil, testKey5, txn.OrigTimestamp, value5, txn); err != nil {
 				t.Fatal(err)
 			}
-			if len(kvs) != 1 {
-				t.Fatalf("expected 1 key but got %d", len(kvs))
-			}
-			if resumeSpan != nil {
-				t.Fatalf("resumeSpan = %+v", resumeSpan)
-			}
 
-			kvs, resumeSpan, _, err = MVCCScan(ctx, engine, testKey5, testKey6.Next(), 1,
-				hlc.Timestamp{WallTime: 1}, MVCCScanOptions{Reverse: true})
-			if err != nil {
-				t.Fatal(err)
-			}
-			if len(kvs) != 1 {
-				t.Fatalf("expected 1 key but got %d", len(kvs))
+			testCases := []struct {
+				ts, minTS  hlc.Timestamp
+				tombstones bool
+				expKeys    []roachpb.Key
+			}{
+				{hlc.Timestamp{WallTime: 5}, hlc.Timestamp{}, false, []roachpb.Key{testKey1, testKey2, testKey3}},
+				{hlc.Timestamp{WallTime: 5}, ts1, false, []roachpb.Key{testKey2, testKey3}},
+				{hlc.Timestamp{WallTime: 5}, ts1, true, []roachpb.Key{testKey2, testKey3, testKey4}},
+				{hlc.Timestamp{WallTime: 5}, ts3, false, nil},
+				{ts2, ts1, false, nil},
+				{ts2, hlc.Timestamp{Logical: 1}, false, []roachpb.Key{testKey1, testKey2, testKey4}},
 			}
-			if resumeSpan != nil {
-				t.Fatalf("resumeSpan = %+v", resumeSpan)
+			for _, tc := range testCases {
+				name := fmt.Sprintf("ts=%s,minTS=%s,tombstones=%t", tc.ts, tc.minTS, tc.tombstones)
+				t.Run(name, func(t *testing.T) {
+					kvs, _, intents, err := MVCCScan(ctx, engine, testKey1, testKey6, math.MaxInt64, tc.ts,
+						MVCCScanOptions{Inconsistent: true, Tombstones: tc.tombstones, MinTimestamp: tc.minTS})
+					if err != nil {
+						t.Fatal(err)
+					}
+					var actual []roachpb.Key
+					for _, kv := range kvs {
+						actual = append(actual, kv.Key)
+					}
+					if !reflect.DeepEqual(tc.expKeys, actual) {
+						t.Fatalf("expected %s, got %s", tc.expKeys, actual)
+					}
+					// The intent is surfaced regardless of MinTimestamp.
+					if len(intents) != 1 || !intents[0].Key.Equal(testKey5) {
+						t.Fatalf("expected intent on %s, got %v", testKey5, intents)
+					}
+				})
 			}
 		})
 	}
@@ -2913,38 +5858,315 @@ func TestMVCCClearTimeRange(t *testing.T) {
 				_, _, _, err = MVCCScan(ctx, e, testKey3, testKey4, 100, ts5, MVCCScanOptions{})
 				require.Error(t, err)
 
-				// Scan (> k3 to avoid intent) to confirm that k5 was indeed reverted to
-				// value as of ts3 (i.e. v4 was cleared to expose v2).
-				actual, _, _, err = MVCCScan(ctx, e, testKey4, keyMax, 100, ts5, MVCCScanOptions{})
-				require.NoError(t, err)
-				require.Equal(t, ts3Content[2:], actual)
-			})
+				// Scan (> k3 to avoid intent) to confirm that k5 was indeed reverted to
+				// value as of ts3 (i.e. v4 was cleared to expose v2).
+				actual, _, _, err = MVCCScan(ctx, e, testKey4, keyMax, 100, ts5, MVCCScanOptions{})
+				require.NoError(t, err)
+				require.Equal(t, ts3Content[2:], actual)
+			})
+
+			t.Run("clear below intent", func(t *testing.T) {
+				e := setupKVsWithIntent(t)
+				defer e.Close()
+				assertKVs(t, e, ts2, ts2Content)
+				_, err := MVCCClearTimeRange(ctx, e, nil, keyMin, keyMax, ts1, ts2, 10)
+				require.NoError(t, err)
+				assertKVs(t, e, ts2, ts1Content)
+			})
+		})
+	}
+}
+
+func computeStats(
+	t *testing.T, batch Reader, from, to roachpb.Key, nowNanos int64,
+) enginepb.MVCCStats {
+	t.Helper()
+	iter := batch.NewIterator(IterOptions{UpperBound: to})
+	defer iter.Close()
+	s, err := ComputeStatsGo(iter, from, to, nowNanos)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	return s
+}
+
+func TestMVCCCheckConsistency(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, impl := range mvccEngineImpls {
+		t.Run(impl.name, func(t *testing.T) {
+			engine := impl.create()
+			defer engine.Close()
+
+			ts1 := hlc.Timestamp{WallTime: 1}
+			ts2 := hlc.Timestamp{WallTime: 2}
+			txn := makeTxn(*txn1, ts2)
+			putMeta := func(key roachpb.Key, meta *enginepb.MVCCMetadata) {
+				t.Helper()
+				if _, _, err := PutProto(engine, MakeMVCCMetadataKey(key), meta); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Well-formed data: a committed value with an intent on top, a deletion
+			// intent and an inline value.
+			if err := MVCCPut(ctx, engine, nil, testKey1, ts1, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey1, ts2, value2, txn); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, ts1, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCDelete(ctx, engine, nil, testKey2, ts2, txn); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey3, hlc.Timestamp{}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			reports, err := MVCCCheckConsistency(ctx, engine, keyMin, keyMax)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reports) != 0 {
+				t.Fatalf("expected no inconsistencies, got %v", reports)
+			}
+
+			// An inline value which also has versioned values.
+			if err := engine.Put(MVCCKey{Key: testKey3, Timestamp: ts1}, value1.RawBytes); err != nil {
+				t.Fatal(err)
+			}
+			// An intent without a provisional value.
+			putMeta(testKey4, &enginepb.MVCCMetadata{
+				Txn:       &txn.TxnMeta,
+				Timestamp: hlc.LegacyTimestamp(ts2),
+				KeyBytes:  MVCCVersionTimestampSize,
+			})
+			// An undecodable metadata record.
+			if err := engine.Put(MakeMVCCMetadataKey(testKey5), []byte("garbage")); err != nil {
+				t.Fatal(err)
+			}
+			// An intent whose value size disagrees with its provisional value.
+			if err := MVCCPut(ctx, engine, nil, testKey6, ts2, value2, txn); err != nil {
+				t.Fatal(err)
+			}
+			putMeta(testKey6, &enginepb.MVCCMetadata{
+				Txn:       &txn.TxnMeta,
+				Timestamp: hlc.LegacyTimestamp(ts2),
+				KeyBytes:  MVCCVersionTimestampSize,
+				ValBytes:  1,
+			})
+			// A metadata record which is neither an intent nor an inline value.
+			testKey7 := roachpb.Key("/db7")
+			putMeta(testKey7, &enginepb.MVCCMetadata{Timestamp: hlc.LegacyTimestamp(ts1)})
+
+			reports, err = MVCCCheckConsistency(ctx, engine, keyMin, keyMax)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []struct {
+				key  roachpb.Key
+				desc string
+			}{
+				{testKey3, "inline value has versioned values"},
+				{testKey4, "has no provisional value"},
+				{testKey5, "unable to decode MVCCMetadata"},
+				{testKey6, "intent records 1 value bytes"},
+				{testKey7, "neither an intent nor an inline value"},
+			}
+			if len(reports) != len(expected) {
+				t.Fatalf("expected %d inconsistencies, got %v", len(expected), reports)
+			}
+			for i, exp := range expected {
+				if !reports[i].Key.Key.Equal(exp.key) || !strings.Contains(reports[i].Description, exp.desc) {
+					t.Errorf("%d: expected %s: %q, got %s", i, exp.key, exp.desc, reports[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCFingerprint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			type write struct {
+				key   roachpb.Key
+				ts    int64
+				value *roachpb.Value
+			}
+			replica := func(writes ...write) Engine {
+				engine := engineImpl.create()
+				for _, w := range writes {
+					ts := hlc.Timestamp{WallTime: w.ts}
+					var err error
+					if w.value == nil {
+						err = MVCCDelete(ctx, engine, nil, w.key, ts, nil)
+					} else {
+						err = MVCCPut(ctx, engine, nil, w.key, ts, *w.value, nil)
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				return engine
+			}
+			// a has a tombstone on testKey3, written after its value. b has an
+			// older version of testKey1, and c writes testKey1 at another
+			// timestamp. d has a different value for testKey2.
+			a := replica(write{testKey1, 2, &value1}, write{testKey2, 2, &value2},
+				write{testKey3, 2, &value3}, write{testKey3, 3, nil})
+			defer a.Close()
+			b := replica(write{testKey2, 2, &value2}, write{testKey1, 1, &value4},
+				write{testKey1, 2, &value1})
+			defer b.Close()
+			c := replica(write{testKey1, 3, &value1}, write{testKey2, 2, &value2})
+			defer c.Close()
+			d := replica(write{testKey1, 2, &value1}, write{testKey2, 2, &value3})
+			defer d.Close()
+
+			ts := hlc.Timestamp{WallTime: 5}
+			fingerprint := func(engine Engine, start, end roachpb.Key, opts MVCCFingerprintOptions) uint64 {
+				t.Helper()
+				fp, err := MVCCFingerprint(ctx, engine, start, end, ts, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fp
+			}
+			for _, orderDependent := range []bool{false, true} {
+				for i, tc := range []struct {
+					opts     MVCCFingerprintOptions
+					expEqual []bool // whether b, c and d match a
+				}{
+					{MVCCFingerprintOptions{}, []bool{true, true, false}},
+					{MVCCFingerprintOptions{IncludeTimestamps: true}, []bool{true, false, false}},
+					{MVCCFingerprintOptions{IncludeTombstones: true}, []bool{false, false, false}},
+				} {
+					tc.opts.OrderDependent = orderDependent
+					expFP := fingerprint(a, testKey1, testKey5, tc.opts)
+					for j, engine := range []Engine{b, c, d} {
+						if fp := fingerprint(engine, testKey1, testKey5, tc.opts); (fp == expFP) != tc.expEqual[j] {
+							t.Errorf("%d: %+v: replica %d: expected equal=%t, got %x and %x",
+								i, tc.opts, j, tc.expEqual[j], expFP, fp)
+						}
+					}
+				}
+			}
+
+			// Order-independent fingerprints of adjacent spans add up.
+			if fp, fp1, fp2 := fingerprint(a, testKey1, testKey5, MVCCFingerprintOptions{}),
+				fingerprint(a, testKey1, testKey2, MVCCFingerprintOptions{}),
+				fingerprint(a, testKey2, testKey5, MVCCFingerprintOptions{}); fp != fp1+fp2 {
+				t.Errorf("expected %x = %x + %x", fp, fp1, fp2)
+			}
+
+			// Intents are conflicts.
+			txn := makeTxn(*txn1, hlc.Timestamp{WallTime: 4})
+			if err := MVCCPut(ctx, d, nil, testKey4, txn.OrigTimestamp, value4, txn); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := MVCCFingerprint(ctx, d, testKey1, testKey5, ts, MVCCFingerprintOptions{}); !testutils.IsError(err, "conflicting intents") {
+				t.Fatalf("expected WriteIntentError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMVCCPredicateDeleteRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			e := engineImpl.create()
+			defer e.Close()
+
+			// Write 20 keys, every third key at a newer timestamp.
+			var ms enginepb.MVCCStats
+			const numKeys = 20
+			for i := 0; i < numKeys; i++ {
+				key := roachpb.Key(fmt.Sprintf("key-%02d", i))
+				ts := hlc.Timestamp{WallTime: 1}
+				if i%3 == 0 {
+					ts = hlc.Timestamp{WallTime: 2}
+				}
+				value := roachpb.MakeValueFromString(strconv.Itoa(i))
+				if err := MVCCPut(ctx, e, &ms, key, ts, value, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Delete keys with odd values, or which were written at the newer
+			// timestamp.
+			predicate := func(k MVCCKey, v []byte) (bool, error) {
+				if k.Timestamp == (hlc.Timestamp{WallTime: 2}) {
+					return true, nil
+				}
+				b, err := roachpb.Value{RawBytes: v}.GetBytes()
+				if err != nil {
+					return false, err
+				}
+				i, err := strconv.Atoi(string(b))
+				return i%2 == 1, err
+			}
+			shouldDelete := func(i int) bool { return i%3 == 0 || i%2 == 1 }
+
+			// Use a small batch limit so that several calls are needed.
+			ts := hlc.Timestamp{WallTime: 3}
+			span := &roachpb.Span{Key: roachpb.Key("key-"), EndKey: roachpb.Key("key-99")}
+			var calls int
+			for span != nil {
+				var err error
+				span, err = MVCCPredicateDeleteRange(ctx, e, &ms, span.Key, span.EndKey, ts, predicate, 30)
+				if err != nil {
+					t.Fatal(err)
+				}
+				calls++
+			}
+			if calls < 2 {
+				t.Fatalf("expected multiple calls, got %d", calls)
+			}
+
+			kvs, _, _, err := MVCCScan(ctx, e, roachpb.Key("key-"), roachpb.Key("key-99"), math.MaxInt64,
+				ts, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected []roachpb.Key
+			for i := 0; i < numKeys; i++ {
+				if !shouldDelete(i) {
+					expected = append(expected, roachpb.Key(fmt.Sprintf("key-%02d", i)))
+				}
+			}
+			var actual []roachpb.Key
+			for _, kv := range kvs {
+				actual = append(actual, kv.Key)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("expected %s, got %s", expected, actual)
+			}
+
+			// Reads below the deletion timestamp still see all keys.
+			kvs, _, _, err = MVCCScan(ctx, e, roachpb.Key("key-"), roachpb.Key("key-99"), math.MaxInt64,
+				hlc.Timestamp{WallTime: 2}, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != numKeys {
+				t.Fatalf("expected %d keys, got %d", numKeys, len(kvs))
+			}
 
-			t.Run("clear below intent", func(t *testing.T) {
-				e := setupKVsWithIntent(t)
-				defer e.Close()
-				assertKVs(t, e, ts2, ts2Content)
-				_, err := MVCCClearTimeRange(ctx, e, nil, keyMin, keyMax, ts1, ts2, 10)
-				require.NoError(t, err)
-				assertKVs(t, e, ts2, ts1Content)
-			})
+			require.Equal(t, computeStats(t, e, keyMin, keyMax, ts.WallTime), ms)
 		})
 	}
 }
 
-func computeStats(
-	t *testing.T, batch Reader, from, to roachpb.Key, nowNanos int64,
-) enginepb.MVCCStats {
-	t.Helper()
-	iter := batch.NewIterator(IterOptions{UpperBound: to})
-	defer iter.Close()
-	s, err := ComputeStatsGo(iter, from, to, nowNanos)
-	if err != nil {
-		t.Fatalf("%+v", err)
-	}
-	return s
-}
-
 // TestMVCCClearTimeRangeOnRandomData sets up mostly random KVs and then picks
 // some random times to which to revert, ensuring that a MVCC-Scan at each of
 // those times before reverting matches the result of an MVCC-Scan done at a
@@ -3196,6 +6418,76 @@ func TestMVCCConditionalPut(t *testing.T) {
 	}
 }
 
+// TestMVCCConditionalPutMissingBehavior verifies that deletion tombstones are
+// treated as absent values by all CPutMissingBehavior modes.
+func TestMVCCConditionalPutMissingBehavior(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			// testKey1 is deleted, testKey2 holds a live value.
+			if err := MVCCPut(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCDelete(ctx, engine, nil, testKey1, hlc.Timestamp{WallTime: 2}, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := MVCCPut(ctx, engine, nil, testKey2, hlc.Timestamp{WallTime: 1}, value1, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			testCases := []struct {
+				key      roachpb.Key
+				expVal   *roachpb.Value
+				behavior CPutMissingBehavior
+				expErr   bool
+			}{
+				// A tombstone counts as absent.
+				{testKey1, nil, CPutFailIfMissing, false},
+				{testKey1, &value2, CPutFailIfMissing, true},
+				{testKey1, &value2, CPutAllowIfMissing, false},
+				{testKey1, nil, CPutRequireMissing, false},
+				{testKey1, &value2, CPutRequireMissing, false},
+				// A key which was never written is absent.
+				{testKey3, &value2, CPutAllowIfMissing, false},
+				{testKey3, nil, CPutRequireMissing, false},
+				// A live value must match the expected value in every mode but
+				// CPutRequireMissing, which never succeeds for a live value.
+				{testKey2, &value1, CPutFailIfMissing, false},
+				{testKey2, &value2, CPutFailIfMissing, true},
+				{testKey2, &value2, CPutAllowIfMissing, true},
+				{testKey2, nil, CPutAllowIfMissing, true},
+				{testKey2, &value1, CPutRequireMissing, true},
+				{testKey2, nil, CPutRequireMissing, true},
+			}
+			for i, tc := range testCases {
+				t.Run(strconv.Itoa(i), func(t *testing.T) {
+					batch := engine.NewBatch()
+					defer batch.Close()
+					err := MVCCConditionalPut(
+						ctx, batch, nil, tc.key, hlc.Timestamp{WallTime: 3}, value3, tc.expVal, tc.behavior, nil)
+					if tc.expErr {
+						cfErr, ok := err.(*roachpb.ConditionFailedError)
+						if !ok {
+							t.Fatalf("expected ConditionFailedError, got %v", err)
+						}
+						if tc.key.Equal(testKey2) && (cfErr.ActualValue == nil ||
+							!cfErr.ActualValue.EqualData(value1)) {
+							t.Fatalf("expected actual value %v, got %v", value1, cfErr.ActualValue)
+						}
+					} else if err != nil {
+						t.Fatal(err)
+					}
+				})
+			}
+		})
+	}
+}
+
 func TestMVCCConditionalPutWithTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -3341,6 +6633,67 @@ func TestMVCCInitPut(t *testing.T) {
 	}
 }
 
+func TestMVCCInitPutIdempotent(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ts := func(wallTime int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wallTime} }
+			expectVersion := func(expTS hlc.Timestamp) {
+				t.Helper()
+				val, _, err := MVCCGet(ctx, engine, testKey1, hlc.MaxTimestamp, MVCCGetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if val == nil || !val.EqualData(value1) || val.Timestamp != expTS {
+					t.Fatalf("expected %s@%s, found %v", value1, expTS, val)
+				}
+			}
+
+			if err := MVCCInitPutIdempotent(ctx, engine, nil, testKey1, ts(2), value1, false, false, nil); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(ts(2))
+
+			// A retry at the same or an older timestamp succeeds without writing,
+			// whereas MVCCInitPut would fail with a WriteTooOldError.
+			for _, retryTS := range []hlc.Timestamp{ts(1), ts(2)} {
+				for _, bump := range []bool{false, true} {
+					if err := MVCCInitPutIdempotent(ctx, engine, nil, testKey1, retryTS, value1, false, bump, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			expectVersion(ts(2))
+
+			// A retry at a newer timestamp only writes when bumping.
+			if err := MVCCInitPutIdempotent(ctx, engine, nil, testKey1, ts(3), value1, false, false, nil); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(ts(2))
+			if err := MVCCInitPutIdempotent(ctx, engine, nil, testKey1, ts(4), value1, false, true, nil); err != nil {
+				t.Fatal(err)
+			}
+			expectVersion(ts(4))
+
+			// A different value still fails.
+			for _, bump := range []bool{false, true} {
+				err := MVCCInitPutIdempotent(ctx, engine, nil, testKey1, ts(5), value2, false, bump, nil)
+				if e, ok := err.(*roachpb.ConditionFailedError); !ok {
+					t.Fatalf("expected ConditionFailedError, found %v", err)
+				} else if !e.ActualValue.EqualData(value1) {
+					t.Fatalf("unexpected actual value %v", e.ActualValue)
+				}
+			}
+			expectVersion(ts(4))
+		})
+	}
+}
+
 func TestMVCCInitPutWithTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -4968,6 +8321,72 @@ func TestMVCCResolveTxnRangeResume(t *testing.T) {
 	}
 }
 
+func TestMVCCResolveWriteIntentRangeWithMaxBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const numIntents = 2000
+	const maxBytes = 10 << 10 // 10 KB
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ms := &enginepb.MVCCStats{}
+			for i := 0; i < numIntents; i++ {
+				key := roachpb.Key(fmt.Sprintf("%04d", i))
+				if err := MVCCPut(ctx, engine, ms, key, txn1.OrigTimestamp, value1, txn1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			span := &roachpb.Span{Key: roachpb.Key("0000"), EndKey: roachpb.Key("9999")}
+			var resolved int64
+			var calls int
+			for span != nil {
+				num, resumeSpan, err := MVCCResolveWriteIntentRangeWithMaxBytes(ctx, engine, ms, roachpb.Intent{
+					Span:   *span,
+					Txn:    txn1Commit.TxnMeta,
+					Status: txn1Commit.Status,
+				}, math.MaxInt64, maxBytes)
+				if err != nil {
+					t.Fatal(err)
+				}
+				calls++
+				if num == 0 {
+					t.Fatalf("call %d made no progress", calls)
+				}
+				resolved += num
+				if resumeSpan != nil && !resumeSpan.EndKey.Equal(span.EndKey) {
+					t.Fatalf("unexpected resume span %s", resumeSpan)
+				}
+				span = resumeSpan
+
+				// The stats reflect exactly the intents that were resolved.
+				expMS := computeStats(t, engine, keyMin, keyMax, 0)
+				assertEq(t, engine, fmt.Sprintf("after call %d", calls), ms, &expMS)
+				if expMS.IntentCount != numIntents-resolved {
+					t.Fatalf("after call %d: expected %d intents left, found %d",
+						calls, numIntents-resolved, expMS.IntentCount)
+				}
+			}
+			if resolved != numIntents {
+				t.Fatalf("expected %d intents resolved, got %d", numIntents, resolved)
+			}
+			if calls < 10 {
+				t.Fatalf("expected resolution to be chunked, took %d calls", calls)
+			}
+			kvs, _, _, err := MVCCScan(ctx, engine, keyMin, keyMax, math.MaxInt64, hlc.MaxTimestamp, MVCCScanOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kvs) != numIntents {
+				t.Fatalf("expected %d committed values, found %d", numIntents, len(kvs))
+			}
+		})
+	}
+}
+
 func TestValidSplitKeys(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -5000,7 +8419,219 @@ func TestValidSplitKeys(t *testing.T) {
 	}
 }
 
-func TestFindSplitKey(t *testing.T) {
+func TestFindSplitKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ms := &enginepb.MVCCStats{}
+			// Generate a series of KeyValues, each containing targetLength
+			// bytes, writing key #i to (encoded) key #i through the MVCC
+			// facility. Assuming that this translates roughly into same-length
+			// values after MVCC encoding, the split key should hence be chosen
+			// as the middle key of the interval.
+			splitReservoirSize := 100
+			for i := 0; i < splitReservoirSize; i++ {
+				k := fmt.Sprintf("%09d", i)
+				v := strings.Repeat("X", 10-len(k))
+				val := roachpb.MakeValueFromString(v)
+				// Write the key and value through MVCC
+				if err := MVCCPut(ctx, engine, ms, []byte(k), hlc.Timestamp{Logical: 1}, val, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			testData := []struct {
+				targetSize int64
+				splitInd   int
+			}{
+				{(ms.KeyBytes + ms.ValBytes) / 2, splitReservoirSize / 2},
+				{0, 0},
+				{math.MaxInt64, splitReservoirSize},
+			}
+
+			for i, td := range testData {
+				humanSplitKey, err := MVCCFindSplitKey(ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, td.targetSize)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ind, err := strconv.Atoi(string(humanSplitKey))
+				if err != nil {
+					t.Fatalf("%d: could not parse key %s as int: %+v", i, humanSplitKey, err)
+				}
+				if ind == 0 {
+					t.Fatalf("%d: should never select first key as split key", i)
+				}
+				if diff := td.splitInd - ind; diff > 1 || diff < -1 {
+					t.Fatalf("%d: wanted key #%d+-1, but got %d (diff %d)", i, td.splitInd, ind, diff)
+				}
+			}
+		})
+	}
+}
+
+// TestFindSplitKeyWithMinBytes verifies that no split key is returned when
+// either side of the split would be smaller than minBytes.
+func TestFindSplitKeyWithMinBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const numKeys = 100
+	const largeValueSize = 64 << 10
+	testCases := []struct {
+		name     string
+		largeKey int
+	}{
+		{"front-loaded", 0},
+		{"back-loaded", numKeys - 1},
+		{"uniform", -1},
+	}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					engine := engineImpl.create()
+					defer engine.Close()
+
+					ms := &enginepb.MVCCStats{}
+					for i := 0; i < numKeys; i++ {
+						k := fmt.Sprintf("%09d", i)
+						v := strings.Repeat("X", 10)
+						if i == tc.largeKey {
+							v = strings.Repeat("X", largeValueSize)
+						}
+						val := roachpb.MakeValueFromString(v)
+						if err := MVCCPut(ctx, engine, ms, []byte(k), hlc.Timestamp{Logical: 1}, val, nil); err != nil {
+							t.Fatal(err)
+						}
+					}
+					targetSize := (ms.KeyBytes + ms.ValBytes) / 2
+
+					// Without a meaningful minimum, a split key is always found.
+					splitKey, err := MVCCFindSplitKeyWithMinBytes(
+						ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, targetSize, 1<<10)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if splitKey == nil {
+						t.Fatal("expected a split key")
+					}
+					expSplitKey, err := MVCCFindSplitKey(ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, targetSize)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !splitKey.Equal(expSplitKey) {
+						t.Fatalf("expected split key %s, got %s", expSplitKey, splitKey)
+					}
+
+					// With skewed data, one side of the split is smaller than a large
+					// minimum and no split key is returned.
+					splitKey, err = MVCCFindSplitKeyWithMinBytes(
+						ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, targetSize, largeValueSize/4)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if tc.largeKey >= 0 && splitKey != nil {
+						t.Fatalf("expected no split key, got %s", splitKey)
+					}
+
+					// A minimum larger than half of the data can never be satisfied.
+					splitKey, err = MVCCFindSplitKeyWithMinBytes(
+						ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, targetSize, targetSize+1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if splitKey != nil {
+						t.Fatalf("expected no split key, got %s", splitKey)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestFindSplitKeyWeighted verifies that the split key balances the weights
+// of the keys, and balances their size when the weights are uniform.
+func TestFindSplitKeyWeighted(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	const numKeys = 100
+	keyIndex := func(t *testing.T, key roachpb.Key) int {
+		ind, err := strconv.Atoi(string(key))
+		if err != nil {
+			t.Fatalf("could not parse key %s as int: %+v", key, err)
+		}
+		return ind
+	}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ms := &enginepb.MVCCStats{}
+			for i := 0; i < numKeys; i++ {
+				k := fmt.Sprintf("%09d", i)
+				val := roachpb.MakeValueFromString(strings.Repeat("X", 10))
+				if err := MVCCPut(ctx, engine, ms, []byte(k), hlc.Timestamp{Logical: 1}, val, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The last tenth of the keys is hot, and carries as much weight as
+			// the rest of them.
+			hot := func(k MVCCKey) float64 {
+				if keyIndex(t, k.Key) >= 90 {
+					return 9
+				}
+				return 1
+			}
+			splitKey, err := MVCCFindSplitKeyWeighted(
+				ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, 0 /* minBytes */, hot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ind := keyIndex(t, splitKey); ind < 89 || ind > 91 {
+				t.Fatalf("wanted key #90+-1, but got %d", ind)
+			}
+
+			// A minimum size which the small side of the split doesn't have
+			// prevents the split.
+			splitKey, err = MVCCFindSplitKeyWeighted(
+				ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, (ms.KeyBytes+ms.ValBytes)/4, hot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if splitKey != nil {
+				t.Fatalf("expected no split key, got %s", splitKey)
+			}
+
+			// Uniform weights split by size.
+			expSplitKey, err := MVCCFindSplitKey(
+				ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, (ms.KeyBytes+ms.ValBytes)/2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range []float64{0, 1, 5} {
+				splitKey, err := MVCCFindSplitKeyWeighted(
+					ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, 0, /* minBytes */
+					func(MVCCKey) float64 { return w })
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !splitKey.Equal(expSplitKey) {
+					t.Fatalf("weight %f: expected split key %s, got %s", w, expSplitKey, splitKey)
+				}
+			}
+		})
+	}
+}
+
+func TestMVCCSampleKeys(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
 	ctx := context.Background()
@@ -5009,48 +8640,60 @@ func TestFindSplitKey(t *testing.T) {
 			engine := engineImpl.create()
 			defer engine.Close()
 
-			ms := &enginepb.MVCCStats{}
-			// Generate a series of KeyValues, each containing targetLength
-			// bytes, writing key #i to (encoded) key #i through the MVCC
-			// facility. Assuming that this translates roughly into same-length
-			// values after MVCC encoding, the split key should hence be chosen
-			// as the middle key of the interval.
-			splitReservoirSize := 100
-			for i := 0; i < splitReservoirSize; i++ {
-				k := fmt.Sprintf("%09d", i)
-				v := strings.Repeat("X", 10-len(k))
-				val := roachpb.MakeValueFromString(v)
-				// Write the key and value through MVCC
-				if err := MVCCPut(ctx, engine, ms, []byte(k), hlc.Timestamp{Logical: 1}, val, nil); err != nil {
+			// Key "b" stores nine times as many bytes as key "a", across two
+			// versions, and "c" is outside of the sampled span.
+			for _, kv := range []struct {
+				key  string
+				ts   int64
+				size int
+			}{
+				{"a", 1, 1000},
+				{"b", 1, 4500},
+				{"b", 2, 4500},
+				{"c", 1, 1000},
+			} {
+				val := roachpb.MakeValueFromString(strings.Repeat("X", kv.size))
+				if err := MVCCPut(ctx, engine, nil, roachpb.Key(kv.key), hlc.Timestamp{WallTime: kv.ts}, val, nil); err != nil {
 					t.Fatal(err)
 				}
 			}
+			iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+			defer iter.Close()
+			rng, _ := randutil.NewPseudoRand()
 
-			testData := []struct {
-				targetSize int64
-				splitInd   int
-			}{
-				{(ms.KeyBytes + ms.ValBytes) / 2, splitReservoirSize / 2},
-				{0, 0},
-				{math.MaxInt64, splitReservoirSize},
-			}
-
-			for i, td := range testData {
-				humanSplitKey, err := MVCCFindSplitKey(ctx, engine, roachpb.RKeyMin, roachpb.RKeyMax, td.targetSize)
+			// All of the keys of the span are returned, in order, if there are no
+			// more than requested.
+			for _, n := range []int{2, 3} {
+				sampled, err := mvccSampleKeys(iter, roachpb.Key("a"), roachpb.Key("c"), n, rng)
 				if err != nil {
 					t.Fatal(err)
 				}
-				ind, err := strconv.Atoi(string(humanSplitKey))
+				if expected := []roachpb.Key{roachpb.Key("a"), roachpb.Key("b")}; !reflect.DeepEqual(sampled, expected) {
+					t.Fatalf("%d: expected %s, got %s", n, expected, sampled)
+				}
+			}
+			if sampled, err := MVCCSampleKeys(iter, roachpb.Key("a"), roachpb.Key("c"), 0); err != nil || sampled != nil {
+				t.Fatalf("expected no keys, got %s, err=%v", sampled, err)
+			}
+
+			// Single keys are sampled proportionally to their size.
+			const trials = 10000
+			var b int
+			for i := 0; i < trials; i++ {
+				sampled, err := mvccSampleKeys(iter, roachpb.Key("a"), roachpb.Key("c"), 1, rng)
 				if err != nil {
-					t.Fatalf("%d: could not parse key %s as int: %+v", i, humanSplitKey, err)
+					t.Fatal(err)
 				}
-				if ind == 0 {
-					t.Fatalf("%d: should never select first key as split key", i)
+				if len(sampled) != 1 {
+					t.Fatalf("expected a single key, got %s", sampled)
 				}
-				if diff := td.splitInd - ind; diff > 1 || diff < -1 {
-					t.Fatalf("%d: wanted key #%d+-1, but got %d (diff %d)", i, td.splitInd, ind, diff)
+				if sampled[0].Equal(roachpb.Key("b")) {
+					b++
 				}
 			}
+			if frac := float64(b) / trials; frac < 0.85 || frac > 0.95 {
+				t.Fatalf("expected b to be sampled about 90%% of the time, got %.2f%%", frac*100)
+			}
 		})
 	}
 }
@@ -5409,6 +9052,60 @@ func TestFindValidSplitKeys(t *testing.T) {
 	}
 }
 
+// TestFindSplitKeyWithRowStart verifies that split keys found with a custom
+// row definition always fall on a row boundary.
+func TestFindSplitKeyWithRowStart(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// Rows are made of keys "row<i>/<family>"; the row starts at its first key.
+	rowStart := func(key roachpb.Key) (roachpb.Key, error) {
+		i := bytes.IndexByte(key, '/')
+		if i < 0 {
+			return nil, errors.Errorf("%q is not a row key", key)
+		}
+		return key[:i+1], nil
+	}
+	const numRows = 10
+
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			ctx := context.Background()
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ms := &enginepb.MVCCStats{}
+			rowKeys := make(map[string]bool)
+			for i := 0; i < numRows; i++ {
+				row := fmt.Sprintf("row%02d/", i)
+				rowKeys[row] = true
+				// Rows have a varying number of column families of varying sizes.
+				for fam := 0; fam <= i%4; fam++ {
+					key := roachpb.Key(fmt.Sprintf("%s%d", row, fam))
+					val := roachpb.MakeValueFromString(strings.Repeat("X", 10*(fam+1)*(i+1)))
+					if err := MVCCPut(ctx, engine, ms, key, hlc.Timestamp{Logical: 1}, val, nil); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			total := ms.KeyBytes + ms.ValBytes
+			for targetSize := int64(1); targetSize < total; targetSize += total / 50 {
+				splitKey, err := MVCCFindSplitKeyWithRowStart(
+					ctx, engine, roachpb.RKey("row"), roachpb.RKey("rox"), targetSize, rowStart)
+				if err != nil {
+					t.Fatalf("target size %d: %+v", targetSize, err)
+				}
+				if !rowKeys[string(splitKey)] {
+					t.Fatalf("target size %d: split key %q is not at a row boundary", targetSize, splitKey)
+				}
+				if splitKey.Equal(roachpb.Key("row00/")) {
+					t.Fatalf("target size %d: split key %q is the start of the first row", targetSize, splitKey)
+				}
+			}
+		})
+	}
+}
+
 // TestFindBalancedSplitKeys verifies split keys are located such that
 // the left and right halves are equally balanced.
 func TestFindBalancedSplitKeys(t *testing.T) {
@@ -5606,6 +9303,390 @@ func TestMVCCGarbageCollect(t *testing.T) {
 	}
 }
 
+// TestMVCCGarbageCollectPreserveLatestTombstone verifies that the latest
+// version of a deleted key survives GC if PreserveLatestTombstone is set,
+// while the versions beneath it are collected.
+func TestMVCCGarbageCollectPreserveLatestTombstone(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			ms := &enginepb.MVCCStats{}
+			ts1 := hlc.Timestamp{WallTime: 1e9}
+			ts2 := hlc.Timestamp{WallTime: 2e9}
+			ts3 := hlc.Timestamp{WallTime: 3e9}
+			put := func(key string, ts hlc.Timestamp) {
+				t.Helper()
+				if err := MVCCPut(ctx, engine, ms, roachpb.Key(key), ts, value1, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			del := func(key string, ts hlc.Timestamp) {
+				t.Helper()
+				if err := MVCCDelete(ctx, engine, ms, roachpb.Key(key), ts, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			put("a", ts1)
+			put("a", ts2)
+			del("a", ts3)
+			put("b", ts1)
+			del("b", ts2)
+			put("c", ts1)
+			put("c", ts2)
+
+			expectKeys := func(expEncKeys ...MVCCKey) {
+				t.Helper()
+				kvs, err := Scan(engine, keyMin, keyMax, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(kvs) != len(expEncKeys) {
+					t.Fatalf("expected %d kvs, found %v", len(expEncKeys), kvs)
+				}
+				for i, kv := range kvs {
+					if !kv.Key.Equal(expEncKeys[i]) {
+						t.Errorf("%d: expected key %q; got %q", i, expEncKeys[i], kv.Key)
+					}
+				}
+				iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+				defer iter.Close()
+				expMS, err := ComputeStatsGo(iter, roachpb.KeyMin, roachpb.KeyMax, ts3.WallTime)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertEq(t, engine, "verification", ms, &expMS)
+			}
+
+			gcKeys := []roachpb.GCRequest_GCKey{
+				{Key: roachpb.Key("a"), Timestamp: ts3},
+				{Key: roachpb.Key("b"), Timestamp: ts2},
+				{Key: roachpb.Key("c"), Timestamp: ts1},
+			}
+			opts := MVCCGarbageCollectOptions{PreserveLatestTombstone: true}
+			if _, err := MVCCGarbageCollectWithOptions(ctx, engine, ms, gcKeys, ts3, opts); err != nil {
+				t.Fatal(err)
+			}
+			expectKeys(
+				mvccVersionKey(roachpb.Key("a"), ts3),
+				mvccVersionKey(roachpb.Key("b"), ts2),
+				mvccVersionKey(roachpb.Key("c"), ts2),
+			)
+
+			// Collecting the same keys again is a no-op.
+			if _, err := MVCCGarbageCollectWithOptions(ctx, engine, ms, gcKeys, ts3, opts); err != nil {
+				t.Fatal(err)
+			}
+			expectKeys(
+				mvccVersionKey(roachpb.Key("a"), ts3),
+				mvccVersionKey(roachpb.Key("b"), ts2),
+				mvccVersionKey(roachpb.Key("c"), ts2),
+			)
+
+			// Without the option, the tombstones are collected as well.
+			if err := MVCCGarbageCollect(ctx, engine, ms, gcKeys, ts3); err != nil {
+				t.Fatal(err)
+			}
+			expectKeys(mvccVersionKey(roachpb.Key("c"), ts2))
+		})
+	}
+}
+
+// TestMVCCGarbageCollectWithLimit verifies that GC work can be split into
+// chunks using the returned resume keys, with stats kept correct after each
+// chunk.
+func TestMVCCGarbageCollectWithLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	ts1 := hlc.Timestamp{WallTime: 1e9}
+	ts2 := hlc.Timestamp{WallTime: 2e9}
+	ts3 := hlc.Timestamp{WallTime: 3e9}
+	const numKeys = 10
+
+	testCases := []struct {
+		name              string
+		maxKeys, maxBytes int64
+		expCalls          int
+	}{
+		{"keys", 3, 0, 4},
+		{"bytes", 0, 1, numKeys},
+		{"unlimited", 0, 0, 1},
+	}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					engine := engineImpl.create()
+					defer engine.Close()
+
+					ms := &enginepb.MVCCStats{}
+					var gcKeys []roachpb.GCRequest_GCKey
+					for i := 0; i < numKeys; i++ {
+						key := roachpb.Key(fmt.Sprintf("key-%02d", i))
+						for _, ts := range []hlc.Timestamp{ts1, ts2, ts3} {
+							if err := MVCCPut(ctx, engine, ms, key, ts, value1, nil); err != nil {
+								t.Fatal(err)
+							}
+						}
+						gcKeys = append(gcKeys, roachpb.GCRequest_GCKey{Key: key, Timestamp: ts2})
+					}
+
+					var calls int
+					for resume := gcKeys; len(resume) > 0; {
+						var err error
+						prevLen := len(resume)
+						resume, err = MVCCGarbageCollectWithLimit(ctx, engine, ms, resume, ts3, tc.maxKeys, tc.maxBytes)
+						if err != nil {
+							t.Fatal(err)
+						}
+						calls++
+						if len(resume) >= prevLen {
+							t.Fatalf("no progress: %d keys left of %d", len(resume), prevLen)
+						}
+						if tc.maxKeys > 0 && int64(prevLen-len(resume)) > tc.maxKeys {
+							t.Fatalf("processed %d keys, more than limit of %d", prevLen-len(resume), tc.maxKeys)
+						}
+
+						// The stats reflect exactly the portion that was collected.
+						expMS := computeStats(t, engine, roachpb.KeyMin, roachpb.KeyMax, ts3.WallTime)
+						assertEq(t, engine, fmt.Sprintf("after call %d", calls), ms, &expMS)
+					}
+					if calls != tc.expCalls {
+						t.Fatalf("expected %d calls, got %d", tc.expCalls, calls)
+					}
+
+					kvs, err := Scan(engine, keyMin, keyMax, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(kvs) != numKeys {
+						t.Fatalf("expected %d remaining versions, got %d", numKeys, len(kvs))
+					}
+					for _, kv := range kvs {
+						if kv.Key.Timestamp != ts3 {
+							t.Fatalf("unexpected remaining version %s", kv.Key)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestMVCCGarbageCollectRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	ts1 := hlc.Timestamp{WallTime: 1e9}
+	ts2 := hlc.Timestamp{WallTime: 2e9}
+	ts3 := hlc.Timestamp{WallTime: 3e9}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			for _, maxBytes := range []int64{0, 1} {
+				t.Run(fmt.Sprintf("maxBytes=%d", maxBytes), func(t *testing.T) {
+					engine := engineImpl.create()
+					defer engine.Close()
+
+					ms := &enginepb.MVCCStats{}
+					value := roachpb.MakeValueFromString("value")
+					put := func(key string, ts hlc.Timestamp, txn *roachpb.Transaction) {
+						if err := MVCCPut(ctx, engine, ms, roachpb.Key(key), ts, value, txn); err != nil {
+							t.Fatal(err)
+						}
+					}
+					del := func(key string, ts hlc.Timestamp) {
+						if err := MVCCDelete(ctx, engine, ms, roachpb.Key(key), ts, nil); err != nil {
+							t.Fatal(err)
+						}
+					}
+					put("a", ts1, nil)
+					put("a", ts2, nil)
+					put("a-del", ts1, nil)
+					del("a-del", ts2)
+					put("b", ts1, nil)
+					put("b", ts2, nil)
+					put("b", ts3, nil)
+					put("b-del", ts1, nil)
+					put("b-del", ts2, nil)
+					del("b-del", ts3)
+					put("c", ts1, nil)
+					del("c", ts2)
+					put("c", ts3, nil)
+					put("i", ts1, nil)
+					put("i", ts2, nil)
+					put("i", ts3, makeTxn(*txn1, ts3))
+					put("inline", hlc.Timestamp{}, nil)
+
+					// Collect the span at ts2, in chunks if maxBytes is set.
+					var calls int
+					for key := roachpb.KeyMin; key != nil; calls++ {
+						resumeKey, err := MVCCGarbageCollectRange(ctx, engine, ms, key, roachpb.KeyMax, ts2, maxBytes)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if resumeKey != nil && resumeKey.Compare(key) <= 0 {
+							t.Fatalf("resume key %s doesn't progress past %s", resumeKey, key)
+						}
+						key = resumeKey
+					}
+					if maxBytes == 0 && calls != 1 {
+						t.Fatalf("expected a single call, found %d", calls)
+					} else if maxBytes > 0 && calls <= 1 {
+						t.Fatalf("expected the collection to be chunked, found %d calls", calls)
+					}
+
+					// The latest version at or below ts2 of every key is kept, unless
+					// it's a deletion, along with the newer versions.
+					expected := []string{
+						"a@2",
+						"b@3", "b@2",
+						"b-del@3", "b-del@2",
+						"c@3",
+						"i@meta", "i@3", "i@2",
+						"inline@meta",
+					}
+					kvs, err := Scan(engine, keyMin, keyMax, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					var found []string
+					for _, kv := range kvs {
+						if kv.Key.IsValue() {
+							found = append(found, fmt.Sprintf("%s@%d", string(kv.Key.Key), kv.Key.Timestamp.WallTime/1e9))
+						} else {
+							found = append(found, fmt.Sprintf("%s@meta", string(kv.Key.Key)))
+						}
+					}
+					if !reflect.DeepEqual(found, expected) {
+						t.Fatalf("expected %s, found %s", expected, found)
+					}
+
+					// Verify aggregated stats match computed stats after GC.
+					iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+					defer iter.Close()
+					for _, mvccStatsTest := range mvccStatsTests {
+						t.Run(mvccStatsTest.name, func(t *testing.T) {
+							expMS, err := mvccStatsTest.fn(iter, roachpb.KeyMin, roachpb.KeyMax, ts3.WallTime)
+							if err != nil {
+								t.Fatal(err)
+							}
+							assertEq(t, engine, "verification", ms, &expMS)
+						})
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestMVCCAnalyzeVersions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	ts1 := hlc.Timestamp{WallTime: 1e9}
+	ts2 := hlc.Timestamp{WallTime: 2e9}
+	ts3 := hlc.Timestamp{WallTime: 3e9}
+	for _, engineImpl := range mvccEngineImpls {
+		t.Run(engineImpl.name, func(t *testing.T) {
+			engine := engineImpl.create()
+			defer engine.Close()
+
+			value := roachpb.MakeValueFromString("value")
+			put := func(key string, ts hlc.Timestamp, txn *roachpb.Transaction) {
+				if err := MVCCPut(ctx, engine, nil, roachpb.Key(key), ts, value, txn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			del := func(key string, ts hlc.Timestamp) {
+				if err := MVCCDelete(ctx, engine, nil, roachpb.Key(key), ts, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			put("a", ts1, nil)
+			put("a", ts2, nil)
+			put("a-del", ts1, nil)
+			del("a-del", ts2)
+			put("b", ts1, nil)
+			put("b", ts2, nil)
+			put("b", ts3, nil)
+			put("c", ts1, nil)
+			del("c", ts2)
+			put("c", ts3, nil)
+			put("i", ts1, nil)
+			put("i", ts2, nil)
+			put("i", ts3, makeTxn(*txn1, ts3))
+			put("inline", hlc.Timestamp{}, nil)
+
+			analyze := func() VersionHistogram {
+				t.Helper()
+				iter := engine.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+				defer iter.Close()
+				h, err := MVCCAnalyzeVersions(iter, roachpb.KeyMin, roachpb.KeyMax, ts2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return h
+			}
+			// versionBytes returns the size of the versions in the engine.
+			versionBytes := func() int64 {
+				t.Helper()
+				kvs, err := Scan(engine, roachpb.KeyMin, roachpb.KeyMax, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var size int64
+				for _, kv := range kvs {
+					if kv.Key.IsValue() {
+						size += int64(kv.Key.Len() + len(kv.Value))
+					}
+				}
+				return size
+			}
+
+			// At ts2, the oldest versions of a, b and i are reclaimable, and so
+			// are all of the versions of a-del and the versions of c below its
+			// tombstone, tombstones included.
+			h := analyze()
+			var expVersions [versionHistogramMaxVersions + 1]int64
+			expVersions[2], expVersions[3] = 2, 3
+			if h.Keys != 5 || h.Versions != expVersions || h.MaxVersions != 3 || h.ReclaimableVersions != 7 {
+				t.Fatalf("unexpected histogram %+v", h)
+			}
+
+			// The estimate matches what GC collects.
+			before := versionBytes()
+			if _, err := MVCCGarbageCollectRange(
+				ctx, engine, nil, roachpb.KeyMin, roachpb.KeyMax, ts2, 0, /* maxBytes */
+			); err != nil {
+				t.Fatal(err)
+			}
+			if reclaimed := before - versionBytes(); reclaimed != h.ReclaimableBytes {
+				t.Fatalf("expected %d reclaimable bytes, GC reclaimed %d", h.ReclaimableBytes, reclaimed)
+			}
+			h = analyze()
+			expVersions = [versionHistogramMaxVersions + 1]int64{}
+			expVersions[1], expVersions[2] = 2, 2
+			if h.Keys != 4 || h.Versions != expVersions || h.ReclaimableVersions != 0 || h.ReclaimableBytes != 0 {
+				t.Fatalf("unexpected histogram after GC %+v", h)
+			}
+
+			// Keys with many versions are counted in the last bucket.
+			const many = versionHistogramMaxVersions + 10
+			for i := 1; i <= many; i++ {
+				put("z", hlc.Timestamp{WallTime: ts3.WallTime + int64(i)}, nil)
+			}
+			if h = analyze(); h.Versions[versionHistogramMaxVersions] != 1 || h.MaxVersions != many {
+				t.Fatalf("unexpected histogram %+v", h)
+			}
+		})
+	}
+}
+
 // TestMVCCGarbageCollectNonDeleted verifies that the first value for
 // a key cannot be GC'd if it's not deleted.
 func TestMVCCGarbageCollectNonDeleted(t *testing.T) {
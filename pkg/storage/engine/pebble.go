@@ -13,18 +13,26 @@ package engine
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/pkg/errors"
 )
@@ -189,6 +197,10 @@ var PebbleTablePropertyCollectors = []func() pebble.TablePropertyCollector{
 }
 
 // DefaultPebbleOptions returns the default pebble options.
+//
+// Unlike RocksDB (see rocksdbConcurrency), the vendored version of Pebble runs
+// at most one compaction at a time per store and has no option controlling
+// compaction concurrency, so none is exposed in PebbleConfig.
 func DefaultPebbleOptions() *pebble.Options {
 	return &pebble.Options{
 		Comparer:              MVCCComparer,
@@ -213,6 +225,151 @@ type PebbleConfig struct {
 	base.StorageConfig
 	// Pebble specific options.
 	Opts *pebble.Options
+	// ReadOnly opens the store without replaying or modifying the WAL, for
+	// inspecting the store of a crashed node. All write methods of the
+	// resulting engine, including committing batches, return
+	// errPebbleReadOnly.
+	ReadOnly bool
+	// EncryptionOptions, if set, encrypts the store at rest. The store records
+	// whether it is encrypted when it is created, and opening it later with or
+	// without encryption options to the contrary fails.
+	EncryptionOptions *PebbleEncryptionOptions
+	// OnWriteStallBegin and OnWriteStallEnd, if set, are called when Pebble
+	// starts and stops stalling writes, for instance to shed load or alert. The
+	// callbacks are invoked synchronously on the write path and must not
+	// block. They are chained with any write stall handlers already set in
+	// Opts.EventListener.
+	OnWriteStallBegin func(WriteStallEvent)
+	OnWriteStallEnd   func(WriteStallEvent)
+	// OnCorruption, if set, is called when a read encounters corrupt data, for
+	// instance so that the store can be marked unhealthy. The read still fails
+	// with the corruption error. The callback is invoked synchronously by the
+	// reader and must not block. Corruption errors are counted in
+	// Stats.Corruptions regardless.
+	OnCorruption func(CorruptionEvent)
+	// Cache, if set, is used as the block cache of the store instead of
+	// Opts.Cache. A single cache can be shared by all of the stores of a node,
+	// so that they draw from one memory budget instead of each being sized for
+	// its peak usage: the capacity of a shared cache is the total for all of
+	// the stores, and the block cache metrics of each of them report the usage
+	// of the whole cache. The memory of the cache is reclaimed by the garbage
+	// collector once it is no longer referenced, so closing one of the stores
+	// leaves the cache usable by the others.
+	Cache *pebble.Cache
+	// WALMinSyncInterval, if positive, is the minimum duration between the
+	// syncs of the WAL, like the rocksdb.min_wal_sync_interval setting for
+	// RocksDB. Synced commits arriving within the interval wait for the next
+	// sync and share it, which trades commit latency for fewer syncs under
+	// write bursts.
+	//
+	// The vendored version of Pebble doesn't recycle WAL files: a new file is
+	// created for every memtable, and removed once the memtable is flushed.
+	// The number and duration of the WAL syncs are reported by GetMetrics, so
+	// that the latency of syncs can be monitored.
+	WALMinSyncInterval time.Duration
+	// MemTableSize and MemTableStopWritesThreshold, if positive, override the
+	// size of the memtables and the number of memtables which may be queued for
+	// flushing before writes are stalled (see pebble.Options). Larger memtables
+	// are flushed less often, which reduces write amplification under
+	// write-heavy workloads, while smaller ones bound the memory used by the
+	// store. Once MemTableStopWritesThreshold memtables are waiting to be
+	// flushed, writes stall until a flush completes (see OnWriteStallBegin),
+	// so the product of the two is the memory the memtables may grow to, and
+	// the amount of writes which can be absorbed by a burst before stalling.
+	MemTableSize                uint64
+	MemTableStopWritesThreshold int
+	// MaxMemTableMemory, if positive, caps the memory the memtables may grow
+	// to, i.e. the product of the memtable size and of the stop writes
+	// threshold, whether configured above or in Opts. Opening the store fails
+	// if it is exceeded.
+	MaxMemTableMemory uint64
+}
+
+// WriteStallReason is the reason for a write stall.
+type WriteStallReason int
+
+const (
+	// WriteStallUnknown is used for stall reasons not recognized below.
+	WriteStallUnknown WriteStallReason = iota
+	// WriteStallMemTableCount is a stall caused by too many memtables waiting
+	// to be flushed (see pebble.Options.MemTableStopWritesThreshold).
+	WriteStallMemTableCount
+	// WriteStallL0FileCount is a stall caused by too many files in L0 (see
+	// pebble.Options.L0StopWritesThreshold).
+	WriteStallL0FileCount
+)
+
+func (r WriteStallReason) String() string {
+	switch r {
+	case WriteStallMemTableCount:
+		return "memtable count"
+	case WriteStallL0FileCount:
+		return "L0 file count"
+	default:
+		return "unknown"
+	}
+}
+
+// WriteStallEvent describes the beginning or end of a write stall.
+type WriteStallEvent struct {
+	Reason WriteStallReason
+	// Duration is the length of the stall. It is only set when the stall ends.
+	Duration time.Duration
+}
+
+// pebbleWriteStallTracker turns Pebble's write stall events into
+// WriteStallEvents.
+type pebbleWriteStallTracker struct {
+	onBegin, onEnd func(WriteStallEvent)
+
+	mu struct {
+		syncutil.Mutex
+		start  time.Time
+		reason WriteStallReason
+	}
+}
+
+// install chains the tracker into the write stall handlers of l.
+func (t *pebbleWriteStallTracker) install(l *pebble.EventListener) {
+	prevBegin, prevEnd := l.WriteStallBegin, l.WriteStallEnd
+	l.WriteStallBegin = func(info pebble.WriteStallBeginInfo) {
+		if prevBegin != nil {
+			prevBegin(info)
+		}
+		t.begin(info.Reason)
+	}
+	l.WriteStallEnd = func() {
+		if prevEnd != nil {
+			prevEnd()
+		}
+		t.end()
+	}
+}
+
+func (t *pebbleWriteStallTracker) begin(reason string) {
+	ev := WriteStallEvent{Reason: WriteStallUnknown}
+	switch {
+	case strings.Contains(reason, "memtable"):
+		ev.Reason = WriteStallMemTableCount
+	case strings.Contains(reason, "L0"):
+		ev.Reason = WriteStallL0FileCount
+	}
+	t.mu.Lock()
+	t.mu.start = timeutil.Now()
+	t.mu.reason = ev.Reason
+	t.mu.Unlock()
+	if t.onBegin != nil {
+		t.onBegin(ev)
+	}
+}
+
+func (t *pebbleWriteStallTracker) end() {
+	t.mu.Lock()
+	ev := WriteStallEvent{Reason: t.mu.reason, Duration: timeutil.Since(t.mu.start)}
+	t.mu.Unlock()
+	if t.onEnd != nil {
+		t.onEnd(ev)
+	}
 }
 
 // Pebble is a wrapper around a Pebble database instance.
@@ -227,17 +384,69 @@ type Pebble struct {
 	settings *cluster.Settings
 
 	// Relevant options copied over from pebble.Options.
-	fs vfs.FS
+	fs       vfs.FS
+	readOnly bool
+
+	suggestedCompactions compactionSuggester
+	corruption           *pebbleCorruptionReporter
+	// wal wraps fs for the WAL files, to measure the latency of their syncs.
+	wal    *pebbleWALFS
+	events *pebbleEventListeners
 }
 
+// errPebbleReadOnly is returned by the write methods of a Pebble engine
+// opened with PebbleConfig.ReadOnly.
+var errPebbleReadOnly = errors.New("engine opened read-only")
+
 var _ Engine = &Pebble{}
 
+// newPebbleOptions returns the options with which NewPebble opens Pebble for
+// cfg: a copy of cfg.Opts with the settings of cfg applied. cfg.Opts itself is
+// left unchanged, so that it can be reused, e.g. to reopen the engine.
+func newPebbleOptions(cfg PebbleConfig) (*pebble.Options, error) {
+	opts := *cfg.Opts
+	if cfg.EncryptionOptions != nil {
+		if cfg.EncryptionOptions.FS == nil {
+			return nil, errors.New("encryption options must specify an FS")
+		}
+		opts.FS = cfg.EncryptionOptions.FS
+	}
+	if cfg.Cache != nil {
+		opts.Cache = cfg.Cache
+	}
+	if cfg.MemTableSize > 0 {
+		opts.MemTableSize = int(cfg.MemTableSize)
+	}
+	if cfg.MemTableStopWritesThreshold > 0 {
+		opts.MemTableStopWritesThreshold = cfg.MemTableStopWritesThreshold
+	} else if cfg.MemTableStopWritesThreshold < 0 {
+		return nil, errors.Errorf("invalid memtable stop writes threshold %d", cfg.MemTableStopWritesThreshold)
+	}
+	// pebble.Open also calls EnsureDefaults, but only after doing a clone. Call
+	// EnsureDefaults beforehand so we have matching options here for when we
+	// save opts.FS and opts.ReadOnly later on.
+	opts.EnsureDefaults()
+	opts.ReadOnly = cfg.ReadOnly || cfg.Opts.ReadOnly
+	memTableMemory := uint64(opts.MemTableSize) * uint64(opts.MemTableStopWritesThreshold)
+	if cfg.MaxMemTableMemory > 0 && memTableMemory > cfg.MaxMemTableMemory {
+		return nil, errors.Errorf(
+			"memtables of %s with a stop writes threshold of %d may use %s, more than the maximum of %s",
+			humanizeutil.IBytes(int64(opts.MemTableSize)), opts.MemTableStopWritesThreshold,
+			humanizeutil.IBytes(int64(memTableMemory)), humanizeutil.IBytes(int64(cfg.MaxMemTableMemory)))
+	}
+	if cfg.OnWriteStallBegin != nil || cfg.OnWriteStallEnd != nil {
+		t := &pebbleWriteStallTracker{onBegin: cfg.OnWriteStallBegin, onEnd: cfg.OnWriteStallEnd}
+		t.install(&opts.EventListener)
+	}
+	return &opts, nil
+}
+
 // NewPebble creates a new Pebble instance, at the specified path.
 func NewPebble(cfg PebbleConfig) (*Pebble, error) {
-	// pebble.Open also calls EnsureDefaults, but only after doing a clone. Call
-	// EnsureDefaults beforehand so we have a matching cfg here for when we save
-	// cfg.FS and cfg.ReadOnly later on.
-	cfg.Opts.EnsureDefaults()
+	opts, err := newPebbleOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	var auxDir string
 	if cfg.Dir == "" {
@@ -247,23 +456,54 @@ func NewPebble(cfg PebbleConfig) (*Pebble, error) {
 		// actually exist on disk even though they don't actually write files to
 		// the directory. See SSTSnapshotStorage for one example of this bad
 		// behavior.
-		var err error
 		auxDir, err = ioutil.TempDir(os.TempDir(), "cockroach-auxiliary")
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		auxDir = cfg.Opts.FS.PathJoin(cfg.Dir, "auxiliary")
-		if err := cfg.Opts.FS.MkdirAll(auxDir, 0755); err != nil {
-			return nil, err
+		auxDir = opts.FS.PathJoin(cfg.Dir, "auxiliary")
+		if !opts.ReadOnly {
+			if err := opts.FS.MkdirAll(auxDir, 0755); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	db, err := pebble.Open(cfg.StorageConfig.Dir, cfg.Opts)
-	if err != nil {
+	if cfg.WALDir != "" {
+		if !opts.ReadOnly {
+			if err := checkPebbleWALDir(opts.FS, cfg.WALDir); err != nil {
+				return nil, err
+			}
+		}
+		opts.WALDir = cfg.WALDir
+	}
+
+	if err := checkPebbleEncryption(opts.FS, cfg.Dir, cfg.EncryptionOptions != nil); err != nil {
 		return nil, err
 	}
 
+	// Only Pebble sees the WAL wrapper, so that the engine's FS remains the
+	// one it was configured with.
+	fs := opts.FS
+	wal := newPebbleWALFS(fs, cfg.WALMinSyncInterval)
+	opts.FS = wal
+	events := newPebbleEventListeners()
+	events.install(&opts.EventListener)
+	// Pebble records the name of the comparator of a store in its MANIFEST,
+	// and refuses to open the store with a comparator of a different name.
+	db, err := pebble.Open(cfg.StorageConfig.Dir, opts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open store at %s with comparator %q",
+			cfg.Dir, opts.Comparer.Name)
+	}
+	if cfg.EncryptionOptions != nil && !opts.ReadOnly {
+		// Pebble now holds the lock of the store.
+		if err := markPebbleEncryption(fs, cfg.Dir); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
 	return &Pebble{
 		db:       db,
 		path:     cfg.Dir,
@@ -271,10 +511,40 @@ func NewPebble(cfg PebbleConfig) (*Pebble, error) {
 		maxSize:  cfg.MaxSize,
 		attrs:    cfg.Attrs,
 		settings: cfg.Settings,
-		fs:       cfg.Opts.FS,
+		fs:       fs,
+		readOnly: opts.ReadOnly,
+		wal:      wal,
+		events:   events,
+		corruption: &pebbleCorruptionReporter{
+			db:           db,
+			fs:           fs,
+			dir:          cfg.Dir,
+			onCorruption: cfg.OnCorruption,
+		},
 	}, nil
 }
 
+// checkPebbleWALDir creates the WAL directory if necessary and verifies that
+// files can be created in it, so that a misconfigured WAL directory is
+// reported when the engine is opened rather than on the first write.
+func checkPebbleWALDir(fs vfs.FS, walDir string) error {
+	if err := fs.MkdirAll(walDir, 0755); err != nil {
+		return errors.Wrapf(err, "could not create WAL directory %s", walDir)
+	}
+	testFile := fs.PathJoin(walDir, "cockroach-wal-check")
+	f, err := fs.Create(testFile)
+	if err != nil {
+		return errors.Wrapf(err, "WAL directory %s is not writable", walDir)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "WAL directory %s is not writable", walDir)
+	}
+	if err := fs.Remove(testFile); err != nil {
+		return errors.Wrapf(err, "WAL directory %s is not writable", walDir)
+	}
+	return nil
+}
+
 func newPebbleInMem(attrs roachpb.Attributes, cacheSize int64) *Pebble {
 	opts := DefaultPebbleOptions()
 	opts.Cache = pebble.NewCache(cacheSize)
@@ -296,6 +566,7 @@ func newPebbleInMem(attrs roachpb.Attributes, cacheSize int64) *Pebble {
 
 // Close implements the Engine interface.
 func (p *Pebble) Close() {
+	p.suggestedCompactions.close()
 	p.closed = true
 	_ = p.db.Close()
 }
@@ -311,10 +582,16 @@ func (p *Pebble) Get(key MVCCKey) ([]byte, error) {
 		return nil, emptyKeyError()
 	}
 	ret, err := p.db.Get(EncodeKey(key))
-	if err == pebble.ErrNotFound || len(ret) == 0 {
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		p.corruption.maybeReport(err, roachpb.Span{Key: key.Key})
+		return nil, err
+	}
+	if len(ret) == 0 {
 		return nil, nil
 	}
-	return ret, err
+	return ret, nil
 }
 
 // GetCompactionStats implements the Engine interface.
@@ -355,7 +632,7 @@ func (p *Pebble) Iterate(
 
 // NewIterator implements the Engine interface.
 func (p *Pebble) NewIterator(opts IterOptions) Iterator {
-	iter := newPebbleIterator(p.db, opts)
+	iter := newPebbleIterator(p.db, opts, p.corruption)
 	if iter == nil {
 		panic("couldn't create a new iterator")
 	}
@@ -364,6 +641,9 @@ func (p *Pebble) NewIterator(opts IterOptions) Iterator {
 
 // ApplyBatchRepr implements the Engine interface.
 func (p *Pebble) ApplyBatchRepr(repr []byte, sync bool) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	// batch.SetRepr takes ownership of the underlying slice, so make a copy.
 	reprCopy := make([]byte, len(repr))
 	copy(reprCopy, repr)
@@ -382,6 +662,9 @@ func (p *Pebble) ApplyBatchRepr(repr []byte, sync bool) error {
 
 // Clear implements the Engine interface.
 func (p *Pebble) Clear(key MVCCKey) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	if len(key.Key) == 0 {
 		return emptyKeyError()
 	}
@@ -390,6 +673,9 @@ func (p *Pebble) Clear(key MVCCKey) error {
 
 // SingleClear implements the Engine interface.
 func (p *Pebble) SingleClear(key MVCCKey) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	if len(key.Key) == 0 {
 		return emptyKeyError()
 	}
@@ -398,6 +684,9 @@ func (p *Pebble) SingleClear(key MVCCKey) error {
 
 // ClearRange implements the Engine interface.
 func (p *Pebble) ClearRange(start, end MVCCKey) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	bufStart := EncodeKey(start)
 	bufEnd := EncodeKey(end)
 	return p.db.DeleteRange(bufStart, bufEnd, pebble.Sync)
@@ -405,6 +694,9 @@ func (p *Pebble) ClearRange(start, end MVCCKey) error {
 
 // ClearIterRange implements the Engine interface.
 func (p *Pebble) ClearIterRange(iter Iterator, start, end roachpb.Key) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	// Write all the tombstones in one batch.
 	batch := p.NewWriteOnlyBatch()
 	defer batch.Close()
@@ -417,6 +709,9 @@ func (p *Pebble) ClearIterRange(iter Iterator, start, end roachpb.Key) error {
 
 // Merge implements the Engine interface.
 func (p *Pebble) Merge(key MVCCKey, value []byte) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	if len(key.Key) == 0 {
 		return emptyKeyError()
 	}
@@ -425,6 +720,9 @@ func (p *Pebble) Merge(key MVCCKey, value []byte) error {
 
 // Put implements the Engine interface.
 func (p *Pebble) Put(key MVCCKey, value []byte) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	if len(key.Key) == 0 {
 		return emptyKeyError()
 	}
@@ -433,6 +731,9 @@ func (p *Pebble) Put(key MVCCKey, value []byte) error {
 
 // LogData implements the Engine interface.
 func (p *Pebble) LogData(data []byte) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	return p.db.LogData(data, pebble.Sync)
 }
 
@@ -451,11 +752,35 @@ func (p *Pebble) Capacity() (roachpb.StoreCapacity, error) {
 	return computeCapacity(p.path, p.maxSize)
 }
 
-// Flush implements the Engine interface.
+// Flush implements the Engine interface. It forces the memtables to be
+// flushed to sstables and waits for the flush to complete, for instance
+// before taking a checkpoint. It is safe to call concurrently with writes,
+// which go to a new memtable while the flush is in progress.
 func (p *Pebble) Flush() error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	return p.db.Flush()
 }
 
+// UnflushedBytes returns the size of the live write-ahead log, i.e. of the
+// writes which have been committed but not yet flushed to sstables. Callers
+// can use it to apply backpressure when durability falls behind. It is safe to
+// call concurrently with writes.
+func (p *Pebble) UnflushedBytes() uint64 {
+	return p.db.Metrics().WAL.Size
+}
+
+// FlushedSequence returns the number of memtable flushes completed since the
+// engine was opened, which increases every time writes are moved from the
+// write-ahead log to sstables. Together with UnflushedBytes, it lets callers
+// track the progress of durability. The vendored Pebble does not expose the
+// sequence number of the last flushed write, which is why flushes are counted
+// instead. It is safe to call concurrently with writes.
+func (p *Pebble) FlushedSequence() uint64 {
+	return uint64(p.db.Metrics().Flush.Count)
+}
+
 // GetStats implements the Engine interface.
 func (p *Pebble) GetStats() (*Stats, error) {
 	m := p.db.Metrics()
@@ -472,9 +797,38 @@ func (p *Pebble) GetStats() (*Stats, error) {
 		TableReadersMemEstimate:        m.TableCache.Size,
 		PendingCompactionBytesEstimate: int64(m.Compact.EstimatedDebt),
 		L0FileCount:                    m.Levels[0].NumFiles,
+		PendingSuggestedCompactions:    p.suggestedCompactions.numPending(),
+		Corruptions:                    p.corruption.numCorruptions(),
 	}, nil
 }
 
+// GetMetrics implements the Engine interface.
+func (p *Pebble) GetMetrics() (*Metrics, error) {
+	m := p.db.Metrics()
+	metrics := &Metrics{
+		LevelFiles:          make([]int64, len(m.Levels)),
+		LevelBytes:          make([]int64, len(m.Levels)),
+		BlockCacheHits:      m.BlockCache.Hits,
+		BlockCacheMisses:    m.BlockCache.Misses,
+		BlockCacheSize:      m.BlockCache.Size,
+		FilterHits:          m.Filter.Hits,
+		FilterMisses:        m.Filter.Misses,
+		MemTableCount:       int64(m.MemTable.Count),
+		MemTableSize:        int64(m.MemTable.Size),
+		FlushCount:          m.Flush.Count,
+		CompactionCount:     m.Compact.Count,
+		CompactionDebtBytes: int64(m.Compact.EstimatedDebt),
+		WALFiles:            int64(m.WAL.Files),
+		WALSize:             int64(m.WAL.Size),
+	}
+	metrics.WALSyncs, metrics.WALSyncDuration = p.wal.syncStats()
+	for level := range m.Levels {
+		metrics.LevelFiles[level] = m.Levels[level].NumFiles
+		metrics.LevelBytes[level] = int64(m.Levels[level].Size)
+	}
+	return metrics, nil
+}
+
 // GetEncryptionRegistries implements the Engine interface.
 func (p *Pebble) GetEncryptionRegistries() (*EncryptionRegistries, error) {
 	// TODO(sumeer): Implement this. These are encryption-at-rest specific stats.
@@ -493,8 +847,13 @@ func (p *Pebble) GetAuxiliaryDir() string {
 }
 
 // NewBatch implements the Engine interface.
+//
+// If the engine was opened read-only, the batch can be read from and written
+// to, but committing it returns errPebbleReadOnly.
 func (p *Pebble) NewBatch() Batch {
-	return newPebbleBatch(p.db, p.db.NewIndexedBatch())
+	batch := newPebbleBatch(p.db, p.db.NewIndexedBatch(), p.corruption)
+	batch.readOnly = p.readOnly
+	return batch
 }
 
 // NewReadOnly implements the Engine interface.
@@ -505,14 +864,19 @@ func (p *Pebble) NewReadOnly() ReadWriter {
 }
 
 // NewWriteOnlyBatch implements the Engine interface.
+//
+// See NewBatch for the behavior on an engine opened read-only.
 func (p *Pebble) NewWriteOnlyBatch() Batch {
-	return newPebbleBatch(p.db, p.db.NewBatch())
+	batch := newPebbleBatch(p.db, p.db.NewBatch(), p.corruption)
+	batch.readOnly = p.readOnly
+	return batch
 }
 
 // NewSnapshot implements the Engine interface.
 func (p *Pebble) NewSnapshot() Reader {
 	return &pebbleSnapshot{
-		snapshot: p.db.NewSnapshot(),
+		snapshot:   p.db.NewSnapshot(),
+		corruption: p.corruption,
 	}
 }
 
@@ -523,39 +887,226 @@ func (p *Pebble) Type() enginepb.EngineType {
 
 // IngestExternalFiles implements the Engine interface.
 func (p *Pebble) IngestExternalFiles(ctx context.Context, paths []string) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	return p.db.Ingest(paths)
 }
 
+// ingestSSTAtTimestampBatchSize is the size, in bytes, past which
+// IngestSSTAtTimestamp commits the batch it writes the rewritten keys to and
+// starts a new one.
+var ingestSSTAtTimestampBatchSize = 4 << 20
+
+// IngestSSTAtTimestamp ingests the external sstables at the given paths,
+// rewriting the timestamp of every MVCC key to ts. This is used to import data
+// built offline with a placeholder timestamp so that it lands at the correct
+// commit time. The sstables must only contain MVCC versioned keys; an error is
+// returned if any of them contain intents, inline values or keys that are not
+// MVCC-encoded, in which case nothing is written.
+//
+// Since the timestamp is part of the encoded key, the sstables can't be
+// ingested directly. Instead, they are read once to check their keys, and
+// then their contents are streamed through batches of bounded size, the last
+// of which is synced. An error while writing them, or a crash, may leave part
+// of the keys written; as the rewrite is deterministic, ingesting the same
+// sstables again completes the import. If a key has multiple versions, only
+// the newest one is kept, as all of them would otherwise collapse onto the
+// same key.
+func (p *Pebble) IngestSSTAtTimestamp(paths []string, ts hlc.Timestamp) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
+	if ts == (hlc.Timestamp{}) {
+		return errors.New("cannot ingest sstables at an empty timestamp")
+	}
+	for _, path := range paths {
+		if err := p.rewriteSSTAtTimestamp(path, ts, nil /* put */); err != nil {
+			return errors.Wrapf(err, "checking %s", path)
+		}
+	}
+
+	batch := p.NewWriteOnlyBatch()
+	defer func() { batch.Close() }()
+	put := func(key MVCCKey, value []byte) error {
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		if batch.Len() < ingestSSTAtTimestampBatchSize {
+			return nil
+		}
+		if err := batch.Commit(false /* sync */); err != nil {
+			return err
+		}
+		batch.Close()
+		batch = p.NewWriteOnlyBatch()
+		return nil
+	}
+	for _, path := range paths {
+		if err := p.rewriteSSTAtTimestamp(path, ts, put); err != nil {
+			return errors.Wrapf(err, "rewriting %s", path)
+		}
+	}
+	// Syncing the last batch also makes the preceding ones durable, as they
+	// precede it in the WAL.
+	return batch.Commit(true /* sync */)
+}
+
+// rewriteSSTAtTimestamp passes the newest version of every key in the sstable
+// at path to put, at timestamp ts. If put is nil, the keys are only checked.
+func (p *Pebble) rewriteSSTAtTimestamp(
+	path string, ts hlc.Timestamp, put func(MVCCKey, []byte) error,
+) error {
+	file, err := p.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	sst, err := sstable.NewReader(file, sstable.ReaderOptions{
+		Comparer: MVCCComparer,
+	})
+	if err != nil {
+		return err
+	}
+	iter := &sstIterator{sst: sst}
+	defer iter.Close()
+
+	for iter.Seek(MVCCKey{Key: roachpb.KeyMin}); ; iter.NextKey() {
+		if ok, err := iter.Valid(); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+		key := iter.UnsafeKey()
+		if !key.IsValue() {
+			// Keys without a timestamp are either intents or inline values,
+			// neither of which can be rewritten to a timestamp.
+			return errors.Errorf("sstable contains non-versioned key %s", key)
+		}
+		if put == nil {
+			continue
+		}
+		if err := put(MVCCKey{Key: key.Key, Timestamp: ts}, iter.UnsafeValue()); err != nil {
+			return err
+		}
+	}
+}
+
 // PreIngestDelay implements the Engine interface.
 func (p *Pebble) PreIngestDelay(ctx context.Context) {
 	preIngestDelay(ctx, p, p.settings)
 }
 
-// ApproximateDiskBytes implements the Engine interface.
+// ApproximateDiskBytes implements the Engine interface. It returns the
+// estimated number of bytes occupied by [from, to) in sstables, computed from
+// the sstable metadata without reading any data. Tables contained in the span
+// count in full. Tables straddling one of the span's boundaries count in
+// proportion to the part of their key range that overlaps the span, which is
+// interpolated from their smallest and largest keys. Data still in the
+// memtables isn't included.
 func (p *Pebble) ApproximateDiskBytes(from, to roachpb.Key) (uint64, error) {
-	// TODO(itsbilal): Add functionality in Pebble to do this count internally,
-	// instead of iterating over the range.
-	count := uint64(0)
-	_ = p.Iterate(from, to, func(kv MVCCKeyValue) (bool, error) {
-		count += uint64(kv.Key.Len() + len(kv.Value))
-		return false, nil
-	})
-	return count, nil
+	if to.Compare(from) <= 0 {
+		return 0, nil
+	}
+	var count float64
+	for _, tables := range p.db.SSTables() {
+		for _, table := range tables {
+			smallest, err := DecodeMVCCKey(table.Smallest.UserKey)
+			if err != nil {
+				return 0, err
+			}
+			largest, err := DecodeMVCCKey(table.Largest.UserKey)
+			if err != nil {
+				return 0, err
+			}
+			count += float64(table.Size) * overlapFraction(smallest.Key, largest.Key, from, to)
+		}
+	}
+	return uint64(count), nil
+}
+
+// overlapFraction returns the estimated fraction of the key range [smallest,
+// largest] of an sstable that overlaps [from, to). Keys are interpolated by
+// interpreting the 8 bytes following the common prefix of smallest and largest
+// as a big-endian integer, which assumes the table's keys are uniformly
+// distributed in that range.
+func overlapFraction(smallest, largest, from, to roachpb.Key) float64 {
+	if largest.Compare(from) < 0 || smallest.Compare(to) >= 0 {
+		return 0
+	}
+	if smallest.Compare(from) >= 0 && largest.Compare(to) < 0 {
+		return 1
+	}
+	var prefix int
+	for prefix < len(smallest) && prefix < len(largest) && smallest[prefix] == largest[prefix] {
+		prefix++
+	}
+	pos := func(key roachpb.Key) float64 {
+		if !bytes.HasPrefix(key, largest[:prefix]) {
+			if key.Compare(smallest) < 0 {
+				return 0
+			}
+			return math.MaxUint64
+		}
+		var buf [8]byte
+		copy(buf[:], key[prefix:])
+		return float64(binary.BigEndian.Uint64(buf[:]))
+	}
+	lo, hi := pos(smallest), pos(largest)
+	if hi <= lo {
+		// All of the table's keys share their first distinguishing 8 bytes, so
+		// there is nothing to interpolate on.
+		return 1
+	}
+	start, end := lo, hi
+	if smallest.Compare(from) < 0 {
+		start = math.Max(lo, pos(from))
+	}
+	if largest.Compare(to) >= 0 {
+		end = math.Min(hi, pos(to))
+	}
+	if end <= start {
+		return 0
+	}
+	return (end - start) / (hi - lo)
 }
 
 // Compact implements the Engine interface.
 func (p *Pebble) Compact() error {
-	// TODO(hueypark): Implement this.
-	return nil
+	return p.CompactRange(nil, nil, true /* forceBottommost */)
 }
 
 // CompactRange implements the Engine interface.
 func (p *Pebble) CompactRange(start, end roachpb.Key, forceBottommost bool) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
+	// pebble.DB.Compact requires both bounds. Keys outside of [KeyMin, KeyMax)
+	// are never written, so those stand in for unbounded ends of the range.
+	if len(start) == 0 {
+		start = roachpb.KeyMin
+	}
+	if len(end) == 0 {
+		end = roachpb.KeyMax
+	}
 	bufStart := EncodeKey(MVCCKey{start, hlc.Timestamp{}})
 	bufEnd := EncodeKey(MVCCKey{end, hlc.Timestamp{}})
 	return p.db.Compact(bufStart, bufEnd)
 }
 
+// RegisterEventListener implements the Engine interface.
+func (p *Pebble) RegisterEventListener(listener EngineEventListener) error {
+	p.events.register(listener)
+	return nil
+}
+
+// SuggestCompaction implements the Engine interface.
+func (p *Pebble) SuggestCompaction(start, end roachpb.Key, reason string) {
+	if p.readOnly {
+		return
+	}
+	p.suggestedCompactions.suggest(p, start, end, reason)
+}
+
 // InMem returns true if the receiver is an in-memory engine and false
 // otherwise.
 func (p *Pebble) InMem() bool {
@@ -564,6 +1115,9 @@ func (p *Pebble) InMem() bool {
 
 // OpenFile implements the Engine interface.
 func (p *Pebble) OpenFile(filename string) (DBFile, error) {
+	if p.readOnly {
+		return nil, errPebbleReadOnly
+	}
 	// TODO(peter): On RocksDB, the MemEnv allows creating a file when the parent
 	// directory does not exist. Various tests in the storage package depend on
 	// this because they are accidentally creating the required directory on the
@@ -588,6 +1142,9 @@ func (p *Pebble) ReadFile(filename string) ([]byte, error) {
 
 // WriteFile writes data to a file in this RocksDB's env.
 func (p *Pebble) WriteFile(filename string, data []byte) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	file, err := p.fs.Create(filename)
 	if err != nil {
 		return err
@@ -600,11 +1157,17 @@ func (p *Pebble) WriteFile(filename string, data []byte) error {
 
 // DeleteFile implements the Engine interface.
 func (p *Pebble) DeleteFile(filename string) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	return p.fs.Remove(filename)
 }
 
 // DeleteDirAndFiles implements the Engine interface.
 func (p *Pebble) DeleteDirAndFiles(dir string) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	// TODO(itsbilal): Implement FS.RemoveAll then call that here instead.
 	files, err := p.fs.List(dir)
 	if err != nil {
@@ -634,10 +1197,24 @@ func (p *Pebble) DeleteDirAndFiles(dir string) error {
 
 // LinkFile implements the Engine interface.
 func (p *Pebble) LinkFile(oldname, newname string) error {
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	return p.fs.Link(oldname, newname)
 }
 
-// CreateCheckpoint implements the Engine interface.
+// Env implements the Engine interface.
+func (p *Pebble) Env() vfs.FS {
+	return p.fs
+}
+
+// CreateCheckpoint implements the Engine interface. The checkpoint is a
+// consistent copy of the store at the time of the call: sstables are
+// hard-linked, and the WAL files backing the memtables are copied, so that
+// writes which were committed but not yet flushed are included. Writes are
+// only held up while the set of files to checkpoint is determined, not while
+// they are linked or copied. The checkpoint can be opened as an independent
+// engine, for example with PebbleConfig.ReadOnly set.
 func (p *Pebble) CreateCheckpoint(dir string) error {
 	return p.db.Checkpoint(dir)
 }
@@ -660,6 +1237,69 @@ func (p *Pebble) GetSSTables() (sstables SSTableInfos) {
 	return sstables
 }
 
+// LSMLevel describes the files in one level of a Pebble LSM.
+type LSMLevel struct {
+	Level    int
+	NumFiles int64
+	Size     int64
+	// Smallest and Largest are the bounds of the keys in the level's files.
+	// They are empty if the level has no files.
+	Smallest, Largest MVCCKey
+}
+
+// LSMLevels describes the levels of a Pebble LSM, from L0 to the bottommost
+// level.
+type LSMLevels []LSMLevel
+
+func (l LSMLevels) String() string {
+	var buf bytes.Buffer
+	for _, level := range l {
+		fmt.Fprintf(&buf, "L%d: %d files, %s", level.Level, level.NumFiles,
+			humanizeutil.IBytes(level.Size))
+		if level.NumFiles > 0 {
+			fmt.Fprintf(&buf, " [%s-%s]", level.Smallest, level.Largest)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// LSMInfo returns the number of files, total size and key bounds of each
+// level of the LSM. It only reads the metadata of the current version of the
+// LSM, so it is cheap and doesn't trigger flushes or compactions. Note that
+// the file counts and the key bounds are read separately, and may disagree if
+// a flush or compaction completes in between.
+func (p *Pebble) LSMInfo() LSMLevels {
+	m := p.db.Metrics()
+	levels := make(LSMLevels, len(m.Levels))
+	for i := range m.Levels {
+		levels[i] = LSMLevel{
+			Level:    i,
+			NumFiles: m.Levels[i].NumFiles,
+			Size:     int64(m.Levels[i].Size),
+		}
+	}
+	for i, tables := range p.db.SSTables() {
+		if i >= len(levels) {
+			break
+		}
+		var smallest, largest []byte
+		for _, table := range tables {
+			if smallest == nil || MVCCComparer.Compare(table.Smallest.UserKey, smallest) < 0 {
+				smallest = table.Smallest.UserKey
+			}
+			if largest == nil || MVCCComparer.Compare(table.Largest.UserKey, largest) > 0 {
+				largest = table.Largest.UserKey
+			}
+		}
+		if smallest != nil {
+			levels[i].Smallest, _ = DecodeMVCCKey(smallest)
+			levels[i].Largest, _ = DecodeMVCCKey(largest)
+		}
+	}
+	return levels
+}
+
 type pebbleReadOnly struct {
 	parent     *Pebble
 	prefixIter pebbleIterator
@@ -712,7 +1352,7 @@ func (p *pebbleReadOnly) NewIterator(opts IterOptions) Iterator {
 
 	if opts.MinTimestampHint != (hlc.Timestamp{}) {
 		// Iterators that specify timestamp bounds cannot be cached.
-		return newPebbleIterator(p.parent.db, opts)
+		return newPebbleIterator(p.parent.db, opts, p.parent.corruption)
 	}
 
 	iter := &p.normalIter
@@ -726,7 +1366,7 @@ func (p *pebbleReadOnly) NewIterator(opts IterOptions) Iterator {
 	if iter.iter != nil {
 		iter.setOptions(opts)
 	} else {
-		iter.init(p.parent.db, opts)
+		iter.init(p.parent.db, opts, p.parent.corruption)
 		iter.reusable = true
 	}
 
@@ -776,8 +1416,9 @@ func (p *pebbleReadOnly) LogLogicalOp(op MVCCLogicalOpType, details MVCCLogicalO
 
 // pebbleSnapshot represents a snapshot created using Pebble.NewSnapshot().
 type pebbleSnapshot struct {
-	snapshot *pebble.Snapshot
-	closed   bool
+	snapshot   *pebble.Snapshot
+	closed     bool
+	corruption *pebbleCorruptionReporter
 }
 
 var _ Reader = &pebbleSnapshot{}
@@ -800,10 +1441,16 @@ func (p *pebbleSnapshot) Get(key MVCCKey) ([]byte, error) {
 	}
 
 	ret, err := p.snapshot.Get(EncodeKey(key))
-	if err == pebble.ErrNotFound || len(ret) == 0 {
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		p.corruption.maybeReport(err, roachpb.Span{Key: key.Key})
+		return nil, err
+	}
+	if len(ret) == 0 {
 		return nil, nil
 	}
-	return ret, err
+	return ret, nil
 }
 
 // GetProto implements the Reader interface.
@@ -815,6 +1462,9 @@ func (p *pebbleSnapshot) GetProto(
 	}
 
 	val, err := p.snapshot.Get(EncodeKey(key))
+	if err != nil {
+		p.corruption.maybeReport(err, roachpb.Span{Key: key.Key})
+	}
 	if err != nil || val == nil {
 		return false, 0, 0, err
 	}
@@ -834,5 +1484,5 @@ func (p *pebbleSnapshot) Iterate(
 
 // NewIterator implements the Reader interface.
 func (p pebbleSnapshot) NewIterator(opts IterOptions) Iterator {
-	return newPebbleIterator(p.snapshot, opts)
+	return newPebbleIterator(p.snapshot, opts, p.corruption)
 }
@@ -30,6 +30,11 @@ type pebbleBatch struct {
 	isDistinct   bool
 	distinctOpen bool
 	parentBatch  *pebbleBatch
+	// Set when the batch was created by an engine opened read-only, in which
+	// case Commit fails.
+	readOnly bool
+	// corruption is notified of the corruption errors encountered by reads.
+	corruption *pebbleCorruptionReporter
 }
 
 var _ Batch = &pebbleBatch{}
@@ -41,12 +46,15 @@ var pebbleBatchPool = sync.Pool{
 }
 
 // Instantiates a new pebbleBatch.
-func newPebbleBatch(db *pebble.DB, batch *pebble.Batch) *pebbleBatch {
+func newPebbleBatch(
+	db *pebble.DB, batch *pebble.Batch, corruption *pebbleCorruptionReporter,
+) *pebbleBatch {
 	pb := pebbleBatchPool.Get().(*pebbleBatch)
 	*pb = pebbleBatch{
-		db:    db,
-		batch: batch,
-		buf:   pb.buf,
+		db:         db,
+		batch:      batch,
+		buf:        pb.buf,
+		corruption: corruption,
 		prefixIter: pebbleIterator{
 			lowerBoundBuf: pb.prefixIter.lowerBoundBuf,
 			upperBoundBuf: pb.prefixIter.upperBoundBuf,
@@ -106,10 +114,16 @@ func (p *pebbleBatch) Get(key MVCCKey) ([]byte, error) {
 	}
 	p.buf = EncodeKeyToBuf(p.buf[:0], key)
 	ret, err := r.Get(p.buf)
-	if err == pebble.ErrNotFound || len(ret) == 0 {
+	if err == pebble.ErrNotFound {
 		return nil, nil
+	} else if err != nil {
+		p.corruption.maybeReport(err, roachpb.Span{Key: key.Key})
+		return nil, err
 	}
-	return ret, err
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
 }
 
 // GetProto implements the Batch interface.
@@ -132,6 +146,9 @@ func (p *pebbleBatch) GetProto(
 	}
 	p.buf = EncodeKeyToBuf(p.buf[:0], key)
 	val, err := r.Get(p.buf)
+	if err != nil {
+		p.corruption.maybeReport(err, roachpb.Span{Key: key.Key})
+	}
 	if err != nil || val == nil {
 		return false, 0, 0, err
 	}
@@ -167,7 +184,7 @@ func (p *pebbleBatch) NewIterator(opts IterOptions) Iterator {
 
 	if opts.MinTimestampHint != (hlc.Timestamp{}) {
 		// Iterators that specify timestamp bounds cannot be cached.
-		return newPebbleIterator(p.batch, opts)
+		return newPebbleIterator(p.batch, opts, p.corruption)
 	}
 
 	iter := &p.normalIter
@@ -181,9 +198,9 @@ func (p *pebbleBatch) NewIterator(opts IterOptions) Iterator {
 	if iter.iter != nil {
 		iter.setOptions(opts)
 	} else if p.batch.Indexed() {
-		iter.init(p.batch, opts)
+		iter.init(p.batch, opts, p.corruption)
 	} else {
-		iter.init(p.db, opts)
+		iter.init(p.db, opts, p.corruption)
 	}
 
 	iter.inuse = true
@@ -316,6 +333,9 @@ func (p *pebbleBatch) Commit(sync bool) error {
 	if p.batch == nil {
 		panic("called with nil batch")
 	}
+	if p.readOnly {
+		return errPebbleReadOnly
+	}
 	err := p.batch.Commit(opts)
 	if err != nil {
 		panic(err)
@@ -339,12 +359,17 @@ func (p *pebbleBatch) Distinct() ReadWriter {
 	// optimization. In Pebble we're still using the same underlying batch and if
 	// it is indexed we'll still be indexing it as we Go.
 	p.distinctOpen = true
-	d := newPebbleBatch(p.db, p.batch)
+	d := newPebbleBatch(p.db, p.batch, p.corruption)
 	d.parentBatch = p
 	d.isDistinct = true
 	return d
 }
 
+// WriteOnly implements the Batch interface.
+func (p *pebbleBatch) WriteOnly() bool {
+	return !p.batch.Indexed() && !p.isDistinct
+}
+
 // Empty implements the Batch interface.
 func (p *pebbleBatch) Empty() bool {
 	return p.batch.Count() == 0
@@ -355,6 +380,11 @@ func (p *pebbleBatch) Len() int {
 	return len(p.batch.Repr())
 }
 
+// Count implements the Batch interface.
+func (p *pebbleBatch) Count() int {
+	return int(p.batch.Count())
+}
+
 // Repr implements the Batch interface.
 func (p *pebbleBatch) Repr() []byte {
 	// Repr expects a "safe" byte slice as its output. The return value of
@@ -0,0 +1,130 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/pkg/errors"
+)
+
+// ErrInjectedCorruption is the read error returned by the files of an FS
+// created by NewCorruptingFS with the CorruptReadError mode. It is recognized
+// as a corruption error by Pebble engines, and reported as such to
+// PebbleConfig.OnCorruption.
+var ErrInjectedCorruption = errors.New("injected corruption")
+
+// CorruptionMode is the way an FS created by NewCorruptingFS corrupts reads.
+type CorruptionMode int
+
+const (
+	// CorruptFlipBytes inverts the bits of the corrupted bytes, as if the data
+	// had been damaged on disk. Reads succeed, but checksums don't match.
+	CorruptFlipBytes CorruptionMode = iota
+	// CorruptReadError fails the reads of the corrupted bytes with
+	// ErrInjectedCorruption, as if the device had failed to read them.
+	CorruptReadError
+)
+
+// CorruptionPolicy determines the reads corrupted by an FS created by
+// NewCorruptingFS. Reads are corrupted deterministically: the same reads of
+// the same files are always corrupted in the same way.
+type CorruptionPolicy struct {
+	// Mode is the way reads are corrupted.
+	Mode CorruptionMode
+	// Match, if set, selects the files to corrupt by name. By default, sstables
+	// are corrupted.
+	Match func(name string) bool
+	// Offset and Length delimit the bytes [Offset, Offset+Length) of the
+	// matching files which are corrupted. Reads which don't overlap them are
+	// left untouched.
+	Offset, Length int64
+}
+
+// NewCorruptingFS returns an FS which passes all calls through to fs, but
+// corrupts the reads of files opened for reading according to policy. Files
+// are written without corruption, so a store can be populated normally and
+// its sstables are corrupted once read back. It is meant for tests of the
+// handling of corrupt data by the read path, through PebbleConfig.Opts.FS,
+// e.g. on top of vfs.NewMem().
+func NewCorruptingFS(fs vfs.FS, policy CorruptionPolicy) vfs.FS {
+	if policy.Match == nil {
+		policy.Match = func(name string) bool { return filepath.Ext(name) == ".sst" }
+	}
+	return &corruptingFS{FS: fs, policy: policy}
+}
+
+// corruptingFS implements vfs.FS. See NewCorruptingFS.
+type corruptingFS struct {
+	vfs.FS
+	policy CorruptionPolicy
+}
+
+var _ vfs.FS = &corruptingFS{}
+
+// Open implements vfs.FS.
+func (fs *corruptingFS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.Open(name, opts...)
+	if err != nil || !fs.policy.Match(name) {
+		return f, err
+	}
+	return &corruptingFile{File: f, policy: &fs.policy}, nil
+}
+
+// corruptingFile wraps a file opened for reading by a corruptingFS.
+type corruptingFile struct {
+	vfs.File
+	policy *CorruptionPolicy
+	// pos is the offset of sequential reads.
+	pos int64
+}
+
+// corrupt applies the policy to the n bytes read into p at offset off.
+func (f *corruptingFile) corrupt(p []byte, off int64, n int) (int, error) {
+	start, end := f.policy.Offset, f.policy.Offset+f.policy.Length
+	if start < off {
+		start = off
+	}
+	if readEnd := off + int64(n); end > readEnd {
+		end = readEnd
+	}
+	if start >= end {
+		return n, nil
+	}
+	if f.policy.Mode == CorruptReadError {
+		return int(start - off), ErrInjectedCorruption
+	}
+	for i := start - off; i < end-off; i++ {
+		p[i] ^= 0xff
+	}
+	return n, nil
+}
+
+// Read implements io.Reader.
+func (f *corruptingFile) Read(p []byte) (int, error) {
+	off := f.pos
+	n, err := f.File.Read(p)
+	f.pos += int64(n)
+	if n, cerr := f.corrupt(p, off, n); cerr != nil {
+		return n, cerr
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *corruptingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	if n, cerr := f.corrupt(p, off, n); cerr != nil {
+		return n, cerr
+	}
+	return n, err
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/golang/snappy"
+)
+
+// CorruptionEvent describes the corruption of an engine's files, as detected
+// by a read. The read itself fails with Err.
+type CorruptionEvent struct {
+	// Err is the error returned to the reader.
+	Err error
+	// Span is the span of keys that was being read. Span.EndKey is empty for
+	// point reads. Both keys are empty if the span is unknown, such as for
+	// unbounded prefix iterators.
+	Span roachpb.Span
+	// Tables are the sstables overlapping Span, one of which is presumably
+	// corrupt. It is empty if Span is unknown.
+	Tables []CorruptTableInfo
+}
+
+// CorruptTableInfo identifies an sstable that may be corrupt.
+type CorruptTableInfo struct {
+	SSTableInfo
+	// FileNum is the file number of the sstable.
+	FileNum uint64
+	// Path is the path of the sstable.
+	Path string
+}
+
+// pebbleCorruptionMessages are the messages of the errors, or their prefixes,
+// with which the vendored version of Pebble reports corrupt data. That version
+// doesn't mark its corruption errors, but creates them from these constant
+// strings, such as "pebble/table: invalid table (checksum mismatch)" for
+// blocks which fail their checksum.
+var pebbleCorruptionMessages = []string{
+	"pebble/table: invalid table",
+	"pebble/table: corrupt",
+	"pebble/record: invalid chunk",
+	"pebble/record: zeroed chunk",
+}
+
+// isPebbleCorruption returns whether err signals corrupt data: either one of
+// Pebble's corruption errors, recognized by their messages, an error decoding
+// a compressed block, or the read errors injected by a corrupting FS (see
+// NewCorruptingFS). The messages are matched in full rather than by keywords,
+// so that errors which merely mention corruption, e.g. in a path, don't
+// match.
+func isPebbleCorruption(err error) bool {
+	if errors.Is(err, ErrInjectedCorruption) || errors.Is(err, snappy.ErrCorrupt) {
+		return true
+	}
+	msg := err.Error()
+	for _, m := range pebbleCorruptionMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// pebbleCorruptionReporter counts the corruption errors encountered by the
+// reads of a Pebble engine, and reports them to PebbleConfig.OnCorruption.
+type pebbleCorruptionReporter struct {
+	// count is accessed atomically.
+	count        int64
+	db           *pebble.DB
+	fs           vfs.FS
+	dir          string
+	onCorruption func(CorruptionEvent)
+}
+
+// maybeReport reports err if it signals corruption. span is the span of keys
+// being read. The reporter may be nil.
+func (r *pebbleCorruptionReporter) maybeReport(err error, span roachpb.Span) {
+	if r == nil || err == nil || err == pebble.ErrNotFound || !isPebbleCorruption(err) {
+		return
+	}
+	atomic.AddInt64(&r.count, 1)
+	if r.onCorruption == nil {
+		return
+	}
+	event := CorruptionEvent{Err: err, Span: span}
+	if len(span.Key) > 0 || len(span.EndKey) > 0 {
+		event.Tables = r.overlappingTables(span)
+	}
+	r.onCorruption(event)
+}
+
+// overlappingTables returns the sstables overlapping span.
+func (r *pebbleCorruptionReporter) overlappingTables(span roachpb.Span) []CorruptTableInfo {
+	end := span.EndKey
+	if len(end) == 0 {
+		end = span.Key.Next()
+	}
+	var tables []CorruptTableInfo
+	for level, levelTables := range r.db.SSTables() {
+		for _, table := range levelTables {
+			smallest, _ := DecodeMVCCKey(table.Smallest.UserKey)
+			largest, _ := DecodeMVCCKey(table.Largest.UserKey)
+			if largest.Key.Compare(span.Key) < 0 || smallest.Key.Compare(end) >= 0 {
+				continue
+			}
+			tables = append(tables, CorruptTableInfo{
+				SSTableInfo: SSTableInfo{
+					Level: level,
+					Size:  int64(table.Size),
+					Start: smallest,
+					End:   largest,
+				},
+				FileNum: table.FileNum,
+				Path:    r.fs.PathJoin(r.dir, fmt.Sprintf("%06d.sst", table.FileNum)),
+			})
+		}
+	}
+	return tables
+}
+
+// numCorruptions returns the number of corruption errors reported so far.
+func (r *pebbleCorruptionReporter) numCorruptions() int64 {
+	if r == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.count)
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/golang/snappy"
+)
+
+func TestPebbleCorruptionReporting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	var events []CorruptionEvent
+	open := func() *Pebble {
+		p, err := NewPebble(PebbleConfig{
+			StorageConfig: base.StorageConfig{Dir: dir},
+			Opts:          testPebbleOptions(vfs.Default),
+			OnCorruption:  func(e CorruptionEvent) { events = append(events, e) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	key := func(i int) roachpb.Key { return roachpb.Key(fmt.Sprintf("key-%04d", i)) }
+	p := open()
+	for i := 0; i < 1000; i++ {
+		value := roachpb.MakeValueFromString(strings.Repeat("x", 100))
+		if err := MVCCPut(ctx, p, nil, key(i), ts, value, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	// Corrupt the start of the first data block of every sstable.
+	ssts, err := filepath.Glob(filepath.Join(dir, "*.sst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ssts) == 0 {
+		t.Fatal("no sstables written")
+	}
+	corrupt := make(map[string]bool)
+	for _, sst := range ssts {
+		corrupt[filepath.Base(sst)] = true
+		data, err := ioutil.ReadFile(sst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 8; i < 16; i++ {
+			data[i] ^= 0xff
+		}
+		if err := ioutil.WriteFile(sst, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p = open()
+	defer p.Close()
+
+	// Reads of the corrupt blocks fail, and are reported.
+	if _, _, err := MVCCGet(ctx, p, key(0), ts, MVCCGetOptions{}); err == nil {
+		t.Fatal("expected read of corrupt data to fail")
+	}
+	if _, _, _, err := MVCCScan(ctx, p, key(0), key(1000), math.MaxInt64, ts, MVCCScanOptions{}); err == nil {
+		t.Fatal("expected scan of corrupt data to fail")
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 corruption events, found %d", len(events))
+	}
+	for _, e := range events {
+		// The error is the one Pebble returns for the flipped bytes, rather
+		// than one injected by a corrupting FS.
+		if e.Err == nil || !isPebbleCorruption(e.Err) || errors.Is(e.Err, ErrInjectedCorruption) {
+			t.Fatalf("unexpected error %v", e.Err)
+		}
+		if !e.Span.Key.Equal(key(0)) {
+			t.Fatalf("unexpected span %s", e.Span)
+		}
+		if len(e.Tables) == 0 {
+			t.Fatal("expected the tables overlapping the read to be reported")
+		}
+		var listed bool
+		for _, table := range e.Tables {
+			if _, err := p.fs.Stat(table.Path); err != nil || filepath.Ext(table.Path) != ".sst" {
+				t.Fatalf("unexpected table path %s: %v", table.Path, err)
+			}
+			listed = listed || corrupt[filepath.Base(table.Path)]
+		}
+		if !listed {
+			t.Fatalf("expected a corrupt table among %+v", e.Tables)
+		}
+	}
+
+	stats, err := p.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Corruptions != 2 {
+		t.Fatalf("expected 2 corruptions, found %d", stats.Corruptions)
+	}
+}
+
+func TestIsPebbleCorruption(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		// The errors of the vendored Pebble for corrupt sstables and logs.
+		{errors.New("pebble/table: invalid table (checksum mismatch)"), true},
+		{errors.Wrap(errors.New("pebble/table: invalid table (bad magic number)"), "reading 000012.sst"), true},
+		{errors.New("pebble/table: corrupt index entry"), true},
+		{errors.New("pebble/record: invalid chunk"), true},
+		{snappy.ErrCorrupt, true},
+		{ErrInjectedCorruption, true},
+		{errors.Wrap(ErrInjectedCorruption, "reading 000012.sst"), true},
+		// Errors which merely mention corruption don't signal it.
+		{errors.New("open /mnt/corrupt/000012.sst: no such file or directory"), false},
+		{errors.New("invalid table name \"corrupt\""), false},
+		{pebble.ErrNotFound, false},
+	}
+	for _, tc := range testCases {
+		if actual := isPebbleCorruption(tc.err); actual != tc.expected {
+			t.Errorf("%v: expected %t, got %t", tc.err, tc.expected, actual)
+		}
+	}
+}
+
+func TestCorruptingFS(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	key := func(i int) roachpb.Key { return roachpb.Key(fmt.Sprintf("key-%04d", i)) }
+	for _, c := range []struct {
+		name string
+		mode CorruptionMode
+	}{
+		{"flip-bytes", CorruptFlipBytes},
+		{"read-error", CorruptReadError},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var events []CorruptionEvent
+			// Corrupt the start of the first data block of every sstable.
+			fs := NewCorruptingFS(vfs.NewMem(), CorruptionPolicy{Mode: c.mode, Offset: 8, Length: 8})
+			p, err := NewPebble(PebbleConfig{
+				Opts:         testPebbleOptions(fs),
+				OnCorruption: func(e CorruptionEvent) { events = append(events, e) },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			for i := 0; i < 1000; i++ {
+				value := roachpb.MakeValueFromString(strings.Repeat("x", 100))
+				if err := MVCCPut(ctx, p, nil, key(i), ts, value, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Reads of the memtable aren't affected.
+			if _, _, err := MVCCGet(ctx, p, key(0), ts, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := p.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reads of the corrupt block fail rather than returning garbage, and
+			// are reported.
+			if _, _, err := MVCCGet(ctx, p, key(0), ts, MVCCGetOptions{}); err == nil {
+				t.Fatal("expected read of corrupt data to fail")
+			}
+			if _, _, _, err := MVCCScan(ctx, p, key(0), key(1000), math.MaxInt64, ts, MVCCScanOptions{}); err == nil {
+				t.Fatal("expected scan of corrupt data to fail")
+			}
+			if len(events) != 2 {
+				t.Fatalf("expected 2 corruption events, found %d", len(events))
+			}
+			if c.mode == CorruptReadError {
+				for _, e := range events {
+					if !testutils.IsError(e.Err, ErrInjectedCorruption.Error()) {
+						t.Fatalf("unexpected error %v", e.Err)
+					}
+				}
+			}
+
+			// Keys in other blocks can still be read.
+			if v, _, err := MVCCGet(ctx, p, key(999), ts, MVCCGetOptions{}); err != nil {
+				t.Fatal(err)
+			} else if v == nil {
+				t.Fatalf("expected a value for %s", key(999))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/pkg/errors"
+)
+
+// PebbleEncryptionOptions configures encryption-at-rest for a Pebble store.
+type PebbleEncryptionOptions struct {
+	// FS encrypts the store's files. It is used in place of Opts.FS, which it
+	// typically wraps. File names must be preserved. It is required.
+	FS vfs.FS
+}
+
+const (
+	// encryptionMarkerFilename is the name of the file, in the data directory
+	// of an encrypted store, recording that the store is encrypted.
+	encryptionMarkerFilename = "COCKROACHDB_ENCRYPTED"
+	// encryptionMarkerContents is written to the marker through the
+	// encrypted FS, so that reading it back verifies that the store is opened
+	// with the FS, and keys, it was created with.
+	encryptionMarkerContents = "cockroachdb encrypted store\n"
+)
+
+// checkPebbleEncryption verifies, before a store is opened through fs, that
+// the store is encrypted iff encrypted is set. It doesn't write to dir, which
+// Pebble hasn't locked yet: new encrypted stores are recorded as such by
+// markPebbleEncryption once Pebble has opened them.
+func checkPebbleEncryption(fs vfs.FS, dir string, encrypted bool) error {
+	markerPath := fs.PathJoin(dir, encryptionMarkerFilename)
+	_, err := fs.Stat(markerPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	hasMarker := err == nil
+
+	switch {
+	case hasMarker && !encrypted:
+		return errors.Errorf(
+			"store at %s is encrypted and must be opened with encryption options", dir)
+	case hasMarker:
+		f, err := fs.Open(markerPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		contents, err := ioutil.ReadAll(f)
+		if err != nil {
+			return errors.Wrapf(err, "could not read encryption marker of store at %s", dir)
+		}
+		if string(contents) != encryptionMarkerContents {
+			return errors.Errorf(
+				"store at %s was encrypted with different encryption options", dir)
+		}
+		return nil
+	case !encrypted:
+		return nil
+	}
+
+	// An encrypted store without a marker must be a new store, or one whose
+	// creation was interrupted before it was marked, whose CURRENT file was
+	// then written through fs. Opening an existing plaintext store through the
+	// encrypted FS would read garbage.
+	f, err := fs.Open(fs.PathJoin(dir, "CURRENT"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	contents, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(string(contents), "MANIFEST-") {
+		return errors.Errorf(
+			"store at %s is not encrypted and cannot be opened with encryption options", dir)
+	}
+	return nil
+}
+
+// markPebbleEncryption records that the store in dir is encrypted, by creating
+// a marker file through fs unless it exists already. Pebble must hold the lock
+// of the store, so that concurrent opens of the store can't race on the
+// marker.
+func markPebbleEncryption(fs vfs.FS, dir string) error {
+	markerPath := fs.PathJoin(dir, encryptionMarkerFilename)
+	if _, err := fs.Stat(markerPath); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	f, err := fs.Create(markerPath)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(encryptionMarkerContents)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
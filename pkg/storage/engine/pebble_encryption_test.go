@@ -0,0 +1,174 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// xorFS is a toy encrypted FS which XORs the contents of all files with key.
+type xorFS struct {
+	vfs.FS
+	key byte
+}
+
+func (fs xorFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return xorFile{File: f, key: fs.key}, nil
+}
+
+func (fs xorFS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.Open(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return xorFile{File: f, key: fs.key}, nil
+}
+
+type xorFile struct {
+	vfs.File
+	key byte
+}
+
+func (f xorFile) xor(p []byte) {
+	for i := range p {
+		p[i] ^= f.key
+	}
+}
+
+func (f xorFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.xor(p[:n])
+	return n, err
+}
+
+func (f xorFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.xor(p[:n])
+	return n, err
+}
+
+func (f xorFile) Write(p []byte) (int, error) {
+	buf := append([]byte(nil), p...)
+	f.xor(buf)
+	return f.File.Write(buf)
+}
+
+func TestPebbleEncryption(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	open := func(dir string, enc *PebbleEncryptionOptions) (*Pebble, error) {
+		return NewPebble(PebbleConfig{
+			StorageConfig:     base.StorageConfig{Dir: dir},
+			Opts:              testPebbleOptions(vfs.Default),
+			EncryptionOptions: enc,
+		})
+	}
+	encOpts := func(key byte) *PebbleEncryptionOptions {
+		return &PebbleEncryptionOptions{FS: xorFS{FS: vfs.Default, key: key}}
+	}
+
+	// Encryption options without an FS are rejected, rather than silently
+	// storing plaintext.
+	if _, err := open(dir, &PebbleEncryptionOptions{}); !testutils.IsError(err, "encryption options must specify an FS") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Create an encrypted store.
+	eng, err := open(dir, encOpts(0x5a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("a"), []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+
+	// It can't be opened in plaintext, or with a different key.
+	if _, err := open(dir, nil); !testutils.IsError(err, "is encrypted and must be opened with encryption options") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := open(dir, encOpts(0x42)); !testutils.IsError(err, "was encrypted with different encryption options") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// It can be reopened with the same options.
+	eng, err = open(dir, encOpts(0x5a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := eng.Get(mvccKey("a")); err != nil {
+		t.Fatal(err)
+	} else if string(val) != "secret" {
+		t.Fatalf("unexpected value %q", val)
+	}
+	eng.Close()
+
+	// A store whose creation was interrupted before it was marked as
+	// encrypted can be reopened with the options it was created with, which
+	// marks it.
+	if err := vfs.Default.Remove(filepath.Join(dir, encryptionMarkerFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(dir, encOpts(0x42)); !testutils.IsError(err, "is not encrypted and cannot be opened with encryption options") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	eng, err = open(dir, encOpts(0x5a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+	if _, err := vfs.Default.Stat(filepath.Join(dir, encryptionMarkerFilename)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The encrypting FS doesn't leak into the caller's options.
+	opts := testPebbleOptions(vfs.Default)
+	eng, err = NewPebble(PebbleConfig{
+		StorageConfig:     base.StorageConfig{Dir: dir},
+		Opts:              opts,
+		EncryptionOptions: encOpts(0x5a),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+	if opts.FS != vfs.Default {
+		t.Fatal("expected the options of the caller to be left unchanged")
+	}
+
+	// A plaintext store can't be opened with encryption.
+	plainDir, plainCleanup := testutils.TempDir(t)
+	defer plainCleanup()
+	eng, err = open(plainDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+	if _, err := open(plainDir, encOpts(0x5a)); !testutils.IsError(err, "is not encrypted and cannot be opened with encryption options") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/pebble"
+)
+
+// pebbleEventListeners forwards Pebble's flush and compaction events to the
+// EngineEventListeners registered with a Pebble engine.
+type pebbleEventListeners struct {
+	mu struct {
+		syncutil.Mutex
+		listeners []EngineEventListener
+		// starts holds the start times of the flushes and compactions in
+		// progress, by job ID. The vendored version of Pebble doesn't report
+		// their durations.
+		starts map[int]time.Time
+	}
+}
+
+func newPebbleEventListeners() *pebbleEventListeners {
+	l := &pebbleEventListeners{}
+	l.mu.starts = make(map[int]time.Time)
+	return l
+}
+
+// register adds listener to the listeners notified of events.
+func (l *pebbleEventListeners) register(listener EngineEventListener) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mu.listeners = append(l.mu.listeners, listener)
+}
+
+// install chains the forwarding of events into the flush and compaction
+// handlers of el.
+func (l *pebbleEventListeners) install(el *pebble.EventListener) {
+	prevFlushBegin, prevFlushEnd := el.FlushBegin, el.FlushEnd
+	prevCompactionBegin, prevCompactionEnd := el.CompactionBegin, el.CompactionEnd
+	el.FlushBegin = func(info pebble.FlushInfo) {
+		if prevFlushBegin != nil {
+			prevFlushBegin(info)
+		}
+		l.begin(info.JobID)
+	}
+	el.FlushEnd = func(info pebble.FlushInfo) {
+		if prevFlushEnd != nil {
+			prevFlushEnd(info)
+		}
+		ev := FlushInfo{Tables: len(info.Output), Duration: l.end(info.JobID), Err: info.Err}
+		for _, table := range info.Output {
+			ev.Bytes += int64(table.Size)
+		}
+		for _, listener := range l.listeners() {
+			if listener.OnFlushEnd != nil {
+				listener.OnFlushEnd(ev)
+			}
+		}
+	}
+	el.CompactionBegin = func(info pebble.CompactionInfo) {
+		if prevCompactionBegin != nil {
+			prevCompactionBegin(info)
+		}
+		l.begin(info.JobID)
+	}
+	el.CompactionEnd = func(info pebble.CompactionInfo) {
+		if prevCompactionEnd != nil {
+			prevCompactionEnd(info)
+		}
+		ev := CompactionInfo{
+			InputLevel:  info.Input.Level,
+			OutputLevel: info.Output.Level,
+			Duration:    l.end(info.JobID),
+			Err:         info.Err,
+		}
+		for _, tables := range info.Input.Tables {
+			for _, table := range tables {
+				ev.InputBytes += int64(table.Size)
+			}
+		}
+		for _, table := range info.Output.Tables {
+			ev.OutputBytes += int64(table.Size)
+		}
+		for _, listener := range l.listeners() {
+			if listener.OnCompactionEnd != nil {
+				listener.OnCompactionEnd(ev)
+			}
+		}
+	}
+}
+
+// listeners returns the registered listeners. They are invoked without
+// holding the lock, so that they may register other listeners.
+func (l *pebbleEventListeners) listeners() []EngineEventListener {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.mu.listeners
+}
+
+func (l *pebbleEventListeners) begin(jobID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mu.starts[jobID] = timeutil.Now()
+}
+
+// end returns the duration of the job, or zero if its start wasn't seen.
+func (l *pebbleEventListeners) end(jobID int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	start, ok := l.mu.starts[jobID]
+	if !ok {
+		return 0
+	}
+	delete(l.mu.starts, jobID)
+	return timeutil.Since(start)
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/bloom"
+)
+
+// PebbleKeyspaceFilters configures the bloom filters of Pebble sstables by
+// keyspace, so that point lookups into, say, the system ranges can use more
+// aggressive filters than scan-heavy user data.
+type PebbleKeyspaceFilters struct {
+	// Name identifies the configuration. It is persisted in every sstable
+	// along with the filter, and sstables whose filter names don't match are
+	// read without their filters. It must be changed whenever Bucket changes,
+	// since filters built with one bucketing can't be queried with another.
+	Name string
+	// Bucket maps the key part of an MVCC key to an index into BitsPerKey.
+	// Keys mapped outside of BitsPerKey are not filtered.
+	Bucket func(key roachpb.Key) int
+	// BitsPerKey holds the bloom filter bits per key of each bucket. A value of
+	// zero disables filtering of the bucket's keys.
+	BitsPerKey []int
+}
+
+// DefaultPebbleOptionsWithFilters is like DefaultPebbleOptions, but it adds
+// bloom filters configured by keyspace to all levels.
+func DefaultPebbleOptionsWithFilters(filters PebbleKeyspaceFilters) *pebble.Options {
+	opts := DefaultPebbleOptions()
+	policy := newKeyspaceFilterPolicy(filters)
+	for i := range opts.Levels {
+		opts.Levels[i].FilterPolicy = policy
+		opts.Levels[i].FilterType = pebble.TableFilter
+	}
+	opts.Filters = map[string]pebble.FilterPolicy{policy.Name(): policy}
+	return opts
+}
+
+// keyspaceFilterPolicy is a pebble.FilterPolicy whose filters consist of one
+// bloom filter per bucket, each over the keys of its bucket. Pebble passes
+// the key part of MVCC keys to the policy, as determined by
+// MVCCComparer.Split.
+//
+// The filter is encoded as the concatenation, in bucket order, of the
+// uvarint-prefixed bloom filters of the buckets. Buckets without keys have
+// empty filters, which don't contain any key.
+type keyspaceFilterPolicy struct {
+	filters  PebbleKeyspaceFilters
+	policies []pebble.FilterPolicy
+}
+
+var _ pebble.FilterPolicy = &keyspaceFilterPolicy{}
+
+func newKeyspaceFilterPolicy(filters PebbleKeyspaceFilters) *keyspaceFilterPolicy {
+	p := &keyspaceFilterPolicy{
+		filters:  filters,
+		policies: make([]pebble.FilterPolicy, len(filters.BitsPerKey)),
+	}
+	for i, bits := range filters.BitsPerKey {
+		if bits > 0 {
+			p.policies[i] = bloom.FilterPolicy(bits)
+		}
+	}
+	return p
+}
+
+// bucket returns the policy of the key's bucket, or nil if the key isn't
+// filtered.
+func (p *keyspaceFilterPolicy) bucket(key []byte) (int, pebble.FilterPolicy) {
+	i := p.filters.Bucket(key)
+	if i < 0 || i >= len(p.policies) {
+		return -1, nil
+	}
+	return i, p.policies[i]
+}
+
+// Name implements the pebble.FilterPolicy interface.
+func (p *keyspaceFilterPolicy) Name() string {
+	return fmt.Sprintf("cockroach.KeyspaceBloomFilter(%s,%v)", p.filters.Name, p.filters.BitsPerKey)
+}
+
+// MayContain implements the pebble.FilterPolicy interface.
+func (p *keyspaceFilterPolicy) MayContain(ftype pebble.FilterType, filter, key []byte) bool {
+	i, policy := p.bucket(key)
+	if policy == nil {
+		return true
+	}
+	for j := 0; j <= i; j++ {
+		n, w := binary.Uvarint(filter)
+		if w <= 0 || uint64(len(filter)-w) < n {
+			// The filter is corrupt.
+			return true
+		}
+		if j == i {
+			sub := filter[w : w+int(n)]
+			return len(sub) > 0 && policy.MayContain(ftype, sub, key)
+		}
+		filter = filter[w+int(n):]
+	}
+	return true
+}
+
+// NewWriter implements the pebble.FilterPolicy interface.
+func (p *keyspaceFilterPolicy) NewWriter(ftype pebble.FilterType) pebble.FilterWriter {
+	return &keyspaceFilterWriter{
+		policy:  p,
+		ftype:   ftype,
+		writers: make([]pebble.FilterWriter, len(p.policies)),
+	}
+}
+
+// keyspaceFilterWriter builds the filters of a keyspaceFilterPolicy.
+type keyspaceFilterWriter struct {
+	policy  *keyspaceFilterPolicy
+	ftype   pebble.FilterType
+	writers []pebble.FilterWriter
+	tmp     []byte
+}
+
+// AddKey implements the pebble.FilterWriter interface.
+func (w *keyspaceFilterWriter) AddKey(key []byte) {
+	i, policy := w.policy.bucket(key)
+	if policy == nil {
+		return
+	}
+	if w.writers[i] == nil {
+		w.writers[i] = policy.NewWriter(w.ftype)
+	}
+	w.writers[i].AddKey(key)
+}
+
+// Finish implements the pebble.FilterWriter interface.
+func (w *keyspaceFilterWriter) Finish(buf []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	for i, writer := range w.writers {
+		w.tmp = w.tmp[:0]
+		if writer != nil {
+			w.tmp = writer.Finish(w.tmp)
+			w.writers[i] = nil
+		}
+		buf = append(buf, lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(w.tmp)))]...)
+		buf = append(buf, w.tmp...)
+	}
+	return buf
+}
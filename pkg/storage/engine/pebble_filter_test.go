@@ -0,0 +1,123 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// testKeyspaceFilters filters keys prefixed with "sys" with 10 bits per key,
+// keys prefixed with "tmp" with 10 bits per key as well, and doesn't filter
+// other keys.
+var testKeyspaceFilters = PebbleKeyspaceFilters{
+	Name: "test",
+	Bucket: func(key roachpb.Key) int {
+		switch {
+		case bytes.HasPrefix(key, []byte("sys")):
+			return 0
+		case bytes.HasPrefix(key, []byte("tmp")):
+			return 1
+		default:
+			return 2
+		}
+	},
+	BitsPerKey: []int{10, 10, 0},
+}
+
+func TestKeyspaceFilterPolicy(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	policy := newKeyspaceFilterPolicy(testKeyspaceFilters)
+	w := policy.NewWriter(pebble.TableFilter)
+	const numKeys = 1000
+	for i := 0; i < numKeys; i++ {
+		w.AddKey([]byte(fmt.Sprintf("sys-%d", i)))
+		w.AddKey([]byte(fmt.Sprintf("user-%d", i)))
+	}
+	filter := w.Finish(nil)
+
+	var falsePositives int
+	for i := 0; i < numKeys; i++ {
+		if !policy.MayContain(pebble.TableFilter, filter, []byte(fmt.Sprintf("sys-%d", i))) {
+			t.Fatalf("filter doesn't contain sys-%d", i)
+		}
+		if policy.MayContain(pebble.TableFilter, filter, []byte(fmt.Sprintf("sys-%d", i+numKeys))) {
+			falsePositives++
+		}
+		// Unfiltered keys may always be contained.
+		if !policy.MayContain(pebble.TableFilter, filter, []byte(fmt.Sprintf("user-%d", i+numKeys))) {
+			t.Fatalf("filter excludes unfiltered key user-%d", i+numKeys)
+		}
+		// The tmp bucket has no keys.
+		if policy.MayContain(pebble.TableFilter, filter, []byte(fmt.Sprintf("tmp-%d", i))) {
+			t.Fatalf("empty bucket contains tmp-%d", i)
+		}
+	}
+	if falsePositives > numKeys/20 {
+		t.Fatalf("%d false positives out of %d", falsePositives, numKeys)
+	}
+
+	// Corrupt filters don't exclude any keys.
+	if !policy.MayContain(pebble.TableFilter, filter[:3], []byte("tmp-0")) {
+		t.Fatal("corrupt filter excludes key")
+	}
+}
+
+func TestPebbleKeyspaceFilters(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	opts := DefaultPebbleOptionsWithFilters(testKeyspaceFilters)
+	opts.Cache = pebble.NewCache(testCacheSize)
+	opts.FS = vfs.NewMem()
+	p, err := NewPebble(PebbleConfig{Opts: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	var keys []roachpb.Key
+	for i := 0; i < 100; i++ {
+		for _, prefix := range []string{"sys", "user"} {
+			key := roachpb.Key(fmt.Sprintf("%s-%03d", prefix, i))
+			keys = append(keys, key)
+			if err := MVCCPut(ctx, p, nil, key, ts, roachpb.MakeValueFromString(key.String()), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := p.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range keys {
+		if v, _, err := MVCCGet(ctx, p, key, ts, MVCCGetOptions{}); err != nil {
+			t.Fatal(err)
+		} else if v == nil {
+			t.Fatalf("key %s not found", key)
+		}
+		if v, _, err := MVCCGet(ctx, p, key.Next(), ts, MVCCGetOptions{}); err != nil {
+			t.Fatal(err)
+		} else if v != nil {
+			t.Fatalf("unexpected value at %s", key.Next())
+		}
+	}
+}
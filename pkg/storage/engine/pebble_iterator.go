@@ -46,6 +46,16 @@ type pebbleIterator struct {
 	// Stat tracking the number of sstables encountered during time-bound
 	// iteration.
 	timeBoundNumSSTables int
+	// Stats tracking seeks and steps, including those performed by the MVCC
+	// scanner, and versions the scanner skipped due to timestamp filtering.
+	seekCount, stepCount, versionsSkipped int
+	// corruption, if set, is notified of the corruption errors encountered by
+	// the iterator. Errors are only reported once per iterator.
+	corruption         *pebbleCorruptionReporter
+	reportedCorruption bool
+	// prefetch, if set, reads ahead of forward iteration. See
+	// IterOptions.AsyncPrefetchDepth.
+	prefetch *pebblePrefetcher
 }
 
 var _ Iterator = &pebbleIterator{}
@@ -57,21 +67,26 @@ var pebbleIterPool = sync.Pool{
 }
 
 // Instantiates a new Pebble iterator, or gets one from the pool.
-func newPebbleIterator(handle pebble.Reader, opts IterOptions) Iterator {
+func newPebbleIterator(
+	handle pebble.Reader, opts IterOptions, corruption *pebbleCorruptionReporter,
+) Iterator {
 	iter := pebbleIterPool.Get().(*pebbleIterator)
-	iter.init(handle, opts)
+	iter.init(handle, opts, corruption)
 	return iter
 }
 
 // init resets this pebbleIterator for use with the specified arguments. The
 // current instance could either be a cached iterator (eg. in pebbleBatch), or
 // a newly-instantiated one through newPebbleIterator.
-func (p *pebbleIterator) init(handle pebble.Reader, opts IterOptions) {
+func (p *pebbleIterator) init(
+	handle pebble.Reader, opts IterOptions, corruption *pebbleCorruptionReporter,
+) {
 	*p = pebbleIterator{
 		lowerBoundBuf: p.lowerBoundBuf,
 		upperBoundBuf: p.upperBoundBuf,
 		prefix:        opts.Prefix,
 		reusable:      p.reusable,
+		corruption:    corruption,
 	}
 
 	if !opts.Prefix && len(opts.UpperBound) == 0 && len(opts.LowerBound) == 0 {
@@ -126,6 +141,15 @@ func (p *pebbleIterator) init(handle pebble.Reader, opts IterOptions) {
 	if p.iter == nil {
 		panic("unable to create iterator")
 	}
+	if opts.AsyncPrefetchDepth > 0 && !opts.Prefix {
+		// The prefetcher reads from its own goroutine, which isn't safe for
+		// batches that are concurrently written to.
+		switch handle.(type) {
+		case *pebble.DB, *pebble.Snapshot:
+			p.prefetch = newPebblePrefetcher(
+				handle, p.options.LowerBound, p.options.UpperBound, opts.AsyncPrefetchDepth)
+		}
+	}
 
 	p.inuse = true
 }
@@ -139,6 +163,7 @@ func (p *pebbleIterator) setOptions(opts IterOptions) {
 	}
 
 	p.prefix = opts.Prefix
+	p.reportedCorruption = false
 	if opts.LowerBound != nil {
 		// This is the same as
 		// p.options.LowerBound = EncodeKeyToBuf(p.lowerBoundBuf[:0], MVCCKey{Key: opts.LowerBound}) .
@@ -163,6 +188,10 @@ func (p *pebbleIterator) Close() {
 		panic("closing idle iterator")
 	}
 	p.inuse = false
+	if p.prefetch != nil {
+		p.prefetch.close()
+		p.prefetch = nil
+	}
 
 	if p.reusable {
 		return
@@ -175,21 +204,63 @@ func (p *pebbleIterator) Close() {
 
 // Seek implements the Iterator interface.
 func (p *pebbleIterator) Seek(key MVCCKey) {
+	p.seekCount++
 	p.keyBuf = EncodeKeyToBuf(p.keyBuf[:0], key)
 	if p.prefix {
 		p.iter.SeekPrefixGE(p.keyBuf)
 	} else {
 		p.iter.SeekGE(p.keyBuf)
+		if p.prefetch != nil {
+			p.prefetch.seek(p.keyBuf)
+		}
+	}
+}
+
+// seekRawGE seeks to the first key greater than or equal to the encoded key,
+// which needn't be a valid MVCC key.
+func (p *pebbleIterator) seekRawGE(key []byte) {
+	p.seekCount++
+	if p.prefix {
+		p.iter.SeekPrefixGE(key)
+	} else {
+		p.iter.SeekGE(key)
 	}
 }
 
 // Valid implements the Iterator interface.
 func (p *pebbleIterator) Valid() (bool, error) {
-	return p.iter.Valid(), p.iter.Error()
+	err := p.iter.Error()
+	if err != nil {
+		p.maybeReportCorruption(err, roachpb.Span{})
+	}
+	return p.iter.Valid(), err
+}
+
+// maybeReportCorruption reports err to the iterator's corruption reporter,
+// unless an error was already reported. span is the span being read, if
+// known; it defaults to the iterator's bounds.
+func (p *pebbleIterator) maybeReportCorruption(err error, span roachpb.Span) {
+	if p.reportedCorruption || p.corruption == nil || !isPebbleCorruption(err) {
+		return
+	}
+	p.reportedCorruption = true
+	if len(span.Key) == 0 && len(span.EndKey) == 0 {
+		if len(p.options.LowerBound) > 0 {
+			span.Key = append(roachpb.Key(nil), p.options.LowerBound[:len(p.options.LowerBound)-1]...)
+		}
+		if len(p.options.UpperBound) > 0 {
+			span.EndKey = append(roachpb.Key(nil), p.options.UpperBound[:len(p.options.UpperBound)-1]...)
+		}
+	}
+	p.corruption.maybeReport(err, span)
 }
 
 // Next implements the Iterator interface.
 func (p *pebbleIterator) Next() {
+	p.stepCount++
+	if p.prefetch != nil && p.iter.Valid() {
+		p.prefetch.advance(len(p.iter.Key()) + len(p.iter.Value()))
+	}
 	p.iter.Next()
 }
 
@@ -200,7 +271,14 @@ func (p *pebbleIterator) NextKey() {
 	}
 	p.keyBuf = append(p.keyBuf[:0], p.UnsafeKey().Key...)
 
-	for p.iter.Next() {
+	p.stepCount++
+	for {
+		if p.prefetch != nil {
+			p.prefetch.advance(len(p.iter.Key()) + len(p.iter.Value()))
+		}
+		if !p.iter.Next() {
+			break
+		}
 		if !bytes.Equal(p.keyBuf, p.UnsafeKey().Key) {
 			break
 		}
@@ -249,8 +327,22 @@ func (p *pebbleIterator) SeekReverse(key MVCCKey) {
 	}
 }
 
+// SeekLT implements the Iterator interface.
+func (p *pebbleIterator) SeekLT(key MVCCKey) {
+	p.seekCount++
+	p.keyBuf = EncodeKeyToBuf(p.keyBuf[:0], MakeMVCCMetadataKey(key.Key))
+	if !p.iter.SeekLT(p.keyBuf) {
+		return
+	}
+	// The iterator is positioned at the oldest version of the preceding key,
+	// since versions sort by descending timestamp. Seek to its newest one.
+	p.keyBuf = EncodeKeyToBuf(p.keyBuf[:0], MakeMVCCMetadataKey(p.UnsafeKey().Key))
+	p.iter.SeekGE(p.keyBuf)
+}
+
 // Prev implements the Iterator interface.
 func (p *pebbleIterator) Prev() {
+	p.stepCount++
 	p.iter.Prev()
 }
 
@@ -403,8 +495,10 @@ func (p *pebbleIterator) MVCCGet(
 
 	mvccScanner.init(opts.Txn)
 	mvccScanner.get()
+	p.addScannerStats(mvccScanner)
 
 	if mvccScanner.err != nil {
+		p.maybeReportCorruption(mvccScanner.err, roachpb.Span{Key: key})
 		return nil, nil, mvccScanner.err
 	}
 	intents, err := buildScanIntents(mvccScanner.intents.Repr())
@@ -451,6 +545,10 @@ func (p *pebbleIterator) MVCCScan(
 		resumeSpan = &roachpb.Span{Key: start, EndKey: end}
 		return nil, 0, resumeSpan, nil, nil
 	}
+	if opts.IntentsOnly {
+		resumeSpan, intents, err = mvccScanIntents(p, start, end, max, opts)
+		return nil, 0, resumeSpan, intents, err
+	}
 	if p.iter == nil {
 		panic("uninitialized iterator")
 	}
@@ -461,19 +559,31 @@ func (p *pebbleIterator) MVCCScan(
 	*mvccScanner = pebbleMVCCScanner{
 		parent:       p.iter,
 		reverse:      opts.Reverse,
+		prefix:       p.prefix && !opts.Reverse,
 		start:        start,
 		end:          end,
 		ts:           timestamp,
+		minTS:        opts.MinTimestamp,
 		maxKeys:      max,
+		targetBytes:  opts.TargetBytes,
 		inconsistent: opts.Inconsistent,
 		tombstones:   opts.Tombstones,
 		ignoreSeq:    opts.IgnoreSequence,
 	}
+	mvccScanner.familySuffixes = columnFamilySuffixes(opts.ColumnFamilyIDs)
+	mvccScanner.keysOnly = opts.KeysOnly
+	mvccScanner.trace = opts.trace
+	mvccScanner.maxVersionsPerKey = opts.MaxVersionsPerKey
+	if !opts.Reverse && !mvccScanner.prefix {
+		mvccScanner.prefetch = p.prefetch
+	}
 
 	mvccScanner.init(opts.Txn)
 	resumeSpan, err = mvccScanner.scan()
+	p.addScannerStats(mvccScanner)
 
 	if err != nil {
+		p.maybeReportCorruption(err, roachpb.Span{Key: start, EndKey: end})
 		return nil, 0, nil, nil, err
 	}
 
@@ -503,9 +613,20 @@ func (p *pebbleIterator) SetUpperBound(upperBound roachpb.Key) {
 func (p *pebbleIterator) Stats() IteratorStats {
 	return IteratorStats{
 		TimeBoundNumSSTs: p.timeBoundNumSSTables,
+		SeekCount:        p.seekCount,
+		StepCount:        p.stepCount,
+		VersionsSkipped:  p.versionsSkipped,
 	}
 }
 
+// addScannerStats accumulates the counters collected by an MVCC scanner that
+// operated on this iterator.
+func (p *pebbleIterator) addScannerStats(s *pebbleMVCCScanner) {
+	p.seekCount += s.seekCount
+	p.stepCount += s.stepCount
+	p.versionsSkipped += s.versionsSkipped
+}
+
 // CheckForKeyCollisions indicates if the provided SST data collides with this
 // iterator in the specified range.
 func (p *pebbleIterator) CheckForKeyCollisions(
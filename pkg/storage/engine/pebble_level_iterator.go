@@ -0,0 +1,176 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/pkg/errors"
+)
+
+// NewLevelIterator returns an iterator over the keys physically present in
+// the sstables of the given level of the LSM, bypassing the merged view of
+// the engine. It is a diagnostic tool, e.g. to confirm whether a key was moved
+// to another level by a compaction, and must not be used to serve reads.
+//
+// The sstables are those of the level at the time of the call: they are opened
+// right away, and later compactions aren't reflected in the iteration. The
+// keys of all of them are merged, which matters for L0, whose sstables may
+// overlap; a key present in several sstables is returned once for each of
+// them. Point deletions are returned as keys with empty values, and range
+// deletions aren't returned at all. Only the bounds of opts are used.
+func (p *Pebble) NewLevelIterator(level int, opts IterOptions) (SimpleIterator, error) {
+	ssts, err := p.openLevelSSTables(level)
+	if err != nil {
+		return nil, err
+	}
+	iter := &pebbleLevelIterator{
+		lowerBound: opts.LowerBound,
+		upperBound: opts.UpperBound,
+		cur:        -1,
+	}
+	for _, sst := range ssts {
+		iter.ssts = append(iter.ssts, &sstIterator{sst: sst})
+	}
+	return iter, nil
+}
+
+// openLevelSSTables opens the sstables currently in the given level of the
+// LSM. The caller must close the returned readers.
+func (p *Pebble) openLevelSSTables(level int) ([]*sstable.Reader, error) {
+	levels := p.db.SSTables()
+	if level < 0 || level >= len(levels) {
+		return nil, errors.Errorf("level %d out of range [0, %d)", level, len(levels))
+	}
+	var ssts []*sstable.Reader
+	closeAll := func() {
+		for _, sst := range ssts {
+			_ = sst.Close()
+		}
+	}
+	for _, table := range levels[level] {
+		path := p.fs.PathJoin(p.path, fmt.Sprintf("%06d.sst", table.FileNum))
+		file, err := p.fs.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, errors.Wrapf(err, "opening sstable %d of L%d", table.FileNum, level)
+		}
+		sst, err := sstable.NewReader(file, sstable.ReaderOptions{
+			Comparer: MVCCComparer,
+		})
+		if err != nil {
+			_ = file.Close()
+			closeAll()
+			return nil, errors.Wrapf(err, "reading sstable %d of L%d", table.FileNum, level)
+		}
+		ssts = append(ssts, sst)
+	}
+	return ssts, nil
+}
+
+// pebbleLevelIterator merges the keys of the sstables of an LSM level. See
+// Pebble.NewLevelIterator.
+type pebbleLevelIterator struct {
+	ssts                   []*sstIterator
+	lowerBound, upperBound roachpb.Key
+	// cur is the index of the sstable positioned at the current key, or -1 if
+	// the iterator is exhausted.
+	cur int
+	err error
+	// For allocation avoidance in NextKey.
+	nextKeyStart []byte
+}
+
+var _ SimpleIterator = &pebbleLevelIterator{}
+
+// Close implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) Close() {
+	for _, sst := range l.ssts {
+		sst.Close()
+	}
+	l.ssts = nil
+}
+
+// Seek implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) Seek(key MVCCKey) {
+	if len(l.lowerBound) > 0 && key.Key.Compare(l.lowerBound) < 0 {
+		key = MakeMVCCMetadataKey(l.lowerBound)
+	}
+	for _, sst := range l.ssts {
+		sst.Seek(key)
+	}
+	l.findCur()
+}
+
+// findCur positions the iterator at the smallest key of the sstables.
+func (l *pebbleLevelIterator) findCur() {
+	l.cur = -1
+	for i, sst := range l.ssts {
+		ok, err := sst.Valid()
+		if err != nil {
+			l.err = err
+			return
+		}
+		if ok && (l.cur == -1 || sst.UnsafeKey().Less(l.ssts[l.cur].UnsafeKey())) {
+			l.cur = i
+		}
+	}
+	if l.cur != -1 && len(l.upperBound) > 0 &&
+		l.ssts[l.cur].UnsafeKey().Key.Compare(l.upperBound) >= 0 {
+		l.cur = -1
+	}
+}
+
+// Valid implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) Valid() (bool, error) {
+	if l.err != nil {
+		return false, l.err
+	}
+	return l.cur != -1, nil
+}
+
+// Next implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) Next() {
+	if ok, _ := l.Valid(); !ok {
+		return
+	}
+	l.ssts[l.cur].Next()
+	l.findCur()
+}
+
+// NextKey implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) NextKey() {
+	if ok, _ := l.Valid(); !ok {
+		return
+	}
+	l.nextKeyStart = append(l.nextKeyStart[:0], l.UnsafeKey().Key...)
+	for l.Next(); l.cur != -1 && l.err == nil && bytes.Equal(l.nextKeyStart, l.UnsafeKey().Key); l.Next() {
+	}
+}
+
+// UnsafeKey implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) UnsafeKey() MVCCKey {
+	if l.cur == -1 {
+		return MVCCKey{}
+	}
+	return l.ssts[l.cur].UnsafeKey()
+}
+
+// UnsafeValue implements the SimpleIterator interface.
+func (l *pebbleLevelIterator) UnsafeValue() []byte {
+	if l.cur == -1 {
+		return nil
+	}
+	return l.ssts[l.cur].UnsafeValue()
+}
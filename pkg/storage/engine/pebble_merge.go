@@ -317,3 +317,31 @@ func (t *MVCCValueMerger) Finish() ([]byte, error) {
 	}
 	return res, nil
 }
+
+// MergeTimeSeries merges update into existing and returns the result. It runs
+// exactly the merge operator invoked by Pebble during reads and compactions
+// (MVCCMerger), so that the merge logic can be tested and reused outside of
+// the engine. Both operands, as well as the result, are encoded the way the
+// engine stores merge operands: an MVCCMetadata wrapping an inline
+// roachpb.Value. A nil existing value merges update into nothing, which still
+// sorts and deduplicates its samples.
+//
+// While it is intended for time series values, MergeTimeSeries also merges
+// two non-timeseries values by concatenation, like the engine does.
+func MergeTimeSeries(existing, update []byte) ([]byte, error) {
+	if existing == nil {
+		valueMerger, err := MVCCMerger.Merge(nil /* key */, update)
+		if err != nil {
+			return nil, err
+		}
+		return valueMerger.Finish()
+	}
+	valueMerger, err := MVCCMerger.Merge(nil /* key */, existing)
+	if err != nil {
+		return nil, err
+	}
+	if err := valueMerger.MergeNewer(update); err != nil {
+		return nil, err
+	}
+	return valueMerger.Finish()
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/pkg/errors"
+)
+
+// MVCCScanMergeOperands returns the merge operands stored in the sstables of
+// reader for the inline value of key, from oldest to newest, without merging
+// them. It is a debugging tool: feeding the operands to the merge operator one
+// at a time (see MergeInternalTimeSeriesData) allows finding the operand that
+// corrupted a merged value. Only Pebble engines are supported.
+//
+// The operands are the ones visible in storage, which depends on when the
+// last flushes and compactions ran: compactions merge the operands of the
+// sstables they combine into one, and the operands still in the memtables
+// aren't visible at all, so callers typically flush the engine first, which
+// merges the operands of each memtable into one. If the key was last Put
+// rather than merged, its value is returned first, as the base the operands
+// apply to, and records older than the last deletion of the key aren't
+// returned. Range deletions are ignored.
+func MVCCScanMergeOperands(reader Reader, key roachpb.Key) ([][]byte, error) {
+	p, ok := reader.(*Pebble)
+	if !ok {
+		return nil, errors.Errorf("cannot read merge operands from %T", reader)
+	}
+	if len(key) == 0 {
+		return nil, emptyKeyError()
+	}
+
+	type record struct {
+		seqNum uint64
+		kind   sstable.InternalKeyKind
+		value  []byte
+	}
+	var records []record
+	encKey := EncodeKey(MakeMVCCMetadataKey(key))
+	for level, n := 0, len(p.db.SSTables()); level < n; level++ {
+		ssts, err := p.openLevelSSTables(level)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		for _, sst := range ssts {
+			if firstErr != nil {
+				_ = sst.Close()
+				continue
+			}
+			iter := sst.NewIter(nil /* lower */, nil /* upper */)
+			for k, v := iter.SeekGE(encKey); k != nil && bytes.Equal(k.UserKey, encKey); k, v = iter.Next() {
+				records = append(records, record{
+					seqNum: k.SeqNum(),
+					kind:   k.Kind(),
+					value:  append([]byte(nil), v...),
+				})
+			}
+			err = iter.Error()
+			if closeErr := iter.Close(); err == nil {
+				err = closeErr
+			}
+			if closeErr := sst.Close(); err == nil {
+				err = closeErr
+			}
+			firstErr = err
+		}
+		if firstErr != nil {
+			return nil, errors.Wrapf(firstErr, "reading L%d", level)
+		}
+	}
+
+	// Sequence numbers order the records across sstables and levels.
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].seqNum < records[j].seqNum
+	})
+	var operands [][]byte
+	for _, r := range records {
+		switch r.kind {
+		case sstable.InternalKeyKindMerge:
+			operands = append(operands, r.value)
+		case sstable.InternalKeyKindSet:
+			operands = append(operands[:0], r.value)
+		default:
+			// A deletion clears the operands preceding it.
+			operands = operands[:0]
+		}
+	}
+	return operands, nil
+}
@@ -32,6 +32,7 @@ const (
 // expected by MVCCScanDecodeKeyValue.
 type pebbleResults struct {
 	count int64
+	bytes int64
 	repr  []byte
 	bufs  [][]byte
 }
@@ -74,6 +75,7 @@ func (p *pebbleResults) put(key []byte, value []byte) {
 	copy(p.repr[startIdx+kvLenSize:], key)
 	copy(p.repr[startIdx+kvLenSize+len(key):], value)
 	p.count++
+	p.bytes += int64(len(key) + len(value))
 }
 
 func (p *pebbleResults) finish() [][]byte {
@@ -90,12 +92,30 @@ type pebbleMVCCScanner struct {
 	parent  *pebble.Iterator
 	reverse bool
 	peeked  bool
+	// If set, forward seeks use SeekPrefixGE so that bloom filters are
+	// consulted. Only set when scanning the versions of a single key.
+	prefix bool
 	// Iteration bounds. Does not contain MVCC timestamp.
 	start, end roachpb.Key
 	// Timestamp with which MVCCScan/MVCCGet was called.
 	ts hlc.Timestamp
+	// Keys whose visible version is at or below minTS are skipped. Zero means
+	// no lower bound.
+	minTS hlc.Timestamp
 	// Max number of keys to return.
 	maxKeys int64
+	// If set, the suffixes of the column families to return. See
+	// MVCCScanOptions.ColumnFamilyIDs.
+	familySuffixes [][]byte
+	// If set, keys are returned with empty values.
+	keysOnly bool
+	// If set, reads ahead of forward scans. See IterOptions.AsyncPrefetchDepth.
+	prefetch *pebblePrefetcher
+	// If set, records the keys added to results. See MVCCScanOptions.Trace.
+	trace *mvccScanTrace
+	// Stop adding keys once the key and value bytes in results reach this
+	// limit. Zero means no limit.
+	targetBytes int64
 	// Transaction epoch and sequence number.
 	txn         *roachpb.Transaction
 	txnEpoch    enginepb.TxnEpoch
@@ -118,8 +138,15 @@ type pebbleMVCCScanner struct {
 	// Stores any error returned. If non-nil, iteration short circuits.
 	err error
 	// Number of iterations to try before we do a Seek/SeekReverse. Stays within
-	// [1, maxItersBeforeSeek] and defaults to maxItersBeforeSeek/2 .
+	// [1, itersBeforeSeekLimit] and defaults to itersBeforeSeekLimit/2 .
 	itersBeforeSeek int
+	// The upper bound of itersBeforeSeek: maxItersBeforeSeek, unless
+	// maxVersionsPerKey is lower. See MVCCScanOptions.MaxVersionsPerKey.
+	itersBeforeSeekLimit int
+	maxVersionsPerKey    int
+	// Iterator stats, accumulated into the parent pebbleIterator's stats. See
+	// IteratorStats.
+	seekCount, stepCount, versionsSkipped int
 }
 
 // Pool for allocating pebble MVCC Scanners.
@@ -132,7 +159,14 @@ var pebbleMVCCScannerPool = sync.Pool{
 // init sets bounds on the underlying pebble iterator, and initializes other
 // fields not set by the calling method.
 func (p *pebbleMVCCScanner) init(txn *roachpb.Transaction) {
-	p.itersBeforeSeek = maxItersBeforeSeek / 2
+	p.itersBeforeSeekLimit = maxItersBeforeSeek
+	if p.maxVersionsPerKey > 0 && p.maxVersionsPerKey < p.itersBeforeSeekLimit {
+		p.itersBeforeSeekLimit = p.maxVersionsPerKey
+	}
+	p.itersBeforeSeek = p.itersBeforeSeekLimit / 2
+	if p.itersBeforeSeek < 1 {
+		p.itersBeforeSeek = 1
+	}
 
 	if txn != nil {
 		p.txn = txn
@@ -145,6 +179,7 @@ func (p *pebbleMVCCScanner) init(txn *roachpb.Transaction) {
 // get iterates exactly once and adds one KV to the result set.
 func (p *pebbleMVCCScanner) get() {
 	p.keyBuf = EncodeKeyToBuf(p.keyBuf[:0], MVCCKey{Key: p.start})
+	p.seekCount++
 	valid := p.parent.SeekPrefixGE(p.keyBuf)
 	if !p.updateCurrent(valid) {
 		return
@@ -152,8 +187,9 @@ func (p *pebbleMVCCScanner) get() {
 	p.getAndAdvance()
 }
 
-// scan iterates until maxKeys records are in results, or the underlying
-// iterator is exhausted, or an error is encountered.
+// scan iterates until maxKeys records are in results, or targetBytes worth of
+// keys and values are in results, or the underlying iterator is exhausted, or
+// an error is encountered.
 func (p *pebbleMVCCScanner) scan() (*roachpb.Span, error) {
 	if p.reverse {
 		p.keyBuf = EncodeKeyToBuf(p.keyBuf[:0], MVCCKey{Key: p.end})
@@ -171,7 +207,7 @@ func (p *pebbleMVCCScanner) scan() (*roachpb.Span, error) {
 	}
 
 	var resume *roachpb.Span
-	if p.results.count == p.maxKeys && p.advanceKey() {
+	if p.limitReached() && p.advanceKey() {
 		if p.reverse {
 			// curKey was not added to results, so it needs to be included in the
 			// resume span.
@@ -189,11 +225,11 @@ func (p *pebbleMVCCScanner) scan() (*roachpb.Span, error) {
 	return resume, p.err
 }
 
-// Increments itersBeforeSeek while ensuring it stays <= maxItersBeforeSeek
+// Increments itersBeforeSeek while ensuring it stays <= itersBeforeSeekLimit
 func (p *pebbleMVCCScanner) incrementItersBeforeSeek() {
 	p.itersBeforeSeek++
-	if p.itersBeforeSeek > maxItersBeforeSeek {
-		p.itersBeforeSeek = maxItersBeforeSeek
+	if p.itersBeforeSeek > p.itersBeforeSeekLimit {
+		p.itersBeforeSeek = p.itersBeforeSeekLimit
 	}
 }
 
@@ -224,8 +260,8 @@ func (p *pebbleMVCCScanner) getFromIntentHistory() bool {
 		return false
 	}
 	intent := p.meta.IntentHistory[upIdx-1]
-	if len(intent.Value) > 0 || p.tombstones {
-		p.results.put(p.curRawKey, intent.Value)
+	if (len(intent.Value) > 0 || p.tombstones) && p.aboveMinTS(hlc.Timestamp(p.meta.Timestamp)) {
+		p.putResult(intent.Value)
 	}
 	return true
 }
@@ -241,6 +277,10 @@ func (p *pebbleMVCCScanner) uncertaintyError(ts hlc.Timestamp) bool {
 // Emit a tuple and return true if we have reason to believe iteration can
 // continue.
 func (p *pebbleMVCCScanner) getAndAdvance() bool {
+	if p.familySuffixes != nil && !wantColumnFamily(p.curKey, p.familySuffixes) {
+		return p.advanceKey()
+	}
+
 	mvccKey := MVCCKey{p.curKey, p.curTS}
 	if mvccKey.IsValue() {
 		if !p.ts.Less(p.curTS) {
@@ -321,7 +361,7 @@ func (p *pebbleMVCCScanner) getAndAdvance() bool {
 		// historical timestamp < the intent timestamp. However, we
 		// return the intent separately; the caller may want to resolve
 		// it.
-		if p.results.count == p.maxKeys {
+		if p.limitReached() {
 			// We've already retrieved the desired number of keys and now
 			// we're adding the resume key. We don't want to add the
 			// intent here as the intents should only correspond to KVs
@@ -366,7 +406,7 @@ func (p *pebbleMVCCScanner) getAndAdvance() bool {
 		// history that has a sequence number equal to or less than the read
 		// sequence, read that value.
 		if p.getFromIntentHistory() {
-			if p.results.count == p.maxKeys {
+			if p.limitReached() {
 				return false
 			}
 			return p.advanceKey()
@@ -486,6 +526,7 @@ func (p *pebbleMVCCScanner) advanceKeyAtEnd() bool {
 		// Iterating to the next key might have caused the iterator to reach the
 		// end of the key space. If that happens, back up to the very last key.
 		p.peeked = false
+		p.seekCount++
 		valid := p.parent.Last()
 		if !p.updateCurrent(valid) {
 			return false
@@ -513,16 +554,42 @@ func (p *pebbleMVCCScanner) advanceKeyAtNewKey(key []byte) bool {
 // results limit.
 func (p *pebbleMVCCScanner) addAndAdvance(val []byte) bool {
 	// Don't include deleted versions len(val) == 0, unless we've been instructed
-	// to include tombstones in the results.
-	if len(val) > 0 || p.tombstones {
-		p.results.put(p.curRawKey, val)
-		if p.results.count == p.maxKeys {
+	// to include tombstones in the results, nor versions at or below minTS.
+	if (len(val) > 0 || p.tombstones) && p.aboveMinTS(p.curTS) {
+		p.putResult(val)
+		if p.limitReached() {
 			return false
 		}
 	}
 	return p.advanceKey()
 }
 
+// Adds the current key and the given value to the result set. The value is
+// dropped if keysOnly is set.
+func (p *pebbleMVCCScanner) putResult(val []byte) {
+	if p.keysOnly {
+		val = nil
+	}
+	p.results.put(p.curRawKey, val)
+	if p.trace != nil {
+		p.trace.added(p.results.count, p.results.bytes)
+	}
+}
+
+// Returns true if a value at the specified timestamp is above minTS, or if
+// minTS is not set.
+func (p *pebbleMVCCScanner) aboveMinTS(ts hlc.Timestamp) bool {
+	return p.minTS == (hlc.Timestamp{}) || p.minTS.Less(ts)
+}
+
+// Returns true if the result set holds maxKeys records, or if targetBytes is
+// set and the key and value bytes in the result set have reached it. The
+// record that crosses targetBytes is always returned in full.
+func (p *pebbleMVCCScanner) limitReached() bool {
+	return p.results.count == p.maxKeys ||
+		(p.targetBytes > 0 && p.results.bytes >= p.targetBytes)
+}
+
 // Seeks to the latest revision of the current key that's still less than or
 // equal to the specified timestamp, adds it to the result set, then moves onto
 // the next user key.
@@ -531,6 +598,7 @@ func (p *pebbleMVCCScanner) seekVersion(ts hlc.Timestamp, uncertaintyCheck bool)
 	origKey := p.keyBuf[:len(p.curKey)]
 
 	for i := 0; i < p.itersBeforeSeek; i++ {
+		p.countVersionSkipped()
 		if !p.iterNext() {
 			return p.advanceKeyAtEnd()
 		}
@@ -548,6 +616,7 @@ func (p *pebbleMVCCScanner) seekVersion(ts hlc.Timestamp, uncertaintyCheck bool)
 	}
 
 	p.decrementItersBeforeSeek()
+	p.countVersionSkipped()
 	if !p.iterSeek(p.keyBuf) {
 		return p.advanceKeyAtEnd()
 	}
@@ -563,6 +632,14 @@ func (p *pebbleMVCCScanner) seekVersion(ts hlc.Timestamp, uncertaintyCheck bool)
 	return p.advanceKey()
 }
 
+// countVersionSkipped records that the scanner is about to move past the
+// current version because it is newer than the read timestamp.
+func (p *pebbleMVCCScanner) countVersionSkipped() {
+	if p.ts.Less(p.curTS) {
+		p.versionsSkipped++
+	}
+}
+
 // Updates cur{RawKey, Key, TS} to match record the iterator is pointing to.
 func (p *pebbleMVCCScanner) updateCurrent(valid bool) bool {
 	if !valid {
@@ -577,13 +654,23 @@ func (p *pebbleMVCCScanner) updateCurrent(valid bool) bool {
 
 // seek seeks to the latest revision of the specified key (or a greater key).
 func (p *pebbleMVCCScanner) iterSeek(key []byte) bool {
+	p.seekCount++
 	p.clearPeeked()
-	valid := p.parent.SeekGE(key)
+	var valid bool
+	if p.prefix {
+		valid = p.parent.SeekPrefixGE(key)
+	} else {
+		valid = p.parent.SeekGE(key)
+		if p.prefetch != nil {
+			p.prefetch.seek(key)
+		}
+	}
 	return p.updateCurrent(valid)
 }
 
 // seekReverse seeks to the latest revision of the key before the specified key.
 func (p *pebbleMVCCScanner) iterSeekReverse(key []byte) bool {
+	p.seekCount++
 	p.clearPeeked()
 
 	valid := p.parent.SeekLT(key)
@@ -603,6 +690,7 @@ func (p *pebbleMVCCScanner) iterSeekReverse(key []byte) bool {
 
 // Advance to the next MVCC key.
 func (p *pebbleMVCCScanner) iterNext() bool {
+	p.stepCount++
 	if p.reverse && p.peeked {
 		// If we have peeked at the previous entry, we need to advance the iterator
 		// twice.
@@ -619,12 +707,16 @@ func (p *pebbleMVCCScanner) iterNext() bool {
 			return false
 		}
 	}
+	if p.prefetch != nil {
+		p.prefetch.advance(len(p.curRawKey) + len(p.curValue))
+	}
 	valid := p.parent.Next()
 	return p.updateCurrent(valid)
 }
 
 // Advance to the previous MVCC Key.
 func (p *pebbleMVCCScanner) iterPrev() bool {
+	p.stepCount++
 	if p.peeked {
 		p.peeked = false
 		return p.updateCurrent(p.parent.Valid())
@@ -0,0 +1,157 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"sync"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/pebble"
+)
+
+// pebblePrefetchBlockSize is the amount of key and value data which the
+// prefetcher considers to be a block. It matches the block size of
+// DefaultPebbleOptions.
+const pebblePrefetchBlockSize = 32 << 10
+
+// pebblePrefetcher reads ahead of a forward iterator on a goroutine of its
+// own, so that the blocks the iterator is about to step into are already in
+// the block cache when it gets there. This overlaps the latency of fetching
+// blocks from slow storage with the decoding done by the iterator's user.
+//
+// The prefetcher uses an iterator of its own, and only ever affects the
+// cache: the results of the iterator it reads ahead of are unchanged. It
+// stays at most depth blocks ahead of the data the iterator has consumed, and
+// idles once it reaches the end of the iterator's bounds until the iterator is
+// repositioned.
+type pebblePrefetcher struct {
+	iter   *pebble.Iterator
+	window int64
+	// pending is the amount of data consumed by the iterator which hasn't been
+	// reported to the prefetcher yet. It is only accessed by the iterator's
+	// goroutine.
+	pending int64
+	mu      struct {
+		syncutil.Mutex
+		cond sync.Cond
+		// seekKey is the encoded key the iterator was last positioned at. seekGen
+		// is incremented whenever it changes.
+		seekKey []byte
+		seekGen int
+		// consumed and fetched are the amount of data read past seekKey by the
+		// iterator and the prefetcher respectively.
+		consumed, fetched int64
+		closed            bool
+	}
+	done chan struct{}
+}
+
+// newPebblePrefetcher starts a prefetcher reading from handle within the
+// given bounds, which are copied.
+func newPebblePrefetcher(
+	handle pebble.Reader, lowerBound, upperBound []byte, depth int,
+) *pebblePrefetcher {
+	opts := pebble.IterOptions{
+		LowerBound: append([]byte(nil), lowerBound...),
+		UpperBound: append([]byte(nil), upperBound...),
+	}
+	p := &pebblePrefetcher{
+		iter:   handle.NewIter(&opts),
+		window: int64(depth) * pebblePrefetchBlockSize,
+		done:   make(chan struct{}),
+	}
+	p.mu.cond.L = &p.mu
+	go p.run()
+	return p
+}
+
+// seek repositions the prefetcher at the encoded key.
+func (p *pebblePrefetcher) seek(key []byte) {
+	p.pending = 0
+	p.mu.Lock()
+	p.mu.seekKey = append(p.mu.seekKey[:0], key...)
+	p.mu.seekGen++
+	p.mu.consumed, p.mu.fetched = 0, 0
+	p.mu.Unlock()
+	p.mu.cond.Signal()
+}
+
+// advance records that the iterator consumed n bytes of data. It is reported
+// to the prefetcher about once per block.
+func (p *pebblePrefetcher) advance(n int) {
+	p.pending += int64(n)
+	if p.pending < pebblePrefetchBlockSize {
+		return
+	}
+	p.mu.Lock()
+	p.mu.consumed += p.pending
+	p.mu.Unlock()
+	p.mu.cond.Signal()
+	p.pending = 0
+}
+
+// close stops the prefetcher and waits for it to release its iterator.
+func (p *pebblePrefetcher) close() {
+	p.mu.Lock()
+	p.mu.closed = true
+	p.mu.Unlock()
+	p.mu.cond.Signal()
+	<-p.done
+}
+
+func (p *pebblePrefetcher) run() {
+	defer close(p.done)
+	// Errors are ignored: the iterator being read ahead of encounters and
+	// returns them itself.
+	defer func() { _ = p.iter.Close() }()
+
+	var gen int
+	var seekKey []byte
+	valid := false
+	for {
+		p.mu.Lock()
+		for !p.mu.closed && p.mu.seekGen == gen &&
+			(!valid || p.mu.fetched-p.mu.consumed >= p.window) {
+			p.mu.cond.Wait()
+		}
+		if p.mu.closed {
+			p.mu.Unlock()
+			return
+		}
+		seek := p.mu.seekGen != gen
+		if seek {
+			gen = p.mu.seekGen
+			seekKey = append(seekKey[:0], p.mu.seekKey...)
+		}
+		p.mu.Unlock()
+
+		// Read about a block, without holding the lock.
+		var fetched int64
+		if seek {
+			valid = p.iter.SeekGE(seekKey)
+		} else {
+			valid = p.iter.Next()
+		}
+		for valid {
+			fetched += int64(len(p.iter.Key()) + len(p.iter.Value()))
+			if fetched >= pebblePrefetchBlockSize {
+				break
+			}
+			valid = p.iter.Next()
+		}
+
+		p.mu.Lock()
+		if p.mu.seekGen == gen {
+			p.mu.fetched += fetched
+		}
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,521 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/pkg/errors"
+)
+
+// NewSpillablePebble creates a Pebble engine that keeps its files in memory
+// until they exceed memLimit bytes, and then transparently moves them to dir,
+// an existing directory on disk. The engine keeps working across the switch:
+// all files are copied to dir, including those still being written, which are
+// written to dir from then on, and all files created afterwards are written to
+// dir directly. Files already open for reading keep being served from memory
+// until they are closed.
+//
+// memLimit only bounds the size of the files in memory. Pebble's memtables are
+// accounted for separately; their size is capped to a quarter of memLimit.
+func NewSpillablePebble(memLimit int64, dir string) (*Pebble, error) {
+	if memLimit <= 0 {
+		return nil, errors.Errorf("memory limit must be positive, got %d", memLimit)
+	}
+	if stat, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !stat.IsDir() {
+		return nil, errors.Errorf("spill directory %s is not a directory", dir)
+	}
+
+	opts := DefaultPebbleOptions()
+	opts.Cache = pebble.NewCache(0)
+	if memTableSize := memLimit / 4; memTableSize < int64(opts.MemTableSize) {
+		const minMemTableSize = 1 << 20 // 1 MB
+		if memTableSize < minMemTableSize {
+			memTableSize = minMemTableSize
+		}
+		opts.MemTableSize = int(memTableSize)
+	}
+	opts.FS = newSpillFS(memLimit, dir)
+	return NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{
+			Attrs: roachpb.Attributes{},
+			// MaxSize doesn't matter for temp storage - it's not enforced in any
+			// way.
+			MaxSize: 0,
+		},
+		Opts: opts,
+	})
+}
+
+// spillFS implements vfs.FS. It starts out as an in-memory FS and spills to a
+// directory on disk once the files it holds in memory exceed a byte limit.
+//
+// Names are resolved against the in-memory FS for files that live in memory,
+// and against dir for all others. Pebble is opened with an empty directory
+// name on top of spillFS, so all names are relative.
+type spillFS struct {
+	// The in-memory FS. Methods not overridden below, such as Lock and the path
+	// manipulation helpers, are served by it.
+	vfs.FS
+	disk     vfs.FS
+	dir      string
+	memLimit int64
+
+	mu struct {
+		syncutil.Mutex
+		spilled bool
+		// memBytes is the total size of the files in memory. The data of files
+		// linked under several names is counted once.
+		memBytes int64
+		// memFiles maps the names of the files that live in memory to their
+		// data, which is shared by the names linked to the same file.
+		memFiles map[string]*spillMemFile
+	}
+}
+
+var _ vfs.FS = &spillFS{}
+
+// spillMemFile describes the data of a file of a spillFS that lives in memory.
+type spillMemFile struct {
+	size int64
+	// names is the number of names linked to the file. It drops to zero once
+	// the file is removed from memory.
+	names int
+	// writer is the file open for writing the data, if any.
+	writer *spillFile
+}
+
+// spillTmpSuffix is the suffix of the names under which files are copied to
+// disk when the FS spills, until the copy is complete.
+const spillTmpSuffix = ".spilltmp"
+
+func newSpillFS(memLimit int64, dir string) *spillFS {
+	fs := &spillFS{
+		FS:       vfs.NewMem(),
+		disk:     vfs.Default,
+		dir:      dir,
+		memLimit: memLimit,
+	}
+	fs.mu.memFiles = make(map[string]*spillMemFile)
+	return fs
+}
+
+// Spilled returns true once the files have been moved to disk.
+func (fs *spillFS) Spilled() bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.mu.spilled
+}
+
+func (fs *spillFS) diskPath(name string) string {
+	return filepath.Join(fs.dir, name)
+}
+
+// inMemLocked returns true if name should be resolved against the in-memory
+// FS.
+func (fs *spillFS) inMemLocked(name string) bool {
+	if !fs.mu.spilled {
+		return true
+	}
+	_, ok := fs.mu.memFiles[name]
+	return ok
+}
+
+// Create implements vfs.FS.
+func (fs *spillFS) Create(name string) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.mu.spilled {
+		// The new file replaces any in-memory file of the same name.
+		if _, ok := fs.mu.memFiles[name]; ok {
+			if err := fs.FS.Remove(name); err != nil {
+				return nil, err
+			}
+			fs.removeMemFileLocked(name)
+		}
+		return fs.disk.Create(fs.diskPath(name))
+	}
+	f, err := fs.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	fs.removeMemFileLocked(name)
+	mf := &spillMemFile{names: 1}
+	sf := &spillFile{fs: fs}
+	sf.mu.file = f
+	sf.mu.mem = mf
+	mf.writer = sf
+	fs.mu.memFiles[name] = mf
+	return sf, nil
+}
+
+// Link implements vfs.FS.
+func (fs *spillFS) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.inMemLocked(oldname) {
+		return fs.disk.Link(fs.diskPath(oldname), fs.diskPath(newname))
+	}
+	if err := fs.FS.Link(oldname, newname); err != nil {
+		return err
+	}
+	// Links share their data, which is only accounted for once.
+	mf := fs.mu.memFiles[oldname]
+	mf.names++
+	fs.mu.memFiles[newname] = mf
+	return nil
+}
+
+// Open implements vfs.FS.
+func (fs *spillFS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.inMemLocked(name) {
+		return fs.disk.Open(fs.diskPath(name), opts...)
+	}
+	return fs.FS.Open(name, opts...)
+}
+
+// OpenDir implements vfs.FS.
+func (fs *spillFS) OpenDir(name string) (vfs.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.mu.spilled {
+		return fs.disk.OpenDir(fs.diskPath(name))
+	}
+	return fs.FS.OpenDir(name)
+}
+
+// Remove implements vfs.FS.
+func (fs *spillFS) Remove(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.inMemLocked(name) {
+		return fs.disk.Remove(fs.diskPath(name))
+	}
+	if err := fs.FS.Remove(name); err != nil {
+		return err
+	}
+	fs.removeMemFileLocked(name)
+	return nil
+}
+
+// Rename implements vfs.FS.
+func (fs *spillFS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.inMemLocked(oldname) {
+		if err := fs.disk.Rename(fs.diskPath(oldname), fs.diskPath(newname)); err != nil {
+			return err
+		}
+		// The renamed file replaces any in-memory file of the same name.
+		if _, ok := fs.mu.memFiles[newname]; ok {
+			if err := fs.FS.Remove(newname); err != nil {
+				return err
+			}
+			fs.removeMemFileLocked(newname)
+		}
+		return nil
+	}
+	if err := fs.FS.Rename(oldname, newname); err != nil {
+		return err
+	}
+	fs.removeMemFileLocked(newname)
+	mf := fs.mu.memFiles[oldname]
+	delete(fs.mu.memFiles, oldname)
+	fs.mu.memFiles[newname] = mf
+	if fs.mu.spilled {
+		if err := fs.disk.Remove(fs.diskPath(newname)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MkdirAll implements vfs.FS.
+func (fs *spillFS) MkdirAll(dir string, perm os.FileMode) error {
+	if err := fs.FS.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+	return fs.disk.MkdirAll(fs.diskPath(dir), perm)
+}
+
+// List implements vfs.FS.
+func (fs *spillFS) List(dir string) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	names, err := fs.FS.List(dir)
+	if err != nil || !fs.mu.spilled {
+		return names, err
+	}
+	diskNames, err := fs.disk.List(fs.diskPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	// Directories are created in both FSes, so skip names listed twice. The
+	// copies of the files being moved to disk aren't listed until they are
+	// complete.
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for _, name := range diskNames {
+		if !seen[name] && !strings.HasSuffix(name, spillTmpSuffix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Stat implements vfs.FS.
+func (fs *spillFS) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.inMemLocked(name) {
+		return fs.disk.Stat(fs.diskPath(name))
+	}
+	return fs.FS.Stat(name)
+}
+
+func (fs *spillFS) removeMemFileLocked(name string) {
+	mf, ok := fs.mu.memFiles[name]
+	if !ok {
+		return
+	}
+	delete(fs.mu.memFiles, name)
+	mf.names--
+	if mf.names == 0 {
+		fs.mu.memBytes -= mf.size
+	}
+}
+
+// memNamesLocked returns the names linked to the in-memory file mf.
+func (fs *spillFS) memNamesLocked(mf *spillMemFile) []string {
+	var names []string
+	for name, f := range fs.mu.memFiles {
+		if f == mf {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// wroteLocked accounts for n bytes written to the in-memory file mf, and
+// returns true if the FS must spill as a result, in which case the caller
+// calls spill after releasing fs.mu.
+func (fs *spillFS) wroteLocked(mf *spillMemFile, n int) bool {
+	if mf.names == 0 {
+		// The file was removed, replaced or moved to disk while open.
+		return false
+	}
+	mf.size += int64(n)
+	fs.mu.memBytes += int64(n)
+	if fs.mu.spilled || fs.mu.memBytes <= fs.memLimit {
+		return false
+	}
+	fs.mu.spilled = true
+	return true
+}
+
+// spill moves the files in memory to disk, once the FS has been marked as
+// spilled. The files are copied without holding fs.mu, so that the FS remains
+// usable meanwhile: until it has been copied, a file keeps being served from
+// memory.
+func (fs *spillFS) spill() error {
+	fs.mu.Lock()
+	var files []*spillMemFile
+	seen := make(map[*spillMemFile]bool, len(fs.mu.memFiles))
+	for _, mf := range fs.mu.memFiles {
+		if !seen[mf] {
+			seen[mf] = true
+			files = append(files, mf)
+		}
+	}
+	fs.mu.Unlock()
+
+	for _, mf := range files {
+		if err := fs.moveToDisk(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveToDisk copies the in-memory file mf to disk and removes it from memory.
+// Readers that already have the file open keep reading the in-memory copy
+// until they close it. If the file is open for writing, its writes are blocked
+// while it's copied, and go to the copy on disk afterwards.
+func (fs *spillFS) moveToDisk(mf *spillMemFile) error {
+	fs.mu.Lock()
+	w := mf.writer
+	fs.mu.Unlock()
+	if w != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.mu.closed {
+			w = nil
+		}
+	}
+
+	fs.mu.Lock()
+	names := fs.memNamesLocked(mf)
+	if len(names) == 0 {
+		// The file was removed in the meantime.
+		fs.mu.Unlock()
+		return nil
+	}
+	src, err := fs.FS.Open(names[0])
+	fs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := fs.diskPath(names[0]) + spillTmpSuffix
+	dst, err := fs.disk.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// The file may have been renamed, linked or removed while it was copied.
+	names = fs.memNamesLocked(mf)
+	if len(names) == 0 {
+		_ = dst.Close()
+		return fs.disk.Remove(tmpPath)
+	}
+	if err := fs.disk.Rename(tmpPath, fs.diskPath(names[0])); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	for _, name := range names[1:] {
+		if err := fs.disk.Link(fs.diskPath(names[0]), fs.diskPath(name)); err != nil {
+			_ = dst.Close()
+			return err
+		}
+	}
+	for _, name := range names {
+		if err := fs.FS.Remove(name); err != nil {
+			_ = dst.Close()
+			return err
+		}
+		fs.removeMemFileLocked(name)
+	}
+	if w == nil {
+		return dst.Close()
+	}
+	// The copy is positioned at the end of the data, where the next write goes.
+	memFile := w.mu.file
+	w.mu.file = dst
+	w.mu.mem = nil
+	mf.writer = nil
+	return memFile.Close()
+}
+
+// spillFile wraps a file of a spillFS that is open for writing. It is created
+// in memory, and written on disk once it's been moved there.
+type spillFile struct {
+	fs *spillFS
+
+	// mu is acquired before fs.mu when both are held.
+	mu struct {
+		syncutil.Mutex
+		file vfs.File
+		// mem is the in-memory data of the file. It's nil once the file has been
+		// moved to disk.
+		mem    *spillMemFile
+		closed bool
+	}
+}
+
+var _ vfs.File = &spillFile{}
+
+// Read implements io.Reader.
+func (f *spillFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mu.file.Read(p)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *spillFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mu.file.ReadAt(p, off)
+}
+
+// Write implements io.Writer.
+func (f *spillFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	n, err := f.mu.file.Write(p)
+	mem := f.mu.mem
+	f.mu.Unlock()
+	if mem == nil {
+		return n, err
+	}
+
+	f.fs.mu.Lock()
+	spill := f.fs.wroteLocked(mem, n)
+	f.fs.mu.Unlock()
+	if spill {
+		if spillErr := f.fs.spill(); err == nil {
+			err = spillErr
+		}
+	}
+	return n, err
+}
+
+// Stat implements vfs.File.
+func (f *spillFile) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mu.file.Stat()
+}
+
+// Sync implements vfs.File.
+func (f *spillFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mu.file.Sync()
+}
+
+// Close implements io.Closer.
+func (f *spillFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.closed = true
+	err := f.mu.file.Close()
+	if f.mu.mem != nil {
+		f.fs.mu.Lock()
+		f.mu.mem.writer = nil
+		f.fs.mu.Unlock()
+	}
+	return err
+}
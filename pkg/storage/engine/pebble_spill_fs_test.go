@@ -0,0 +1,193 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+func TestSpillablePebble(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	eng, err := NewSpillablePebble(256<<10 /* 256 KB */, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	fs := eng.fs.(*spillFS)
+
+	value := bytes.Repeat([]byte("x"), 1<<10)
+	key := func(i int) MVCCKey {
+		return mvccKey(fmt.Sprintf("key-%05d", i))
+	}
+	write := func(from, to int) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			if err := eng.Put(key(i), value); err != nil {
+				t.Fatal(err)
+			}
+			if i%50 == 49 {
+				if err := eng.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	verify := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if val, err := eng.Get(key(i)); err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(val, value) {
+				t.Fatalf("%s: unexpected value %q", key(i), val)
+			}
+		}
+	}
+
+	// Stay below the limit.
+	write(0, 100)
+	if fs.Spilled() {
+		t.Fatal("unexpectedly spilled")
+	}
+	if names, err := ioutil.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(names) != 0 {
+		t.Fatalf("expected no files on disk, found %d", len(names))
+	}
+	verify(100)
+
+	// An iterator opened before the spill keeps working across it.
+	iter := eng.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+	defer iter.Close()
+
+	write(100, 1000)
+	if !fs.Spilled() {
+		t.Fatal("expected engine to spill")
+	}
+	if names, err := ioutil.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(names) == 0 {
+		t.Fatal("expected files on disk")
+	}
+	verify(1000)
+
+	var count int
+	for iter.Seek(NilKey); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			break
+		}
+		count++
+	}
+	if count != 100 {
+		t.Fatalf("expected 100 keys from the pre-spill iterator, found %d", count)
+	}
+
+	// Writes and compactions after the spill go to disk.
+	write(1000, 1100)
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	verify(1100)
+}
+
+func TestSpillFS(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+	fs := newSpillFS(100, dir)
+
+	write := func(f vfs.File, n int) {
+		t.Helper()
+		if _, err := f.Write(bytes.Repeat([]byte("x"), n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectMemBytes := func(expected int64) {
+		t.Helper()
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.mu.memBytes != expected {
+			t.Fatalf("expected %d bytes in memory, found %d", expected, fs.mu.memBytes)
+		}
+	}
+
+	// A file linked under a second name is only accounted for once.
+	f, err := fs.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(f, 40)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Link("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	expectMemBytes(40)
+
+	// A file still open for writing, as the WAL is, when the limit is exceeded
+	// is moved to disk along with the others, and written there afterwards.
+	wal, err := fs.Create("wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(wal, 40)
+	if fs.Spilled() {
+		t.Fatal("unexpectedly spilled")
+	}
+	write(wal, 40)
+	if !fs.Spilled() {
+		t.Fatal("expected the FS to spill")
+	}
+	expectMemBytes(0)
+	write(wal, 10)
+	expectMemBytes(0)
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, size := range map[string]int64{"a": 40, "b": 40, "wal": 90} {
+		if stat, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		} else if stat.Size() != size {
+			t.Fatalf("%s: expected %d bytes on disk, found %d", name, size, stat.Size())
+		}
+	}
+	// No temporary copies are left behind.
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if expected := []string{"a", "b", "wal"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected files %q on disk, found %q", expected, names)
+	}
+}
@@ -12,18 +12,31 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 func TestPebbleTimeBoundPropCollector(t *testing.T) {
@@ -99,3 +112,1074 @@ func TestPebbleTimeBoundPropCollector(t *testing.T) {
 		}
 	})
 }
+
+func TestPebbleWALDir(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	dataDir := filepath.Join(dir, "data")
+	walDir := filepath.Join(dir, "wal")
+	eng, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: dataDir, WALDir: walDir},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+
+	hasLog := func(dir string) bool {
+		names, err := vfs.Default.List(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if strings.HasSuffix(name, ".log") {
+				return true
+			}
+		}
+		return false
+	}
+	if !hasLog(walDir) {
+		t.Fatalf("expected WAL in %s", walDir)
+	}
+	if hasLog(dataDir) {
+		t.Fatalf("expected no WAL in %s", dataDir)
+	}
+
+	// A WAL directory that cannot be created is reported at open time.
+	badWALDir := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(badWALDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: filepath.Join(dir, "data2"), WALDir: badWALDir},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if !testutils.IsError(err, "could not create WAL directory") {
+		t.Fatalf("expected WAL directory error, got %v", err)
+	}
+}
+
+func TestPebbleReadOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	dataDir := filepath.Join(dir, "data")
+	eng, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: dataDir},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+
+	// The caller's options are left unchanged.
+	opts := testPebbleOptions(vfs.Default)
+	eng, err = NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: dataDir},
+		Opts:          opts,
+		ReadOnly:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { eng.Close() }()
+	if opts.ReadOnly {
+		t.Fatal("expected the options of the caller to be left unchanged")
+	}
+
+	// Reads, iterators and metrics work as usual.
+	if val, err := eng.Get(mvccKey("a")); err != nil {
+		t.Fatal(err)
+	} else if string(val) != "a" {
+		t.Fatalf("expected value a, got %q", val)
+	}
+	iter := eng.NewIterator(IterOptions{UpperBound: roachpb.KeyMax})
+	iter.Seek(mvccKey("a"))
+	if ok, err := iter.Valid(); !ok || err != nil {
+		t.Fatalf("expected valid iterator, got %t, %v", ok, err)
+	}
+	iter.Close()
+	if _, err := eng.GetMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes fail.
+	if err := eng.Put(mvccKey("b"), []byte("b")); err != errPebbleReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if err := eng.Clear(mvccKey("a")); err != errPebbleReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	batch := eng.NewBatch()
+	defer batch.Close()
+	if err := batch.Put(mvccKey("b"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Commit(true /* sync */); err != errPebbleReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if val, err := eng.Get(mvccKey("b")); err != nil || val != nil {
+		t.Fatalf("expected no value for b, got %q, %v", val, err)
+	}
+
+	// Options which are read-only make the engine read-only too.
+	eng.Close()
+	opts = testPebbleOptions(vfs.Default)
+	opts.ReadOnly = true
+	eng, err = NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: dataDir},
+		Opts:          opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("b"), []byte("b")); err != errPebbleReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+}
+
+func TestPebbleSharedCache(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	cache := pebble.NewCache(testCacheSize)
+	open := func() *Pebble {
+		opts := testPebbleOptions(vfs.NewMem())
+		prev := opts.Cache
+		eng, err := NewPebble(PebbleConfig{
+			Opts:  opts,
+			Cache: cache,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Cache != prev {
+			t.Fatal("expected the options of the caller to be left unchanged")
+		}
+		return eng
+	}
+	eng1, eng2 := open(), open()
+	defer eng2.Close()
+
+	for _, eng := range []*Pebble{eng1, eng2} {
+		if err := eng.Put(mvccKey("a"), []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reading from the first store populates the cache of the second one.
+	if _, err := eng1.Get(mvccKey("a")); err != nil {
+		t.Fatal(err)
+	}
+	stats1, err := eng1.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats2, err := eng2.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats1.BlockCacheUsage == 0 || stats1.BlockCacheUsage != stats2.BlockCacheUsage {
+		t.Fatalf("expected equal non-zero cache usage, got %d and %d",
+			stats1.BlockCacheUsage, stats2.BlockCacheUsage)
+	}
+
+	// Closing the first store leaves the cache usable by the second one.
+	eng1.Close()
+	if val, err := eng2.Get(mvccKey("a")); err != nil {
+		t.Fatal(err)
+	} else if string(val) != "a" {
+		t.Fatalf("expected a, got %q", val)
+	}
+}
+
+func TestPebbleMemTableConfig(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	open := func(cfg PebbleConfig) (*pebble.Options, error) {
+		cfg.Opts = testPebbleOptions(vfs.NewMem())
+		prev := *cfg.Opts
+		eng, err := NewPebble(cfg)
+		if err != nil {
+			return nil, err
+		}
+		eng.Close()
+		if cfg.Opts.MemTableSize != prev.MemTableSize ||
+			cfg.Opts.MemTableStopWritesThreshold != prev.MemTableStopWritesThreshold {
+			t.Fatal("expected the options of the caller to be left unchanged")
+		}
+		// The options Pebble was opened with.
+		return newPebbleOptions(cfg)
+	}
+
+	// The memtable options are applied.
+	opts, err := open(PebbleConfig{
+		MemTableSize:                1 << 20,
+		MemTableStopWritesThreshold: 8,
+		MaxMemTableMemory:           8 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.MemTableSize != 1<<20 || opts.MemTableStopWritesThreshold != 8 {
+		t.Fatalf("unexpected memtable size %d and stop writes threshold %d",
+			opts.MemTableSize, opts.MemTableStopWritesThreshold)
+	}
+
+	// The cap applies to the configured options, and to the defaults.
+	for _, cfg := range []PebbleConfig{
+		{MemTableSize: 1 << 20, MemTableStopWritesThreshold: 9, MaxMemTableMemory: 8 << 20},
+		{MaxMemTableMemory: 1 << 20},
+	} {
+		if _, err := open(cfg); !testutils.IsError(err, "more than the maximum of") {
+			t.Fatalf("%+v: unexpected error %v", cfg, err)
+		}
+	}
+	if _, err := open(PebbleConfig{MemTableStopWritesThreshold: -1}); !testutils.IsError(err, "invalid memtable stop writes threshold") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestPebbleComparerMismatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	fs := vfs.NewMem()
+	const dir = "db"
+	open := func(comparer *pebble.Comparer, readOnly bool) (*Pebble, error) {
+		opts := testPebbleOptions(fs)
+		opts.Comparer = comparer
+		return NewPebble(PebbleConfig{
+			StorageConfig: base.StorageConfig{Dir: dir},
+			Opts:          opts,
+			ReadOnly:      readOnly,
+		})
+	}
+	// The same comparator under another name, as if it had been renamed or
+	// replaced across versions.
+	renamed := *MVCCComparer
+	renamed.Name = "cockroach_comparator_v2"
+
+	eng, err := open(MVCCComparer, false /* readOnly */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+
+	// The store can't be opened with a different comparator, even read-only.
+	for _, readOnly := range []bool{false, true} {
+		if _, err := open(&renamed, readOnly); !testutils.IsError(err,
+			`could not open store at db with comparator "cockroach_comparator_v2": .*cockroach_comparator`,
+		) {
+			t.Fatalf("readOnly=%t: unexpected error %v", readOnly, err)
+		}
+	}
+
+	// It can be reopened with the same comparator.
+	eng, err = open(MVCCComparer, false /* readOnly */)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eng.Close()
+}
+
+func TestPebbleCheckpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	eng, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: filepath.Join(dir, "data")},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	// One write is flushed to an sstable, the other one only lives in the WAL
+	// and memtable.
+	if err := eng.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("b"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes proceed while the checkpoint is created.
+	checkpointDir := filepath.Join(dir, "checkpoint")
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- eng.CreateCheckpoint(checkpointDir)
+	}()
+	for i := 0; i < 100; i++ {
+		if err := eng.Put(mvccKey(fmt.Sprintf("c%03d", i)), []byte("c")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Put(mvccKey("d"), []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: checkpointDir},
+		Opts:          testPebbleOptions(vfs.Default),
+		ReadOnly:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	for _, key := range []string{"a", "b"} {
+		if val, err := checkpoint.Get(mvccKey(key)); err != nil {
+			t.Fatal(err)
+		} else if string(val) != key {
+			t.Fatalf("expected %s in checkpoint, got %q", key, val)
+		}
+	}
+	if val, err := checkpoint.Get(mvccKey("d")); err != nil {
+		t.Fatal(err)
+	} else if val != nil {
+		t.Fatalf("unexpected write after checkpoint: %q", val)
+	}
+}
+
+func TestPebbleApproximateDiskBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	eng, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: dir},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	rnd, _ := randutil.NewPseudoRand()
+	const mb = 1 << 20
+	approxBytes := func(from, to string) int64 {
+		t.Helper()
+		n, err := eng.ApproximateDiskBytes(roachpb.Key(from), roachpb.Key(to))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int64(n)
+	}
+	expectBetween := func(act, min, max int64) {
+		t.Helper()
+		if act < min || act > max {
+			t.Fatalf("estimated %s; expected between %s and %s", humanizeutil.IBytes(act),
+				humanizeutil.IBytes(min), humanizeutil.IBytes(max))
+		}
+	}
+
+	// One table per key.
+	for i := 0; i < 10; i++ {
+		key := mvccKey(fmt.Sprintf("b%d", i))
+		if err := eng.Put(key, randutil.RandBytes(rnd, mb)); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectBetween(approxBytes("b", "c"), 9*mb, 11*mb)
+	expectBetween(approxBytes("b3", "b6"), 2*mb, 4*mb)
+	expectBetween(approxBytes("b5", "b5\x00"), mb/2, 2*mb)
+	expectBetween(approxBytes("c", "d"), 0, 0)
+
+	// A single table straddling the span boundary is interpolated.
+	for i := 0; i < 10; i++ {
+		key := mvccKey(fmt.Sprintf("a%d", i))
+		if err := eng.Put(key, randutil.RandBytes(rnd, mb/10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectBetween(approxBytes("a", "b"), 9*mb/10, 11*mb/10)
+	expectBetween(approxBytes("a5", "b"), 3*mb/10, 6*mb/10)
+	expectBetween(approxBytes("a0", "a5"), 4*mb/10, 7*mb/10)
+}
+
+func TestPebbleWriteStallCallbacks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var prevEnds int
+	var begins, ends []WriteStallEvent
+	onBegin := func(ev WriteStallEvent) { begins = append(begins, ev) }
+	onEnd := func(ev WriteStallEvent) { ends = append(ends, ev) }
+	var el pebble.EventListener
+	el.WriteStallEnd = func() { prevEnds++ }
+	tracker := &pebbleWriteStallTracker{onBegin: onBegin, onEnd: onEnd}
+	tracker.install(&el)
+
+	// Pebble invokes the handlers installed in the options it was opened with.
+	for _, tc := range []struct {
+		reason string
+		exp    WriteStallReason
+	}{
+		{"memtable count limit reached", WriteStallMemTableCount},
+		{"L0 file count limit exceeded", WriteStallL0FileCount},
+		{"something else", WriteStallUnknown},
+	} {
+		el.WriteStallBegin(pebble.WriteStallBeginInfo{Reason: tc.reason})
+		time.Sleep(time.Millisecond)
+		el.WriteStallEnd()
+		if ev := begins[len(begins)-1]; ev.Reason != tc.exp || ev.Duration != 0 {
+			t.Errorf("%s: unexpected begin event %+v", tc.reason, ev)
+		}
+		if ev := ends[len(ends)-1]; ev.Reason != tc.exp || ev.Duration < time.Millisecond {
+			t.Errorf("%s: unexpected end event %+v", tc.reason, ev)
+		}
+	}
+	if len(begins) != 3 || len(ends) != 3 || prevEnds != 3 {
+		t.Fatalf("unexpected number of events: %d begins, %d ends, %d chained ends",
+			len(begins), len(ends), prevEnds)
+	}
+
+	// NewPebble installs the tracker in its own copy of the options, so that
+	// reopening engines with the same options doesn't stack trackers.
+	opts := testPebbleOptions(vfs.NewMem())
+	opts.EventListener.WriteStallEnd = func() { prevEnds++ }
+	for i := 0; i < 2; i++ {
+		eng, err := NewPebble(PebbleConfig{Opts: opts, OnWriteStallBegin: onBegin, OnWriteStallEnd: onEnd})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eng.Close()
+	}
+	if opts.EventListener.WriteStallBegin != nil {
+		t.Fatal("expected the options of the caller to be left unchanged")
+	}
+	opts.EventListener.WriteStallEnd()
+	if len(ends) != 3 || prevEnds != 4 {
+		t.Fatalf("unexpected number of events: %d ends, %d chained ends", len(ends), prevEnds)
+	}
+}
+
+func TestPebbleEventListeners(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	eng, err := NewPebble(PebbleConfig{Opts: testPebbleOptions(vfs.NewMem())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	// Two listeners are notified of every event.
+	var mu syncutil.Mutex
+	var flushes [2][]FlushInfo
+	var compactions [2][]CompactionInfo
+	for i := range flushes {
+		i := i
+		if err := eng.RegisterEventListener(EngineEventListener{
+			OnFlushEnd: func(info FlushInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				flushes[i] = append(flushes[i], info)
+			},
+			OnCompactionEnd: func(info CompactionInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				compactions[i] = append(compactions[i], info)
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := eng.Put(mvccKey(fmt.Sprintf("key%d", i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range flushes {
+		if len(flushes[i]) < 2 {
+			t.Fatalf("%d: expected at least 2 flushes, found %+v", i, flushes[i])
+		}
+		for _, info := range flushes[i] {
+			if info.Err != nil || info.Tables != 1 || info.Bytes <= 0 || info.Duration < 0 {
+				t.Fatalf("%d: unexpected flush %+v", i, info)
+			}
+		}
+		if len(compactions[i]) == 0 {
+			t.Fatalf("%d: expected compactions", i)
+		}
+		for _, info := range compactions[i] {
+			if info.Err != nil || info.OutputLevel < info.InputLevel || info.InputBytes <= 0 {
+				t.Fatalf("%d: unexpected compaction %+v", i, info)
+			}
+		}
+	}
+	if !reflect.DeepEqual(flushes[0], flushes[1]) || !reflect.DeepEqual(compactions[0], compactions[1]) {
+		t.Fatalf("expected both listeners to be notified of the same events, found %+v and %+v",
+			flushes, compactions)
+	}
+}
+
+func TestPebbleUnflushedBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	eng := newPebbleInMem(roachpb.Attributes{}, testCacheSize)
+	defer eng.Close()
+
+	// Writes proceed concurrently with the calls below.
+	done := make(chan struct{})
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := eng.Put(mvccKey(fmt.Sprintf("concurrent-%d", i)), []byte("v")); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+	stopWriter := func() {
+		close(done)
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value := bytes.Repeat([]byte("x"), 1<<10)
+	for i := 0; i < 1000; i++ {
+		if err := eng.Put(mvccKey(fmt.Sprintf("key-%04d", i)), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unflushed := eng.UnflushedBytes()
+	if unflushed < 1000<<10 {
+		t.Fatalf("expected at least %d unflushed bytes, found %d", 1000<<10, unflushed)
+	}
+	seq := eng.FlushedSequence()
+	// Stop the concurrent writes so that they don't refill the log after the
+	// flush.
+	stopWriter()
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if newSeq := eng.FlushedSequence(); newSeq <= seq {
+		t.Fatalf("expected flushed sequence to increase past %d, found %d", seq, newSeq)
+	}
+	if newUnflushed := eng.UnflushedBytes(); newUnflushed >= unflushed {
+		t.Fatalf("expected unflushed bytes to drop below %d, found %d", unflushed, newUnflushed)
+	}
+}
+
+func TestPebbleLSMInfo(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	eng := newPebbleInMem(roachpb.Attributes{}, testCacheSize)
+	defer eng.Close()
+
+	// Nothing has been flushed yet, and asking doesn't flush.
+	for _, k := range []string{"b", "a", "c"} {
+		if err := eng.Put(mvccKey(k), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	levels := eng.LSMInfo()
+	if len(levels) != 7 {
+		t.Fatalf("expected 7 levels, found %d", len(levels))
+	}
+	for _, level := range levels {
+		if level.NumFiles != 0 || level.Size != 0 {
+			t.Fatalf("expected empty LSM, found:\n%s", levels)
+		}
+	}
+	if n := eng.db.Metrics().Flush.Count; n != 0 {
+		t.Fatalf("expected no flushes, found %d", n)
+	}
+
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var files int64
+	for _, level := range eng.LSMInfo() {
+		if level.NumFiles == 0 {
+			continue
+		}
+		files += level.NumFiles
+		if level.Size <= 0 {
+			t.Fatalf("expected L%d to have a size, found %+v", level.Level, level)
+		}
+		if !level.Smallest.Equal(mvccKey("a")) || !level.Largest.Equal(mvccKey("c")) {
+			t.Fatalf("expected L%d to span [a, c], found %+v", level.Level, level)
+		}
+	}
+	if files != 1 {
+		t.Fatalf("expected 1 file, found %d", files)
+	}
+}
+
+func TestPebbleNewLevelIterator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	eng := newPebbleInMem(roachpb.Attributes{}, testCacheSize)
+	defer eng.Close()
+
+	expectLevel := func(level int, opts IterOptions, expKeys ...string) {
+		t.Helper()
+		iter, err := eng.NewLevelIterator(level, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer iter.Close()
+		var keys []string
+		for iter.Seek(MVCCKey{Key: roachpb.KeyMin}); ; iter.Next() {
+			if ok, err := iter.Valid(); err != nil {
+				t.Fatal(err)
+			} else if !ok {
+				break
+			}
+			keys = append(keys, string(iter.UnsafeKey().Key))
+		}
+		if !reflect.DeepEqual(keys, expKeys) {
+			t.Fatalf("L%d: expected keys %v, found %v", level, expKeys, keys)
+		}
+	}
+
+	// Two flushes result in overlapping sstables in L0, and the key written
+	// twice is present in both.
+	for _, keys := range [][]string{{"a", "b"}, {"b", "c"}} {
+		for _, k := range keys {
+			if err := eng.Put(mvccKey(k), []byte("v")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := eng.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectLevel(0, IterOptions{}, "a", "b", "b", "c")
+	expectLevel(0, IterOptions{LowerBound: roachpb.Key("b"), UpperBound: roachpb.Key("c")}, "b", "b")
+	expectLevel(6, IterOptions{})
+
+	// A full compaction moves the newest version of each key out of L0, into a
+	// single level.
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	expectLevel(0, IterOptions{})
+	for level, info := range eng.LSMInfo() {
+		if level > 0 && info.NumFiles > 0 {
+			expectLevel(level, IterOptions{}, "a", "b", "c")
+		}
+	}
+
+	if _, err := eng.NewLevelIterator(7, IterOptions{}); !testutils.IsError(err, "out of range") {
+		t.Fatalf("expected out of range error, found %v", err)
+	}
+}
+
+func TestMVCCScanMergeOperands(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	opts := testPebbleOptions(vfs.NewMem())
+	// Keep the flushed operands in separate sstables.
+	opts.L0CompactionThreshold = 100
+	eng, err := NewPebble(PebbleConfig{Opts: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	expectOperands := func(key roachpb.Key, expOperands ...[]byte) {
+		t.Helper()
+		operands, err := MVCCScanMergeOperands(eng, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(operands) != len(expOperands) {
+			t.Fatalf("expected %d operands, found %d", len(expOperands), len(operands))
+		}
+		for i := range expOperands {
+			if !bytes.Equal(operands[i], expOperands[i]) {
+				t.Fatalf("operand %d: expected %x, found %x", i, expOperands[i], operands[i])
+			}
+		}
+	}
+
+	key := roachpb.Key("a")
+	for _, s := range []string{"a", "b", "c"} {
+		if err := eng.Merge(MakeMVCCMetadataKey(key), appender(s)); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectOperands(key, appender("a"), appender("b"), appender("c"))
+
+	// Operands in the memtable aren't visible.
+	if err := eng.Merge(MakeMVCCMetadataKey(key), appender("d")); err != nil {
+		t.Fatal(err)
+	}
+	expectOperands(key, appender("a"), appender("b"), appender("c"))
+
+	// A value which was put is the base of the operands merged into it.
+	base := roachpb.Key("b")
+	if err := eng.Put(MakeMVCCMetadataKey(base), appender("base")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Merge(MakeMVCCMetadataKey(base), appender("e")); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expectOperands(base, appender("base"), appender("e"))
+
+	// Compactions merge the operands.
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []roachpb.Key{key, base} {
+		if operands, err := MVCCScanMergeOperands(eng, k); err != nil {
+			t.Fatal(err)
+		} else if len(operands) != 1 {
+			t.Fatalf("%s: expected 1 operand after compaction, found %d", k, len(operands))
+		}
+	}
+
+	// Only Pebble engines are supported.
+	batch := eng.NewBatch()
+	defer batch.Close()
+	if _, err := MVCCScanMergeOperands(batch, key); !testutils.IsError(err, "cannot read merge operands") {
+		t.Fatalf("expected an error, got %v", err)
+	}
+}
+
+// walSyncTrackingFS records the number of bytes written to and synced in the
+// WAL files it creates.
+type walSyncTrackingFS struct {
+	vfs.FS
+	mu struct {
+		syncutil.Mutex
+		written, synced int64
+		syncs           int
+	}
+}
+
+type walSyncTrackingFile struct {
+	vfs.File
+	fs *walSyncTrackingFS
+}
+
+func (fs *walSyncTrackingFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil || !strings.HasSuffix(name, ".log") {
+		return f, err
+	}
+	return walSyncTrackingFile{File: f, fs: fs}, nil
+}
+
+func (f walSyncTrackingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.fs.mu.Lock()
+	f.fs.mu.written += int64(n)
+	f.fs.mu.Unlock()
+	return n, err
+}
+
+func (f walSyncTrackingFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	f.fs.mu.synced = f.fs.mu.written
+	f.fs.mu.syncs++
+	return nil
+}
+
+func (fs *walSyncTrackingFS) stats() (written, synced int64, syncs int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.mu.written, fs.mu.synced, fs.mu.syncs
+}
+
+func TestPebbleCommitSync(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	fs := &walSyncTrackingFS{FS: vfs.NewMem()}
+	eng, err := NewPebble(PebbleConfig{Opts: testPebbleOptions(fs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	commit := func(key string, syncCommit bool) {
+		t.Helper()
+		batch := eng.NewBatch()
+		defer batch.Close()
+		if err := batch.Put(mvccKey(key), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Commit(syncCommit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, prevSyncs := fs.stats()
+	for _, k := range []string{"a", "b", "c"} {
+		commit(k, false /* sync */)
+	}
+	if _, _, syncs := fs.stats(); syncs != prevSyncs {
+		t.Fatalf("expected no WAL syncs for unsynced commits, found %d", syncs-prevSyncs)
+	}
+
+	// A sync commit syncs the writes of the earlier commits along with its own.
+	commit("d", true /* sync */)
+	written, synced, syncs := fs.stats()
+	if syncs == prevSyncs {
+		t.Fatal("expected the WAL to be synced")
+	}
+	if written == 0 || synced != written {
+		t.Fatalf("expected all %d bytes written to the WAL to be synced, found %d", written, synced)
+	}
+}
+
+func TestPebbleWALMinSyncInterval(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const interval = 20 * time.Millisecond
+	eng, err := NewPebble(PebbleConfig{
+		Opts:               testPebbleOptions(vfs.NewMem()),
+		WALMinSyncInterval: interval,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	metrics, err := eng.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevSyncs := metrics.WALSyncs
+
+	// Consecutive synced commits are spaced by the interval.
+	const commits = 3
+	start := timeutil.Now()
+	for i := 0; i < commits; i++ {
+		batch := eng.NewBatch()
+		if err := batch.Put(mvccKey(fmt.Sprint(i)), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Commit(true /* sync */); err != nil {
+			t.Fatal(err)
+		}
+		batch.Close()
+	}
+	if elapsed := timeutil.Since(start); elapsed < (commits-1)*interval {
+		t.Fatalf("expected %d synced commits to take at least %s, took %s", commits, (commits-1)*interval, elapsed)
+	}
+
+	// The syncs are reported by the metrics.
+	metrics, err = eng.GetMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syncs := metrics.WALSyncs - prevSyncs; syncs < commits {
+		t.Fatalf("expected at least %d WAL syncs, found %d", commits, syncs)
+	}
+	if metrics.WALSyncDuration < 0 {
+		t.Fatalf("unexpected WAL sync duration %s", metrics.WALSyncDuration)
+	}
+}
+
+func TestPebbleIngestSSTAtTimestamp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ctx := context.Background()
+	dir, cleanup := testutils.TempDir(t)
+	defer cleanup()
+
+	eng, err := NewPebble(PebbleConfig{
+		StorageConfig: base.StorageConfig{Dir: filepath.Join(dir, "data")},
+		Opts:          testPebbleOptions(vfs.Default),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	writeSST := func(name string, kvs []MVCCKeyValue) string {
+		sst, err := MakeRocksDBSstFileWriter()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sst.Close()
+		for _, kv := range kvs {
+			if err := sst.Put(kv.Key, kv.Value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := sst.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	placeholder := hlc.Timestamp{WallTime: 1}
+	value1 := roachpb.MakeValueFromString("value1")
+	value2 := roachpb.MakeValueFromString("value2")
+	path := writeSST("ok.sst", []MVCCKeyValue{
+		{Key: MVCCKey{Key: roachpb.Key("a"), Timestamp: placeholder.Next()}, Value: value2.RawBytes},
+		{Key: MVCCKey{Key: roachpb.Key("a"), Timestamp: placeholder}, Value: value1.RawBytes},
+		{Key: MVCCKey{Key: roachpb.Key("b"), Timestamp: placeholder}, Value: value1.RawBytes},
+	})
+
+	// Commit every key separately, to cover the batches filling up.
+	defer func(prev int) { ingestSSTAtTimestampBatchSize = prev }(ingestSSTAtTimestampBatchSize)
+	ingestSSTAtTimestampBatchSize = 1
+
+	ts := hlc.Timestamp{WallTime: 10}
+	if err := eng.IngestSSTAtTimestamp([]string{path}, ts); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key roachpb.Key
+		exp []byte
+	}{
+		{roachpb.Key("a"), value2.RawBytes},
+		{roachpb.Key("b"), value1.RawBytes},
+	} {
+		val, _, err := MVCCGet(ctx, eng, tc.key, ts, MVCCGetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val == nil || !bytes.Equal(val.RawBytes, tc.exp) {
+			t.Fatalf("%s: expected %x, got %v", tc.key, tc.exp, val)
+		}
+		if val.Timestamp != ts {
+			t.Fatalf("%s: expected timestamp %s, got %s", tc.key, ts, val.Timestamp)
+		}
+		val, _, err = MVCCGet(ctx, eng, tc.key, ts.Prev(), MVCCGetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != nil {
+			t.Fatalf("%s: expected no value below %s, got %v", tc.key, ts, val)
+		}
+	}
+
+	// An sstable containing an intent is rejected and nothing is written, not
+	// even the keys preceding the intent, in it or in other sstables.
+	meta, err := protoutil.Marshal(&enginepb.MVCCMetadata{Txn: &enginepb.TxnMeta{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	okPath := writeSST("ok2.sst", []MVCCKeyValue{
+		{Key: MVCCKey{Key: roachpb.Key("c"), Timestamp: placeholder}, Value: value1.RawBytes},
+	})
+	badPath := writeSST("intent.sst", []MVCCKeyValue{
+		{Key: MVCCKey{Key: roachpb.Key("d"), Timestamp: placeholder}, Value: value1.RawBytes},
+		{Key: MVCCKey{Key: roachpb.Key("e")}, Value: meta},
+	})
+	if err := eng.IngestSSTAtTimestamp([]string{okPath, badPath}, ts); !testutils.IsError(err, "non-versioned key") {
+		t.Fatalf("expected non-versioned key error, got %v", err)
+	}
+	for _, key := range []roachpb.Key{roachpb.Key("c"), roachpb.Key("d")} {
+		val, _, err := MVCCGet(ctx, eng, key, ts, MVCCGetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != nil {
+			t.Fatalf("%s: expected no value after failed ingestion, got %v", key, val)
+		}
+	}
+}
+
+func TestPebbleEngineIteratorMalformedKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	p := newPebbleInMem(roachpb.Attributes{}, testCacheSize)
+	defer p.Close()
+
+	// Keys that aren't valid MVCC key encodings can't be written through the
+	// Engine interface.
+	malformed := [][]byte{{0xff}, []byte("b\x05")}
+	for _, key := range malformed {
+		if _, err := DecodeMVCCKey(key); err == nil {
+			t.Fatalf("expected %x to be malformed", key)
+		}
+		if err := p.db.Set(key, []byte("malformed"), pebble.Sync); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Put(mvccKey("a"), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	iter := NewEngineIterator(p, IterOptions{UpperBound: roachpb.Key("\xff\xff")})
+	defer iter.Close()
+	var keys [][]byte
+	for iter.SeekGE(nil); ; iter.Next() {
+		if ok, err := iter.Valid(); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			break
+		}
+		keys = append(keys, append([]byte(nil), iter.UnsafeRawKey()...))
+	}
+	if exp := [][]byte{EncodeKey(mvccKey("a")), malformed[1], malformed[0]}; !reflect.DeepEqual(keys, exp) {
+		t.Fatalf("expected keys %x, found %x", exp, keys)
+	}
+
+	iter.SeekGE(malformed[1])
+	if ok, _ := iter.Valid(); !ok || !bytes.Equal(iter.UnsafeRawKey(), malformed[1]) {
+		t.Fatalf("expected to seek to %x", malformed[1])
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// pebbleWALFS wraps the FS of a Pebble engine to measure the latency of the
+// syncs of its WAL files, and to space them by a minimum interval if one is
+// configured (see PebbleConfig.WALMinSyncInterval). Pebble's WAL writer syncs
+// all of the commits waiting on it at once, so delaying a sync lets more
+// commits share it.
+type pebbleWALFS struct {
+	vfs.FS
+	minSyncInterval time.Duration
+
+	// syncs and syncNanos are the number and total duration of the WAL syncs,
+	// and are accessed atomically.
+	syncs     int64
+	syncNanos int64
+
+	mu struct {
+		syncutil.Mutex
+		lastSync time.Time
+	}
+}
+
+var _ vfs.FS = &pebbleWALFS{}
+
+func newPebbleWALFS(fs vfs.FS, minSyncInterval time.Duration) *pebbleWALFS {
+	return &pebbleWALFS{FS: fs, minSyncInterval: minSyncInterval}
+}
+
+// Create implements vfs.FS.
+func (fs *pebbleWALFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	if err != nil || filepath.Ext(name) != ".log" {
+		return f, err
+	}
+	return &pebbleWALFile{File: f, fs: fs}, nil
+}
+
+// syncStats returns the number and total duration of the WAL syncs so far.
+func (fs *pebbleWALFS) syncStats() (syncs int64, duration time.Duration) {
+	return atomic.LoadInt64(&fs.syncs), time.Duration(atomic.LoadInt64(&fs.syncNanos))
+}
+
+// pebbleWALFile is a WAL file created by a pebbleWALFS.
+type pebbleWALFile struct {
+	vfs.File
+	fs *pebbleWALFS
+}
+
+// Sync implements vfs.File.
+func (f *pebbleWALFile) Sync() error {
+	if interval := f.fs.minSyncInterval; interval > 0 {
+		f.fs.mu.Lock()
+		wait := interval - timeutil.Since(f.fs.mu.lastSync)
+		f.fs.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	start := timeutil.Now()
+	err := f.File.Sync()
+	atomic.AddInt64(&f.fs.syncs, 1)
+	atomic.AddInt64(&f.fs.syncNanos, int64(timeutil.Since(start)))
+	f.fs.mu.Lock()
+	f.fs.mu.lastSync = start
+	f.fs.mu.Unlock()
+	return err
+}
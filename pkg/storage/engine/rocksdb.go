@@ -13,6 +13,7 @@ package engine
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,6 +40,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/logtags"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/pkg/errors"
 )
 
@@ -502,6 +504,8 @@ type RocksDB struct {
 		syncutil.Mutex
 		m map[*rocksDBIterator][]byte
 	}
+
+	suggestedCompactions compactionSuggester
 }
 
 var _ Engine = &RocksDB{}
@@ -731,6 +735,7 @@ func (r *RocksDB) Close() {
 		log.Errorf(context.TODO(), "closing unopened rocksdb instance")
 		return
 	}
+	r.suggestedCompactions.close()
 	if len(r.cfg.Dir) == 0 {
 		if log.V(1) {
 			log.Infof(context.TODO(), "closing in-memory rocksdb instance")
@@ -887,6 +892,17 @@ func (r *RocksDB) CompactRange(start, end roachpb.Key, forceBottommost bool) err
 	return statusToError(C.DBCompactRange(r.rdb, goToCSlice(start), goToCSlice(end), C.bool(forceBottommost)))
 }
 
+// SuggestCompaction implements the Engine interface.
+func (r *RocksDB) SuggestCompaction(start, end roachpb.Key, reason string) {
+	r.suggestedCompactions.suggest(r, start, end, reason)
+}
+
+// RegisterEventListener implements the Engine interface. RocksDB's flush and
+// compaction events aren't forwarded from C++, so it isn't supported.
+func (r *RocksDB) RegisterEventListener(EngineEventListener) error {
+	return errors.New("event listeners are not supported by RocksDB engines")
+}
+
 // disableAutoCompaction disables automatic compactions. For testing use only.
 func (r *RocksDB) disableAutoCompaction() error {
 	return statusToError(C.DBDisableAutoCompaction(r.rdb))
@@ -1169,9 +1185,39 @@ func (r *RocksDB) GetStats() (*Stats, error) {
 		TableReadersMemEstimate:        int64(s.table_readers_mem_estimate),
 		PendingCompactionBytesEstimate: int64(s.pending_compaction_bytes_estimate),
 		L0FileCount:                    int64(s.l0_file_count),
+		PendingSuggestedCompactions:    r.suggestedCompactions.numPending(),
 	}, nil
 }
 
+// GetMetrics implements the Engine interface. RocksDB does not expose the
+// number of memtables or the size of the WAL, so those are left zero.
+func (r *RocksDB) GetMetrics() (*Metrics, error) {
+	stats, err := r.GetStats()
+	if err != nil {
+		return nil, err
+	}
+	metrics := &Metrics{
+		BlockCacheHits:      stats.BlockCacheHits,
+		BlockCacheMisses:    stats.BlockCacheMisses,
+		BlockCacheSize:      stats.BlockCacheUsage,
+		FilterHits:          stats.BloomFilterPrefixUseful,
+		FilterMisses:        stats.BloomFilterPrefixChecked - stats.BloomFilterPrefixUseful,
+		MemTableSize:        stats.MemtableTotalSize,
+		FlushCount:          stats.Flushes,
+		CompactionCount:     stats.Compactions,
+		CompactionDebtBytes: stats.PendingCompactionBytesEstimate,
+	}
+	for _, t := range r.GetSSTables() {
+		for len(metrics.LevelFiles) <= t.Level {
+			metrics.LevelFiles = append(metrics.LevelFiles, 0)
+			metrics.LevelBytes = append(metrics.LevelBytes, 0)
+		}
+		metrics.LevelFiles[t.Level]++
+		metrics.LevelBytes[t.Level] += t.Size
+	}
+	return metrics, nil
+}
+
 // GetTickersAndHistograms retrieves maps of all RocksDB tickers and histograms.
 // It differs from `GetStats` by getting _every_ ticker and histogram, and by not
 // getting anything else (DB properties, for example).
@@ -1470,6 +1516,11 @@ func (r *batchIterator) SeekReverse(key MVCCKey) {
 	r.iter.SeekReverse(key)
 }
 
+func (r *batchIterator) SeekLT(key MVCCKey) {
+	r.batch.flushMutations()
+	r.iter.SeekLT(key)
+}
+
 func (r *batchIterator) Valid() (bool, error) {
 	return r.iter.Valid()
 }
@@ -2008,6 +2059,10 @@ func (r *rocksDBBatch) commitInternal(sync bool) error {
 	return nil
 }
 
+func (r *rocksDBBatch) WriteOnly() bool {
+	return r.writeOnly
+}
+
 func (r *rocksDBBatch) Empty() bool {
 	return r.flushes == 0 && r.builder.Count() == 0 && !r.builder.logData
 }
@@ -2016,6 +2071,20 @@ func (r *rocksDBBatch) Len() int {
 	return len(r.unsafeRepr())
 }
 
+func (r *rocksDBBatch) Count() int {
+	if r.flushes == 0 {
+		return int(r.builder.Count())
+	}
+	// The header of the representation counts the mutations flushed to C++ as
+	// well as the buffered ones. Once the batch has been flushed, the
+	// representation always has a header.
+	repr := r.unsafeRepr()
+	if len(repr) < headerSize {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(repr[countPos:headerSize]))
+}
+
 func (r *rocksDBBatch) unsafeRepr() []byte {
 	if r.flushes == 0 {
 		// We've never flushed to C++. Return the mutations only.
@@ -2163,6 +2232,11 @@ func (r *rocksDBIterator) Stats() IteratorStats {
 	return IteratorStats{
 		TimeBoundNumSSTs:           int(stats.timebound_num_ssts),
 		InternalDeleteSkippedCount: int(stats.internal_delete_skipped_count),
+		SeekCount:                  int(stats.seek_count),
+		StepCount:                  int(stats.step_count),
+		InternalKeySkippedCount:    int(stats.internal_key_skipped_count),
+		BlockReadBytes:             int64(stats.block_read_bytes),
+		VersionsSkipped:            int(stats.versions_skipped),
 	}
 }
 
@@ -2210,6 +2284,23 @@ func (r *rocksDBIterator) SeekReverse(key MVCCKey) {
 	}
 }
 
+func (r *rocksDBIterator) SeekLT(key MVCCKey) {
+	r.checkEngineOpen()
+	r.Seek(MakeMVCCMetadataKey(key.Key))
+	if ok, _ := r.Valid(); ok {
+		r.Prev()
+	} else if r.err == nil {
+		// Maybe the key sorts after the last key in RocksDB.
+		r.setState(C.DBIterSeekToLast(r.iter))
+	}
+	if ok, _ := r.Valid(); !ok {
+		return
+	}
+	// The iterator is positioned at the oldest version of the preceding key,
+	// since versions sort by descending timestamp. Seek to its newest one.
+	r.setState(C.DBIterSeek(r.iter, goToCKey(MakeMVCCMetadataKey(r.Key().Key))))
+}
+
 func (r *rocksDBIterator) Valid() (bool, error) {
 	return r.valid, r.err
 }
@@ -2390,14 +2481,21 @@ func (r *rocksDBIterator) MVCCScan(
 		resumeSpan = &roachpb.Span{Key: start, EndKey: end}
 		return nil, 0, resumeSpan, nil, nil
 	}
+	if opts.IntentsOnly {
+		resumeSpan, intents, err = mvccScanIntents(r, start, end, max, opts)
+		return nil, 0, resumeSpan, intents, err
+	}
 
 	r.clearState()
 	state := C.MVCCScan(
 		r.iter, goToCSlice(start), goToCSlice(end),
-		goToCTimestamp(timestamp), C.int64_t(max),
+		goToCTimestamp(timestamp), goToCTimestamp(opts.MinTimestamp),
+		C.int64_t(max), C.int64_t(opts.TargetBytes),
 		goToCTxn(opts.Txn), C.bool(opts.Inconsistent),
 		C.bool(opts.Reverse), C.bool(opts.Tombstones),
 		C.bool(opts.IgnoreSequence),
+		goToCSlice(encodeColumnFamilySuffixes(opts.ColumnFamilyIDs)),
+		C.bool(opts.KeysOnly), C.int(opts.MaxVersionsPerKey),
 	)
 
 	if err := statusToError(state.status); err != nil {
@@ -2636,6 +2734,7 @@ func goToCIterOptions(opts IterOptions) C.DBIterOptions {
 		min_timestamp_hint: goToCTimestamp(opts.MinTimestampHint),
 		max_timestamp_hint: goToCTimestamp(opts.MaxTimestampHint),
 		with_stats:         C.bool(opts.WithStats),
+		readahead_size:     C.int64_t(opts.ReadAheadSize),
 	}
 }
 
@@ -3168,6 +3267,17 @@ func (r *RocksDB) LinkFile(oldname, newname string) error {
 	return nil
 }
 
+// Env implements the Engine interface. RocksDB isn't opened with a vfs.FS, so
+// the returned FS serves files through RocksDB's env. See rocksDBFS.
+func (r *RocksDB) Env() vfs.FS {
+	if r.InMem() {
+		// The operations the env doesn't serve must not reach the real
+		// filesystem.
+		return &rocksDBFS{FS: vfs.NewMem(), r: r}
+	}
+	return &rocksDBFS{FS: vfs.Default, r: r}
+}
+
 // IsValidSplitKey returns whether the key is a valid split key. Certain key
 // ranges cannot be split (the meta1 span and the system DB span); split keys
 // chosen within any of these ranges are considered invalid. And a split key
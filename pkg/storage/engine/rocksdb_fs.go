@@ -0,0 +1,172 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/pkg/errors"
+)
+
+// rocksDBFS implements vfs.FS on top of the env of a RocksDB instance, so that
+// the files it creates end up in the same place as those of the engine: in
+// memory for in-memory engines, and encrypted for engines with an encrypted
+// env.
+//
+// The env only supports a few file operations: Create, Open, Remove and Link
+// go through it, with files opened for reading being read into memory. The
+// directory operations are served by the embedded FS for on-disk engines, and
+// fail for in-memory engines, which have no directories of their own. Lock
+// and the path manipulation helpers are always served by the embedded FS.
+type rocksDBFS struct {
+	// The FS serving operations which the env doesn't support, as well as the
+	// path manipulation helpers. It is an in-memory FS for in-memory engines.
+	vfs.FS
+	r *RocksDB
+}
+
+var _ vfs.FS = &rocksDBFS{}
+
+var errRocksDBFSUnsupported = errors.New("operation not supported by in-memory RocksDB env")
+
+// Create implements vfs.FS.
+func (fs *rocksDBFS) Create(name string) (vfs.File, error) {
+	f, err := fs.r.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rocksDBFSWritableFile{DBFile: f, name: name}, nil
+}
+
+// Link implements vfs.FS.
+func (fs *rocksDBFS) Link(oldname, newname string) error {
+	return fs.r.LinkFile(oldname, newname)
+}
+
+// Open implements vfs.FS.
+func (fs *rocksDBFS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	data, err := fs.r.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rocksDBFSReadableFile{Reader: bytes.NewReader(data), name: name, size: int64(len(data))}, nil
+}
+
+// OpenDir implements vfs.FS.
+func (fs *rocksDBFS) OpenDir(name string) (vfs.File, error) {
+	if fs.r.InMem() {
+		return nil, errRocksDBFSUnsupported
+	}
+	return fs.FS.OpenDir(name)
+}
+
+// Remove implements vfs.FS.
+func (fs *rocksDBFS) Remove(name string) error {
+	return fs.r.DeleteFile(name)
+}
+
+// Rename implements vfs.FS.
+func (fs *rocksDBFS) Rename(oldname, newname string) error {
+	if fs.r.InMem() {
+		return errRocksDBFSUnsupported
+	}
+	return fs.FS.Rename(oldname, newname)
+}
+
+// MkdirAll implements vfs.FS. The in-memory env creates files without their
+// parent directories existing, so it is a no-op for in-memory engines.
+func (fs *rocksDBFS) MkdirAll(dir string, perm os.FileMode) error {
+	if fs.r.InMem() {
+		return nil
+	}
+	return fs.FS.MkdirAll(dir, perm)
+}
+
+// List implements vfs.FS.
+func (fs *rocksDBFS) List(dir string) ([]string, error) {
+	if fs.r.InMem() {
+		return nil, errRocksDBFSUnsupported
+	}
+	return fs.FS.List(dir)
+}
+
+// Stat implements vfs.FS.
+func (fs *rocksDBFS) Stat(name string) (os.FileInfo, error) {
+	if fs.r.InMem() {
+		f, err := fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return f.Stat()
+	}
+	return fs.FS.Stat(name)
+}
+
+// rocksDBFSWritableFile is a vfs.File created by rocksDBFS. It can only be
+// written to.
+type rocksDBFSWritableFile struct {
+	DBFile
+	name string
+}
+
+func (f *rocksDBFSWritableFile) Read(p []byte) (int, error) {
+	return 0, errors.Errorf("%s is open for writing", f.name)
+}
+
+func (f *rocksDBFSWritableFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.Errorf("%s is open for writing", f.name)
+}
+
+func (f *rocksDBFSWritableFile) Stat() (os.FileInfo, error) {
+	return nil, errors.Errorf("%s is open for writing", f.name)
+}
+
+// rocksDBFSReadableFile is a vfs.File opened by rocksDBFS. It holds the
+// contents of the file in memory, and can only be read from.
+type rocksDBFSReadableFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+func (f *rocksDBFSReadableFile) Write(p []byte) (int, error) {
+	return 0, errors.Errorf("%s is open for reading", f.name)
+}
+
+func (f *rocksDBFSReadableFile) Close() error {
+	return nil
+}
+
+func (f *rocksDBFSReadableFile) Sync() error {
+	return nil
+}
+
+func (f *rocksDBFSReadableFile) Stat() (os.FileInfo, error) {
+	return rocksDBFSFileInfo{name: filepath.Base(f.name), size: f.size}, nil
+}
+
+// rocksDBFSFileInfo implements os.FileInfo for rocksDBFSReadableFile.
+type rocksDBFSFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi rocksDBFSFileInfo) Name() string       { return fi.name }
+func (fi rocksDBFSFileInfo) Size() int64        { return fi.size }
+func (fi rocksDBFSFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi rocksDBFSFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi rocksDBFSFileInfo) IsDir() bool        { return false }
+func (fi rocksDBFSFileInfo) Sys() interface{}   { return nil }
@@ -147,6 +147,11 @@ func (r *sstIterator) UnsafeValue() []byte {
 // MVCCKeyCompare compares cockroach keys, including the MVCC timestamps.
 // This assumes these are the keys cockroach usually works with i.e. "user" keys
 // from the point of view of rocksdb.
+//
+// The encoded timestamps are compared as big-endian wall times followed, if
+// non-zero, by big-endian logical ticks, so versions with the same wall time
+// are ordered by their logical ticks, consistently with MVCCKey.Less. The
+// iteration order of the versions of a key is therefore deterministic.
 func MVCCKeyCompare(a, b []byte) int {
 	keyA, tsA, okA := enginepb.SplitMVCCKey(a)
 	keyB, tsB, okB := enginepb.SplitMVCCKey(b)
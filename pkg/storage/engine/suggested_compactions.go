@@ -0,0 +1,112 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// compactionSuggester implements Engine.SuggestCompaction. Suggested spans
+// are queued and compacted one at a time by a background goroutine, which
+// exits when the queue is empty. Overlapping or adjacent suggestions are
+// coalesced while they are queued, so that repeated suggestions for the same
+// span result in a single compaction.
+//
+// The zero value is ready to use.
+type compactionSuggester struct {
+	wg sync.WaitGroup
+	mu struct {
+		syncutil.Mutex
+		// pending holds the queued spans, sorted and non-overlapping.
+		pending []roachpb.Span
+		// running is true while a compaction goroutine is running.
+		running bool
+		// compacting is true while a suggested compaction is in progress.
+		compacting bool
+		closed     bool
+	}
+}
+
+// suggest queues the compaction of [start, end) on e, starting a compaction
+// goroutine if none is running.
+func (s *compactionSuggester) suggest(e Engine, start, end roachpb.Key, reason string) {
+	ctx := context.TODO()
+	log.VEventf(ctx, 2, "suggested compaction of [%s,%s): %s", start, end, reason)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mu.closed {
+		return
+	}
+	if start == nil {
+		start = roachpb.KeyMin
+	}
+	if end == nil {
+		end = roachpb.KeyMax
+	}
+	s.mu.pending, _ = roachpb.MergeSpans(
+		append(s.mu.pending, roachpb.Span{Key: start, EndKey: end}))
+	if s.mu.running {
+		return
+	}
+	s.mu.running = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx, e)
+	}()
+}
+
+func (s *compactionSuggester) run(ctx context.Context, e Engine) {
+	for {
+		s.mu.Lock()
+		s.mu.compacting = false
+		if len(s.mu.pending) == 0 || s.mu.closed {
+			s.mu.running = false
+			s.mu.Unlock()
+			return
+		}
+		span := s.mu.pending[0]
+		s.mu.pending = s.mu.pending[1:]
+		s.mu.compacting = true
+		s.mu.Unlock()
+
+		if err := e.CompactRange(span.Key, span.EndKey, false /* forceBottommost */); err != nil {
+			log.Warningf(ctx, "suggested compaction of %s failed: %v", span, err)
+		}
+	}
+}
+
+// numPending returns the number of suggested compactions that are queued or
+// in progress.
+func (s *compactionSuggester) numPending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := int64(len(s.mu.pending))
+	if s.mu.compacting {
+		n++
+	}
+	return n
+}
+
+// close drops the queued compactions and waits for the one in progress, if
+// any, to finish. Suggestions made afterwards are ignored.
+func (s *compactionSuggester) close() {
+	s.mu.Lock()
+	s.mu.closed = true
+	s.mu.pending = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/pkg/errors"
+)
+
+// blockingCompactEngine records the spans passed to CompactRange, blocking
+// each call until unblocked.
+type blockingCompactEngine struct {
+	Engine
+	compacted chan roachpb.Span
+	unblock   chan struct{}
+}
+
+func (e *blockingCompactEngine) CompactRange(start, end roachpb.Key, _ bool) error {
+	e.compacted <- roachpb.Span{Key: start, EndKey: end}
+	<-e.unblock
+	return nil
+}
+
+func TestCompactionSuggester(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	e := &blockingCompactEngine{
+		compacted: make(chan roachpb.Span, 10),
+		unblock:   make(chan struct{}),
+	}
+	var s compactionSuggester
+	defer s.close()
+
+	span := func(start, end string) roachpb.Span {
+		return roachpb.Span{Key: roachpb.Key(start), EndKey: roachpb.Key(end)}
+	}
+	expectPending := func(exp int64) {
+		t.Helper()
+		testutils.SucceedsSoon(t, func() error {
+			if n := s.numPending(); n != exp {
+				return errors.Errorf("expected %d pending compactions, found %d", exp, n)
+			}
+			return nil
+		})
+	}
+
+	// The first suggestion is compacted right away.
+	s.suggest(e, roachpb.Key("a"), roachpb.Key("c"), "test")
+	if sp := <-e.compacted; !sp.Equal(span("a", "c")) {
+		t.Fatalf("unexpected compaction of %s", sp)
+	}
+	expectPending(1)
+
+	// Overlapping and adjacent suggestions queued in the meantime are coalesced.
+	s.suggest(e, roachpb.Key("b"), roachpb.Key("d"), "test")
+	s.suggest(e, roachpb.Key("d"), roachpb.Key("e"), "test")
+	s.suggest(e, roachpb.Key("x"), roachpb.Key("y"), "test")
+	s.suggest(e, roachpb.Key("b"), roachpb.Key("c"), "test")
+	expectPending(3)
+
+	var compacted []roachpb.Span
+	for i := 0; i < 2; i++ {
+		e.unblock <- struct{}{}
+		compacted = append(compacted, <-e.compacted)
+	}
+	e.unblock <- struct{}{}
+	if exp := []roachpb.Span{span("b", "e"), span("x", "y")}; !reflect.DeepEqual(compacted, exp) {
+		t.Fatalf("expected compactions of %s, got %s", exp, compacted)
+	}
+	expectPending(0)
+
+	// Suggestions are ignored once closed.
+	s.close()
+	s.suggest(e, roachpb.Key("a"), roachpb.Key("b"), "test")
+	expectPending(0)
+}
+
+func TestEngineSuggestCompaction(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	runWithAllEngines(func(e Engine, t *testing.T) {
+		for _, key := range []string{"a", "b", "c"} {
+			if err := e.Put(mvccKey(key), []byte(key)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		e.SuggestCompaction(roachpb.Key("a"), roachpb.Key("c"), "test")
+		e.SuggestCompaction(nil, nil, "test")
+		testutils.SucceedsSoon(t, func() error {
+			stats, err := e.GetStats()
+			if err != nil {
+				return err
+			}
+			if stats.PendingSuggestedCompactions != 0 {
+				return errors.Errorf("%d pending suggested compactions", stats.PendingSuggestedCompactions)
+			}
+			return nil
+		})
+		if val, err := e.Get(mvccKey("b")); err != nil {
+			t.Fatal(err)
+		} else if string(val) != "b" {
+			t.Fatalf("unexpected value %q", val)
+		}
+	}, t)
+}
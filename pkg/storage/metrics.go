@@ -368,6 +368,18 @@ var (
 		Measurement: "Storage",
 		Unit:        metric.Unit_BYTES,
 	}
+	metaRdbPendingSuggestedCompactions = metric.Metadata{
+		Name:        "rocksdb.pending-suggested-compactions",
+		Help:        "Number of suggested compactions queued or in progress",
+		Measurement: "Compactions",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaRdbCorruptions = metric.Metadata{
+		Name:        "rocksdb.corruptions",
+		Help:        "Number of reads that failed due to corrupt data",
+		Measurement: "Reads",
+		Unit:        metric.Unit_COUNT,
+	}
 
 	// Range event metrics.
 	metaRangeSplits = metric.Metadata{
@@ -1040,19 +1052,21 @@ type StoreMetrics struct {
 	FollowerReadsCount *metric.Counter
 
 	// RocksDB metrics.
-	RdbBlockCacheHits           *metric.Gauge
-	RdbBlockCacheMisses         *metric.Gauge
-	RdbBlockCacheUsage          *metric.Gauge
-	RdbBlockCachePinnedUsage    *metric.Gauge
-	RdbBloomFilterPrefixChecked *metric.Gauge
-	RdbBloomFilterPrefixUseful  *metric.Gauge
-	RdbMemtableTotalSize        *metric.Gauge
-	RdbFlushes                  *metric.Gauge
-	RdbCompactions              *metric.Gauge
-	RdbTableReadersMemEstimate  *metric.Gauge
-	RdbReadAmplification        *metric.Gauge
-	RdbNumSSTables              *metric.Gauge
-	RdbPendingCompaction        *metric.Gauge
+	RdbBlockCacheHits              *metric.Gauge
+	RdbBlockCacheMisses            *metric.Gauge
+	RdbBlockCacheUsage             *metric.Gauge
+	RdbBlockCachePinnedUsage       *metric.Gauge
+	RdbBloomFilterPrefixChecked    *metric.Gauge
+	RdbBloomFilterPrefixUseful     *metric.Gauge
+	RdbMemtableTotalSize           *metric.Gauge
+	RdbFlushes                     *metric.Gauge
+	RdbCompactions                 *metric.Gauge
+	RdbTableReadersMemEstimate     *metric.Gauge
+	RdbReadAmplification           *metric.Gauge
+	RdbNumSSTables                 *metric.Gauge
+	RdbPendingCompaction           *metric.Gauge
+	RdbPendingSuggestedCompactions *metric.Gauge
+	RdbCorruptions                 *metric.Gauge
 
 	// TODO(mrtracy): This should be removed as part of #4465. This is only
 	// maintained to keep the current structure of NodeStatus; it would be
@@ -1252,19 +1266,21 @@ func newStoreMetrics(histogramWindow time.Duration) *StoreMetrics {
 		FollowerReadsCount: metric.NewCounter(metaFollowerReadsCount),
 
 		// RocksDB metrics.
-		RdbBlockCacheHits:           metric.NewGauge(metaRdbBlockCacheHits),
-		RdbBlockCacheMisses:         metric.NewGauge(metaRdbBlockCacheMisses),
-		RdbBlockCacheUsage:          metric.NewGauge(metaRdbBlockCacheUsage),
-		RdbBlockCachePinnedUsage:    metric.NewGauge(metaRdbBlockCachePinnedUsage),
-		RdbBloomFilterPrefixChecked: metric.NewGauge(metaRdbBloomFilterPrefixChecked),
-		RdbBloomFilterPrefixUseful:  metric.NewGauge(metaRdbBloomFilterPrefixUseful),
-		RdbMemtableTotalSize:        metric.NewGauge(metaRdbMemtableTotalSize),
-		RdbFlushes:                  metric.NewGauge(metaRdbFlushes),
-		RdbCompactions:              metric.NewGauge(metaRdbCompactions),
-		RdbTableReadersMemEstimate:  metric.NewGauge(metaRdbTableReadersMemEstimate),
-		RdbReadAmplification:        metric.NewGauge(metaRdbReadAmplification),
-		RdbNumSSTables:              metric.NewGauge(metaRdbNumSSTables),
-		RdbPendingCompaction:        metric.NewGauge(metaRdbPendingCompaction),
+		RdbBlockCacheHits:              metric.NewGauge(metaRdbBlockCacheHits),
+		RdbBlockCacheMisses:            metric.NewGauge(metaRdbBlockCacheMisses),
+		RdbBlockCacheUsage:             metric.NewGauge(metaRdbBlockCacheUsage),
+		RdbBlockCachePinnedUsage:       metric.NewGauge(metaRdbBlockCachePinnedUsage),
+		RdbBloomFilterPrefixChecked:    metric.NewGauge(metaRdbBloomFilterPrefixChecked),
+		RdbBloomFilterPrefixUseful:     metric.NewGauge(metaRdbBloomFilterPrefixUseful),
+		RdbMemtableTotalSize:           metric.NewGauge(metaRdbMemtableTotalSize),
+		RdbFlushes:                     metric.NewGauge(metaRdbFlushes),
+		RdbCompactions:                 metric.NewGauge(metaRdbCompactions),
+		RdbTableReadersMemEstimate:     metric.NewGauge(metaRdbTableReadersMemEstimate),
+		RdbReadAmplification:           metric.NewGauge(metaRdbReadAmplification),
+		RdbNumSSTables:                 metric.NewGauge(metaRdbNumSSTables),
+		RdbPendingCompaction:           metric.NewGauge(metaRdbPendingCompaction),
+		RdbPendingSuggestedCompactions: metric.NewGauge(metaRdbPendingSuggestedCompactions),
+		RdbCorruptions:                 metric.NewGauge(metaRdbCorruptions),
 
 		// Range event metrics.
 		RangeSplits:                     metric.NewCounter(metaRangeSplits),
@@ -1457,6 +1473,8 @@ func (sm *StoreMetrics) updateRocksDBStats(stats engine.Stats) {
 	sm.RdbFlushes.Update(stats.Flushes)
 	sm.RdbCompactions.Update(stats.Compactions)
 	sm.RdbTableReadersMemEstimate.Update(stats.TableReadersMemEstimate)
+	sm.RdbPendingSuggestedCompactions.Update(stats.PendingSuggestedCompactions)
+	sm.RdbCorruptions.Update(stats.Corruptions)
 }
 
 func (sm *StoreMetrics) updateEnvStats(stats engine.EnvStats) {
@@ -96,6 +96,19 @@ func (i *Iterator) SeekReverse(key engine.MVCCKey) {
 	i.i.SeekReverse(key)
 }
 
+// SeekLT is part of the engine.Iterator interface.
+func (i *Iterator) SeekLT(key engine.MVCCKey) {
+	if i.spansOnly {
+		i.err = i.spans.CheckAllowed(SpanReadOnly, roachpb.Span{Key: key.Key})
+	} else {
+		i.err = i.spans.CheckAllowedAt(SpanReadOnly, roachpb.Span{Key: key.Key}, i.ts)
+	}
+	if i.err == nil {
+		i.invalid = false
+	}
+	i.i.SeekLT(key)
+}
+
 // Valid is part of the engine.Iterator interface.
 func (i *Iterator) Valid() (bool, error) {
 	if i.err != nil {
@@ -503,6 +516,10 @@ func (s spanSetBatch) Distinct() engine.ReadWriter {
 	return NewReadWriterAt(s.b.Distinct(), s.spans, s.ts)
 }
 
+func (s spanSetBatch) WriteOnly() bool {
+	return s.b.WriteOnly()
+}
+
 func (s spanSetBatch) Empty() bool {
 	return s.b.Empty()
 }
@@ -511,6 +528,10 @@ func (s spanSetBatch) Len() int {
 	return s.b.Len()
 }
 
+func (s spanSetBatch) Count() int {
+	return s.b.Count()
+}
+
 func (s spanSetBatch) Repr() []byte {
 	return s.b.Repr()
 }
@@ -0,0 +1,192 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+// Package mvccdata generates reproducible MVCC keyspaces for tests, along with
+// an oracle that answers get and scan queries over the generated data without
+// involving a storage engine. Tests write the data to an engine and compare
+// the engine's results to the oracle's.
+//
+// The package deliberately doesn't depend on the engine package, so that it
+// can be used by the engine's own tests.
+package mvccdata
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/randutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+// Options configures the data generated by New.
+type Options struct {
+	// NumKeys is the number of keys.
+	NumKeys int
+	// MaxVersions is the maximum number of committed versions per key. Each key
+	// has between 1 and MaxVersions versions.
+	MaxVersions int
+	// ValueBytes is the size of the values.
+	ValueBytes int
+	// TombstoneRatio is the probability of each committed version being a
+	// deletion tombstone.
+	TombstoneRatio float64
+	// IntentRatio is the probability of a key having an intent above its
+	// committed versions.
+	IntentRatio float64
+}
+
+// Version is a committed version of a key. Tombstones have an empty value.
+type Version struct {
+	Timestamp hlc.Timestamp
+	Value     roachpb.Value
+}
+
+// Key holds the versions of a key.
+type Key struct {
+	Key roachpb.Key
+	// Versions holds the committed versions of the key by descending
+	// timestamp.
+	Versions []Version
+	// Intent, if set, is the provisional value of the data's transaction,
+	// whose timestamp is above all committed versions.
+	Intent *Version
+}
+
+// Data is a generated keyspace. It should be treated as immutable.
+type Data struct {
+	// Keys holds the keys in ascending order.
+	Keys []Key
+	// Txn is the transaction that wrote all intents, at varying timestamps.
+	Txn enginepb.TxnMeta
+	// MaxTimestamp is above the timestamps of all versions and intents.
+	MaxTimestamp hlc.Timestamp
+}
+
+// versionInterval is the wall time between successive versions of a key.
+const versionInterval = 10
+
+// New generates a keyspace from seed. The same seed and options always
+// produce the same data.
+//
+// The versions of the i-th key are at wall times 10, 20, ..., and its intent,
+// if any, is 10 above its newest committed version.
+func New(seed int64, opts Options) *Data {
+	rng := rand.New(rand.NewSource(seed))
+	d := &Data{
+		Keys: make([]Key, opts.NumKeys),
+		Txn: enginepb.TxnMeta{
+			Key:   roachpb.Key("txn"),
+			ID:    *uuid.NewPopulatedUUID(rng),
+			Epoch: 1,
+		},
+	}
+	makeValue := func(key roachpb.Key) roachpb.Value {
+		v := roachpb.MakeValueFromBytes(randutil.RandBytes(rng, opts.ValueBytes))
+		v.InitChecksum(key)
+		return v
+	}
+	for i := range d.Keys {
+		k := &d.Keys[i]
+		k.Key = roachpb.Key(fmt.Sprintf("key-%06d", i))
+		numVersions := 1
+		if opts.MaxVersions > 1 {
+			numVersions += rng.Intn(opts.MaxVersions)
+		}
+		k.Versions = make([]Version, numVersions)
+		for j := range k.Versions {
+			v := &k.Versions[numVersions-j-1]
+			v.Timestamp = hlc.Timestamp{WallTime: int64(j+1) * versionInterval}
+			if rng.Float64() >= opts.TombstoneRatio {
+				v.Value = makeValue(k.Key)
+			}
+		}
+		ts := hlc.Timestamp{WallTime: int64(numVersions+1) * versionInterval}
+		if rng.Float64() < opts.IntentRatio {
+			k.Intent = &Version{Timestamp: ts, Value: makeValue(k.Key)}
+		}
+		if d.MaxTimestamp.Less(ts) {
+			d.MaxTimestamp = ts
+		}
+	}
+	return d
+}
+
+// IntentTxn returns the metadata of the transaction that wrote the intent of
+// k, which must have one.
+func (d *Data) IntentTxn(k *Key) enginepb.TxnMeta {
+	txn := d.Txn
+	txn.Timestamp = k.Intent.Timestamp
+	txn.MinTimestamp = k.Intent.Timestamp
+	return txn
+}
+
+// visible returns the newest committed version of k at or below ts, or nil.
+func (k *Key) visible(ts hlc.Timestamp) *Version {
+	for i := range k.Versions {
+		if !ts.Less(k.Versions[i].Timestamp) {
+			return &k.Versions[i]
+		}
+	}
+	return nil
+}
+
+// Get returns the value of key as of ts, as the engine would for a read by a
+// transaction other than Txn: the newest committed version at or below ts,
+// and the intent if it is at or below ts. Consistent reads fail with a
+// WriteIntentError in that case, while inconsistent reads return both. A
+// tombstone is returned as an empty value if tombstones is set, and as a nil
+// value otherwise.
+func (d *Data) Get(
+	key roachpb.Key, ts hlc.Timestamp, tombstones bool,
+) (*roachpb.Value, *roachpb.Intent) {
+	i := sort.Search(len(d.Keys), func(i int) bool { return d.Keys[i].Key.Compare(key) >= 0 })
+	if i == len(d.Keys) || !d.Keys[i].Key.Equal(key) {
+		return nil, nil
+	}
+	k := &d.Keys[i]
+	var intent *roachpb.Intent
+	if k.Intent != nil && !ts.Less(k.Intent.Timestamp) {
+		intent = &roachpb.Intent{
+			Span: roachpb.Span{Key: k.Key}, Txn: d.IntentTxn(k), Status: roachpb.PENDING,
+		}
+	}
+	v := k.visible(ts)
+	if v == nil || (!v.Value.IsPresent() && !tombstones) {
+		return nil, intent
+	}
+	value := v.Value
+	value.Timestamp = v.Timestamp
+	return &value, intent
+}
+
+// Scan returns the key-value pairs in [start, end) as of ts in ascending key
+// order, along with the intents at or below ts, with the same semantics as
+// Get. Scans are unbounded; the oracle doesn't model result limits.
+func (d *Data) Scan(
+	start, end roachpb.Key, ts hlc.Timestamp, tombstones bool,
+) ([]roachpb.KeyValue, []roachpb.Intent) {
+	var kvs []roachpb.KeyValue
+	var intents []roachpb.Intent
+	i := sort.Search(len(d.Keys), func(i int) bool { return d.Keys[i].Key.Compare(start) >= 0 })
+	for ; i < len(d.Keys) && d.Keys[i].Key.Compare(end) < 0; i++ {
+		value, intent := d.Get(d.Keys[i].Key, ts, tombstones)
+		if intent != nil {
+			intents = append(intents, *intent)
+		}
+		if value != nil {
+			kvs = append(kvs, roachpb.KeyValue{Key: d.Keys[i].Key, Value: *value})
+		}
+	}
+	return kvs, intents
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package mvccdata
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestNew(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	opts := Options{
+		NumKeys:        100,
+		MaxVersions:    4,
+		ValueBytes:     8,
+		TombstoneRatio: 0.25,
+		IntentRatio:    0.25,
+	}
+	d := New(1, opts)
+	if !reflect.DeepEqual(d, New(1, opts)) {
+		t.Fatal("expected the same data for the same seed")
+	}
+	if reflect.DeepEqual(d, New(2, opts)) {
+		t.Fatal("expected different data for different seeds")
+	}
+
+	var intents int
+	for i, k := range d.Keys {
+		if i > 0 && !d.Keys[i-1].Key.Less(k.Key) {
+			t.Fatalf("keys out of order: %s, %s", d.Keys[i-1].Key, k.Key)
+		}
+		if n := len(k.Versions); n < 1 || n > opts.MaxVersions {
+			t.Fatalf("%s: unexpected number of versions %d", k.Key, n)
+		}
+		for j := 1; j < len(k.Versions); j++ {
+			if !k.Versions[j].Timestamp.Less(k.Versions[j-1].Timestamp) {
+				t.Fatalf("%s: versions out of order", k.Key)
+			}
+		}
+		if k.Intent != nil {
+			intents++
+			if !k.Versions[0].Timestamp.Less(k.Intent.Timestamp) {
+				t.Fatalf("%s: intent below committed versions", k.Key)
+			}
+		}
+	}
+	if intents == 0 || intents == len(d.Keys) {
+		t.Fatalf("unexpected number of intents %d", intents)
+	}
+}
+
+func TestOracle(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	d := &Data{
+		Keys: []Key{
+			{
+				Key: roachpb.Key("a"),
+				Versions: []Version{
+					{Timestamp: hlc.Timestamp{WallTime: 20}},
+					{Timestamp: hlc.Timestamp{WallTime: 10}, Value: roachpb.MakeValueFromString("a1")},
+				},
+			},
+			{
+				Key:      roachpb.Key("b"),
+				Versions: []Version{{Timestamp: hlc.Timestamp{WallTime: 10}, Value: roachpb.MakeValueFromString("b1")}},
+				Intent:   &Version{Timestamp: hlc.Timestamp{WallTime: 20}, Value: roachpb.MakeValueFromString("b2")},
+			},
+		},
+	}
+	ts := func(wallTime int64) hlc.Timestamp { return hlc.Timestamp{WallTime: wallTime} }
+
+	// The tombstone on "a" hides its first version, unless tombstones are
+	// requested.
+	if v, _ := d.Get(roachpb.Key("a"), ts(25), false /* tombstones */); v != nil {
+		t.Fatalf("expected no value, got %v", v)
+	}
+	if v, _ := d.Get(roachpb.Key("a"), ts(25), true /* tombstones */); v == nil || v.IsPresent() {
+		t.Fatalf("expected tombstone, got %v", v)
+	}
+	if v, _ := d.Get(roachpb.Key("a"), ts(15), false /* tombstones */); v == nil || v.Timestamp != ts(10) {
+		t.Fatalf("expected first version, got %v", v)
+	}
+
+	// The intent on "b" is only returned at or above its timestamp.
+	kvs, intents := d.Scan(roachpb.Key("a"), roachpb.Key("c"), ts(15), false /* tombstones */)
+	if len(kvs) != 2 || len(intents) != 0 {
+		t.Fatalf("unexpected scan result %v, %v", kvs, intents)
+	}
+	kvs, intents = d.Scan(roachpb.Key("a"), roachpb.Key("c"), ts(20), false /* tombstones */)
+	if len(kvs) != 1 || !kvs[0].Key.Equal(roachpb.Key("b")) || len(intents) != 1 ||
+		intents[0].Txn.Timestamp != ts(20) {
+		t.Fatalf("unexpected scan result %v, %v", kvs, intents)
+	}
+}
@@ -1806,6 +1806,14 @@ var charts = []sectionDescription{
 				Title:   "Pending Compaction",
 				Metrics: []string{"rocksdb.estimated-pending-compaction"},
 			},
+			{
+				Title:   "Pending Suggested Compactions",
+				Metrics: []string{"rocksdb.pending-suggested-compactions"},
+			},
+			{
+				Title:   "Corruptions",
+				Metrics: []string{"rocksdb.corruptions"},
+			},
 		},
 	},
 	{